@@ -22,7 +22,11 @@ type CsvCommand struct {
 var _ cmds.GlazeCommand = (*CsvCommand)(nil)
 
 func NewCsvCommand() (*CsvCommand, error) {
-	glazedSection, err := settings.NewStructuredOutputSection()
+	glazedSection, err := settings.NewStructuredOutputSection(settings.WithFileOutputFormats())
+	if err != nil {
+		return nil, err
+	}
+	processingSection, err := settings.NewGlazedProcessingSection()
 	if err != nil {
 		return nil, err
 	}
@@ -72,6 +76,7 @@ func NewCsvCommand() (*CsvCommand, error) {
 			),
 			cmds.WithSections(
 				glazedSection,
+				processingSection,
 			),
 		),
 	}, nil
@@ -0,0 +1,111 @@
+package cmds
+
+import (
+	"context"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/middlewares/row"
+	"github.com/go-go-golems/glazed/pkg/middlewares/table"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+)
+
+type DiffCommand struct {
+	*cmds.CommandDescription
+}
+
+var _ cmds.GlazeCommand = (*DiffCommand)(nil)
+
+type DiffSettings struct {
+	From string   `glazed:"from"`
+	To   string   `glazed:"to"`
+	Key  []string `glazed:"key"`
+}
+
+func NewDiffCommand() (*DiffCommand, error) {
+	glazedSection, err := settings.NewStructuredOutputSection(settings.WithFileOutputFormats())
+	if err != nil {
+		return nil, err
+	}
+	processingSection, err := settings.NewGlazedProcessingSection()
+	if err != nil {
+		return nil, err
+	}
+
+	return &DiffCommand{
+		CommandDescription: cmds.NewCommandDescription(
+			"diff",
+			cmds.WithShort("Compare two datasets"),
+			cmds.WithLong(`Compare two CSV, TSV, JSON or YAML files, matching rows by their key columns.
+
+Outputs one row per added, removed or changed row, with the old and new values
+of the columns that differ. The format of each file is picked by its extension.`),
+			cmds.WithArguments(
+				fields.New(
+					"from",
+					fields.TypeString,
+					fields.WithHelp("Old dataset"),
+					fields.WithRequired(true),
+				),
+				fields.New(
+					"to",
+					fields.TypeString,
+					fields.WithHelp("New dataset"),
+					fields.WithRequired(true),
+				),
+			),
+			cmds.WithFlags(
+				fields.New(
+					"key",
+					fields.TypeStringList,
+					fields.WithHelp("Columns identifying a row in both datasets"),
+					fields.WithRequired(true),
+				),
+			),
+			cmds.WithSections(
+				glazedSection,
+				processingSection,
+			),
+		),
+	}, nil
+}
+
+func (d *DiffCommand) RunIntoGlazeProcessor(ctx context.Context, vals *values.Values, gp middlewares.Processor) error {
+	s := &DiffSettings{}
+	err := vals.DecodeSectionInto(schema.DefaultSlug, s)
+	if err != nil {
+		return errors.Wrap(err, "failed to initialize diff settings from fields")
+	}
+
+	from, err := row.LoadDataset(s.From)
+	if err != nil {
+		return err
+	}
+	to, err := row.LoadDataset(s.To)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]types.FieldName, len(s.Key))
+	copy(keys, s.Key)
+	diff, err := table.NewDiffMiddleware(from, keys)
+	if err != nil {
+		return err
+	}
+	ret, err := diff.Process(ctx, to)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range ret.Rows {
+		if err := gp.AddRow(ctx, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -35,10 +35,14 @@ type JsonSettings struct {
 }
 
 func NewJsonCommand() (*JsonCommand, error) {
-	glazedSection, err := settings.NewStructuredOutputSection()
+	glazedSection, err := settings.NewStructuredOutputSection(settings.WithFileOutputFormats())
 	if err != nil {
 		return nil, errors.Wrap(err, "could not create Glazed section")
 	}
+	processingSection, err := settings.NewGlazedProcessingSection()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create glazed processing section")
+	}
 	return &JsonCommand{
 		CommandDescription: cmds.NewCommandDescription(
 			"json",
@@ -78,6 +82,7 @@ func NewJsonCommand() (*JsonCommand, error) {
 			),
 			cmds.WithSections(
 				glazedSection,
+				processingSection,
 			),
 		),
 	}, nil
@@ -27,10 +27,14 @@ type YamlCommand struct {
 var _ cmds.GlazeCommand = (*YamlCommand)(nil)
 
 func NewYamlCommand() (*YamlCommand, error) {
-	glazedSection, err := settings.NewStructuredOutputSection()
+	glazedSection, err := settings.NewStructuredOutputSection(settings.WithFileOutputFormats())
 	if err != nil {
 		return nil, errors.Wrap(err, "could not create Glazed section")
 	}
+	processingSection, err := settings.NewGlazedProcessingSection()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create glazed processing section")
+	}
 
 	return &YamlCommand{
 		CommandDescription: cmds.NewCommandDescription(
@@ -65,6 +69,7 @@ func NewYamlCommand() (*YamlCommand, error) {
 			),
 			cmds.WithSections(
 				glazedSection,
+				processingSection,
 			),
 		),
 	}, nil
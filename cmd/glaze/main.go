@@ -92,6 +92,14 @@ func main() {
 	cobra.CheckErr(err)
 	rootCmd.AddCommand(command)
 
+	diffCmd, err := cmds.NewDiffCommand()
+	cobra.CheckErr(err)
+	command, err = cli.BuildCobraCommand(diffCmd,
+		cli.WithParserConfig(cli.CobraParserConfig{AppName: "glaze"}),
+	)
+	cobra.CheckErr(err)
+	rootCmd.AddCommand(command)
+
 	htmlCommand, err := html.NewHTMLCommand()
 	cobra.CheckErr(err)
 	rootCmd.AddCommand(htmlCommand)
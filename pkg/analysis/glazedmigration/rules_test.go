@@ -165,6 +165,7 @@ func TestR4KeyRename(t *testing.T) {
 		{"json supported", "json", true, false},
 		{"table supported", "table", true, false},
 		{"yaml supported", "yaml", true, false},
+		{"markdown supported", "markdown", true, false},
 		{"sql unsupported", "sql", true, true},
 		{"excel unsupported", "excel", true, true},
 	}
@@ -536,7 +537,7 @@ func contains(slice []string, s string) bool {
 // the expected format set, guarding against drift in the R4 allowlist.
 func TestStructuredOutputFormatsExported(t *testing.T) {
 	got := settings.StructuredOutputFormats()
-	want := []string{"table", "json", "jsonl", "csv", "tsv", "yaml"}
+	want := []string{"table", "json", "jsonl", "csv", "tsv", "yaml", "markdown", "html", "xlsx", "sqlite", "parquet"}
 	if !reflect.DeepEqual(got, want) {
 		t.Fatalf("StructuredOutputFormats() = %v, want %v", got, want)
 	}
@@ -4,6 +4,7 @@ import (
 	"go/ast"
 	"go/token"
 	"strconv"
+	"strings"
 
 	"github.com/go-go-golems/glazed/pkg/settings"
 	"golang.org/x/tools/go/analysis"
@@ -195,7 +196,7 @@ func fixKeyInMapLiteral(pass *analysis.Pass, lit *ast.CompositeLit) {
 			pass.Report(analysis.Diagnostic{
 				Pos:     kv.Value.Pos(),
 				End:     kv.Value.End(),
-				Message: "value " + strconv.Quote(valueStr) + " is not a supported structured-output format; choose table|json|jsonl|csv|tsv|yaml",
+				Message: "value " + strconv.Quote(valueStr) + " is not a supported structured-output format; choose " + strings.Join(settings.StructuredOutputFormats(), "|"),
 			})
 			// Still rename the key so the section constructs; the value must be
 			// fixed by hand.
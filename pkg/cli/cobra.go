@@ -12,6 +12,7 @@ import (
 	"github.com/go-go-golems/glazed/pkg/cmds"
 	"github.com/go-go-golems/glazed/pkg/cmds/alias"
 	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/schema"
 	"github.com/go-go-golems/glazed/pkg/cmds/values"
 	"github.com/go-go-golems/glazed/pkg/helpers/list"
 	strings2 "github.com/go-go-golems/glazed/pkg/helpers/strings"
@@ -160,11 +161,10 @@ func runCobraCommand(
 			if !ok {
 				return errors.New("Glaze mode requested but command does not implement GlazeCommand")
 			}
-			structuredOutputValues, ok := parsedValues.Get(settings.StructuredOutputSlug)
-			if !ok {
+			if _, ok := parsedValues.Get(settings.StructuredOutputSlug); !ok {
 				return errors.New("structured output section not found")
 			}
-			gp, _, err := settings.SetupStructuredOutput(structuredOutputValues, os.Stdout)
+			gp, _, err := settings.SetupStructuredOutputForCommand(s.Description(), parsedValues, os.Stdout)
 			if err != nil {
 				return err
 			}
@@ -227,7 +227,13 @@ func BuildCobraCommandFromCommandAndFunc(
 		originalSchema := description.Schema
 		structuredSchema := originalSchema.Clone()
 		if _, ok := structuredSchema.Get(settings.StructuredOutputSlug); !ok {
-			structuredOutputSection, err := settings.NewStructuredOutputSection()
+			// The file formats need --output-file, which only the glazed
+			// processing section provides.
+			var sectionOptions []schema.SectionOption
+			if _, ok := structuredSchema.Get(settings.GlazedProcessingSlug); ok {
+				sectionOptions = append(sectionOptions, settings.WithFileOutputFormats())
+			}
+			structuredOutputSection, err := settings.NewStructuredOutputSection(sectionOptions...)
 			if err != nil {
 				return nil, err
 			}
@@ -18,7 +18,8 @@ import (
 )
 
 // CreateStructuredOutputProcessorFromCobra creates a processor for Cobra-centric
-// applications that mounted NewStructuredOutputSection on the command.
+// applications that mounted NewStructuredOutputSection on the command. The
+// glazed processing section is not parsed, see settings.SetupStructuredOutput.
 func CreateStructuredOutputProcessorFromCobra(cmd *cobra.Command) (*middlewares.TableProcessor, formatters.OutputFormatter, error) {
 	outputSection, err := settings.NewStructuredOutputSection()
 	if err != nil {
@@ -8,6 +8,7 @@ import (
 	"github.com/go-go-golems/glazed/pkg/cmds/fields"
 	"github.com/go-go-golems/glazed/pkg/cmds/values"
 	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -52,6 +53,31 @@ func TestGlazeCommandMountsOnlyMinimalStructuredOutputFlags(t *testing.T) {
 	}
 }
 
+func TestGlazeCommandOffersFileFormatsOnlyWithProcessingSection(t *testing.T) {
+	cmd, err := BuildCobraCommandFromCommand(newStructuredOutputTestCommand("rows"))
+	require.NoError(t, err)
+	usage := cmd.Flags().Lookup("format").Usage
+	assert.Contains(t, usage, "json")
+	for _, format := range []string{"xlsx", "sqlite", "parquet"} {
+		assert.NotContains(t, usage, format)
+	}
+
+	processingSection, err := settings.NewGlazedProcessingSection()
+	require.NoError(t, err)
+	command := &structuredOutputTestCommand{CommandDescription: cmds.NewCommandDescription(
+		"rows",
+		cmds.WithSource("test"),
+		cmds.WithSections(processingSection),
+	)}
+	cmd, err = BuildCobraCommandFromCommand(command)
+	require.NoError(t, err)
+	usage = cmd.Flags().Lookup("format").Usage
+	for _, format := range []string{"xlsx", "sqlite", "parquet"} {
+		assert.Contains(t, usage, format)
+	}
+	assert.NotNil(t, cmd.Flags().Lookup("output-file"))
+}
+
 func TestGlazeCommandAllowsFormerGenericFlagNames(t *testing.T) {
 	applicationFlags := []string{
 		"output", "output-file", "fields", "filter", "template", "select", "stream", "sort-by",
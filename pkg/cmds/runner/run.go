@@ -64,11 +64,10 @@ func RunCommand(
 	case cmds.GlazeCommand:
 		// If no processor is provided, create one from structured output settings.
 		if opts.GlazeProcessor == nil {
-			structuredOutputValues, ok := parsedValues.Get(settings.StructuredOutputSlug)
-			if !ok {
+			if _, ok := parsedValues.Get(settings.StructuredOutputSlug); !ok {
 				return fmt.Errorf("structured output section not found")
 			}
-			gp, _, err := settings.SetupStructuredOutput(structuredOutputValues, opts.Writer)
+			gp, _, err := settings.SetupStructuredOutputForCommand(cmd.Description(), parsedValues, opts.Writer)
 			if err != nil {
 				return fmt.Errorf("failed to setup structured output: %w", err)
 			}
@@ -0,0 +1,380 @@
+package expr
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/araddon/dateparse"
+	"github.com/go-go-golems/glazed/pkg/helpers/cast"
+	"github.com/go-go-golems/glazed/pkg/helpers/compare"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+	orderedmap "github.com/wk8/go-ordered-map/v2"
+)
+
+// Eval evaluates node against row. The result is nil, a bool, a float64,
+// a string, a time.Time, a []interface{} or any other value found in the row.
+func Eval(node Node, row types.Row) (interface{}, error) {
+	switch n := node.(type) {
+	case *LiteralNode:
+		return n.Value, nil
+
+	case *ListNode:
+		ret := make([]interface{}, 0, len(n.Elements))
+		for _, e := range n.Elements {
+			v, err := Eval(e, row)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, v)
+		}
+		return ret, nil
+
+	case *FieldNode:
+		v, _ := LookupPath(row, n.Path)
+		return normalize(v), nil
+
+	case *UnaryNode:
+		v, err := Eval(n.Operand, row)
+		if err != nil {
+			return nil, err
+		}
+		return !Truthy(v), nil
+
+	case *BinaryNode:
+		return evalBinary(n, row)
+
+	case *MatchNode:
+		v, err := Eval(n.Operand, row)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			return false, nil
+		}
+		s, ok := v.(string)
+		if !ok {
+			s = fmt.Sprintf("%v", v)
+		}
+		return n.Regexp.MatchString(s) != n.Negate, nil
+
+	case *InNode:
+		v, err := Eval(n.Operand, row)
+		if err != nil {
+			return nil, err
+		}
+		l, err := Eval(n.List, row)
+		if err != nil {
+			return nil, err
+		}
+		if l == nil {
+			return false, nil
+		}
+		list, err := cast.CastListToInterfaceList(l)
+		if err != nil {
+			return nil, errors.Errorf("in expects a list, %s is %s", n.List.String(), describe(l))
+		}
+		for _, element := range list {
+			if Equal(v, normalize(element)) {
+				return !n.Negate, nil
+			}
+		}
+		return n.Negate, nil
+
+	case *IsNullNode:
+		v, err := Eval(n.Operand, row)
+		if err != nil {
+			return nil, err
+		}
+		return (v == nil) != n.Negate, nil
+
+	default:
+		return nil, errors.Errorf("unknown node type %T", node)
+	}
+}
+
+func evalBinary(n *BinaryNode, row types.Row) (interface{}, error) {
+	left, err := Eval(n.Left, row)
+	if err != nil {
+		return nil, err
+	}
+
+	// and / or short-circuit
+	switch n.Operator {
+	case TokenAnd:
+		if !Truthy(left) {
+			return false, nil
+		}
+		right, err := Eval(n.Right, row)
+		if err != nil {
+			return nil, err
+		}
+		return Truthy(right), nil
+	case TokenOr:
+		if Truthy(left) {
+			return true, nil
+		}
+		right, err := Eval(n.Right, row)
+		if err != nil {
+			return nil, err
+		}
+		return Truthy(right), nil
+	}
+
+	right, err := Eval(n.Right, row)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.Operator {
+	case TokenEq:
+		return Equal(left, right), nil
+	case TokenNotEq:
+		return !Equal(left, right), nil
+	case TokenLess, TokenLessEq, TokenGreater, TokenGreaterEq:
+		// comparisons with null (or missing fields) are false, as in SQL
+		if left == nil || right == nil {
+			return false, nil
+		}
+		c, ok := Compare(left, right)
+		if !ok {
+			return nil, errors.Errorf("cannot compare %s with %s in %s",
+				describe(left), describe(right), n.String())
+		}
+		switch n.Operator {
+		case TokenLess:
+			return c < 0, nil
+		case TokenLessEq:
+			return c <= 0, nil
+		case TokenGreater:
+			return c > 0, nil
+		default:
+			return c >= 0, nil
+		}
+	default:
+		return nil, errors.Errorf("unknown operator %s", n.Operator)
+	}
+}
+
+// Truthy returns the boolean interpretation of v: null, false, 0, "" and
+// empty lists are false, everything else is true.
+func Truthy(v interface{}) bool {
+	switch v_ := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v_
+	case float64:
+		return v_ != 0
+	case string:
+		return v_ != ""
+	case []interface{}:
+		return len(v_) > 0
+	default:
+		return true
+	}
+}
+
+// Equal compares two normalized values. Numbers compare numerically, and
+// strings are coerced when compared to numbers, booleans or times, which is
+// what CSV input requires.
+func Equal(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if c, ok := Compare(a, b); ok {
+		return c == 0
+	}
+	if ab, ok := a.(bool); ok {
+		if bb, ok := toBool(b); ok {
+			return ab == bb
+		}
+		return false
+	}
+	if bb, ok := b.(bool); ok {
+		if ab, ok := toBool(a); ok {
+			return ab == bb
+		}
+		return false
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// Compare orders two normalized non-null values. ok is false if the values
+// can't be ordered.
+func Compare(a, b interface{}) (int, bool) {
+	switch a_ := a.(type) {
+	case float64:
+		switch b_ := b.(type) {
+		case float64:
+			return compareFloats(a_, b_), true
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(b_), 64); err == nil {
+				return compareFloats(a_, f), true
+			}
+		}
+	case string:
+		switch b_ := b.(type) {
+		case string:
+			return strings.Compare(a_, b_), true
+		case float64:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(a_), 64); err == nil {
+				return compareFloats(f, b_), true
+			}
+		case time.Time:
+			if t, err := dateparse.ParseAny(a_); err == nil {
+				return t.Compare(b_), true
+			}
+		}
+	case time.Time:
+		switch b_ := b.(type) {
+		case time.Time:
+			return a_.Compare(b_), true
+		case string:
+			if t, err := dateparse.ParseAny(b_); err == nil {
+				return a_.Compare(t), true
+			}
+		}
+	}
+	return 0, false
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func toBool(v interface{}) (bool, bool) {
+	switch v_ := v.(type) {
+	case bool:
+		return v_, true
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(v_))
+		return b, err == nil
+	default:
+		return false, false
+	}
+}
+
+// normalize converts numbers to float64 and pointers to time.Time to time.Time,
+// so that the evaluator only has to deal with a handful of types.
+func normalize(v interface{}) interface{} {
+	if compare.IsOfNumberType(v) {
+		f, _ := cast.CastNumberInterfaceToFloat[float64](v)
+		return f
+	}
+	switch v_ := v.(type) {
+	case *time.Time:
+		if v_ == nil {
+			return nil
+		}
+		return *v_
+	case time.Duration:
+		return v_.Seconds()
+	}
+	return v
+}
+
+func describe(v interface{}) string {
+	switch v_ := v.(type) {
+	case nil:
+		return "null"
+	case float64:
+		return fmt.Sprintf("number %v", v_)
+	case string:
+		return fmt.Sprintf("string %q", v_)
+	case bool:
+		return fmt.Sprintf("bool %v", v_)
+	case time.Time:
+		return fmt.Sprintf("time %s", v_.Format(time.RFC3339))
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// LookupPath resolves a field path against a row.
+//
+// A flattened column named after the whole path (a.b.c) takes precedence,
+// otherwise the path is walked through nested maps, rows and lists, where
+// numeric segments index into lists.
+func LookupPath(row types.Row, path []string) (interface{}, bool) {
+	if len(path) == 0 {
+		return nil, false
+	}
+	if v, ok := row.Get(strings.Join(path, ".")); ok {
+		return v, true
+	}
+	v, ok := row.Get(path[0])
+	if !ok {
+		return nil, false
+	}
+	return lookupValue(v, path[1:])
+}
+
+func lookupValue(v interface{}, path []string) (interface{}, bool) {
+	if len(path) == 0 {
+		return v, true
+	}
+
+	switch v_ := v.(type) {
+	case types.Row:
+		return LookupPath(v_, path)
+	case *orderedmap.OrderedMap[string, string]:
+		child, ok := v_.Get(path[0])
+		if !ok {
+			return nil, false
+		}
+		return lookupValue(child, path[1:])
+	case map[string]interface{}:
+		if child, ok := v_[strings.Join(path, ".")]; ok {
+			return child, true
+		}
+		child, ok := v_[path[0]]
+		if !ok {
+			return nil, false
+		}
+		return lookupValue(child, path[1:])
+	case map[interface{}]interface{}:
+		child, ok := v_[path[0]]
+		if !ok {
+			return nil, false
+		}
+		return lookupValue(child, path[1:])
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		i, err := strconv.Atoi(path[0])
+		if err != nil {
+			return nil, false
+		}
+		if i < 0 {
+			i += rv.Len()
+		}
+		if i < 0 || i >= rv.Len() {
+			return nil, false
+		}
+		return lookupValue(rv.Index(i).Interface(), path[1:])
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		child := rv.MapIndex(reflect.ValueOf(path[0]).Convert(rv.Type().Key()))
+		if !child.IsValid() {
+			return nil, false
+		}
+		return lookupValue(child.Interface(), path[1:])
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,72 @@
+// Package expr implements a small expression language evaluated against
+// types.Row values. It is used by the --where row filter.
+//
+// Examples:
+//
+//	status == "failed" && duration > 30
+//	name =~ "^ci-" and not (team in ["infra", "sre"])
+//	owner.email is not null
+//	items[0].price >= 10.5
+//
+// Fields are referenced by name. Dotted paths (a.b.c) first look up a
+// flattened column with that name and otherwise walk nested objects; numeric
+// segments index into lists. Field names that are not plain identifiers can be
+// quoted with backticks. Missing fields evaluate to null.
+//
+// Numbers compare numerically, strings lexically, times chronologically.
+// Strings are coerced when compared to numbers, booleans or times, so CSV input
+// works as expected. Ordering comparisons involving null are false; ordering
+// values of incompatible types is an evaluation error.
+package expr
+
+import (
+	"github.com/go-go-golems/glazed/pkg/types"
+)
+
+// Expression is a parsed expression, ready to be evaluated against rows.
+type Expression struct {
+	source string
+	root   Node
+}
+
+// Compile parses source. Errors are returned as *ParseError.
+func Compile(source string) (*Expression, error) {
+	root, err := Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	return &Expression{source: source, root: root}, nil
+}
+
+// MustCompile is like Compile but panics if the expression can't be parsed.
+func MustCompile(source string) *Expression {
+	e, err := Compile(source)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// Source returns the original expression.
+func (e *Expression) Source() string {
+	return e.source
+}
+
+// String returns the fully parenthesized form of the parsed expression.
+func (e *Expression) String() string {
+	return e.root.String()
+}
+
+// Eval evaluates the expression against row.
+func (e *Expression) Eval(row types.Row) (interface{}, error) {
+	return Eval(e.root, row)
+}
+
+// Match evaluates the expression against row and returns whether the result is truthy.
+func (e *Expression) Match(row types.Row) (bool, error) {
+	v, err := Eval(e.root, row)
+	if err != nil {
+		return false, err
+	}
+	return Truthy(v), nil
+}
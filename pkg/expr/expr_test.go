@@ -0,0 +1,189 @@
+package expr
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLexer(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []TokenType
+	}{
+		{
+			input:    `status == "failed" && duration > 30`,
+			expected: []TokenType{TokenIdent, TokenEq, TokenString, TokenAnd, TokenIdent, TokenGreater, TokenNumber, TokenEOF},
+		},
+		{
+			input:    `name =~ '^ci-' or not x`,
+			expected: []TokenType{TokenIdent, TokenMatch, TokenString, TokenOr, TokenNot, TokenIdent, TokenEOF},
+		},
+		{
+			input:    "a.b[0].`c d` is not null",
+			expected: []TokenType{TokenIdent, TokenDot, TokenIdent, TokenLeftBracket, TokenNumber, TokenRightBracket, TokenDot, TokenIdent, TokenIs, TokenNot, TokenNull, TokenEOF},
+		},
+		{
+			input:    `x in [1, -2.5]`,
+			expected: []TokenType{TokenIdent, TokenIn, TokenLeftBracket, TokenNumber, TokenComma, TokenMinus, TokenNumber, TokenRightBracket, TokenEOF},
+		},
+	}
+
+	for _, tt := range tests {
+		tokens := NewLexer(tt.input).GetAllTokens()
+		types_ := make([]TokenType, 0, len(tokens))
+		for _, tok := range tokens {
+			types_ = append(types_, tok.Type)
+		}
+		assert.Equal(t, tt.expected, types_, tt.input)
+	}
+}
+
+func TestParsePrecedence(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`a == 1 || b == 2 && c == 3`, `((a == 1) or ((b == 2) and (c == 3)))`},
+		{`not a == 1`, `(not (a == 1))`},
+		{`(a or b) and c`, `((a or b) and c)`},
+		{`a.1.2 != null`, `(a.1.2 != null)`},
+		{`x not in ["a", 'b']`, `(x not in ["a", "b"])`},
+		{`name !~ "^ci"`, `(name !~ "^ci")`},
+	}
+
+	for _, tt := range tests {
+		e, err := Compile(tt.input)
+		require.NoError(t, err, tt.input)
+		assert.Equal(t, tt.expected, e.String(), tt.input)
+	}
+}
+
+func TestParseErrorsPointAtOffendingToken(t *testing.T) {
+	tests := []struct {
+		input    string
+		column   int
+		contains string
+	}{
+		{`status == && x`, 11, `near "&&": expected a value`},
+		{`a == 1 b`, 8, `unexpected token after expression`},
+		{`(a == 1`, 8, `near end of expression: expected ) to close ( at column 1`},
+		{`name =~ "("`, 9, `invalid regular expression`},
+		{`name =~ foo`, 9, `expected a quoted regular expression`},
+		{`x is 3`, 6, `expected null after is`},
+		{`x == "abc`, 6, `unterminated string`},
+		{`a & b`, 3, `illegal character`},
+		{`é == 1`, 1, `near "é": illegal character`},
+		{`name == "café" & b`, 16, `illegal character`},
+		{``, 1, `empty expression`},
+	}
+
+	for _, tt := range tests {
+		_, err := Compile(tt.input)
+		require.Error(t, err, tt.input)
+		var parseError *ParseError
+		require.ErrorAs(t, err, &parseError, tt.input)
+		assert.Equal(t, tt.column, parseError.Token.Position+1, tt.input)
+		assert.Contains(t, err.Error(), tt.contains, tt.input)
+	}
+}
+
+func TestParseErrorRendersCaret(t *testing.T) {
+	_, err := Compile(`a == && b`)
+	require.Error(t, err)
+	assert.Equal(t, "parse error at column 6 near \"&&\": expected a value\n  a == && b\n       ^", err.Error())
+}
+
+func TestParseErrorCaretCountsRunes(t *testing.T) {
+	_, err := Compile(`"héllo" == && b`)
+	require.Error(t, err)
+	assert.Equal(t, "parse error at column 12 near \"&&\": expected a value\n  \"héllo\" == && b\n             ^", err.Error())
+}
+
+func TestMatch(t *testing.T) {
+	created := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	row := types.NewRow(
+		types.MRP("status", "failed"),
+		types.MRP("duration", 42),
+		types.MRP("ratio", 0.5),
+		types.MRP("count", "17"),
+		types.MRP("active", true),
+		types.MRP("empty", nil),
+		types.MRP("created", created),
+		types.MRP("tags", []string{"ci", "nightly"}),
+		types.MRP("owner", map[string]interface{}{
+			"name":  "Ada",
+			"email": "ada@example.com",
+		}),
+		types.MRP("items", []interface{}{
+			map[string]interface{}{"price": 12.5},
+		}),
+		types.MRP("meta.region", "eu"),
+		types.MRP("odd name", 1),
+	)
+
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`status == "failed" && duration > 30`, true},
+		{`status == "failed" && duration > 60`, false},
+		{`status != "failed" || ratio < 1`, true},
+		{`duration >= 42 and duration <= 42.0`, true},
+		{`count > 10`, true},
+		{`count == 17`, true},
+		{`active`, true},
+		{`!active`, false},
+		{`active == "true"`, true},
+		{`empty is null`, true},
+		{`missing is null`, true},
+		{`status is not null`, true},
+		{`missing > 3`, false},
+		{`status =~ "^fa"`, true},
+		{`status !~ "^fa"`, false},
+		{`duration =~ "^4"`, true},
+		{`status in ["ok", "failed"]`, true},
+		{`status not in ["ok", "failed"]`, false},
+		{`duration in [41, 42]`, true},
+		{`"ci" in tags`, true},
+		{`"release" in tags`, false},
+		{`owner.name == "Ada"`, true},
+		{`owner.email =~ "@example\\.com$"`, true},
+		{`owner.phone is null`, true},
+		{`items[0].price > 10`, true},
+		{`items.0.price > 20`, false},
+		{`items[1].price is null`, true},
+		{`meta.region == "eu"`, true},
+		{"`odd name` == 1", true},
+		{`created > "2024-01-01"`, true},
+		{`created < "2024-01-01T00:00:00Z"`, false},
+		{`ratio == -0.5`, false},
+		{`not (status == "ok" or duration < 0)`, true},
+	}
+
+	for _, tt := range tests {
+		e, err := Compile(tt.input)
+		require.NoError(t, err, tt.input)
+		ok, err := e.Match(row)
+		require.NoError(t, err, tt.input)
+		assert.Equal(t, tt.expected, ok, tt.input)
+	}
+}
+
+func TestEvalTypeErrors(t *testing.T) {
+	row := types.NewRow(
+		types.MRP("duration", 42),
+		types.MRP("status", "failed"),
+	)
+
+	_, err := MustCompile(`duration > "long"`).Match(row)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `cannot compare number 42 with string "long"`)
+
+	_, err = MustCompile(`duration in status`).Match(row)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `in expects a list`)
+}
@@ -0,0 +1,410 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// TokenType represents the type of a token
+type TokenType int
+
+const (
+	// Special tokens
+	TokenIllegal TokenType = iota
+	TokenEOF
+
+	// Literals
+	TokenIdent  // field names like status or `field with spaces`
+	TokenNumber // 12, 3.5, 1e3
+	TokenString // "quoted" or 'quoted'
+
+	// Keywords
+	TokenTrue  // true
+	TokenFalse // false
+	TokenNull  // null
+	TokenAnd   // && and
+	TokenOr    // || or
+	TokenNot   // ! not
+	TokenIn    // in
+	TokenIs    // is
+
+	// Operators
+	TokenEq           // ==
+	TokenNotEq        // !=
+	TokenLess         // <
+	TokenLessEq       // <=
+	TokenGreater      // >
+	TokenGreaterEq    // >=
+	TokenMatch        // =~
+	TokenNotMatch     // !~
+	TokenMinus        // -
+	TokenDot          // .
+	TokenComma        // ,
+	TokenLeftParen    // (
+	TokenRightParen   // )
+	TokenLeftBracket  // [
+	TokenRightBracket // ]
+)
+
+// Token represents a single token
+type Token struct {
+	Type  TokenType
+	Value string
+	// Position is the offset of the token in the input, in runes, so that it
+	// can be used as the column of the token in error messages.
+	Position int
+}
+
+// String returns a string representation of the token
+func (t Token) String() string {
+	return fmt.Sprintf("%s:%s", t.Type.String(), t.Value)
+}
+
+// Describe returns the token as it should be shown in error messages.
+func (t Token) Describe() string {
+	if t.Type == TokenEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("%q", t.Value)
+}
+
+// String returns a string representation of the token type
+func (tt TokenType) String() string {
+	switch tt {
+	case TokenIllegal:
+		return "ILLEGAL"
+	case TokenEOF:
+		return "EOF"
+	case TokenIdent:
+		return "IDENT"
+	case TokenNumber:
+		return "NUMBER"
+	case TokenString:
+		return "STRING"
+	case TokenTrue:
+		return "TRUE"
+	case TokenFalse:
+		return "FALSE"
+	case TokenNull:
+		return "NULL"
+	case TokenAnd:
+		return "AND"
+	case TokenOr:
+		return "OR"
+	case TokenNot:
+		return "NOT"
+	case TokenIn:
+		return "IN"
+	case TokenIs:
+		return "IS"
+	case TokenEq:
+		return "EQ"
+	case TokenNotEq:
+		return "NOT_EQ"
+	case TokenLess:
+		return "LT"
+	case TokenLessEq:
+		return "LTE"
+	case TokenGreater:
+		return "GT"
+	case TokenGreaterEq:
+		return "GTE"
+	case TokenMatch:
+		return "MATCH"
+	case TokenNotMatch:
+		return "NOT_MATCH"
+	case TokenMinus:
+		return "MINUS"
+	case TokenDot:
+		return "DOT"
+	case TokenComma:
+		return "COMMA"
+	case TokenLeftParen:
+		return "LPAREN"
+	case TokenRightParen:
+		return "RPAREN"
+	case TokenLeftBracket:
+		return "LBRACKET"
+	case TokenRightBracket:
+		return "RBRACKET"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// Lexer tokenizes an expression
+type Lexer struct {
+	input        string
+	position     int  // current byte position in input (points to current char)
+	readPosition int  // current byte reading position in input (after current char)
+	column       int  // current rune position in input
+	ch           rune // current char under examination
+}
+
+// NewLexer creates a new lexer
+func NewLexer(input string) *Lexer {
+	l := &Lexer{
+		input: input,
+	}
+	l.readChar()
+	return l
+}
+
+// readChar decodes the next UTF-8 character and advances position
+func (l *Lexer) readChar() {
+	if l.position < l.readPosition {
+		l.column++
+	}
+	width := 0
+	if l.readPosition >= len(l.input) {
+		l.ch = 0 // ASCII NUL character represents EOF
+	} else {
+		l.ch, width = utf8.DecodeRuneInString(l.input[l.readPosition:])
+	}
+	l.position = l.readPosition
+	l.readPosition += width
+}
+
+func (l *Lexer) peekChar() rune {
+	if l.readPosition >= len(l.input) {
+		return 0
+	}
+	ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	return ch
+}
+
+// NextToken returns the next token. Lexing errors are returned as TokenIllegal
+// tokens whose value describes the problem, so that the parser can report them
+// with their position.
+func (l *Lexer) NextToken() Token {
+	l.skipWhitespace()
+
+	position, column := l.position, l.column
+	single := func(t TokenType) Token {
+		tok := Token{Type: t, Value: string(l.ch), Position: column}
+		l.readChar()
+		return tok
+	}
+	double := func(t TokenType) Token {
+		tok := Token{Type: t, Value: l.input[position : position+2], Position: column}
+		l.readChar()
+		l.readChar()
+		return tok
+	}
+
+	switch l.ch {
+	case 0:
+		return Token{Type: TokenEOF, Position: column}
+	case '(':
+		return single(TokenLeftParen)
+	case ')':
+		return single(TokenRightParen)
+	case '[':
+		return single(TokenLeftBracket)
+	case ']':
+		return single(TokenRightBracket)
+	case ',':
+		return single(TokenComma)
+	case '.':
+		return single(TokenDot)
+	case '-':
+		return single(TokenMinus)
+	case '=':
+		switch l.peekChar() {
+		case '=':
+			return double(TokenEq)
+		case '~':
+			return double(TokenMatch)
+		default:
+			// a single = is accepted as equality, as in SQL
+			return single(TokenEq)
+		}
+	case '!':
+		switch l.peekChar() {
+		case '=':
+			return double(TokenNotEq)
+		case '~':
+			return double(TokenNotMatch)
+		default:
+			return single(TokenNot)
+		}
+	case '<':
+		switch l.peekChar() {
+		case '=':
+			return double(TokenLessEq)
+		case '>':
+			return double(TokenNotEq)
+		default:
+			return single(TokenLess)
+		}
+	case '>':
+		if l.peekChar() == '=' {
+			return double(TokenGreaterEq)
+		}
+		return single(TokenGreater)
+	case '&':
+		if l.peekChar() == '&' {
+			return double(TokenAnd)
+		}
+		return single(TokenIllegal)
+	case '|':
+		if l.peekChar() == '|' {
+			return double(TokenOr)
+		}
+		return single(TokenIllegal)
+	case '"', '\'':
+		return l.readString()
+	case '`':
+		return l.readQuotedIdentifier()
+	default:
+		if isDigit(l.ch) {
+			return l.readNumber()
+		}
+		if isLetter(l.ch) {
+			value := l.readIdentifier()
+			return Token{Type: lookupIdent(value), Value: value, Position: column}
+		}
+		return single(TokenIllegal)
+	}
+}
+
+// readString reads a quoted string, handling backslash escapes.
+func (l *Lexer) readString() Token {
+	position := l.column
+	quote := l.ch
+	var sb strings.Builder
+	for {
+		l.readChar()
+		switch l.ch {
+		case 0:
+			return Token{Type: TokenIllegal, Value: "unterminated string", Position: position}
+		case quote:
+			l.readChar()
+			return Token{Type: TokenString, Value: sb.String(), Position: position}
+		case '\\':
+			l.readChar()
+			switch l.ch {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 0:
+				return Token{Type: TokenIllegal, Value: "unterminated string", Position: position}
+			default:
+				sb.WriteRune(l.ch)
+			}
+		default:
+			sb.WriteRune(l.ch)
+		}
+	}
+}
+
+// readQuotedIdentifier reads a `backtick quoted` field name, which allows
+// field names containing spaces, dots or operator characters.
+func (l *Lexer) readQuotedIdentifier() Token {
+	position := l.column
+	start := l.position + 1
+	for {
+		l.readChar()
+		if l.ch == 0 {
+			return Token{Type: TokenIllegal, Value: "unterminated quoted field name", Position: position}
+		}
+		if l.ch == '`' {
+			value := l.input[start:l.position]
+			l.readChar()
+			return Token{Type: TokenIdent, Value: value, Position: position}
+		}
+	}
+}
+
+// readNumber reads an integer or floating point literal.
+func (l *Lexer) readNumber() Token {
+	position, column := l.position, l.column
+	for isDigit(l.ch) {
+		l.readChar()
+	}
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		l.readChar()
+		for isDigit(l.ch) {
+			l.readChar()
+		}
+	}
+	if l.ch == 'e' || l.ch == 'E' {
+		l.readChar()
+		if l.ch == '+' || l.ch == '-' {
+			l.readChar()
+		}
+		for isDigit(l.ch) {
+			l.readChar()
+		}
+	}
+	return Token{Type: TokenNumber, Value: l.input[position:l.position], Position: column}
+}
+
+// readIdentifier reads an identifier or keyword
+func (l *Lexer) readIdentifier() string {
+	position := l.position
+	for isLetter(l.ch) || isDigit(l.ch) || l.ch == '-' {
+		// a - followed by a space or digit is an operator, not part of the name
+		if l.ch == '-' && !isLetter(l.peekChar()) {
+			break
+		}
+		l.readChar()
+	}
+	return l.input[position:l.position]
+}
+
+// lookupIdent determines if an identifier is a keyword
+func lookupIdent(ident string) TokenType {
+	switch strings.ToLower(ident) {
+	case "and":
+		return TokenAnd
+	case "or":
+		return TokenOr
+	case "not":
+		return TokenNot
+	case "in":
+		return TokenIn
+	case "is":
+		return TokenIs
+	case "true":
+		return TokenTrue
+	case "false":
+		return TokenFalse
+	case "null", "nil":
+		return TokenNull
+	default:
+		return TokenIdent
+	}
+}
+
+// skipWhitespace skips whitespace characters
+func (l *Lexer) skipWhitespace() {
+	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
+		l.readChar()
+	}
+}
+
+// isLetter checks if character is a letter
+func isLetter(ch rune) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+}
+
+// isDigit checks if character is a digit
+func isDigit(ch rune) bool {
+	return '0' <= ch && ch <= '9'
+}
+
+// GetAllTokens returns all tokens from the input (useful for testing)
+func (l *Lexer) GetAllTokens() []Token {
+	var tokens []Token
+	for {
+		tok := l.NextToken()
+		tokens = append(tokens, tok)
+		if tok.Type == TokenEOF {
+			break
+		}
+	}
+	return tokens
+}
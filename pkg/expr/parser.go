@@ -0,0 +1,468 @@
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Node represents a node in the AST
+type Node interface {
+	String() string
+}
+
+// LiteralNode is a constant: a number (float64), a string, a bool or null (nil).
+type LiteralNode struct {
+	Value interface{}
+}
+
+func (n *LiteralNode) String() string {
+	switch v := n.Value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strconv.Quote(v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// ListNode is a [a, b, c] list, used as the right hand side of in.
+type ListNode struct {
+	Elements []Node
+}
+
+func (n *ListNode) String() string {
+	elements := make([]string, 0, len(n.Elements))
+	for _, e := range n.Elements {
+		elements = append(elements, e.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// FieldNode references a (possibly nested) field of the row.
+type FieldNode struct {
+	Path []string
+}
+
+func (n *FieldNode) String() string {
+	return strings.Join(n.Path, ".")
+}
+
+// UnaryNode is a boolean not.
+type UnaryNode struct {
+	Operator TokenType
+	Operand  Node
+}
+
+func (n *UnaryNode) String() string {
+	return fmt.Sprintf("(not %s)", n.Operand.String())
+}
+
+// BinaryNode is a boolean connective or a comparison.
+type BinaryNode struct {
+	Operator TokenType
+	Left     Node
+	Right    Node
+}
+
+func (n *BinaryNode) String() string {
+	return fmt.Sprintf("(%s %s %s)", n.Left.String(), operatorString(n.Operator), n.Right.String())
+}
+
+// MatchNode is a regular expression match, compiled at parse time.
+type MatchNode struct {
+	Operand Node
+	Regexp  *regexp.Regexp
+	Negate  bool
+}
+
+func (n *MatchNode) String() string {
+	op := "=~"
+	if n.Negate {
+		op = "!~"
+	}
+	return fmt.Sprintf("(%s %s %q)", n.Operand.String(), op, n.Regexp.String())
+}
+
+// InNode checks membership of a value in a list literal or list-valued field.
+type InNode struct {
+	Operand Node
+	List    Node
+	Negate  bool
+}
+
+func (n *InNode) String() string {
+	op := "in"
+	if n.Negate {
+		op = "not in"
+	}
+	return fmt.Sprintf("(%s %s %s)", n.Operand.String(), op, n.List.String())
+}
+
+// IsNullNode checks whether a value is null or missing.
+type IsNullNode struct {
+	Operand Node
+	Negate  bool
+}
+
+func (n *IsNullNode) String() string {
+	if n.Negate {
+		return fmt.Sprintf("(%s is not null)", n.Operand.String())
+	}
+	return fmt.Sprintf("(%s is null)", n.Operand.String())
+}
+
+func operatorString(t TokenType) string {
+	switch t {
+	case TokenAnd:
+		return "and"
+	case TokenOr:
+		return "or"
+	case TokenEq:
+		return "=="
+	case TokenNotEq:
+		return "!="
+	case TokenLess:
+		return "<"
+	case TokenLessEq:
+		return "<="
+	case TokenGreater:
+		return ">"
+	case TokenGreaterEq:
+		return ">="
+	default:
+		return t.String()
+	}
+}
+
+// ParseError is returned when an expression can't be parsed. It points at the
+// offending token.
+type ParseError struct {
+	Expression string
+	Token      Token
+	Message    string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("parse error at column %d near %s: %s\n  %s\n  %s^",
+		e.Token.Position+1,
+		e.Token.Describe(),
+		e.Message,
+		e.Expression,
+		strings.Repeat(" ", e.Token.Position),
+	)
+}
+
+// Parser parses tokens into an AST
+type Parser struct {
+	input string
+	lexer *Lexer
+
+	curToken  Token
+	peekToken Token
+
+	err *ParseError
+}
+
+// NewParser creates a new parser
+func NewParser(input string) *Parser {
+	p := &Parser{
+		input: input,
+		lexer: NewLexer(input),
+	}
+
+	// Read two tokens so curToken and peekToken are both set
+	p.nextToken()
+	p.nextToken()
+
+	return p
+}
+
+// nextToken advances the parser tokens
+func (p *Parser) nextToken() {
+	p.curToken = p.peekToken
+	p.peekToken = p.lexer.NextToken()
+}
+
+// fail records the first error. Parsing functions return nil after calling it.
+func (p *Parser) fail(tok Token, format string, args ...interface{}) Node {
+	if p.err == nil {
+		p.err = &ParseError{
+			Expression: p.input,
+			Token:      tok,
+			Message:    fmt.Sprintf(format, args...),
+		}
+	}
+	return nil
+}
+
+// failIllegal reports a lexing error. Multi-character values of illegal tokens
+// are the lexer's description of the problem.
+func (p *Parser) failIllegal(tok Token) Node {
+	if utf8.RuneCountInString(tok.Value) > 1 {
+		return p.fail(tok, "%s", tok.Value)
+	}
+	return p.fail(tok, "illegal character")
+}
+
+// Parse parses the input and returns the AST
+func Parse(input string) (Node, error) {
+	p := NewParser(input)
+
+	if p.curToken.Type == TokenEOF {
+		p.fail(p.curToken, "empty expression")
+		return nil, p.err
+	}
+
+	node := p.parseOr()
+	if p.err == nil && p.curToken.Type != TokenEOF {
+		if p.curToken.Type == TokenIllegal {
+			p.failIllegal(p.curToken)
+		} else {
+			p.fail(p.curToken, "unexpected token after expression")
+		}
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	return node, nil
+}
+
+// parseOr parses or expressions (lowest precedence)
+func (p *Parser) parseOr() Node {
+	left := p.parseAnd()
+	for p.err == nil && p.curToken.Type == TokenOr {
+		p.nextToken()
+		right := p.parseAnd()
+		left = &BinaryNode{Operator: TokenOr, Left: left, Right: right}
+	}
+	return left
+}
+
+// parseAnd parses and expressions
+func (p *Parser) parseAnd() Node {
+	left := p.parseNot()
+	for p.err == nil && p.curToken.Type == TokenAnd {
+		p.nextToken()
+		right := p.parseNot()
+		left = &BinaryNode{Operator: TokenAnd, Left: left, Right: right}
+	}
+	return left
+}
+
+// parseNot parses not expressions
+func (p *Parser) parseNot() Node {
+	if p.curToken.Type == TokenNot {
+		p.nextToken()
+		operand := p.parseNot()
+		return &UnaryNode{Operator: TokenNot, Operand: operand}
+	}
+	return p.parseComparison()
+}
+
+// parseComparison parses an operand optionally followed by a comparison,
+// a regular expression match, an in list or an is null check.
+func (p *Parser) parseComparison() Node {
+	left := p.parseOperand()
+	if p.err != nil {
+		return nil
+	}
+
+	switch p.curToken.Type {
+	case TokenEq, TokenNotEq, TokenLess, TokenLessEq, TokenGreater, TokenGreaterEq:
+		operator := p.curToken.Type
+		p.nextToken()
+		right := p.parseOperand()
+		return &BinaryNode{Operator: operator, Left: left, Right: right}
+
+	case TokenMatch, TokenNotMatch:
+		negate := p.curToken.Type == TokenNotMatch
+		p.nextToken()
+		if p.curToken.Type != TokenString {
+			return p.fail(p.curToken, "expected a quoted regular expression")
+		}
+		re, err := regexp.Compile(p.curToken.Value)
+		if err != nil {
+			return p.fail(p.curToken, "invalid regular expression: %s", err.Error())
+		}
+		p.nextToken()
+		return &MatchNode{Operand: left, Regexp: re, Negate: negate}
+
+	case TokenIn:
+		p.nextToken()
+		return &InNode{Operand: left, List: p.parseOperand()}
+
+	case TokenNot:
+		if p.peekToken.Type != TokenIn {
+			return p.fail(p.peekToken, "expected in after not")
+		}
+		p.nextToken()
+		p.nextToken()
+		return &InNode{Operand: left, List: p.parseOperand(), Negate: true}
+
+	case TokenIs:
+		p.nextToken()
+		negate := false
+		if p.curToken.Type == TokenNot {
+			negate = true
+			p.nextToken()
+		}
+		if p.curToken.Type != TokenNull {
+			return p.fail(p.curToken, "expected null after is")
+		}
+		p.nextToken()
+		return &IsNullNode{Operand: left, Negate: negate}
+
+	default:
+		return left
+	}
+}
+
+// parseOperand parses literals, field references, lists and grouped expressions.
+func (p *Parser) parseOperand() Node {
+	tok := p.curToken
+	switch tok.Type {
+	case TokenLeftParen:
+		p.nextToken()
+		node := p.parseOr()
+		if p.err != nil {
+			return nil
+		}
+		if p.curToken.Type != TokenRightParen {
+			return p.fail(p.curToken, "expected ) to close ( at column %d", tok.Position+1)
+		}
+		p.nextToken()
+		return node
+
+	case TokenLeftBracket:
+		return p.parseList()
+
+	case TokenNumber:
+		return p.parseNumber(false)
+
+	case TokenMinus:
+		p.nextToken()
+		if p.curToken.Type != TokenNumber {
+			return p.fail(p.curToken, "expected a number after -")
+		}
+		return p.parseNumber(true)
+
+	case TokenString:
+		p.nextToken()
+		return &LiteralNode{Value: tok.Value}
+
+	case TokenTrue, TokenFalse:
+		p.nextToken()
+		return &LiteralNode{Value: tok.Type == TokenTrue}
+
+	case TokenNull:
+		p.nextToken()
+		return &LiteralNode{Value: nil}
+
+	case TokenIdent:
+		return p.parseField()
+
+	case TokenIllegal:
+		return p.failIllegal(tok)
+
+	case TokenEOF:
+		return p.fail(tok, "expected a value")
+
+	default:
+		return p.fail(tok, "expected a value")
+	}
+}
+
+func (p *Parser) parseNumber(negative bool) Node {
+	tok := p.curToken
+	f, err := strconv.ParseFloat(tok.Value, 64)
+	if err != nil {
+		return p.fail(tok, "invalid number")
+	}
+	p.nextToken()
+	if negative {
+		f = -f
+	}
+	return &LiteralNode{Value: f}
+}
+
+func (p *Parser) parseList() Node {
+	p.nextToken() // consume [
+	list := &ListNode{}
+	if p.curToken.Type == TokenRightBracket {
+		p.nextToken()
+		return list
+	}
+	for {
+		element := p.parseOperand()
+		if p.err != nil {
+			return nil
+		}
+		list.Elements = append(list.Elements, element)
+
+		switch p.curToken.Type {
+		case TokenComma:
+			p.nextToken()
+		case TokenRightBracket:
+			p.nextToken()
+			return list
+		default:
+			return p.fail(p.curToken, "expected , or ] in list")
+		}
+	}
+}
+
+// parseField parses a field path such as a.b.c, items[0].name or a.`b c`.
+func (p *Parser) parseField() Node {
+	field := &FieldNode{Path: []string{p.curToken.Value}}
+	p.nextToken()
+
+	for {
+		switch p.curToken.Type {
+		case TokenDot:
+			p.nextToken()
+			switch p.curToken.Type {
+			case TokenIdent:
+				field.Path = append(field.Path, p.curToken.Value)
+			case TokenNumber:
+				// a.1.2 lexes the index part as the number 1.2
+				field.Path = append(field.Path, strings.Split(p.curToken.Value, ".")...)
+			default:
+				if isKeyword(p.curToken.Type) {
+					field.Path = append(field.Path, p.curToken.Value)
+				} else {
+					return p.fail(p.curToken, "expected a field name after .")
+				}
+			}
+			p.nextToken()
+
+		case TokenLeftBracket:
+			p.nextToken()
+			if p.curToken.Type != TokenNumber && p.curToken.Type != TokenString {
+				return p.fail(p.curToken, "expected an index or quoted key")
+			}
+			field.Path = append(field.Path, p.curToken.Value)
+			p.nextToken()
+			if p.curToken.Type != TokenRightBracket {
+				return p.fail(p.curToken, "expected ]")
+			}
+			p.nextToken()
+
+		default:
+			return field
+		}
+	}
+}
+
+func isKeyword(t TokenType) bool {
+	switch t {
+	case TokenTrue, TokenFalse, TokenNull, TokenAnd, TokenOr, TokenNot, TokenIn, TokenIs:
+		return true
+	default:
+		return false
+	}
+}
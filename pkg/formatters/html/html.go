@@ -0,0 +1,277 @@
+package html
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/formatters"
+	"github.com/go-go-golems/glazed/pkg/helpers/cast"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// OutputFormatter renders a table as a standalone HTML page, meant to be
+// shared with people who don't use the command line. The page needs no
+// external resources: its styles and scripts are inlined. Columns can be
+// sorted by clicking their header, rows filtered by a search box, and nested
+// objects and lists are rendered as collapsible JSON.
+type OutputFormatter struct {
+	Title       string
+	Description string
+	OutputFile  string
+}
+
+var _ formatters.TableOutputFormatter = (*OutputFormatter)(nil)
+
+type OutputFormatterOption func(*OutputFormatter)
+
+// WithTitle sets the title of the page, "Results" by default.
+func WithTitle(title string) OutputFormatterOption {
+	return func(f *OutputFormatter) {
+		f.Title = title
+	}
+}
+
+// WithDescription sets a paragraph shown below the title.
+func WithDescription(description string) OutputFormatterOption {
+	return func(f *OutputFormatter) {
+		f.Description = description
+	}
+}
+
+func WithOutputFile(outputFile string) OutputFormatterOption {
+	return func(f *OutputFormatter) {
+		f.OutputFile = outputFile
+	}
+}
+
+func NewOutputFormatter(opts ...OutputFormatterOption) *OutputFormatter {
+	f := &OutputFormatter{}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	return f
+}
+
+func (f *OutputFormatter) ContentType() string {
+	return "text/html"
+}
+
+func (f *OutputFormatter) Close(ctx context.Context, w io.Writer) error {
+	return nil
+}
+
+func (f *OutputFormatter) RegisterTableMiddlewares(mw *middlewares.TableProcessor) error {
+	return nil
+}
+
+func (f *OutputFormatter) RegisterRowMiddlewares(mw *middlewares.TableProcessor) error {
+	return nil
+}
+
+type page struct {
+	Title       string
+	Description string
+	Columns     []types.FieldName
+	Rows        [][]cell
+}
+
+type cell struct {
+	Text string
+	// SortKey is set for numbers and times, so that they sort numerically.
+	SortKey string
+	Class   string
+	// JSON holds the indented encoding of nested values.
+	JSON string
+}
+
+func (f *OutputFormatter) OutputTable(ctx context.Context, table_ *types.Table, w io.Writer) error {
+	if f.OutputFile != "" {
+		f_, err := os.Create(f.OutputFile)
+		if err != nil {
+			return err
+		}
+		defer func(f_ *os.File) {
+			_ = f_.Close()
+		}(f_)
+
+		if err := f.render(table_, f_); err != nil {
+			return err
+		}
+
+		_, _ = fmt.Fprintf(w, "Wrote output to %s\n", f.OutputFile)
+		return nil
+	}
+
+	return f.render(table_, w)
+}
+
+func (f *OutputFormatter) render(table_ *types.Table, w io.Writer) error {
+	p := page{
+		Title:       f.Title,
+		Description: f.Description,
+		Columns:     table_.Columns,
+		Rows:        make([][]cell, 0, len(table_.Rows)),
+	}
+	if p.Title == "" {
+		p.Title = "Results"
+	}
+
+	for _, row := range table_.Rows {
+		cells := make([]cell, len(table_.Columns))
+		for i, column := range table_.Columns {
+			v, _ := row.Get(column)
+			c, err := newCell(v)
+			if err != nil {
+				return errors.Wrapf(err, "could not render column %s", column)
+			}
+			cells[i] = c
+		}
+		p.Rows = append(p.Rows, cells)
+	}
+
+	return pageTemplate.Execute(w, p)
+}
+
+func newCell(v interface{}) (cell, error) {
+	switch v_ := v.(type) {
+	case nil:
+		return cell{Class: "null"}, nil
+	case string:
+		return cell{Text: v_}, nil
+	case bool:
+		return cell{Text: strconv.FormatBool(v_), Class: "bool"}, nil
+	case time.Time:
+		return cell{Text: v_.Format(time.RFC3339), SortKey: strconv.FormatInt(v_.UnixNano(), 10)}, nil
+	case *time.Time:
+		if v_ == nil {
+			return cell{Class: "null"}, nil
+		}
+		return newCell(*v_)
+	case map[string]interface{}, []interface{}, types.Row:
+		return newJSONCell(v_)
+	}
+
+	if n, ok := cast.CastNumberInterfaceToFloat[float64](v); ok {
+		return cell{
+			Text:    fmt.Sprint(v),
+			SortKey: strconv.FormatFloat(n, 'g', -1, 64),
+			Class:   "num",
+		}, nil
+	}
+	if _, err := cast.CastListToInterfaceList(v); err == nil {
+		return newJSONCell(v)
+	}
+	return cell{Text: fmt.Sprint(v)}, nil
+}
+
+func newJSONCell(v interface{}) (cell, error) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return cell{}, err
+	}
+	summary := "{…}"
+	if l, err := cast.CastListToInterfaceList(v); err == nil {
+		summary = fmt.Sprintf("[%d]", len(l))
+	}
+	return cell{Text: summary, JSON: string(b), Class: "nested"}, nil
+}
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2rem; color: #1f2328; }
+h1 { font-size: 1.5rem; margin-bottom: 0.25rem; }
+p.description { color: #59636e; white-space: pre-line; margin-top: 0; }
+.toolbar { display: flex; gap: 1rem; align-items: center; margin: 1rem 0; }
+.toolbar input { padding: 0.35rem 0.5rem; border: 1px solid #d1d9e0; border-radius: 6px; min-width: 16rem; }
+.toolbar .count { color: #59636e; font-size: 0.875rem; }
+table { border-collapse: collapse; font-size: 0.875rem; }
+th, td { border: 1px solid #d1d9e0; padding: 0.35rem 0.6rem; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; cursor: pointer; user-select: none; position: sticky; top: 0; }
+th[aria-sort="ascending"]::after { content: " \25B2"; }
+th[aria-sort="descending"]::after { content: " \25BC"; }
+tbody tr:nth-child(even) { background: #f6f8fa; }
+td.num { text-align: right; font-variant-numeric: tabular-nums; }
+td.bool { text-align: center; }
+td.null { background: #fbfbfb; }
+details summary { cursor: pointer; color: #0969da; }
+details pre { margin: 0.25rem 0 0; font-size: 0.8rem; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{- if .Description}}
+<p class="description">{{.Description}}</p>
+{{- end}}
+<div class="toolbar">
+<input id="filter" type="search" placeholder="Filter rows" aria-label="Filter rows">
+<span class="count" id="count">{{len .Rows}} rows</span>
+</div>
+<table id="results">
+<thead>
+<tr>{{range .Columns}}<th>{{.}}</th>{{end}}</tr>
+</thead>
+<tbody>
+{{- range .Rows}}
+<tr>{{range .}}<td{{if .Class}} class="{{.Class}}"{{end}}{{if .SortKey}} data-sort="{{.SortKey}}"{{end}}>{{if .JSON}}<details><summary>{{.Text}}</summary><pre>{{.JSON}}</pre></details>{{else}}{{.Text}}{{end}}</td>{{end}}</tr>
+{{- end}}
+</tbody>
+</table>
+<script>
+(function () {
+  var table = document.getElementById("results");
+  var body = table.tBodies[0];
+  var rows = Array.prototype.slice.call(body.rows);
+  var count = document.getElementById("count");
+
+  function key(row, i) {
+    var td = row.cells[i];
+    return td.hasAttribute("data-sort") ? td.getAttribute("data-sort") : td.textContent;
+  }
+
+  Array.prototype.forEach.call(table.tHead.rows[0].cells, function (th, i) {
+    th.addEventListener("click", function () {
+      var ascending = th.getAttribute("aria-sort") !== "ascending";
+      Array.prototype.forEach.call(th.parentNode.cells, function (other) {
+        other.removeAttribute("aria-sort");
+      });
+      th.setAttribute("aria-sort", ascending ? "ascending" : "descending");
+      rows.sort(function (a, b) {
+        var x = key(a, i), y = key(b, i);
+        var numeric = a.cells[i].hasAttribute("data-sort") && b.cells[i].hasAttribute("data-sort");
+        var c = numeric ? parseFloat(x) - parseFloat(y) : x.localeCompare(y, undefined, { numeric: true });
+        return ascending ? c : -c;
+      });
+      rows.forEach(function (row) { body.appendChild(row); });
+    });
+  });
+
+  document.getElementById("filter").addEventListener("input", function (e) {
+    var needle = e.target.value.toLowerCase();
+    var shown = 0;
+    rows.forEach(function (row) {
+      var match = row.textContent.toLowerCase().indexOf(needle) !== -1;
+      row.hidden = !match;
+      if (match) { shown++; }
+    });
+    count.textContent = shown + " of " + rows.length + " rows";
+  });
+})();
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,55 @@
+package html
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTMLRendersStandalonePage(t *testing.T) {
+	of := NewOutputFormatter(WithTitle("Jobs <today>"), WithDescription("All jobs"))
+	table_ := types.NewTable()
+	table_.AddRows(
+		types.NewRow(
+			types.MRP("name", "<b>build</b>"),
+			types.MRP("cost", 1.5),
+			types.MRP("ok", true),
+			types.MRP("tags", []interface{}{"a", "b"}),
+			types.MRP("meta", map[string]interface{}{"k": "v"}),
+			types.MRP("note", nil),
+		),
+	)
+	table_.Columns = []types.FieldName{"name", "cost", "ok", "tags", "meta", "note"}
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, of.OutputTable(context.Background(), table_, buf))
+	s := buf.String()
+
+	assert.Contains(t, s, "<title>Jobs &lt;today&gt;</title>")
+	assert.Contains(t, s, `<p class="description">All jobs</p>`)
+	assert.Contains(t, s, "<th>name</th><th>cost</th><th>ok</th><th>tags</th><th>meta</th><th>note</th>")
+	assert.Contains(t, s, "<td>&lt;b&gt;build&lt;/b&gt;</td>")
+	assert.Contains(t, s, `<td class="num" data-sort="1.5">1.5</td>`)
+	assert.Contains(t, s, `<td class="bool">true</td>`)
+	assert.Contains(t, s, "<details><summary>[2]</summary><pre>[\n  &#34;a&#34;,\n  &#34;b&#34;\n]</pre></details>")
+	assert.Contains(t, s, "<details><summary>{…}</summary>")
+	assert.Contains(t, s, `<td class="null"></td>`)
+	assert.NotContains(t, s, "<script src=")
+	assert.NotContains(t, s, "<link")
+}
+
+func TestHTMLDefaultsTitleWithoutDescription(t *testing.T) {
+	of := NewOutputFormatter()
+	table_ := types.NewTable()
+	table_.AddRows(types.NewRow(types.MRP("a", 1)))
+	table_.Columns = []types.FieldName{"a"}
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, of.OutputTable(context.Background(), table_, buf))
+	assert.Contains(t, buf.String(), "<h1>Results</h1>")
+	assert.NotContains(t, buf.String(), `class="description"`)
+}
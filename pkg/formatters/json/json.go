@@ -93,7 +93,9 @@ func (f *OutputFormatter) OutputTable(ctx context.Context, table_ *types.Table,
 	if f.OutputIndividualRows {
 		for _, row := range table_.Rows {
 			encoder := json.NewEncoder(w)
-			encoder.SetIndent("", "  ")
+			if !f.Compact {
+				encoder.SetIndent("", "  ")
+			}
 			err := encoder.Encode(row)
 			if err != nil {
 				return err
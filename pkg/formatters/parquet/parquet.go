@@ -0,0 +1,375 @@
+package parquet
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/formatters"
+	"github.com/go-go-golems/glazed/pkg/helpers/cast"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+	"github.com/pkg/errors"
+)
+
+type Compression string
+
+const (
+	CompressionNone   Compression = "none"
+	CompressionSnappy Compression = "snappy"
+	CompressionGzip   Compression = "gzip"
+	CompressionZstd   Compression = "zstd"
+)
+
+func ParseCompression(s string) (Compression, error) {
+	switch c := Compression(strings.ToLower(strings.TrimSpace(s))); c {
+	case CompressionNone, CompressionSnappy, CompressionGzip, CompressionZstd:
+		return c, nil
+	}
+	return "", errors.Errorf("invalid parquet compression %q, expected none, snappy, gzip or zstd", s)
+}
+
+// OutputFormatter writes a table to a Parquet file. The schema is inferred
+// from the values of each column:
+//
+//   - booleans are BOOLEAN
+//   - integers are INT64, and integers mixed with floats are DOUBLE
+//   - times are INT64 timestamps in microseconds, adjusted to UTC
+//   - strings are UTF-8 BYTE_ARRAY
+//   - nested objects and lists, and columns mixing other types, are UTF-8
+//     BYTE_ARRAY holding JSON
+//
+// Columns holding nulls, or missing from some rows, are optional, the others
+// are required, and columns keep the order of the table. Rows are written in
+// row groups of RowGroupSize rows with github.com/parquet-go/parquet-go.
+type OutputFormatter struct {
+	OutputFile   string
+	RowGroupSize int
+	Compression  Compression
+}
+
+var _ formatters.TableOutputFormatter = (*OutputFormatter)(nil)
+
+type OutputFormatterOption func(*OutputFormatter)
+
+func WithOutputFile(outputFile string) OutputFormatterOption {
+	return func(f *OutputFormatter) {
+		f.OutputFile = outputFile
+	}
+}
+
+// WithRowGroupSize sets the number of rows per row group, 10000 by default.
+func WithRowGroupSize(rowGroupSize int) OutputFormatterOption {
+	return func(f *OutputFormatter) {
+		f.RowGroupSize = rowGroupSize
+	}
+}
+
+// WithCompression sets the compression of the pages, gzip by default.
+func WithCompression(compression Compression) OutputFormatterOption {
+	return func(f *OutputFormatter) {
+		f.Compression = compression
+	}
+}
+
+func NewOutputFormatter(opts ...OutputFormatterOption) *OutputFormatter {
+	f := &OutputFormatter{
+		RowGroupSize: 10000,
+		Compression:  CompressionGzip,
+	}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	return f
+}
+
+func (f *OutputFormatter) ContentType() string {
+	return "application/vnd.apache.parquet"
+}
+
+func (f *OutputFormatter) Close(ctx context.Context, w io.Writer) error {
+	return nil
+}
+
+func (f *OutputFormatter) RegisterTableMiddlewares(mw *middlewares.TableProcessor) error {
+	return nil
+}
+
+func (f *OutputFormatter) RegisterRowMiddlewares(mw *middlewares.TableProcessor) error {
+	return nil
+}
+
+func (f *OutputFormatter) OutputTable(ctx context.Context, table_ *types.Table, w io.Writer) error {
+	if f.OutputFile == "" {
+		return errors.New("parquet output requires an output file")
+	}
+
+	f_, err := os.Create(f.OutputFile)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f_)
+	err = f.write(table_, bw)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if closeErr := f_.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(w, "Wrote output to %s\n", f.OutputFile)
+	return nil
+}
+
+var codecs = map[Compression]compress.Codec{
+	CompressionNone:   &parquet.Uncompressed,
+	CompressionSnappy: &parquet.Snappy,
+	CompressionGzip:   &parquet.Gzip,
+	CompressionZstd:   &parquet.Zstd,
+}
+
+type columnKind int
+
+const (
+	kindString columnKind = iota
+	kindBoolean
+	kindInt64
+	kindDouble
+	kindTimestamp
+)
+
+type column struct {
+	name     types.FieldName
+	kind     columnKind
+	optional bool
+}
+
+func inferColumn(table_ *types.Table, name types.FieldName) column {
+	ret := column{name: name}
+	kind := columnKind(-1)
+	for _, row := range table_.Rows {
+		v, _ := row.Get(name)
+		if v == nil || isNilTime(v) {
+			ret.optional = true
+			continue
+		}
+		k := valueKind(v)
+		switch {
+		case kind == -1:
+			kind = k
+		case kind == k:
+		case (kind == kindInt64 && k == kindDouble) || (kind == kindDouble && k == kindInt64):
+			kind = kindDouble
+		default:
+			kind = kindString
+		}
+	}
+	if kind == -1 {
+		kind = kindString
+	}
+	ret.kind = kind
+	return ret
+}
+
+func valueKind(v interface{}) columnKind {
+	switch v_ := v.(type) {
+	case bool:
+		return kindBoolean
+	case int, int8, int16, int32, int64, uint8, uint16, uint32:
+		return kindInt64
+	case uint:
+		if uint64(v_) <= math.MaxInt64 {
+			return kindInt64
+		}
+		return kindDouble
+	case uint64:
+		if v_ <= math.MaxInt64 {
+			return kindInt64
+		}
+		return kindDouble
+	case float32, float64:
+		return kindDouble
+	case time.Time, *time.Time:
+		return kindTimestamp
+	}
+	return kindString
+}
+
+func (c column) node() parquet.Node {
+	var ret parquet.Node
+	switch c.kind {
+	case kindBoolean:
+		ret = parquet.Leaf(parquet.BooleanType)
+	case kindInt64:
+		ret = parquet.Int(64)
+	case kindDouble:
+		ret = parquet.Leaf(parquet.DoubleType)
+	case kindTimestamp:
+		ret = parquet.Timestamp(parquet.Microsecond)
+	case kindString:
+		ret = parquet.String()
+	}
+	if c.optional {
+		return parquet.Optional(ret)
+	}
+	return parquet.Required(ret)
+}
+
+// value converts v to the parquet value of the column at index i.
+func (c column) value(v interface{}, i int) (parquet.Value, error) {
+	if v == nil || isNilTime(v) {
+		return parquet.NullValue().Level(0, 0, i), nil
+	}
+	definitionLevel := 0
+	if c.optional {
+		definitionLevel = 1
+	}
+
+	var ret parquet.Value
+	switch c.kind {
+	case kindBoolean:
+		ret = parquet.BooleanValue(v.(bool))
+	case kindInt64:
+		n, err := int64Value(v)
+		if err != nil {
+			return parquet.Value{}, err
+		}
+		ret = parquet.Int64Value(n)
+	case kindDouble:
+		n, ok := cast.CastNumberInterfaceToFloat[float64](v)
+		if !ok {
+			return parquet.Value{}, errors.Errorf("could not use %v (%T) as a number", v, v)
+		}
+		ret = parquet.DoubleValue(n)
+	case kindTimestamp:
+		t, ok := v.(time.Time)
+		if !ok {
+			t = *v.(*time.Time)
+		}
+		ret = parquet.Int64Value(t.UnixMicro())
+	case kindString:
+		s, err := stringValue(v)
+		if err != nil {
+			return parquet.Value{}, err
+		}
+		ret = parquet.ByteArrayValue([]byte(s))
+	}
+	return ret.Level(0, definitionLevel, i), nil
+}
+
+// orderedGroup is the root of the schema. Unlike parquet.Group, which sorts
+// its fields by name, it keeps the columns in the order of the table.
+type orderedGroup struct {
+	parquet.Group
+	order []string
+}
+
+func (g orderedGroup) Fields() []parquet.Field {
+	rank := make(map[string]int, len(g.order))
+	for i, name := range g.order {
+		rank[name] = i
+	}
+	ret := append([]parquet.Field(nil), g.Group.Fields()...)
+	sort.SliceStable(ret, func(i, j int) bool {
+		return rank[ret[i].Name()] < rank[ret[j].Name()]
+	})
+	return ret
+}
+
+func (f *OutputFormatter) write(table_ *types.Table, w io.Writer) error {
+	codec, ok := codecs[f.Compression]
+	if !ok {
+		return errors.Errorf("unsupported parquet compression %q", f.Compression)
+	}
+	rowGroupSize := f.RowGroupSize
+	if rowGroupSize <= 0 {
+		rowGroupSize = max(len(table_.Rows), 1)
+	}
+
+	columns := make([]column, len(table_.Columns))
+	root := orderedGroup{Group: parquet.Group{}, order: make([]string, len(columns))}
+	for i, name := range table_.Columns {
+		columns[i] = inferColumn(table_, name)
+		root.Group[name] = columns[i].node()
+		root.order[i] = name
+	}
+
+	writer := parquet.NewWriter(w,
+		parquet.NewSchema("schema", root),
+		parquet.Compression(codec),
+		parquet.MaxRowsPerRowGroup(int64(rowGroupSize)),
+		parquet.CreatedBy("glazed", "", ""),
+	)
+	for _, row := range table_.Rows {
+		parquetRow := make(parquet.Row, len(columns))
+		for i, c := range columns {
+			v, _ := row.Get(c.name)
+			value, err := c.value(v, i)
+			if err != nil {
+				return errors.Wrapf(err, "could not write column %s", c.name)
+			}
+			parquetRow[i] = value
+		}
+		if _, err := writer.WriteRows([]parquet.Row{parquetRow}); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+func isNilTime(v interface{}) bool {
+	t, ok := v.(*time.Time)
+	return ok && t == nil
+}
+
+func int64Value(v interface{}) (int64, error) {
+	switch v_ := v.(type) {
+	case int:
+		return int64(v_), nil
+	case int8:
+		return int64(v_), nil
+	case int16:
+		return int64(v_), nil
+	case int32:
+		return int64(v_), nil
+	case int64:
+		return v_, nil
+	case uint8:
+		return int64(v_), nil
+	case uint16:
+		return int64(v_), nil
+	case uint32:
+		return int64(v_), nil
+	case uint:
+		return int64(v_), nil
+	case uint64:
+		return int64(v_), nil
+	}
+	return 0, errors.Errorf("could not use %v (%T) as an integer", v, v)
+}
+
+// stringValue returns strings as they are and encodes other values as JSON.
+func stringValue(v interface{}) (string, error) {
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
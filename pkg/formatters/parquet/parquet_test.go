@@ -0,0 +1,133 @@
+package parquet
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openFile(t *testing.T, path string) *parquet.File {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = f.Close() })
+	stat, err := f.Stat()
+	require.NoError(t, err)
+	file, err := parquet.OpenFile(f, stat.Size())
+	require.NoError(t, err)
+	return file
+}
+
+type record struct {
+	ID    int64     `parquet:"id"`
+	Name  *string   `parquet:"name,optional"`
+	At    time.Time `parquet:"at,timestamp(microsecond)"`
+	Meta  *string   `parquet:"meta,optional"`
+	Score float64   `parquet:"score"`
+	OK    bool      `parquet:"ok"`
+}
+
+func TestParquetWritesSchemaAndRowGroups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.parquet")
+	of := NewOutputFormatter(WithOutputFile(path), WithRowGroupSize(2), WithCompression(CompressionNone))
+	table_ := types.NewTable()
+	table_.AddRows(
+		types.NewRow(types.MRP("id", 1), types.MRP("name", "a"), types.MRP("at", time.Unix(1, 0)),
+			types.MRP("meta", map[string]interface{}{"k": 1}), types.MRP("score", 1), types.MRP("ok", true)),
+		types.NewRow(types.MRP("id", 2), types.MRP("name", nil), types.MRP("at", time.Unix(2, 0)),
+			types.MRP("meta", nil), types.MRP("score", 2.5), types.MRP("ok", false)),
+		types.NewRow(types.MRP("id", 3), types.MRP("name", "c"), types.MRP("at", time.Unix(3, 0)),
+			types.MRP("meta", nil), types.MRP("score", 3), types.MRP("ok", true)),
+	)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, of.OutputTable(context.Background(), table_, buf))
+	assert.Equal(t, "Wrote output to "+path+"\n", buf.String())
+
+	file := openFile(t, path)
+	assert.Equal(t, int64(3), file.NumRows())
+	require.Len(t, file.RowGroups(), 2)
+	assert.Equal(t, int64(2), file.RowGroups()[0].NumRows())
+	assert.Equal(t, int64(1), file.RowGroups()[1].NumRows())
+
+	fields := file.Schema().Fields()
+	names := make([]string, len(fields))
+	for i, field := range fields {
+		names[i] = field.Name()
+	}
+	assert.Equal(t, []string{"id", "name", "at", "meta", "score", "ok"}, names)
+	assert.True(t, fields[0].Required())
+	assert.Equal(t, parquet.Int64, fields[0].Type().Kind())
+	assert.True(t, fields[1].Optional())
+	assert.Equal(t, parquet.ByteArray, fields[1].Type().Kind())
+	assert.IsType(t, &format.TimestampType{}, fields[2].Type().LogicalType().Value)
+	assert.Equal(t, parquet.Double, fields[4].Type().Kind())
+	assert.Equal(t, parquet.Boolean, fields[5].Type().Kind())
+
+	rows, err := parquet.ReadFile[record](path)
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	a, c, meta := "a", "c", `{"k":1}`
+	assert.Equal(t, []record{
+		{ID: 1, Name: &a, At: time.Unix(1, 0).UTC(), Meta: &meta, Score: 1, OK: true},
+		{ID: 2, At: time.Unix(2, 0).UTC(), Score: 2.5},
+		{ID: 3, Name: &c, At: time.Unix(3, 0).UTC(), Score: 3, OK: true},
+	}, rows)
+}
+
+func TestParquetCompressesPages(t *testing.T) {
+	for compression, codec := range map[Compression]format.CompressionCodec{
+		CompressionNone:   format.Uncompressed,
+		CompressionSnappy: format.Snappy,
+		CompressionGzip:   format.Gzip,
+		CompressionZstd:   format.Zstd,
+	} {
+		t.Run(string(compression), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "out.parquet")
+			table_ := types.NewTable()
+			table_.AddRows(
+				types.NewRow(types.MRP("a", 1), types.MRP("b", "x")),
+				types.NewRow(types.MRP("a", 2), types.MRP("b", "y")),
+			)
+			of := NewOutputFormatter(WithOutputFile(path), WithCompression(compression))
+			require.NoError(t, of.OutputTable(context.Background(), table_, &bytes.Buffer{}))
+
+			file := openFile(t, path)
+			for _, chunk := range file.Metadata().RowGroups[0].Columns {
+				assert.Equal(t, codec, chunk.MetaData.Codec)
+			}
+
+			rows, err := parquet.ReadFile[struct {
+				A int64  `parquet:"a"`
+				B string `parquet:"b"`
+			}](path)
+			require.NoError(t, err)
+			require.Len(t, rows, 2)
+			assert.Equal(t, int64(2), rows[1].A)
+			assert.Equal(t, "y", rows[1].B)
+		})
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	for _, s := range []string{"none", "snappy", "gzip", "ZSTD"} {
+		_, err := ParseCompression(s)
+		assert.NoError(t, err, s)
+	}
+	_, err := ParseCompression("lzo")
+	assert.Error(t, err)
+}
+
+func TestParquetRequiresOutputFile(t *testing.T) {
+	err := NewOutputFormatter().OutputTable(context.Background(), types.NewTable(), &bytes.Buffer{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,377 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/formatters"
+	"github.com/go-go-golems/glazed/pkg/helpers/cast"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+	_ "modernc.org/sqlite"
+)
+
+// maxVariables is the number of parameters SQLite accepts in one statement.
+const maxVariables = 32766
+
+// OutputFormatter inserts a table into a table of a SQLite database, creating
+// the database and the table if they don't exist. The column types of a new
+// table are inferred from the values: INTEGER, REAL, BOOLEAN, TIMESTAMP or
+// TEXT. Columns missing from an existing table are added to it. Nested
+// objects and lists are stored as JSON.
+//
+// All the rows are inserted in a single transaction, with multi-row INSERT
+// statements of BatchSize rows.
+type OutputFormatter struct {
+	OutputFile string
+	TableName  string
+	// Indexes lists the columns to index, if they aren't already.
+	Indexes   []types.FieldName
+	BatchSize int
+}
+
+var _ formatters.TableOutputFormatter = (*OutputFormatter)(nil)
+
+type OutputFormatterOption func(*OutputFormatter)
+
+func WithOutputFile(outputFile string) OutputFormatterOption {
+	return func(f *OutputFormatter) {
+		f.OutputFile = outputFile
+	}
+}
+
+// WithTableName sets the table the rows are inserted into, "data" by default.
+func WithTableName(tableName string) OutputFormatterOption {
+	return func(f *OutputFormatter) {
+		f.TableName = tableName
+	}
+}
+
+func WithIndexes(columns ...types.FieldName) OutputFormatterOption {
+	return func(f *OutputFormatter) {
+		f.Indexes = columns
+	}
+}
+
+// WithBatchSize sets the number of rows inserted per statement, 500 by
+// default.
+func WithBatchSize(batchSize int) OutputFormatterOption {
+	return func(f *OutputFormatter) {
+		f.BatchSize = batchSize
+	}
+}
+
+func NewOutputFormatter(opts ...OutputFormatterOption) *OutputFormatter {
+	f := &OutputFormatter{
+		TableName: "data",
+		BatchSize: 500,
+	}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	return f
+}
+
+func (f *OutputFormatter) ContentType() string {
+	return "application/vnd.sqlite3"
+}
+
+func (f *OutputFormatter) Close(ctx context.Context, w io.Writer) error {
+	return nil
+}
+
+func (f *OutputFormatter) RegisterTableMiddlewares(mw *middlewares.TableProcessor) error {
+	return nil
+}
+
+func (f *OutputFormatter) RegisterRowMiddlewares(mw *middlewares.TableProcessor) error {
+	return nil
+}
+
+func (f *OutputFormatter) OutputTable(ctx context.Context, table_ *types.Table, w io.Writer) error {
+	if f.OutputFile == "" {
+		return errors.New("sqlite output requires an output file")
+	}
+	if f.TableName == "" {
+		return errors.New("sqlite output requires a table name")
+	}
+
+	db, err := sql.Open("sqlite", f.OutputFile)
+	if err != nil {
+		return errors.Wrapf(err, "could not open %s", f.OutputFile)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := f.insert(ctx, tx, table_); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(w, "Wrote %d rows to table %s of %s\n", len(table_.Rows), f.TableName, f.OutputFile)
+	return nil
+}
+
+func (f *OutputFormatter) insert(ctx context.Context, tx *sql.Tx, table_ *types.Table) error {
+	if len(table_.Columns) == 0 {
+		return nil
+	}
+
+	existing, err := tableColumns(ctx, tx, f.TableName)
+	if err != nil {
+		return err
+	}
+	if len(existing) == 0 {
+		definitions := make([]string, len(table_.Columns))
+		for i, column := range table_.Columns {
+			definitions[i] = quoteIdentifier(column) + " " + columnType(table_, column)
+		}
+		q := fmt.Sprintf("CREATE TABLE %s (%s)", quoteIdentifier(f.TableName), strings.Join(definitions, ", "))
+		if _, err := tx.ExecContext(ctx, q); err != nil {
+			return errors.Wrapf(err, "could not create table %s", f.TableName)
+		}
+	} else {
+		for _, column := range table_.Columns {
+			if existing[strings.ToLower(column)] {
+				continue
+			}
+			q := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s",
+				quoteIdentifier(f.TableName), quoteIdentifier(column), columnType(table_, column))
+			if _, err := tx.ExecContext(ctx, q); err != nil {
+				return errors.Wrapf(err, "could not add column %s to table %s", column, f.TableName)
+			}
+		}
+	}
+
+	for _, column := range f.Indexes {
+		q := fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)",
+			quoteIdentifier("idx_"+f.TableName+"_"+column), quoteIdentifier(f.TableName), quoteIdentifier(column))
+		if _, err := tx.ExecContext(ctx, q); err != nil {
+			return errors.Wrapf(err, "could not index column %s", column)
+		}
+	}
+
+	batchSize := f.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	if maxRows := maxVariables / len(table_.Columns); batchSize > maxRows {
+		batchSize = maxRows
+	}
+
+	var stmt *sql.Stmt
+	defer func() {
+		if stmt != nil {
+			_ = stmt.Close()
+		}
+	}()
+	stmtRows := 0
+	args := make([]interface{}, 0, batchSize*len(table_.Columns))
+	for start := 0; start < len(table_.Rows); start += batchSize {
+		end := start + batchSize
+		if end > len(table_.Rows) {
+			end = len(table_.Rows)
+		}
+		if stmt == nil || stmtRows != end-start {
+			if stmt != nil {
+				_ = stmt.Close()
+			}
+			stmtRows = end - start
+			stmt, err = tx.PrepareContext(ctx, f.insertStatement(table_.Columns, stmtRows))
+			if err != nil {
+				return err
+			}
+		}
+
+		args = args[:0]
+		for _, row := range table_.Rows[start:end] {
+			for _, column := range table_.Columns {
+				v, _ := row.Get(column)
+				arg, err := sqlValue(v)
+				if err != nil {
+					return errors.Wrapf(err, "could not insert column %s", column)
+				}
+				args = append(args, arg)
+			}
+		}
+		if _, err := stmt.ExecContext(ctx, args...); err != nil {
+			return errors.Wrapf(err, "could not insert into table %s", f.TableName)
+		}
+	}
+
+	return nil
+}
+
+func (f *OutputFormatter) insertStatement(columns []types.FieldName, rows int) string {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = quoteIdentifier(column)
+	}
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "INSERT INTO %s (%s) VALUES ", quoteIdentifier(f.TableName), strings.Join(quoted, ", "))
+	for i := 0; i < rows; i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(placeholders)
+	}
+	return b.String()
+}
+
+// tableColumns returns the lowercased columns of a table, or nothing if the
+// table doesn't exist.
+func tableColumns(ctx context.Context, tx *sql.Tx, tableName string) (map[string]bool, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT name FROM pragma_table_info(?)", tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	ret := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		ret[strings.ToLower(name)] = true
+	}
+	return ret, rows.Err()
+}
+
+// columnType infers the type of a column from its non-null values. Columns
+// mixing integers and floats are REAL, columns mixing other types are TEXT.
+func columnType(table_ *types.Table, column types.FieldName) string {
+	ret := ""
+	for _, row := range table_.Rows {
+		v, _ := row.Get(column)
+		t := valueType(v)
+		switch {
+		case t == "":
+		case ret == "":
+			ret = t
+		case ret == t:
+		case (ret == "INTEGER" && t == "REAL") || (ret == "REAL" && t == "INTEGER"):
+			ret = "REAL"
+		default:
+			return "TEXT"
+		}
+	}
+	if ret == "" {
+		return "TEXT"
+	}
+	return ret
+}
+
+func valueType(v interface{}) string {
+	switch v_ := v.(type) {
+	case nil:
+		return ""
+	case bool:
+		return "BOOLEAN"
+	case int, int8, int16, int32, int64, uint8, uint16, uint32:
+		return "INTEGER"
+	case uint:
+		if uint64(v_) <= math.MaxInt64 {
+			return "INTEGER"
+		}
+		return "REAL"
+	case uint64:
+		if v_ <= math.MaxInt64 {
+			return "INTEGER"
+		}
+		return "REAL"
+	case float32, float64:
+		return "REAL"
+	case time.Time, *time.Time:
+		return "TIMESTAMP"
+	case []byte:
+		return "BLOB"
+	}
+	if _, ok := cast.CastNumberInterfaceToFloat[float64](v); ok {
+		return "REAL"
+	}
+	return "TEXT"
+}
+
+// sqlValue converts a value to a type supported by the driver: booleans are
+// stored as 0 or 1, times as RFC 3339 text and nested values as JSON.
+func sqlValue(v interface{}) (interface{}, error) {
+	switch v_ := v.(type) {
+	case nil, string, int64, float64:
+		return v_, nil
+	case bool:
+		if v_ {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case time.Time:
+		return v_.Format(time.RFC3339Nano), nil
+	case *time.Time:
+		if v_ == nil {
+			return nil, nil
+		}
+		return v_.Format(time.RFC3339Nano), nil
+	case int:
+		return int64(v_), nil
+	case int8:
+		return int64(v_), nil
+	case int16:
+		return int64(v_), nil
+	case int32:
+		return int64(v_), nil
+	case uint8:
+		return int64(v_), nil
+	case uint16:
+		return int64(v_), nil
+	case uint32:
+		return int64(v_), nil
+	case uint:
+		if uint64(v_) <= math.MaxInt64 {
+			return int64(v_), nil
+		}
+		return float64(v_), nil
+	case uint64:
+		if v_ <= math.MaxInt64 {
+			return int64(v_), nil
+		}
+		return float64(v_), nil
+	case float32:
+		return float64(v_), nil
+	case []byte:
+		return v_, nil
+	}
+
+	if f, ok := cast.CastNumberInterfaceToFloat[float64](v); ok {
+		return f, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func quoteIdentifier(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
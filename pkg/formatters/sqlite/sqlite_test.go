@@ -0,0 +1,130 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func columnTypes(t *testing.T, db *sql.DB, table string) map[string]string {
+	t.Helper()
+	rows, err := db.Query("SELECT name, type FROM pragma_table_info(?)", table)
+	require.NoError(t, err)
+	defer func() {
+		_ = rows.Close()
+	}()
+	ret := map[string]string{}
+	for rows.Next() {
+		var name, type_ string
+		require.NoError(t, rows.Scan(&name, &type_))
+		ret[name] = type_
+	}
+	require.NoError(t, rows.Err())
+	return ret
+}
+
+func TestSQLiteCreatesTypedTableInBatches(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.db")
+	of := NewOutputFormatter(
+		WithOutputFile(path),
+		WithTableName("jobs"),
+		WithIndexes("name"),
+		WithBatchSize(2),
+	)
+	table_ := types.NewTable()
+	for i := 0; i < 5; i++ {
+		var mixed interface{} = "x"
+		if i == 0 {
+			mixed = 1
+		}
+		table_.AddRows(types.NewRow(
+			types.MRP("name", "job"),
+			types.MRP("count", i),
+			types.MRP("cost", 1.5),
+			types.MRP("ok", i%2 == 0),
+			types.MRP("at", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)),
+			types.MRP("tags", []interface{}{"a"}),
+			types.MRP("mixed", mixed),
+		))
+	}
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, of.OutputTable(context.Background(), table_, buf))
+	assert.Equal(t, "Wrote 5 rows to table jobs of "+path+"\n", buf.String())
+
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	assert.Equal(t, map[string]string{
+		"name":  "TEXT",
+		"count": "INTEGER",
+		"cost":  "REAL",
+		"ok":    "BOOLEAN",
+		"at":    "TIMESTAMP",
+		"tags":  "TEXT",
+		"mixed": "TEXT",
+	}, columnTypes(t, db, "jobs"))
+
+	var count, sum, trues int
+	var tags, at string
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*), SUM(count), SUM(ok), MIN(tags), MIN(CAST(at AS TEXT)) FROM jobs`).
+		Scan(&count, &sum, &trues, &tags, &at))
+	assert.Equal(t, 5, count)
+	assert.Equal(t, 10, sum)
+	assert.Equal(t, 3, trues)
+	assert.Equal(t, `["a"]`, tags)
+	assert.Equal(t, "2024-01-02T03:04:05Z", at)
+
+	var index string
+	require.NoError(t, db.QueryRow(`SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = 'jobs'`).Scan(&index))
+	assert.Equal(t, "idx_jobs_name", index)
+}
+
+func TestSQLiteAppendsAndAddsColumns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.db")
+	ctx := context.Background()
+
+	first := types.NewTable()
+	first.AddRows(types.NewRow(types.MRP("id", 1)))
+	require.NoError(t, NewOutputFormatter(WithOutputFile(path)).OutputTable(ctx, first, &bytes.Buffer{}))
+
+	second := types.NewTable()
+	second.AddRows(types.NewRow(types.MRP("id", 2), types.MRP("name", "b")))
+	require.NoError(t, NewOutputFormatter(WithOutputFile(path)).OutputTable(ctx, second, &bytes.Buffer{}))
+
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	rows, err := db.Query(`SELECT id, name FROM data ORDER BY id`)
+	require.NoError(t, err)
+	defer func() {
+		_ = rows.Close()
+	}()
+	got := []string{}
+	for rows.Next() {
+		var id int
+		var name sql.NullString
+		require.NoError(t, rows.Scan(&id, &name))
+		got = append(got, name.String)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []string{"", "b"}, got)
+}
+
+func TestSQLiteRequiresOutputFile(t *testing.T) {
+	err := NewOutputFormatter().OutputTable(context.Background(), types.NewTable(), &bytes.Buffer{})
+	assert.Error(t, err)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/go-go-golems/glazed/pkg/formatters"
@@ -50,7 +51,9 @@ type OutputFormatter struct {
 	TableStyleFile      string
 	OutputFile          string
 	PrintTableStyle     bool
-	hasOutputHeaders    bool
+	// Caption is rendered below the table.
+	Caption          string
+	hasOutputHeaders bool
 }
 
 func (tof *OutputFormatter) Close(ctx context.Context, w io.Writer) error {
@@ -111,6 +114,12 @@ func WithPrintTableStyle(printTableStyle bool) OutputFormatterOption {
 	}
 }
 
+func WithCaption(caption string) OutputFormatterOption {
+	return func(f *OutputFormatter) {
+		f.Caption = caption
+	}
+}
+
 func NewOutputFormatter(tableFormat string, opts ...OutputFormatterOption) *OutputFormatter {
 	f := &OutputFormatter{
 		TableFormat: tableFormat,
@@ -134,6 +143,8 @@ func (tof *OutputFormatter) ContentType() string {
 		return "text/csv"
 	case "html":
 		return "text/html"
+	case "markdown":
+		return "text/markdown"
 	default:
 		return "text/plain"
 	}
@@ -230,7 +241,7 @@ func (tof *OutputFormatter) outputMarkdownRow(row_ types.Row, w io.Writer) error
 	}
 
 	for pair := row_.Oldest(); pair != nil; pair = pair.Next() {
-		_, err := fmt.Fprintf(w, "| %s ", pair.Value)
+		_, err := fmt.Fprintf(w, "| %s ", escapeMarkdownCell(valueToString(pair.Value)))
 		if err != nil {
 			return err
 		}
@@ -291,6 +302,9 @@ func (tof *OutputFormatter) makeTable(table_ *types.Table, rows []types.Row, w i
 	headers, _ := cast.CastList[interface{}](table_.Columns)
 
 	t.AppendHeader(headers)
+	if tof.Caption != "" {
+		t.SetCaption(tof.Caption)
+	}
 	for _, row := range rows {
 		var row_ []interface{}
 		for _, column := range table_.Columns {
@@ -298,6 +312,10 @@ func (tof *OutputFormatter) makeTable(table_ *types.Table, rows []types.Row, w i
 			if v, ok := row.Get(column); ok {
 				s = valueToString(v)
 			}
+			if tof.TableFormat == "markdown" {
+				// go-pretty only escapes \n
+				s = strings.ReplaceAll(s, "\r\n", "\n")
+			}
 			row_ = append(row_, s)
 		}
 		t.AppendRow(row_)
@@ -305,7 +323,14 @@ func (tof *OutputFormatter) makeTable(table_ *types.Table, rows []types.Row, w i
 
 	switch tof.TableFormat {
 	case "markdown":
-		s := t.RenderMarkdown()
+		// values are rendered as strings, so go-pretty can't align numbers
+		// by itself
+		columnConfigs := []table.ColumnConfig{}
+		for i, align := range markdownAlignments(table_.Columns, rows) {
+			columnConfigs = append(columnConfigs, table.ColumnConfig{Number: i + 1, Align: align})
+		}
+		t.SetColumnConfigs(columnConfigs)
+		s := t.RenderMarkdown() + "\n"
 		_, err := w.Write([]byte(s))
 		if err != nil {
 			return err
@@ -352,6 +377,55 @@ func (tof *OutputFormatter) makeTable(table_ *types.Table, rows []types.Row, w i
 	}
 }
 
+// markdownAlignments right-aligns the columns holding only numbers, including
+// numeric strings such as CSV cells, and centers the columns holding only
+// booleans. Other columns, and columns holding only nulls, use the default
+// alignment.
+func markdownAlignments(columns []types.FieldName, rows []types.Row) []text.Align {
+	ret := make([]text.Align, len(columns))
+	for i, column := range columns {
+		numbers, booleans, values := 0, 0, 0
+		for _, row := range rows {
+			v, ok := row.Get(column)
+			if !ok || v == nil {
+				continue
+			}
+			values++
+			switch v_ := v.(type) {
+			case bool:
+				booleans++
+			case string:
+				if _, err := strconv.ParseFloat(strings.TrimSpace(v_), 64); err == nil {
+					numbers++
+				}
+			default:
+				if _, ok := cast.CastNumberInterfaceToFloat[float64](v); ok {
+					numbers++
+				}
+			}
+		}
+		switch {
+		case values == 0:
+			ret[i] = text.AlignDefault
+		case numbers == values:
+			ret[i] = text.AlignRight
+		case booleans == values:
+			ret[i] = text.AlignCenter
+		default:
+			ret[i] = text.AlignDefault
+		}
+	}
+	return ret
+}
+
+// escapeMarkdownCell escapes the pipes and newlines of a GitHub-flavored
+// markdown table cell, as go-pretty does when rendering a whole table.
+func escapeMarkdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	s = strings.ReplaceAll(s, "\r\n", "<br/>")
+	return strings.ReplaceAll(s, "\n", "<br/>")
+}
+
 func valueToString(v types.GenericCellValue) string {
 	var s string
 	switch v_ := v.(type) {
@@ -32,5 +32,23 @@ func TestTableRenameEndToEnd(t *testing.T) {
 	require.NoError(t, err)
 
 	// parse s
-	assert.Equal(t, "| b |\n| --- |\n| 1 |", buf.String())
+	assert.Equal(t, "| b |\n| ---:|\n| 1 |\n", buf.String())
+}
+
+func TestMarkdownAlignsAndEscapesCells(t *testing.T) {
+	of := NewOutputFormatter("markdown", WithCaption("Jobs"))
+	table_ := types.NewTable()
+	table_.AddRows(
+		types.NewRow(types.MRP("name", "a|b"), types.MRP("cost", "1.5"), types.MRP("ok", true), types.MRP("note", nil)),
+		types.NewRow(types.MRP("name", "line\r\nbreak"), types.MRP("cost", 2), types.MRP("ok", false), types.MRP("note", nil)),
+	)
+	table_.Columns = []types.FieldName{"name", "cost", "ok", "note"}
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, of.OutputTable(context.Background(), table_, buf))
+	assert.Equal(t, "| name | cost | ok | note |\n"+
+		"| --- | ---:|:---:| --- |\n"+
+		"| a\\|b | 1.5 | true | <nil> |\n"+
+		"| line<br/>break | 2 | false | <nil> |\n"+
+		"_Jobs_\n", buf.String())
 }
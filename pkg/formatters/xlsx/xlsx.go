@@ -0,0 +1,486 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-go-golems/glazed/pkg/formatters"
+	"github.com/go-go-golems/glazed/pkg/helpers/cast"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// OutputFormatter writes a table to an Excel workbook. Numbers, booleans and
+// times are written as typed cells, nested objects and lists as JSON strings.
+// The header row is bold and frozen, and columns are sized to their content.
+//
+// Workbooks are binary, so they are written to OutputFile and never to the
+// output stream.
+type OutputFormatter struct {
+	OutputFile string
+	// SheetName is the name of the sheet when the table isn't split, "Sheet1"
+	// by default.
+	SheetName string
+	// SheetColumn splits the table into one sheet per value of the column,
+	// in the order in which the values are first seen. The column itself is
+	// left out of the sheets.
+	SheetColumn types.FieldName
+}
+
+var _ formatters.TableOutputFormatter = (*OutputFormatter)(nil)
+
+type OutputFormatterOption func(*OutputFormatter)
+
+func WithOutputFile(outputFile string) OutputFormatterOption {
+	return func(f *OutputFormatter) {
+		f.OutputFile = outputFile
+	}
+}
+
+func WithSheetName(name string) OutputFormatterOption {
+	return func(f *OutputFormatter) {
+		f.SheetName = name
+	}
+}
+
+func WithSheetColumn(column types.FieldName) OutputFormatterOption {
+	return func(f *OutputFormatter) {
+		f.SheetColumn = column
+	}
+}
+
+func NewOutputFormatter(opts ...OutputFormatterOption) *OutputFormatter {
+	f := &OutputFormatter{}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	return f
+}
+
+func (f *OutputFormatter) ContentType() string {
+	return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+}
+
+func (f *OutputFormatter) Close(ctx context.Context, w io.Writer) error {
+	return nil
+}
+
+func (f *OutputFormatter) RegisterTableMiddlewares(mw *middlewares.TableProcessor) error {
+	return nil
+}
+
+func (f *OutputFormatter) RegisterRowMiddlewares(mw *middlewares.TableProcessor) error {
+	return nil
+}
+
+func (f *OutputFormatter) OutputTable(ctx context.Context, table_ *types.Table, w io.Writer) error {
+	if f.OutputFile == "" {
+		return errors.New("xlsx output requires an output file")
+	}
+
+	sheets := f.sheets(table_)
+
+	f_, err := os.Create(f.OutputFile)
+	if err != nil {
+		return err
+	}
+	err = WriteWorkbook(f_, sheets...)
+	if closeErr := f_.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(w, "Wrote output to %s\n", f.OutputFile)
+	return nil
+}
+
+func (f *OutputFormatter) sheets(table_ *types.Table) []Sheet {
+	if f.SheetColumn == "" {
+		name := f.SheetName
+		if name == "" {
+			name = "Sheet1"
+		}
+		return []Sheet{{Name: name, Table: table_}}
+	}
+
+	columns := []types.FieldName{}
+	for _, column := range table_.Columns {
+		if column != f.SheetColumn {
+			columns = append(columns, column)
+		}
+	}
+
+	ret := []Sheet{}
+	index := map[string]int{}
+	for _, row := range table_.Rows {
+		v, _ := row.Get(f.SheetColumn)
+		name := "null"
+		if v != nil {
+			name = fmt.Sprint(v)
+		}
+		i, ok := index[name]
+		if !ok {
+			i = len(ret)
+			index[name] = i
+			ret = append(ret, Sheet{Name: name, Table: &types.Table{Columns: columns}})
+		}
+		ret[i].Table.Rows = append(ret[i].Table.Rows, row)
+	}
+	if len(ret) == 0 {
+		name := f.SheetName
+		if name == "" {
+			name = "Sheet1"
+		}
+		ret = append(ret, Sheet{Name: name, Table: &types.Table{Columns: columns}})
+	}
+	return ret
+}
+
+// Sheet is a named table of a workbook.
+type Sheet struct {
+	Name  string
+	Table *types.Table
+}
+
+// maxSheetRows is the number of rows of an Excel sheet, including the header.
+const maxSheetRows = 1_048_576
+
+// automatic column widths are kept between minColumnWidth and maxColumnWidth
+// characters
+const (
+	minColumnWidth = 8
+	maxColumnWidth = 80
+)
+
+// cell styles, indexing the cellXfs of styles.xml
+const (
+	styleDefault = 0
+	styleHeader  = 1
+	styleTime    = 2
+)
+
+// WriteWorkbook writes sheets as an Excel workbook to w. Sheet names are
+// shortened to 31 characters, stripped of the characters Excel rejects and
+// made unique.
+func WriteWorkbook(w io.Writer, sheets ...Sheet) error {
+	if len(sheets) == 0 {
+		return errors.New("a workbook needs at least one sheet")
+	}
+	names := sheetNames(sheets)
+
+	z := zip.NewWriter(w)
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", contentTypesXML(len(sheets))},
+		{"_rels/.rels", rootRelsXML},
+		{"xl/workbook.xml", workbookXML(names)},
+		{"xl/_rels/workbook.xml.rels", workbookRelsXML(len(sheets))},
+		{"xl/styles.xml", stylesXML},
+	}
+	for _, file := range files {
+		fw, err := z.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, file.content); err != nil {
+			return err
+		}
+	}
+
+	for i, sheet := range sheets {
+		fw, err := z.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1))
+		if err != nil {
+			return err
+		}
+		if err := writeSheet(fw, sheet.Table); err != nil {
+			return errors.Wrapf(err, "could not write sheet %s", names[i])
+		}
+	}
+
+	return z.Close()
+}
+
+type cell struct {
+	value string
+	// typ is the t attribute of the cell: "n" for numbers and times, "b" for
+	// booleans and "inlineStr" for strings.
+	typ   string
+	style int
+	width int
+}
+
+func newCell(v interface{}) (cell, bool, error) {
+	switch v_ := v.(type) {
+	case nil:
+		return cell{}, false, nil
+	case string:
+		return stringCell(v_), true, nil
+	case bool:
+		if v_ {
+			return cell{value: "1", typ: "b", width: 5}, true, nil
+		}
+		return cell{value: "0", typ: "b", width: 5}, true, nil
+	case time.Time:
+		return timeCell(v_), true, nil
+	case *time.Time:
+		if v_ == nil {
+			return cell{}, false, nil
+		}
+		return timeCell(*v_), true, nil
+	case map[string]interface{}, []interface{}, types.Row:
+		b, err := json.Marshal(v_)
+		if err != nil {
+			return cell{}, false, err
+		}
+		return stringCell(string(b)), true, nil
+	}
+
+	if n, ok := cast.CastNumberInterfaceToFloat[float64](v); ok {
+		if math.IsNaN(n) || math.IsInf(n, 0) {
+			return stringCell(fmt.Sprint(v)), true, nil
+		}
+		s := strconv.FormatFloat(n, 'g', -1, 64)
+		return cell{value: s, typ: "n", width: len(s)}, true, nil
+	}
+	if l, err := cast.CastListToInterfaceList(v); err == nil {
+		b, err := json.Marshal(l)
+		if err != nil {
+			return cell{}, false, err
+		}
+		return stringCell(string(b)), true, nil
+	}
+	return stringCell(fmt.Sprint(v)), true, nil
+}
+
+func stringCell(s string) cell {
+	width := 0
+	for _, line := range strings.Split(s, "\n") {
+		if n := utf8.RuneCountInString(line); n > width {
+			width = n
+		}
+	}
+	return cell{value: s, typ: "inlineStr", width: width}
+}
+
+// timeCell writes t as an Excel serial date, the number of days since
+// 1899-12-30, keeping its wall clock as Excel has no time zones.
+func timeCell(t time.Time) cell {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	seconds := float64(wall.Unix()-epoch.Unix()) + float64(wall.Nanosecond())/1e9
+	days := seconds / (24 * 60 * 60)
+	return cell{value: strconv.FormatFloat(days, 'f', -1, 64), typ: "n", style: styleTime, width: 19}
+}
+
+func writeSheet(w io.Writer, table_ *types.Table) error {
+	if len(table_.Rows)+1 > maxSheetRows {
+		return errors.Errorf("%d rows don't fit in a sheet of %d rows", len(table_.Rows), maxSheetRows-1)
+	}
+
+	widths := make([]int, len(table_.Columns))
+	rows := make([][]*cell, 0, len(table_.Rows)+1)
+
+	header := make([]*cell, len(table_.Columns))
+	for i, column := range table_.Columns {
+		c := stringCell(column)
+		c.style = styleHeader
+		header[i] = &c
+		widths[i] = c.width
+	}
+	rows = append(rows, header)
+
+	for _, row := range table_.Rows {
+		cells := make([]*cell, len(table_.Columns))
+		for i, column := range table_.Columns {
+			v, _ := row.Get(column)
+			c, ok, err := newCell(v)
+			if err != nil {
+				return errors.Wrapf(err, "could not write column %s", column)
+			}
+			if !ok {
+				continue
+			}
+			cells[i] = &c
+			if c.width > widths[i] {
+				widths[i] = c.width
+			}
+		}
+		rows = append(rows, cells)
+	}
+
+	b := &strings.Builder{}
+	b.WriteString(xml.Header)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	if len(widths) > 0 {
+		b.WriteString(`<cols>`)
+		for i, width := range widths {
+			width += 2
+			if width < minColumnWidth {
+				width = minColumnWidth
+			}
+			if width > maxColumnWidth {
+				width = maxColumnWidth
+			}
+			fmt.Fprintf(b, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, i+1, i+1, width)
+		}
+		b.WriteString(`</cols>`)
+	}
+	b.WriteString(`<sheetData>`)
+	for r, cells := range rows {
+		fmt.Fprintf(b, `<row r="%d">`, r+1)
+		for i, c := range cells {
+			if c == nil {
+				continue
+			}
+			ref := columnName(i) + strconv.Itoa(r+1)
+			fmt.Fprintf(b, `<c r="%s" t="%s"`, ref, c.typ)
+			if c.style != styleDefault {
+				fmt.Fprintf(b, ` s="%d"`, c.style)
+			}
+			b.WriteString(`>`)
+			if c.typ == "inlineStr" {
+				b.WriteString(`<is><t xml:space="preserve">`)
+				if err := xml.EscapeText(b, []byte(c.value)); err != nil {
+					return err
+				}
+				b.WriteString(`</t></is>`)
+			} else {
+				b.WriteString(`<v>` + c.value + `</v>`)
+			}
+			b.WriteString(`</c>`)
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData></worksheet>`)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// columnName returns the letters of the i-th column, starting at 0: A, B, ...,
+// Z, AA, AB, ...
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+func sheetNames(sheets []Sheet) []string {
+	ret := make([]string, len(sheets))
+	seen := map[string]bool{}
+	for i, sheet := range sheets {
+		name := strings.Map(func(r rune) rune {
+			if strings.ContainsRune(`[]:*?/\`, r) {
+				return '_'
+			}
+			return r
+		}, strings.TrimSpace(sheet.Name))
+		name = strings.Trim(name, "'")
+		if name == "" {
+			name = fmt.Sprintf("Sheet%d", i+1)
+		}
+		name = truncateRunes(name, 31)
+
+		unique := name
+		for n := 2; seen[strings.ToLower(unique)]; n++ {
+			suffix := fmt.Sprintf(" (%d)", n)
+			unique = truncateRunes(name, 31-len(suffix)) + suffix
+		}
+		seen[strings.ToLower(unique)] = true
+		ret[i] = unique
+	}
+	return ret
+}
+
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
+
+func escapeAttr(s string) string {
+	b := &strings.Builder{}
+	_ = xml.EscapeText(b, []byte(s))
+	return b.String()
+}
+
+func contentTypesXML(sheets int) string {
+	b := &strings.Builder{}
+	b.WriteString(xml.Header)
+	b.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	b.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	b.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	b.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	b.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(b, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i)
+	}
+	b.WriteString(`</Types>`)
+	return b.String()
+}
+
+const rootRelsXML = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+func workbookXML(names []string) string {
+	b := &strings.Builder{}
+	b.WriteString(xml.Header)
+	b.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">`)
+	b.WriteString(`<sheets>`)
+	for i, name := range names {
+		fmt.Fprintf(b, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escapeAttr(name), i+1, i+1)
+	}
+	b.WriteString(`</sheets></workbook>`)
+	return b.String()
+}
+
+// workbookRelsXML links the sheets as rId1 to rIdN and the styles as rIdN+1.
+func workbookRelsXML(sheets int) string {
+	b := &strings.Builder{}
+	b.WriteString(xml.Header)
+	b.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i, i)
+	}
+	fmt.Fprintf(b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, sheets+1)
+	b.WriteString(`</Relationships>`)
+	return b.String()
+}
+
+// stylesXML defines the cell styles styleDefault, styleHeader and styleTime.
+const stylesXML = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="3">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`</cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
@@ -0,0 +1,112 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readWorkbook(t *testing.T, path string) map[string]string {
+	t.Helper()
+	r, err := zip.OpenReader(path)
+	require.NoError(t, err)
+	defer func() {
+		_ = r.Close()
+	}()
+
+	ret := map[string]string{}
+	for _, f := range r.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		b, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		_ = rc.Close()
+		ret[f.Name] = string(b)
+	}
+	return ret
+}
+
+func TestXLSXWritesTypedCells(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.xlsx")
+	of := NewOutputFormatter(WithOutputFile(path))
+	table_ := types.NewTable()
+	table_.AddRows(
+		types.NewRow(
+			types.MRP("name", "a<b"),
+			types.MRP("cost", 1.5),
+			types.MRP("ok", true),
+			types.MRP("at", time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)),
+			types.MRP("tags", []interface{}{"x"}),
+			types.MRP("note", nil),
+		),
+	)
+	table_.Columns = []types.FieldName{"name", "cost", "ok", "at", "tags", "note"}
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, of.OutputTable(context.Background(), table_, buf))
+	assert.Equal(t, "Wrote output to "+path+"\n", buf.String())
+
+	files := readWorkbook(t, path)
+	assert.Contains(t, files["xl/workbook.xml"], `<sheet name="Sheet1" sheetId="1" r:id="rId1"/>`)
+	sheet := files["xl/worksheets/sheet1.xml"]
+	assert.Contains(t, sheet, `<pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/>`)
+	assert.Contains(t, sheet, `<c r="A1" t="inlineStr" s="1"><is><t xml:space="preserve">name</t></is></c>`)
+	assert.Contains(t, sheet, `<c r="A2" t="inlineStr"><is><t xml:space="preserve">a&lt;b</t></is></c>`)
+	assert.Contains(t, sheet, `<c r="B2" t="n"><v>1.5</v></c>`)
+	assert.Contains(t, sheet, `<c r="C2" t="b"><v>1</v></c>`)
+	assert.Contains(t, sheet, `<c r="D2" t="n" s="2"><v>45293.5</v></c>`)
+	assert.Contains(t, sheet, `<c r="E2" t="inlineStr"><is><t xml:space="preserve">[&#34;x&#34;]</t></is></c>`)
+	assert.NotContains(t, sheet, `r="F2"`)
+	assert.Contains(t, sheet, `<col min="1" max="1" width="8" customWidth="1"/>`)
+	assert.Contains(t, sheet, `<col min="4" max="4" width="21" customWidth="1"/>`)
+}
+
+func TestXLSXSplitsSheetsByColumn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.xlsx")
+	of := NewOutputFormatter(WithOutputFile(path), WithSheetColumn("region"))
+	table_ := types.NewTable()
+	table_.AddRows(
+		types.NewRow(types.MRP("region", "eu/west"), types.MRP("n", 1)),
+		types.NewRow(types.MRP("region", "us"), types.MRP("n", 2)),
+		types.NewRow(types.MRP("region", "eu/west"), types.MRP("n", 3)),
+	)
+
+	require.NoError(t, of.OutputTable(context.Background(), table_, &bytes.Buffer{}))
+	files := readWorkbook(t, path)
+	assert.Contains(t, files["xl/workbook.xml"], `<sheet name="eu_west" sheetId="1" r:id="rId1"/><sheet name="us" sheetId="2" r:id="rId2"/>`)
+	assert.Contains(t, files["xl/worksheets/sheet1.xml"], `<c r="A3" t="n"><v>3</v></c>`)
+	assert.NotContains(t, files["xl/worksheets/sheet1.xml"], "region")
+	assert.Contains(t, files["xl/worksheets/sheet2.xml"], `<c r="A2" t="n"><v>2</v></c>`)
+}
+
+func TestXLSXRequiresOutputFile(t *testing.T) {
+	of := NewOutputFormatter()
+	err := of.OutputTable(context.Background(), types.NewTable(), &bytes.Buffer{})
+	assert.Error(t, err)
+}
+
+func TestSheetNamesAreUnique(t *testing.T) {
+	names := sheetNames([]Sheet{
+		{Name: "Data"},
+		{Name: "data"},
+		{Name: ""},
+		{Name: "a very long sheet name that excel would reject"},
+	})
+	assert.Equal(t, []string{"Data", "data (2)", "Sheet3", "a very long sheet name that exc"}, names)
+}
+
+func TestColumnName(t *testing.T) {
+	assert.Equal(t, "A", columnName(0))
+	assert.Equal(t, "Z", columnName(25))
+	assert.Equal(t, "AA", columnName(26))
+	assert.Equal(t, "AZ", columnName(51))
+	assert.Equal(t, "BA", columnName(52))
+}
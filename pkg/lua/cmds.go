@@ -37,12 +37,11 @@ func CallGlazedCommandFromLua(L *lua2.LState, cmd cmds.GlazeCommand, luaTable *l
 		return nil, fmt.Errorf("error executing middlewares: %v", err)
 	}
 
-	structuredOutputValues, ok := parsedValues.Get(settings.StructuredOutputSlug)
-	if !ok {
+	if _, ok := parsedValues.Get(settings.StructuredOutputSlug); !ok {
 		return nil, fmt.Errorf("structured output section not found")
 	}
-	gp, _, err := settings.SetupStructuredProcessor(
-		structuredOutputValues,
+	gp, _, err := settings.SetupStructuredProcessorFromValues(
+		parsedValues,
 		middlewares2.WithTableMiddleware(&table.NullTableMiddleware{}),
 	)
 	if err != nil {
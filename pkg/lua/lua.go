@@ -2,15 +2,13 @@ package lua
 
 import (
 	"fmt"
-	"reflect"
 	"strings"
-	"time"
 
 	"github.com/go-go-golems/glazed/pkg/cmds/fields"
 	"github.com/go-go-golems/glazed/pkg/cmds/schema"
 	"github.com/go-go-golems/glazed/pkg/cmds/sources"
 	"github.com/go-go-golems/glazed/pkg/cmds/values"
-	"github.com/go-go-golems/glazed/pkg/helpers/cast"
+	luamiddlewares "github.com/go-go-golems/glazed/pkg/middlewares/lua"
 	"github.com/go-go-golems/glazed/pkg/types"
 	lua "github.com/yuin/gopher-lua"
 )
@@ -277,140 +275,18 @@ func ParseFieldFromLua(L *lua.LState, value lua.LValue, fieldDef *fields.Definit
 }
 
 // LuaValueToInterface converts a Lua value to a Go interface{}
-
 func LuaValueToInterface(L *lua.LState, value lua.LValue) interface{} {
-	switch v := value.(type) {
-	case *lua.LNilType:
-		return nil
-	case lua.LBool:
-		return bool(v)
-	case lua.LNumber:
-		return float64(v)
-	case lua.LString:
-		return string(v)
-	case *lua.LTable:
-		maxn := v.MaxN()
-		if maxn == 0 { // Table is a map
-			result := make(map[string]interface{})
-			v.ForEach(func(key, value lua.LValue) {
-				result[key.String()] = LuaValueToInterface(L, value)
-			})
-			return result
-		} else { // Table is an array
-			result := make([]interface{}, 0, maxn)
-			for i := 1; i <= maxn; i++ {
-				result = append(result, LuaValueToInterface(L, v.RawGetInt(i)))
-			}
-			return result
-		}
-	default:
-		return v.String()
-	}
+	return luamiddlewares.LuaValueToInterface(L, value)
 }
 
 // GlazedTableToLuaTable converts a Glazed table to a Lua table
 func GlazedTableToLuaTable(L *lua.LState, glazedTable *types.Table) *lua.LTable {
-	luaTable := L.CreateTable(len(glazedTable.Rows), 0)
-
-	for i, row := range glazedTable.Rows {
-		rowTable := L.CreateTable(0, len(glazedTable.Columns))
-		for _, col := range glazedTable.Columns {
-			value, ok := row.Get(col)
-			if !ok {
-				continue
-			}
-			rowTable.RawSetString(col, InterfaceToLuaValue(L, value))
-		}
-		luaTable.RawSetInt(i+1, rowTable)
-	}
-
-	return luaTable
+	return luamiddlewares.GlazedTableToLuaTable(L, glazedTable)
 }
 
 // InterfaceToLuaValue converts a Go interface{} to a Lua value
 func InterfaceToLuaValue(L *lua.LState, value interface{}) lua.LValue {
-	// Dereference pointers
-	if reflect.ValueOf(value).Kind() == reflect.Ptr {
-		if reflect.ValueOf(value).IsNil() {
-			return lua.LNil
-		}
-		return InterfaceToLuaValue(L, reflect.ValueOf(value).Elem().Interface())
-	}
-
-	// Unwrap interfaces
-	if v := reflect.ValueOf(value); v.Kind() == reflect.Interface && !v.IsNil() {
-		return InterfaceToLuaValue(L, v.Elem().Interface())
-	}
-
-	switch v := value.(type) {
-	case nil:
-		return lua.LNil
-	case bool:
-		return lua.LBool(v)
-	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, uintptr:
-		if n, ok := cast.CastNumberInterfaceToFloat[float64](v); ok {
-			return lua.LNumber(n)
-		}
-	case float32, float64:
-		if n, ok := cast.CastFloatInterfaceToFloat[float64](v); ok {
-			return lua.LNumber(n)
-		}
-	case string:
-		return lua.LString(v)
-	case []byte:
-		return lua.LString(string(v))
-	case time.Time:
-		return lua.LString(v.Format(time.RFC3339))
-	case []interface{}:
-		table := L.CreateTable(len(v), 0)
-		for i, item := range v {
-			table.RawSetInt(i+1, InterfaceToLuaValue(L, item))
-		}
-		return table
-	case map[string]interface{}:
-		table := L.CreateTable(0, len(v))
-		for key, item := range v {
-			table.RawSetString(key, InterfaceToLuaValue(L, item))
-		}
-		return table
-	}
-
-	// Handle slices and arrays
-	if reflect.TypeOf(value).Kind() == reflect.Slice || reflect.TypeOf(value).Kind() == reflect.Array {
-		v := reflect.ValueOf(value)
-		table := L.CreateTable(v.Len(), 0)
-		for i := 0; i < v.Len(); i++ {
-			table.RawSetInt(i+1, InterfaceToLuaValue(L, v.Index(i).Interface()))
-		}
-		return table
-	}
-
-	// Handle maps
-	if reflect.TypeOf(value).Kind() == reflect.Map {
-		v := reflect.ValueOf(value)
-		table := L.CreateTable(0, v.Len())
-		for _, key := range v.MapKeys() {
-			table.RawSet(InterfaceToLuaValue(L, key.Interface()), InterfaceToLuaValue(L, v.MapIndex(key).Interface()))
-		}
-		return table
-	}
-
-	// Handle structs
-	if reflect.TypeOf(value).Kind() == reflect.Struct {
-		v := reflect.ValueOf(value)
-		t := v.Type()
-		table := L.CreateTable(0, v.NumField())
-		for i := 0; i < v.NumField(); i++ {
-			field := t.Field(i)
-			if field.IsExported() {
-				table.RawSetString(field.Name, InterfaceToLuaValue(L, v.Field(i).Interface()))
-			}
-		}
-		return table
-	}
-
-	// Default: convert to string
-	return lua.LString(fmt.Sprintf("%v", value))
+	return luamiddlewares.InterfaceToLuaValue(L, value)
 }
 
 // SectionValuesToLuaTable converts SectionValues to a Lua table.
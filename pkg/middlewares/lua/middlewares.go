@@ -0,0 +1,244 @@
+package lua
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// LuaRowMiddleware calls a Lua function with every row, as a table of columns.
+// The function returns:
+//
+//   - nil or false to drop the row
+//   - true to keep the row it was passed, including the changes it made to it
+//   - a table of columns to replace the row
+//   - a list of such tables to output zero, one or many rows
+//
+// Values are converted with InterfaceToLuaValue and LuaValueToInterface, so
+// numbers come back as float64 and times as RFC3339 strings. Null values are
+// nil in Lua, which removes them from the table, and setting a column to nil
+// removes it from the row. Null columns are kept when the function returns the
+// row it was passed. Columns of the input row keep their order, new columns are
+// appended in alphabetical order.
+//
+// A Lua state can't be used concurrently, so the middleware is not
+// concurrency safe. The caller of NewLuaRowMiddleware owns the state and closes
+// it, while middlewares created by a Script release its state when closed.
+type LuaRowMiddleware struct {
+	state    *lua.LState
+	function *lua.LFunction
+	script   *Script
+}
+
+var _ middlewares.RowMiddleware = (*LuaRowMiddleware)(nil)
+
+func NewLuaRowMiddleware(L *lua.LState, function *lua.LFunction) *LuaRowMiddleware {
+	return &LuaRowMiddleware{
+		state:    L,
+		function: function,
+	}
+}
+
+func (l *LuaRowMiddleware) Process(ctx context.Context, row types.Row) ([]types.Row, error) {
+	columns := types.GetFields(row)
+	nulls := map[types.FieldName]bool{}
+	arg := l.state.CreateTable(0, len(columns))
+	for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+		if pair.Value == nil {
+			nulls[pair.Key] = true
+		}
+		arg.RawSetString(pair.Key, InterfaceToLuaValue(l.state, pair.Value))
+	}
+
+	ret, err := callLuaFunction(l.state, l.function, arg)
+	if err != nil {
+		return nil, fmt.Errorf("error calling row function: %w", err)
+	}
+
+	switch v := ret.(type) {
+	case *lua.LNilType:
+		return []types.Row{}, nil
+	case lua.LBool:
+		if !v {
+			return []types.Row{}, nil
+		}
+		return []types.Row{luaTableToRow(l.state, arg, columns, nulls)}, nil
+	case *lua.LTable:
+		if v == arg {
+			return []types.Row{luaTableToRow(l.state, arg, columns, nulls)}, nil
+		}
+		return luaTableToRows(l.state, v, columns)
+	default:
+		return nil, fmt.Errorf("row function returned %s, expected nil, a boolean, a row or a list of rows", ret.Type())
+	}
+}
+
+func (l *LuaRowMiddleware) ConcurrencySafe() bool {
+	return false
+}
+
+func (l *LuaRowMiddleware) Close(ctx context.Context) error {
+	if l.script != nil {
+		l.script.release()
+		l.script = nil
+	}
+	return nil
+}
+
+// LuaTableMiddleware calls a Lua function with the list of all rows of the
+// table, and replaces them with the list of rows it returns. Rows are
+// converted as by LuaRowMiddleware. Columns of the input table keep their
+// order, new columns are appended in alphabetical order.
+//
+// As for LuaRowMiddleware, the caller of NewLuaTableMiddleware owns the Lua
+// state and closes it.
+type LuaTableMiddleware struct {
+	state    *lua.LState
+	function *lua.LFunction
+	script   *Script
+}
+
+var _ middlewares.TableMiddleware = (*LuaTableMiddleware)(nil)
+
+func NewLuaTableMiddleware(L *lua.LState, function *lua.LFunction) *LuaTableMiddleware {
+	return &LuaTableMiddleware{
+		state:    L,
+		function: function,
+	}
+}
+
+func (l *LuaTableMiddleware) Process(ctx context.Context, table *types.Table) (*types.Table, error) {
+	ret, err := callLuaFunction(l.state, l.function, GlazedTableToLuaTable(l.state, table))
+	if err != nil {
+		return nil, fmt.Errorf("error calling table function: %w", err)
+	}
+
+	var rows []types.Row
+	switch v := ret.(type) {
+	case *lua.LNilType:
+		rows = []types.Row{}
+	case *lua.LTable:
+		rows, err = luaTableToRows(l.state, v, table.Columns)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("table function returned %s, expected a list of rows", ret.Type())
+	}
+
+	newTable := types.NewTable()
+	newTable.AddRows(rows...)
+	seen := map[types.FieldName]bool{}
+	for _, column := range table.Columns {
+		seen[column] = true
+	}
+	columns := []types.FieldName{}
+	for _, column := range table.Columns {
+		if containsColumn(rows, column) {
+			columns = append(columns, column)
+		}
+	}
+	for _, row := range rows {
+		for _, column := range types.GetFields(row) {
+			if !seen[column] {
+				seen[column] = true
+				columns = append(columns, column)
+			}
+		}
+	}
+	newTable.Columns = columns
+	return newTable, nil
+}
+
+func (l *LuaTableMiddleware) Close(ctx context.Context) error {
+	if l.script != nil {
+		l.script.release()
+		l.script = nil
+	}
+	return nil
+}
+
+// LookupLuaFunction returns the global function name of L.
+func LookupLuaFunction(L *lua.LState, name string) (*lua.LFunction, error) {
+	fn, ok := L.GetGlobal(name).(*lua.LFunction)
+	if !ok {
+		return nil, fmt.Errorf("function %s not found in Lua state", name)
+	}
+	return fn, nil
+}
+
+func callLuaFunction(L *lua.LState, fn *lua.LFunction, args ...lua.LValue) (lua.LValue, error) {
+	if err := L.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true}, args...); err != nil {
+		return nil, err
+	}
+	ret := L.Get(-1)
+	L.Pop(1)
+	return ret, nil
+}
+
+// luaTableToRows converts either a single row or a list of rows.
+func luaTableToRows(L *lua.LState, t *lua.LTable, columns []types.FieldName) ([]types.Row, error) {
+	if t.MaxN() == 0 {
+		if isEmptyLuaTable(t) {
+			return []types.Row{}, nil
+		}
+		return []types.Row{luaTableToRow(L, t, columns, nil)}, nil
+	}
+
+	ret := make([]types.Row, 0, t.MaxN())
+	for i := 1; i <= t.MaxN(); i++ {
+		rowTable, ok := t.RawGetInt(i).(*lua.LTable)
+		if !ok {
+			return nil, fmt.Errorf("row %d returned by Lua is a %s, expected a table", i, t.RawGetInt(i).Type())
+		}
+		ret = append(ret, luaTableToRow(L, rowTable, columns, nil))
+	}
+	return ret, nil
+}
+
+// luaTableToRow converts a table of columns to a row, putting columns first
+// and the remaining keys in alphabetical order. The columns in nulls are set to
+// null if they are missing from the table.
+func luaTableToRow(L *lua.LState, t *lua.LTable, columns []types.FieldName, nulls map[types.FieldName]bool) types.Row {
+	values := map[string]interface{}{}
+	t.ForEach(func(key, value lua.LValue) {
+		values[key.String()] = LuaValueToInterface(L, value)
+	})
+
+	ret := types.NewRow()
+	for _, column := range columns {
+		if v, ok := values[column]; ok {
+			ret.Set(column, v)
+			delete(values, column)
+		} else if nulls[column] {
+			ret.Set(column, nil)
+		}
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		ret.Set(key, values[key])
+	}
+	return ret
+}
+
+func isEmptyLuaTable(t *lua.LTable) bool {
+	key, _ := t.Next(lua.LNil)
+	return key == lua.LNil
+}
+
+func containsColumn(rows []types.Row, column types.FieldName) bool {
+	for _, row := range rows {
+		if _, ok := row.Get(column); ok {
+			return true
+		}
+	}
+	return false
+}
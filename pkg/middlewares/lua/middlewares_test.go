@@ -0,0 +1,149 @@
+package lua
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	assert2 "github.com/go-go-golems/glazed/pkg/helpers/assert"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+)
+
+const testScript = `
+function process_row(row)
+  if row.cost == nil then
+    return false
+  end
+  if row.split then
+    return { { name = row.name, part = 1 }, { name = row.name, part = 2 } }
+  end
+  row.double = row.cost * 2
+  return true
+end
+
+function process_table(rows)
+  local total = 0
+  for _, row in ipairs(rows) do
+    total = total + row.cost
+  end
+  local ret = {}
+  for _, row in ipairs(rows) do
+    table.insert(ret, { name = row.name, share = row.cost / total })
+  end
+  return ret
+end
+`
+
+func newTestState(t *testing.T) *lua.LState {
+	t.Helper()
+	L := lua.NewState()
+	t.Cleanup(L.Close)
+	require.NoError(t, L.DoString(testScript))
+	return L
+}
+
+func TestLuaRowMiddleware(t *testing.T) {
+	L := newTestState(t)
+	fn, err := LookupLuaFunction(L, "process_row")
+	require.NoError(t, err)
+	mw := NewLuaRowMiddleware(L, fn)
+	ctx := context.Background()
+
+	rows, err := mw.Process(ctx, types.NewRow(types.MRP("name", "ada"), types.MRP("note", nil), types.MRP("cost", 3)))
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, []types.FieldName{"name", "note", "cost", "double"}, types.GetFields(rows[0]))
+	assert2.EqualRowValue(t, 6.0, rows[0], "double")
+	assert2.EqualRowValue(t, nil, rows[0], "note")
+
+	rows, err = mw.Process(ctx, types.NewRow(types.MRP("name", "bob"), types.MRP("cost", nil)))
+	require.NoError(t, err)
+	assert.Empty(t, rows)
+
+	rows, err = mw.Process(ctx, types.NewRow(types.MRP("name", "cy"), types.MRP("cost", 1), types.MRP("split", true)))
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, []types.FieldName{"name", "part"}, types.GetFields(rows[1]))
+	assert2.EqualRowValue(t, 2.0, rows[1], "part")
+
+	require.NoError(t, L.DoString(`function broken(row) error("boom") end`))
+	fn, err = LookupLuaFunction(L, "broken")
+	require.NoError(t, err)
+	_, err = NewLuaRowMiddleware(L, fn).Process(ctx, types.NewRow(types.MRP("name", "ada")))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "boom")
+
+	_, err = LookupLuaFunction(L, "missing")
+	assert.Error(t, err)
+}
+
+func TestLuaTableMiddleware(t *testing.T) {
+	L := newTestState(t)
+	fn, err := LookupLuaFunction(L, "process_table")
+	require.NoError(t, err)
+
+	table := types.NewTable()
+	table.AddRows(
+		types.NewRow(types.MRP("name", "ada"), types.MRP("cost", 1)),
+		types.NewRow(types.MRP("name", "bob"), types.MRP("cost", 3)),
+	)
+	newTable, err := NewLuaTableMiddleware(L, fn).Process(context.Background(), table)
+	require.NoError(t, err)
+	assert.Equal(t, []types.FieldName{"name", "share"}, newTable.Columns)
+	require.Len(t, newTable.Rows, 2)
+	assert2.EqualRowValue(t, "bob", newTable.Rows[1], "name")
+	assert2.EqualRowValue(t, 0.75, newTable.Rows[1], "share")
+}
+
+func TestScriptSharesStateBetweenMiddlewares(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.lua")
+	require.NoError(t, os.WriteFile(path, []byte(`
+local seen = 0
+function process_row(row)
+  seen = seen + 1
+  return true
+end
+function process_table(rows)
+  return { { seen = seen } }
+end
+`), 0644))
+
+	script, err := LoadScript(path, "process_row", "process_table")
+	require.NoError(t, err)
+	rowMiddleware := script.RowMiddleware()
+	tableMiddleware := script.TableMiddleware()
+	require.NotNil(t, rowMiddleware)
+	require.NotNil(t, tableMiddleware)
+	assert.False(t, rowMiddleware.ConcurrencySafe())
+
+	ctx := context.Background()
+	table := types.NewTable()
+	for _, name := range []string{"ada", "bob"} {
+		rows, err := rowMiddleware.Process(ctx, types.NewRow(types.MRP("name", name)))
+		require.NoError(t, err)
+		table.AddRows(rows...)
+	}
+	require.NoError(t, rowMiddleware.Close(ctx))
+	assert.False(t, script.closed)
+
+	newTable, err := tableMiddleware.Process(ctx, table)
+	require.NoError(t, err)
+	require.Len(t, newTable.Rows, 1)
+	assert2.EqualRowValue(t, 2.0, newTable.Rows[0], "seen")
+	require.NoError(t, tableMiddleware.Close(ctx))
+	assert.True(t, script.closed)
+
+	script, err = LoadScript(path, "process_row", "")
+	require.NoError(t, err)
+	assert.Nil(t, script.TableMiddleware())
+	script.Close()
+
+	_, err = LoadScript(path, "missing", "")
+	assert.Error(t, err)
+	_, err = LoadScript(filepath.Join(t.TempDir(), "missing.lua"), "process_row", "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,96 @@
+package lua
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Script is a Lua script run in its own state, whose row and table functions
+// are run by the middlewares it creates. The middlewares share the state, so
+// that the functions can share globals, and the state is closed once all of
+// them are closed.
+type Script struct {
+	state         *lua.LState
+	rowFunction   *lua.LFunction
+	tableFunction *lua.LFunction
+	// middlewares is the number of middlewares that were created and not
+	// closed yet.
+	middlewares int
+	closed      bool
+}
+
+// LoadScript runs the script at path and looks up its row and table
+// functions. Empty function names are not looked up, and the script has to
+// define at least one of the others.
+func LoadScript(path string, rowFunction string, tableFunction string) (*Script, error) {
+	L := lua.NewState()
+	if err := L.DoFile(path); err != nil {
+		L.Close()
+		return nil, errors.Wrapf(err, "could not run Lua script %s", path)
+	}
+
+	ret := &Script{state: L}
+	names := []string{}
+	if rowFunction != "" {
+		names = append(names, rowFunction)
+		ret.rowFunction, _ = LookupLuaFunction(L, rowFunction)
+	}
+	if tableFunction != "" {
+		names = append(names, tableFunction)
+		ret.tableFunction, _ = LookupLuaFunction(L, tableFunction)
+	}
+	if ret.rowFunction == nil && ret.tableFunction == nil {
+		L.Close()
+		return nil, errors.Errorf("script %s doesn't define %s", path, strings.Join(names, " or "))
+	}
+	return ret, nil
+}
+
+// HasRowFunction returns true if the script defines the row function.
+func (s *Script) HasRowFunction() bool {
+	return s.rowFunction != nil
+}
+
+// HasTableFunction returns true if the script defines the table function.
+func (s *Script) HasTableFunction() bool {
+	return s.tableFunction != nil
+}
+
+// RowMiddleware creates a middleware calling the row function, or returns nil
+// if the script doesn't define it.
+func (s *Script) RowMiddleware() *LuaRowMiddleware {
+	if s.rowFunction == nil {
+		return nil
+	}
+	s.middlewares++
+	return &LuaRowMiddleware{state: s.state, function: s.rowFunction, script: s}
+}
+
+// TableMiddleware creates a middleware calling the table function, or returns
+// nil if the script doesn't define it.
+func (s *Script) TableMiddleware() *LuaTableMiddleware {
+	if s.tableFunction == nil {
+		return nil
+	}
+	s.middlewares++
+	return &LuaTableMiddleware{state: s.state, function: s.tableFunction, script: s}
+}
+
+// Close closes the state, even if middlewares still use it. It is only needed
+// when the middlewares of the script are not closed, such as when setting up a
+// processor fails.
+func (s *Script) Close() {
+	if !s.closed {
+		s.closed = true
+		s.state.Close()
+	}
+}
+
+func (s *Script) release() {
+	s.middlewares--
+	if s.middlewares <= 0 {
+		s.Close()
+	}
+}
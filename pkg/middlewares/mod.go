@@ -22,3 +22,27 @@ type RowMiddleware interface {
 	Process(ctx context.Context, row types.Row) ([]types.Row, error)
 	Close(ctx context.Context) error
 }
+
+// FlushingRowMiddleware is a RowMiddleware that holds back rows, for example to
+// sort them, and emits them once all rows have been seen.
+type FlushingRowMiddleware interface {
+	RowMiddleware
+	// Flush is called once by TableProcessor.Close, before the table middlewares
+	// are run. Rows passed to emit are processed by the downstream row
+	// middlewares, as if they had been returned by Process.
+	Flush(ctx context.Context, emit func(row types.Row) error) error
+}
+
+// ConcurrencySafe is implemented by object and row middlewares whose Process
+// method can be called from multiple goroutines at once. Only such middlewares
+// are run by the workers of a TableProcessor created with WithWorkers.
+type ConcurrencySafe interface {
+	ConcurrencySafe() bool
+}
+
+// IsConcurrencySafe returns true if mw implements ConcurrencySafe and reports
+// being safe.
+func IsConcurrencySafe(mw interface{}) bool {
+	cs, ok := mw.(ConcurrencySafe)
+	return ok && cs.ConcurrencySafe()
+}
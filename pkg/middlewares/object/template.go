@@ -66,3 +66,7 @@ func (rgtm *TemplateMiddleware) Process(ctx context.Context, object types.Row) (
 
 	return []types.Row{ret}, nil
 }
+
+func (rgtm *TemplateMiddleware) ConcurrencySafe() bool {
+	return true
+}
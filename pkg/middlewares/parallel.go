@@ -0,0 +1,205 @@
+package middlewares
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+)
+
+// WithWorkers makes the TableProcessor run its middlewares on a pool of n
+// goroutines. Rows are still passed on, and collected into the table, in the
+// order in which they were added.
+//
+// Only the leading object and row middlewares that are ConcurrencySafe are run
+// by the workers. The first middleware that isn't, and every middleware after
+// it, is run serially in row order, so that stateful middlewares such as
+// row.SkipLimitMiddleware or output middlewares behave as without workers.
+//
+// AddRow returns as soon as the row has been queued. Errors are reported by
+// the next call to AddRow, and by Close, which waits for all queued rows.
+// Values of n lower than 2 process rows serially on the caller goroutine.
+func WithWorkers(n int) TableProcessorOption {
+	return func(p *TableProcessor) {
+		p.workers = n
+	}
+}
+
+type parallelJob struct {
+	ctx  context.Context
+	row  types.Row
+	rows []types.Row
+	err  error
+	done chan struct{}
+}
+
+// parallelPipeline runs the concurrency safe prefix of the middlewares of a
+// TableProcessor on a pool of workers. A sequencer goroutine waits for the
+// rows in input order and runs the remaining middlewares.
+type parallelPipeline struct {
+	parallelObjectMiddlewares []ObjectMiddleware
+	parallelRowMiddlewares    []RowMiddleware
+	serialObjectMiddlewares   []ObjectMiddleware
+	serialRowMiddlewares      []RowMiddleware
+
+	jobs    chan *parallelJob
+	ordered chan *parallelJob
+	workers sync.WaitGroup
+	done    chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+func (p *TableProcessor) startParallelPipeline() *parallelPipeline {
+	pp := &parallelPipeline{
+		jobs:    make(chan *parallelJob, p.workers*4),
+		ordered: make(chan *parallelJob, p.workers*4),
+		done:    make(chan struct{}),
+	}
+
+	objectIdx := 0
+	for objectIdx < len(p.ObjectMiddlewares) && IsConcurrencySafe(p.ObjectMiddlewares[objectIdx]) {
+		objectIdx++
+	}
+	rowIdx := 0
+	if objectIdx == len(p.ObjectMiddlewares) {
+		for rowIdx < len(p.RowMiddlewares) && IsConcurrencySafe(p.RowMiddlewares[rowIdx]) {
+			rowIdx++
+		}
+	}
+	pp.parallelObjectMiddlewares = p.ObjectMiddlewares[:objectIdx]
+	pp.serialObjectMiddlewares = p.ObjectMiddlewares[objectIdx:]
+	pp.parallelRowMiddlewares = p.RowMiddlewares[:rowIdx]
+	pp.serialRowMiddlewares = p.RowMiddlewares[rowIdx:]
+
+	for i := 0; i < p.workers; i++ {
+		pp.workers.Add(1)
+		go pp.work()
+	}
+	go pp.sequence(p)
+
+	return pp
+}
+
+func (pp *parallelPipeline) work() {
+	defer pp.workers.Done()
+	for job := range pp.jobs {
+		switch {
+		case pp.firstError() != nil:
+			// the pipeline already failed, don't waste time on the row
+		case job.ctx.Err() != nil:
+			job.err = job.ctx.Err()
+		default:
+			job.rows, job.err = processObjects(job.ctx, pp.parallelObjectMiddlewares, []types.Row{job.row})
+			if job.err == nil {
+				job.rows, job.err = processRows(job.ctx, pp.parallelRowMiddlewares, job.rows)
+			}
+		}
+		close(job.done)
+	}
+}
+
+func (pp *parallelPipeline) sequence(p *TableProcessor) {
+	defer close(pp.done)
+	for job := range pp.ordered {
+		<-job.done
+		if pp.firstError() != nil {
+			continue
+		}
+		if job.err != nil {
+			pp.setError(job.err)
+			continue
+		}
+
+		rows, err := processObjects(job.ctx, pp.serialObjectMiddlewares, job.rows)
+		if err == nil {
+			rows, err = processRows(job.ctx, pp.serialRowMiddlewares, rows)
+		}
+		if err != nil {
+			pp.setError(err)
+			continue
+		}
+		p.collectRows(rows)
+	}
+}
+
+func (pp *parallelPipeline) addRow(ctx context.Context, row types.Row) error {
+	if err := pp.firstError(); err != nil {
+		return err
+	}
+
+	job := &parallelJob{
+		ctx:  ctx,
+		row:  row,
+		done: make(chan struct{}),
+	}
+
+	select {
+	case pp.ordered <- job:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case pp.jobs <- job:
+	case <-ctx.Done():
+		// the sequencer is already waiting for the job
+		job.err = ctx.Err()
+		close(job.done)
+		return ctx.Err()
+	}
+
+	return nil
+}
+
+// wait waits for all queued rows to be processed and returns the first error.
+func (pp *parallelPipeline) wait() error {
+	close(pp.ordered)
+	close(pp.jobs)
+	pp.workers.Wait()
+	<-pp.done
+	return pp.firstError()
+}
+
+func (pp *parallelPipeline) firstError() error {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	return pp.err
+}
+
+func (pp *parallelPipeline) setError(err error) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	if pp.err == nil {
+		pp.err = err
+	}
+}
+
+// SynchronizedProcessor wraps a Processor so that AddRow and Close can be
+// called from multiple goroutines. Rows are added in the order in which the
+// calls acquire the lock.
+type SynchronizedProcessor struct {
+	mu        sync.Mutex
+	processor Processor
+}
+
+var _ Processor = (*SynchronizedProcessor)(nil)
+
+func NewSynchronizedProcessor(processor Processor) *SynchronizedProcessor {
+	return &SynchronizedProcessor{
+		processor: processor,
+	}
+}
+
+func (s *SynchronizedProcessor) AddRow(ctx context.Context, row types.Row) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.processor.AddRow(ctx, row)
+}
+
+func (s *SynchronizedProcessor) Close(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.processor.Close(ctx)
+}
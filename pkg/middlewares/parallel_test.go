@@ -0,0 +1,154 @@
+package middlewares
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowDoubleMiddleware is concurrency safe and takes a random amount of time.
+type slowDoubleMiddleware struct {
+	running    int32
+	maxRunning int32
+	failOn     int
+}
+
+func (m *slowDoubleMiddleware) Process(_ context.Context, row types.Row) ([]types.Row, error) {
+	running := atomic.AddInt32(&m.running, 1)
+	defer atomic.AddInt32(&m.running, -1)
+	for {
+		max := atomic.LoadInt32(&m.maxRunning)
+		if running <= max || atomic.CompareAndSwapInt32(&m.maxRunning, max, running) {
+			break
+		}
+	}
+
+	time.Sleep(time.Duration(rand.Intn(200)) * time.Microsecond)
+	v, _ := row.Get("i")
+	if m.failOn > 0 && v.(int) == m.failOn {
+		return nil, errors.Errorf("failed on %d", v)
+	}
+	return []types.Row{types.NewRow(types.MRP("i", v), types.MRP("double", v.(int)*2))}, nil
+}
+
+func (*slowDoubleMiddleware) ConcurrencySafe() bool { return true }
+
+func (*slowDoubleMiddleware) Close(context.Context) error { return nil }
+
+// orderRecordingMiddleware is not concurrency safe.
+type orderRecordingMiddleware struct {
+	seen []int
+}
+
+func (m *orderRecordingMiddleware) Process(_ context.Context, row types.Row) ([]types.Row, error) {
+	v, _ := row.Get("i")
+	m.seen = append(m.seen, v.(int))
+	return []types.Row{row}, nil
+}
+
+func (*orderRecordingMiddleware) Close(context.Context) error { return nil }
+
+func TestParallelProcessorPreservesOrder(t *testing.T) {
+	slow := &slowDoubleMiddleware{}
+	recorder := &orderRecordingMiddleware{}
+	processor := NewTableProcessor(
+		WithWorkers(8),
+		WithRowMiddleware(slow, recorder),
+		WithTableMiddleware(&processorTestTableMiddleware{}),
+	)
+
+	ctx := context.Background()
+	for i := 0; i < 200; i++ {
+		require.NoError(t, processor.AddRow(ctx, types.NewRow(types.MRP("i", i))))
+	}
+	require.NoError(t, processor.Close(ctx))
+
+	require.Len(t, processor.Table.Rows, 200)
+	for i, row := range processor.Table.Rows {
+		v, _ := row.Get("double")
+		require.Equal(t, i*2, v)
+		require.Equal(t, i, recorder.seen[i])
+	}
+	assert.Greater(t, atomic.LoadInt32(&slow.maxRunning), int32(1))
+}
+
+func TestParallelProcessorReturnsFirstError(t *testing.T) {
+	processor := NewTableProcessor(
+		WithWorkers(4),
+		WithRowMiddleware(&slowDoubleMiddleware{failOn: 10}),
+		WithTableMiddleware(&processorTestTableMiddleware{}),
+	)
+
+	ctx := context.Background()
+	var addErr error
+	for i := 0; i < 1000 && addErr == nil; i++ {
+		addErr = processor.AddRow(ctx, types.NewRow(types.MRP("i", i)))
+	}
+	err := processor.Close(ctx)
+	require.Error(t, err)
+	assert.Equal(t, "failed on 10", err.Error())
+	if addErr != nil {
+		assert.Equal(t, "failed on 10", addErr.Error())
+	}
+	for i, row := range processor.Table.Rows {
+		v, _ := row.Get("i")
+		require.Equal(t, i, v)
+		require.Less(t, i, 10)
+	}
+}
+
+func TestParallelProcessorHonorsCancellation(t *testing.T) {
+	processor := NewTableProcessor(
+		WithWorkers(4),
+		WithRowMiddleware(&slowDoubleMiddleware{}),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, processor.AddRow(ctx, types.NewRow(types.MRP("i", 1))))
+	cancel()
+
+	var err error
+	for i := 0; i < 1000 && err == nil; i++ {
+		err = processor.AddRow(ctx, types.NewRow(types.MRP("i", i)))
+	}
+	require.ErrorIs(t, err, context.Canceled)
+	require.ErrorIs(t, processor.Close(context.Background()), context.Canceled)
+}
+
+func TestSynchronizedProcessorAddsRowsFromGoroutines(t *testing.T) {
+	processor := NewTableProcessor(
+		WithWorkers(4),
+		WithRowMiddleware(&slowDoubleMiddleware{}),
+		WithTableMiddleware(&processorTestTableMiddleware{}),
+	)
+	synchronized := NewSynchronizedProcessor(processor)
+
+	ctx := context.Background()
+	wg := sync.WaitGroup{}
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				assert.NoError(t, synchronized.AddRow(ctx, types.NewRow(types.MRP("i", g*25+i))))
+			}
+		}(g)
+	}
+	wg.Wait()
+	require.NoError(t, synchronized.Close(ctx))
+
+	seen := map[int]bool{}
+	for _, row := range processor.Table.Rows {
+		v, _ := row.Get("i")
+		seen[v.(int)] = true
+	}
+	assert.Len(t, seen, 200)
+}
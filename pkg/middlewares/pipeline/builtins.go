@@ -0,0 +1,604 @@
+package pipeline
+
+import (
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/middlewares/lua"
+	"github.com/go-go-golems/glazed/pkg/middlewares/object"
+	"github.com/go-go-golems/glazed/pkg/middlewares/row"
+	"github.com/go-go-golems/glazed/pkg/middlewares/table"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// registerBuiltins registers the stages corresponding to the glazed
+// processing flags, along with a few middlewares that have no flag:
+//
+//	object: template
+//	row:    join, lua, explode, flatten, unflatten, rename, replace, coerce, time-bucket,
+//	        add-fields, template, where, filter, remove-duplicates, distinct,
+//	        remove-nulls, sample, redact, sort-columns, reorder-columns,
+//	        output-fields, skip-limit
+//	table:  lua, unpivot, group-by, resample, pivot, window, describe, sort-by,
+//	        output-fields, skip-limit, unflatten
+func registerBuiltins(r *Registry) {
+	mustRegister(r.RegisterObjectMiddleware("template", newObjectTemplateStage))
+
+	mustRegister(r.RegisterRowMiddleware("join", newJoinStage))
+	mustRegister(r.RegisterRowMiddleware("lua", newLuaRowStage))
+	mustRegister(r.RegisterRowMiddleware("explode", newExplodeStage))
+	mustRegister(r.RegisterRowMiddleware("flatten", func(options Options) (middlewares.RowMiddleware, error) {
+		if err := options.Decode(&struct{}{}); err != nil {
+			return nil, err
+		}
+		return row.NewFlattenObjectMiddleware(), nil
+	}))
+	mustRegister(r.RegisterRowMiddleware("unflatten", func(options Options) (middlewares.RowMiddleware, error) {
+		separator, err := decodeSeparator(options)
+		if err != nil {
+			return nil, err
+		}
+		return row.NewUnflattenObjectMiddleware(separator), nil
+	}))
+	mustRegister(r.RegisterRowMiddleware("rename", newRenameStage))
+	mustRegister(r.RegisterRowMiddleware("replace", newReplaceStage))
+	mustRegister(r.RegisterRowMiddleware("coerce", newCoerceStage))
+	mustRegister(r.RegisterRowMiddleware("time-bucket", newTimeBucketStage))
+	mustRegister(r.RegisterRowMiddleware("add-fields", func(options Options) (middlewares.RowMiddleware, error) {
+		var o struct {
+			Fields map[string]string `yaml:"fields"`
+		}
+		if err := options.Decode(&o); err != nil {
+			return nil, err
+		}
+		return row.NewAddFieldMiddleware(o.Fields), nil
+	}))
+	mustRegister(r.RegisterRowMiddleware("template", newRowTemplateStage))
+	mustRegister(r.RegisterRowMiddleware("where", func(options Options) (middlewares.RowMiddleware, error) {
+		var o struct {
+			Expression string `yaml:"expression"`
+		}
+		if err := options.Decode(&o); err != nil {
+			return nil, err
+		}
+		if o.Expression == "" {
+			return nil, errors.New("missing expression")
+		}
+		return row.NewWhereMiddleware(o.Expression)
+	}))
+	mustRegister(r.RegisterRowMiddleware("filter", newFilterStage))
+	mustRegister(r.RegisterRowMiddleware("remove-duplicates", func(options Options) (middlewares.RowMiddleware, error) {
+		columns, err := decodeColumns(options)
+		if err != nil {
+			return nil, err
+		}
+		return row.NewRemoveDuplicatesMiddleware(columns...), nil
+	}))
+	mustRegister(r.RegisterRowMiddleware("distinct", func(options Options) (middlewares.RowMiddleware, error) {
+		var o struct {
+			Columns  []types.FieldName `yaml:"columns"`
+			MemoryMB int               `yaml:"memory-mb"`
+		}
+		if err := options.Decode(&o); err != nil {
+			return nil, err
+		}
+		if o.MemoryMB < 0 {
+			return nil, errors.New("memory-mb must not be negative")
+		}
+		return row.NewDistinctMiddleware(o.Columns, row.WithDistinctMemoryBudget(o.MemoryMB*1024*1024)), nil
+	}))
+	mustRegister(r.RegisterRowMiddleware("remove-nulls", func(options Options) (middlewares.RowMiddleware, error) {
+		if err := options.Decode(&struct{}{}); err != nil {
+			return nil, err
+		}
+		return row.NewRemoveNullsMiddleware(), nil
+	}))
+	mustRegister(r.RegisterRowMiddleware("sample", newSampleStage))
+	mustRegister(r.RegisterRowMiddleware("redact", newRedactStage))
+	mustRegister(r.RegisterRowMiddleware("sort-columns", func(options Options) (middlewares.RowMiddleware, error) {
+		if err := options.Decode(&struct{}{}); err != nil {
+			return nil, err
+		}
+		return row.NewSortColumnsMiddleware(), nil
+	}))
+	mustRegister(r.RegisterRowMiddleware("reorder-columns", func(options Options) (middlewares.RowMiddleware, error) {
+		columns, err := decodeColumns(options)
+		if err != nil {
+			return nil, err
+		}
+		return row.NewReorderColumnOrderMiddleware(columns), nil
+	}))
+	mustRegister(r.RegisterRowMiddleware("output-fields", func(options Options) (middlewares.RowMiddleware, error) {
+		columns, err := decodeColumns(options)
+		if err != nil {
+			return nil, err
+		}
+		return row.NewOutputFieldsMiddleware(columns...), nil
+	}))
+	mustRegister(r.RegisterRowMiddleware("skip-limit", func(options Options) (middlewares.RowMiddleware, error) {
+		skip, limit, err := decodeSkipLimit(options)
+		if err != nil {
+			return nil, err
+		}
+		return &row.SkipLimitMiddleware{Skip: skip, Limit: limit}, nil
+	}))
+
+	mustRegister(r.RegisterTableMiddleware("lua", newLuaTableStage))
+	mustRegister(r.RegisterTableMiddleware("unpivot", newUnpivotStage))
+	mustRegister(r.RegisterTableMiddleware("group-by", func(options Options) (middlewares.TableMiddleware, error) {
+		var o struct {
+			Columns      []string `yaml:"columns"`
+			Aggregations []string `yaml:"aggregations"`
+		}
+		if err := options.Decode(&o); err != nil {
+			return nil, err
+		}
+		return table.NewGroupByMiddlewareFromSpecs(o.Columns, o.Aggregations...)
+	}))
+	mustRegister(r.RegisterTableMiddleware("resample", newResampleStage))
+	mustRegister(r.RegisterTableMiddleware("pivot", newPivotStage))
+	mustRegister(r.RegisterTableMiddleware("window", newWindowStage))
+	mustRegister(r.RegisterTableMiddleware("describe", newDescribeStage))
+	mustRegister(r.RegisterTableMiddleware("sort-by", func(options Options) (middlewares.TableMiddleware, error) {
+		columns, err := decodeColumns(options)
+		if err != nil {
+			return nil, err
+		}
+		if len(columns) == 0 {
+			return nil, errors.New("missing columns")
+		}
+		return table.NewSortByMiddlewareFromColumns(columns...), nil
+	}))
+	mustRegister(r.RegisterTableMiddleware("output-fields", func(options Options) (middlewares.TableMiddleware, error) {
+		columns, err := decodeColumns(options)
+		if err != nil {
+			return nil, err
+		}
+		return table.NewOutputFieldsMiddleware(columns...), nil
+	}))
+	mustRegister(r.RegisterTableMiddleware("skip-limit", func(options Options) (middlewares.TableMiddleware, error) {
+		skip, limit, err := decodeSkipLimit(options)
+		if err != nil {
+			return nil, err
+		}
+		return table.NewSkipLimitMiddleware(skip, limit), nil
+	}))
+	mustRegister(r.RegisterTableMiddleware("unflatten", func(options Options) (middlewares.TableMiddleware, error) {
+		separator, err := decodeSeparator(options)
+		if err != nil {
+			return nil, err
+		}
+		return table.NewUnflattenObjectMiddleware(separator), nil
+	}))
+}
+
+func mustRegister(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+func decodeColumns(options Options) ([]types.FieldName, error) {
+	var o struct {
+		Columns []types.FieldName `yaml:"columns"`
+	}
+	if err := options.Decode(&o); err != nil {
+		return nil, err
+	}
+	return o.Columns, nil
+}
+
+func decodeSeparator(options Options) (string, error) {
+	o := struct {
+		Separator string `yaml:"separator"`
+	}{Separator: "."}
+	if err := options.Decode(&o); err != nil {
+		return "", err
+	}
+	if o.Separator == "" {
+		return "", errors.New("empty separator")
+	}
+	return o.Separator, nil
+}
+
+func decodeSkipLimit(options Options) (int, int, error) {
+	var o struct {
+		Skip  int `yaml:"skip"`
+		Limit int `yaml:"limit"`
+	}
+	if err := options.Decode(&o); err != nil {
+		return 0, 0, err
+	}
+	if o.Skip < 0 || o.Limit < 0 {
+		return 0, 0, errors.New("skip and limit must not be negative")
+	}
+	return o.Skip, o.Limit, nil
+}
+
+func newObjectTemplateStage(options Options) (middlewares.ObjectMiddleware, error) {
+	var o struct {
+		Fields map[types.FieldName]string `yaml:"fields"`
+	}
+	if err := options.Decode(&o); err != nil {
+		return nil, err
+	}
+	return object.NewTemplateMiddleware(o.Fields)
+}
+
+// newJoinStage loads the lookup dataset when the stage is created.
+func newJoinStage(options Options) (middlewares.RowMiddleware, error) {
+	o := struct {
+		File   string   `yaml:"file"`
+		On     []string `yaml:"on"`
+		Type   string   `yaml:"type"`
+		Prefix string   `yaml:"prefix"`
+	}{Type: string(row.JoinInner), Prefix: "join_"}
+	if err := options.Decode(&o); err != nil {
+		return nil, err
+	}
+	if o.File == "" || len(o.On) == 0 {
+		return nil, errors.New("missing file or on")
+	}
+	keys, err := row.ParseJoinKeys(o.On...)
+	if err != nil {
+		return nil, err
+	}
+	lookup, err := row.LoadDataset(o.File)
+	if err != nil {
+		return nil, err
+	}
+	return row.NewJoinMiddleware(lookup.Rows, keys,
+		row.WithJoinType(row.JoinType(o.Type)),
+		row.WithConflictPrefix(o.Prefix),
+	)
+}
+
+// decodeLuaScript loads the script of a lua stage, whose function defaults to
+// defaultFunction.
+func decodeLuaScript(options Options, defaultFunction string) (string, string, error) {
+	o := struct {
+		Script   string `yaml:"script"`
+		Function string `yaml:"function"`
+	}{Function: defaultFunction}
+	if err := options.Decode(&o); err != nil {
+		return "", "", err
+	}
+	if o.Script == "" {
+		return "", "", errors.New("missing script")
+	}
+	return o.Script, o.Function, nil
+}
+
+// newLuaRowStage runs the script in a Lua state of its own, closed with the
+// stage.
+func newLuaRowStage(options Options) (middlewares.RowMiddleware, error) {
+	path, function, err := decodeLuaScript(options, "process_row")
+	if err != nil {
+		return nil, err
+	}
+	script, err := lua.LoadScript(path, function, "")
+	if err != nil {
+		return nil, err
+	}
+	return script.RowMiddleware(), nil
+}
+
+// newLuaTableStage runs the script in a Lua state of its own, closed with the
+// stage.
+func newLuaTableStage(options Options) (middlewares.TableMiddleware, error) {
+	path, function, err := decodeLuaScript(options, "process_table")
+	if err != nil {
+		return nil, err
+	}
+	script, err := lua.LoadScript(path, "", function)
+	if err != nil {
+		return nil, err
+	}
+	return script.TableMiddleware(), nil
+}
+
+func newExplodeStage(options Options) (middlewares.RowMiddleware, error) {
+	var o struct {
+		Column      types.FieldName `yaml:"column"`
+		IndexColumn types.FieldName `yaml:"index-column"`
+		DropEmpty   bool            `yaml:"drop-empty"`
+	}
+	if err := options.Decode(&o); err != nil {
+		return nil, err
+	}
+	if o.Column == "" {
+		return nil, errors.New("missing column")
+	}
+	explodeOptions := []row.ExplodeOption{}
+	if o.IndexColumn != "" {
+		explodeOptions = append(explodeOptions, row.WithIndexColumn(o.IndexColumn))
+	}
+	if o.DropEmpty {
+		explodeOptions = append(explodeOptions, row.WithDropEmpty())
+	}
+	return row.NewExplodeMiddleware(o.Column, explodeOptions...), nil
+}
+
+// newRenameStage takes the same options as the files of --rename-yaml.
+func newRenameStage(options Options) (middlewares.RowMiddleware, error) {
+	var o row.ColumnMiddlewareConfig
+	if err := options.Decode(&o); err != nil {
+		return nil, err
+	}
+	return row.NewRenameColumnMiddleware(o.FieldRenames, o.RegexpRenames), nil
+}
+
+// newReplaceStage takes the same options as the files of --replace-file.
+func newReplaceStage(options Options) (middlewares.RowMiddleware, error) {
+	b, err := options.YAML()
+	if err != nil {
+		return nil, err
+	}
+	return row.NewReplaceMiddlewareFromYAML(b)
+}
+
+func newCoerceStage(options Options) (middlewares.RowMiddleware, error) {
+	var o struct {
+		Columns []string `yaml:"columns"`
+		OnError string   `yaml:"on-error"`
+	}
+	if err := options.Decode(&o); err != nil {
+		return nil, err
+	}
+	coercions, err := row.ParseCoercions(o.Columns...)
+	if err != nil {
+		return nil, err
+	}
+	if o.OnError != "" {
+		policy, err := row.ParseCoerceErrorPolicy(o.OnError)
+		if err != nil {
+			return nil, err
+		}
+		for i := range coercions {
+			coercions[i].OnError = policy
+		}
+	}
+	return row.NewCoerceMiddleware(coercions...), nil
+}
+
+func newRowTemplateStage(options Options) (middlewares.RowMiddleware, error) {
+	o := struct {
+		Fields          map[types.FieldName]string `yaml:"fields"`
+		RenameSeparator string                     `yaml:"rename-separator"`
+	}{RenameSeparator: "_"}
+	if err := options.Decode(&o); err != nil {
+		return nil, err
+	}
+	return row.NewTemplateMiddleware(o.Fields, o.RenameSeparator)
+}
+
+func newFilterStage(options Options) (middlewares.RowMiddleware, error) {
+	var o struct {
+		Fields       []string `yaml:"fields"`
+		Filters      []string `yaml:"filters"`
+		RegexFields  []string `yaml:"regex-fields"`
+		RegexFilters []string `yaml:"regex-filters"`
+	}
+	if err := options.Decode(&o); err != nil {
+		return nil, err
+	}
+	return row.NewFieldsFilterMiddleware(
+		row.WithFields(o.Fields),
+		row.WithFilters(o.Filters),
+		row.WithRegexFields(o.RegexFields),
+		row.WithRegexFilters(o.RegexFilters),
+	), nil
+}
+
+func newSampleStage(options Options) (middlewares.RowMiddleware, error) {
+	var o struct {
+		N       int               `yaml:"n"`
+		Percent float64           `yaml:"percent"`
+		Key     []types.FieldName `yaml:"key"`
+		Seed    int64             `yaml:"seed"`
+	}
+	if err := options.Decode(&o); err != nil {
+		return nil, err
+	}
+	switch {
+	case o.N > 0 && o.Percent == 0 && len(o.Key) == 0:
+		return row.NewReservoirSampleMiddleware(o.N, o.Seed), nil
+	case o.N == 0 && o.Percent > 0 && o.Percent <= 100:
+		if len(o.Key) > 0 {
+			return row.NewHashSampleMiddleware(o.Key, o.Percent/100, o.Seed), nil
+		}
+		return row.NewBernoulliSampleMiddleware(o.Percent/100, o.Seed), nil
+	default:
+		return nil, errors.New("expected either a positive n, or a percent between 0 and 100 with an optional key")
+	}
+}
+
+func newUnpivotStage(options Options) (middlewares.TableMiddleware, error) {
+	o := struct {
+		Columns     []types.FieldName `yaml:"columns"`
+		KeyColumn   types.FieldName   `yaml:"key-column"`
+		ValueColumn types.FieldName   `yaml:"value-column"`
+	}{KeyColumn: "key", ValueColumn: "value"}
+	if err := options.Decode(&o); err != nil {
+		return nil, err
+	}
+	if len(o.Columns) == 0 {
+		return nil, errors.New("missing columns")
+	}
+	return table.NewUnpivotMiddleware(o.Columns, table.WithUnpivotColumnNames(o.KeyColumn, o.ValueColumn)), nil
+}
+
+func newRedactStage(options Options) (middlewares.RowMiddleware, error) {
+	var o struct {
+		Columns          map[types.FieldName]string `yaml:"columns"`
+		Regexps          map[string]string          `yaml:"regexps"`
+		Key              string                     `yaml:"key"`
+		FormatPreserving bool                       `yaml:"format-preserving"`
+	}
+	if err := options.Decode(&o); err != nil {
+		return nil, err
+	}
+	if len(o.Columns) == 0 && len(o.Regexps) == 0 {
+		return nil, errors.New("missing columns or regexps")
+	}
+	redactOptions := []row.RedactOption{
+		row.WithRedactKey([]byte(o.Key)),
+		row.WithFormatPreserving(o.FormatPreserving),
+	}
+	for column, spec := range o.Columns {
+		redaction, err := row.ParseRedaction(spec)
+		if err != nil {
+			return nil, err
+		}
+		redactOptions = append(redactOptions, row.WithRedactColumn(column, redaction))
+	}
+	patterns := make([]string, 0, len(o.Regexps))
+	for pattern := range o.Regexps {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		redaction, err := row.ParseRedaction(o.Regexps[pattern])
+		if err != nil {
+			return nil, err
+		}
+		redactOptions = append(redactOptions, row.WithRedactRegexp(re, redaction))
+	}
+	return row.NewRedactMiddleware(redactOptions...)
+}
+
+func newTimeBucketStage(options Options) (middlewares.RowMiddleware, error) {
+	var o struct {
+		Columns  []string `yaml:"columns"`
+		TimeZone string   `yaml:"time-zone"`
+	}
+	if err := options.Decode(&o); err != nil {
+		return nil, err
+	}
+	columns, err := row.ParseTimeBucketColumns(o.Columns...)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, errors.New("missing columns")
+	}
+	location, err := time.LoadLocation(o.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+	return row.NewTimeBucketMiddleware(columns, row.WithTimeBucketLocation(location)), nil
+}
+
+func newResampleStage(options Options) (middlewares.TableMiddleware, error) {
+	o := struct {
+		Column       types.FieldName   `yaml:"column"`
+		Bucket       string            `yaml:"bucket"`
+		Series       []types.FieldName `yaml:"series"`
+		Aggregations []string          `yaml:"aggregations"`
+		Fill         string            `yaml:"fill"`
+		TimeZone     string            `yaml:"time-zone"`
+	}{Fill: string(table.ResampleFillNull)}
+	if err := options.Decode(&o); err != nil {
+		return nil, err
+	}
+	if o.Column == "" || o.Bucket == "" {
+		return nil, errors.New("missing column or bucket")
+	}
+	bucket, err := row.ParseTimeBucket(o.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	aggregations, err := table.ParseAggregations(o.Aggregations...)
+	if err != nil {
+		return nil, err
+	}
+	fill, err := table.ParseResampleFill(o.Fill)
+	if err != nil {
+		return nil, err
+	}
+	location, err := time.LoadLocation(o.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+	return table.NewResampleMiddleware(
+		o.Column,
+		bucket,
+		table.WithResampleSeries(o.Series...),
+		table.WithResampleAggregations(aggregations...),
+		table.WithResampleFill(fill),
+		table.WithResampleLocation(location),
+	), nil
+}
+
+func newPivotStage(options Options) (middlewares.TableMiddleware, error) {
+	o := struct {
+		Key         types.FieldName   `yaml:"key"`
+		Value       types.FieldName   `yaml:"value"`
+		Index       []types.FieldName `yaml:"index"`
+		Aggregation string            `yaml:"aggregation"`
+		Fill        interface{}       `yaml:"fill"`
+	}{Aggregation: "first"}
+	if err := options.Decode(&o); err != nil {
+		return nil, err
+	}
+	if o.Key == "" || o.Value == "" {
+		return nil, errors.New("missing key or value column")
+	}
+	agg, err := table.ParsePivotAggregation(o.Aggregation, o.Value)
+	if err != nil {
+		return nil, err
+	}
+	pivotOptions := []table.PivotOption{table.WithPivotAggregation(agg), table.WithPivotFillValue(o.Fill)}
+	if len(o.Index) > 0 {
+		pivotOptions = append(pivotOptions, table.WithPivotIndex(o.Index...))
+	}
+	return table.NewPivotMiddleware(o.Key, o.Value, pivotOptions...), nil
+}
+
+func newWindowStage(options Options) (middlewares.TableMiddleware, error) {
+	var o struct {
+		Columns     []string          `yaml:"columns"`
+		PartitionBy []types.FieldName `yaml:"partition-by"`
+		OrderBy     []string          `yaml:"order-by"`
+	}
+	if err := options.Decode(&o); err != nil {
+		return nil, err
+	}
+	columns, err := table.ParseWindowColumns(o.Columns...)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, errors.New("missing columns")
+	}
+	return table.NewWindowMiddleware(
+		columns,
+		table.WithWindowPartitionBy(o.PartitionBy...),
+		table.WithWindowOrderBy(o.OrderBy...),
+	), nil
+}
+
+func newDescribeStage(options Options) (middlewares.TableMiddleware, error) {
+	o := struct {
+		Top         int  `yaml:"top"`
+		Approximate bool `yaml:"approximate"`
+	}{Top: 5}
+	if err := options.Decode(&o); err != nil {
+		return nil, err
+	}
+	if o.Top < 0 {
+		return nil, errors.New("top must not be negative")
+	}
+	describeOptions := []table.DescribeOption{table.WithDescribeTopValues(o.Top)}
+	if o.Approximate {
+		describeOptions = append(describeOptions, table.WithApproximateDistinct())
+	}
+	return table.NewDescribeMiddleware(describeOptions...), nil
+}
@@ -0,0 +1,147 @@
+// Package pipeline describes chains of middlewares declaratively, so that a
+// whole processing pipeline can be kept in a YAML file:
+//
+//	row:
+//	  - name: rename
+//	    options:
+//	      renames:
+//	        name: person
+//	  - name: where
+//	    options:
+//	      expression: cost > 10
+//	table:
+//	  - name: sort-by
+//	    options:
+//	      columns: [-cost]
+//
+// Stages are looked up by name in a Registry, which creates their middlewares
+// from their options. Since a TableProcessor runs object middlewares before row
+// middlewares and row middlewares before table middlewares, each kind of stage
+// has its own list.
+package pipeline
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Pipeline lists the object, row and table stages of a pipeline, each run in
+// the order of its list.
+type Pipeline struct {
+	Object []Stage `yaml:"object,omitempty"`
+	Row    []Stage `yaml:"row,omitempty"`
+	Table  []Stage `yaml:"table,omitempty"`
+}
+
+// Stage is a named middleware of the registry with its options.
+type Stage struct {
+	Name    string  `yaml:"name"`
+	Options Options `yaml:"options,omitempty"`
+}
+
+// Options holds the options of a stage until its factory decodes them.
+type Options struct {
+	node *yaml.Node
+}
+
+// NewOptions creates options from a value that can be marshalled to YAML, for
+// pipelines built in code.
+func NewOptions(v interface{}) (Options, error) {
+	node := &yaml.Node{}
+	if err := node.Encode(v); err != nil {
+		return Options{}, err
+	}
+	return Options{node: node}, nil
+}
+
+func (o *Options) UnmarshalYAML(node *yaml.Node) error {
+	o.node = node
+	return nil
+}
+
+func (o Options) MarshalYAML() (interface{}, error) {
+	return o.node, nil
+}
+
+// IsZero reports whether no options were given.
+func (o Options) IsZero() bool {
+	return o.node == nil
+}
+
+// Decode decodes the options into v, usually a pointer to a struct with yaml
+// tags. Options that are not fields of v are an error. v is left untouched if
+// no options were given.
+func (o Options) Decode(v interface{}) error {
+	if o.node == nil {
+		return nil
+	}
+	b, err := yaml.Marshal(o.node)
+	if err != nil {
+		return err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(b))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(v); err != nil {
+		return errors.Wrap(err, "invalid options")
+	}
+	return nil
+}
+
+// YAML returns the options as a YAML document, for middlewares that parse
+// their own YAML configuration.
+func (o Options) YAML() ([]byte, error) {
+	if o.node == nil {
+		return []byte{}, nil
+	}
+	return yaml.Marshal(o.node)
+}
+
+// ParsePipeline parses a pipeline file. Unknown keys are an error, but stages
+// are only checked against a registry by Registry.Validate.
+func ParsePipeline(r io.Reader) (*Pipeline, error) {
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+	ret := &Pipeline{}
+	if err := decoder.Decode(ret); err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "could not parse pipeline")
+	}
+	if err := checkStageNames(ObjectStage, ret.Object); err != nil {
+		return nil, err
+	}
+	if err := checkStageNames(RowStage, ret.Row); err != nil {
+		return nil, err
+	}
+	if err := checkStageNames(TableStage, ret.Table); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func checkStageNames(kind StageKind, stages []Stage) error {
+	for i, stage := range stages {
+		if stage.Name == "" {
+			return errors.Errorf("%s stage %d has no name", kind, i+1)
+		}
+	}
+	return nil
+}
+
+// LoadPipeline parses the pipeline file fileName.
+func LoadPipeline(fileName string) (*Pipeline, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not open pipeline file %s", fileName)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	ret, err := ParsePipeline(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid pipeline file %s", fileName)
+	}
+	return ret, nil
+}
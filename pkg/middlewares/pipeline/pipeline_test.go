@@ -0,0 +1,147 @@
+package pipeline
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/middlewares/row"
+	"github.com/go-go-golems/glazed/pkg/middlewares/table"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPipeline = `
+object:
+  - name: template
+    options:
+      fields:
+        label: "{{ .name }}-{{ .team }}"
+        name: "{{ .name }}"
+        team: "{{ .team }}"
+        cost: "{{ .cost }}"
+row:
+  - name: coerce
+    options:
+      columns: [cost:int]
+  - name: where
+    options:
+      expression: cost > 1
+table:
+  - name: group-by
+    options:
+      columns: [team]
+      aggregations: [sum:cost, count]
+  - name: sort-by
+    options:
+      columns: [-sum_cost]
+`
+
+func runPipeline(t *testing.T, processor *middlewares.TableProcessor, rows ...types.Row) *types.Table {
+	t.Helper()
+	ctx := context.Background()
+	for _, row := range rows {
+		require.NoError(t, processor.AddRow(ctx, row))
+	}
+	require.NoError(t, processor.Close(ctx))
+	return processor.GetTable()
+}
+
+func TestPipelineFromYAML(t *testing.T) {
+	p, err := ParsePipeline(strings.NewReader(testPipeline))
+	require.NoError(t, err)
+	require.Len(t, p.Object, 1)
+	require.Len(t, p.Row, 2)
+	require.Len(t, p.Table, 2)
+
+	processor, err := NewDefaultRegistry().NewTableProcessor(p)
+	require.NoError(t, err)
+	output := runPipeline(t, processor,
+		types.NewRow(types.MRP("name", "ada"), types.MRP("team", "web"), types.MRP("cost", 1)),
+		types.NewRow(types.MRP("name", "bob"), types.MRP("team", "web"), types.MRP("cost", 2)),
+		types.NewRow(types.MRP("name", "cy"), types.MRP("team", "infra"), types.MRP("cost", 5)),
+		types.NewRow(types.MRP("name", "dee"), types.MRP("team", "infra"), types.MRP("cost", 4)),
+	)
+
+	require.Len(t, output.Rows, 2)
+	assert.Equal(t, []types.FieldName{"team", "sum_cost", "count"}, output.Columns)
+	team, _ := output.Rows[0].Get("team")
+	sum, _ := output.Rows[0].Get("sum_cost")
+	assert.Equal(t, "infra", team)
+	assert.EqualValues(t, 9, sum)
+	count, _ := output.Rows[1].Get("count")
+	assert.EqualValues(t, 1, count)
+}
+
+func TestPipelineValidation(t *testing.T) {
+	registry := NewDefaultRegistry()
+	tests := []struct {
+		name     string
+		pipeline string
+		err      string
+	}{
+		{"unknown section", "rows:\n  - name: flatten\n", "field rows not found"},
+		{"missing name", "row:\n  - options: {}\n", "row stage 1 has no name"},
+		{"unknown stage", "row:\n  - name: flatten\n  - name: nope\n", `row stage 2: unknown stage "nope"`},
+		{"wrong kind", "table:\n  - name: where\n", `table stage 1: unknown stage "where"`},
+		{"unknown option", "row:\n  - name: where\n    options:\n      expr: a > 1\n", "row stage 1 (where): invalid options"},
+		{"invalid option", "table:\n  - name: group-by\n    options:\n      aggregations: [nope:cost]\n", "table stage 1 (group-by)"},
+		{"invalid expression", "row:\n  - name: where\n    options:\n      expression: a >\n", "row stage 1 (where)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParsePipeline(strings.NewReader(tt.pipeline))
+			if err == nil {
+				err = registry.Validate(p)
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestRegistryRegistersCustomStages(t *testing.T) {
+	registry := NewDefaultRegistry()
+	upper := func(options Options) (middlewares.RowMiddleware, error) {
+		var o struct {
+			Column string `yaml:"column"`
+		}
+		if err := options.Decode(&o); err != nil {
+			return nil, err
+		}
+		return row.NewLambdaMiddleware(func(ctx context.Context, r types.Row) ([]types.Row, error) {
+			if v, ok := r.Get(o.Column); ok {
+				r.Set(o.Column, strings.ToUpper(v.(string)))
+			}
+			return []types.Row{r}, nil
+		}), nil
+	}
+	err := registry.RegisterRowMiddleware("upper", upper)
+	require.NoError(t, err)
+	assert.Contains(t, registry.Names(RowStage), "upper")
+	assert.NotContains(t, NewDefaultRegistry().Names(RowStage), "upper")
+
+	err = registry.RegisterRowMiddleware("upper", upper)
+	assert.EqualError(t, err, "row stage upper is already registered")
+	err = registry.RegisterRowMiddleware("lower", nil)
+	assert.EqualError(t, err, "row stage lower has no factory")
+	// table stages have their own names
+	err = registry.RegisterTableMiddleware("where", func(options Options) (middlewares.TableMiddleware, error) {
+		return table.NewSkipLimitMiddleware(0, 0), nil
+	})
+	assert.NoError(t, err)
+
+	options, err := NewOptions(map[string]string{"column": "name"})
+	require.NoError(t, err)
+	processor, err := registry.NewTableProcessor(&Pipeline{
+		Row:   []Stage{{Name: "upper", Options: options}},
+		Table: []Stage{{Name: "skip-limit"}},
+	})
+	require.NoError(t, err)
+	output := runPipeline(t, processor, types.NewRow(types.MRP("name", "ada")))
+	require.Len(t, output.Rows, 1)
+	name, _ := output.Rows[0].Get("name")
+	assert.Equal(t, "ADA", name)
+}
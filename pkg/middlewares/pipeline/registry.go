@@ -0,0 +1,270 @@
+package pipeline
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/pkg/errors"
+)
+
+// StageKind is the kind of middleware a pipeline stage creates. A
+// TableProcessor always runs object middlewares first, then row middlewares,
+// then table middlewares.
+type StageKind string
+
+const (
+	ObjectStage StageKind = "object"
+	RowStage    StageKind = "row"
+	TableStage  StageKind = "table"
+)
+
+type ObjectMiddlewareFactory func(options Options) (middlewares.ObjectMiddleware, error)
+type RowMiddlewareFactory func(options Options) (middlewares.RowMiddleware, error)
+type TableMiddlewareFactory func(options Options) (middlewares.TableMiddleware, error)
+
+// Registry maps stage names to the factories creating their middlewares. Each
+// kind of stage has its own namespace, so that a row and a table stage can
+// share a name.
+type Registry struct {
+	mu      sync.RWMutex
+	objects map[string]ObjectMiddlewareFactory
+	rows    map[string]RowMiddlewareFactory
+	tables  map[string]TableMiddlewareFactory
+}
+
+// NewRegistry creates an empty registry. Use NewDefaultRegistry to start from
+// the built-in stages.
+func NewRegistry() *Registry {
+	return &Registry{
+		objects: map[string]ObjectMiddlewareFactory{},
+		rows:    map[string]RowMiddlewareFactory{},
+		tables:  map[string]TableMiddlewareFactory{},
+	}
+}
+
+// NewDefaultRegistry creates a registry holding the built-in stages, see
+// registerBuiltins.
+func NewDefaultRegistry() *Registry {
+	ret := NewRegistry()
+	registerBuiltins(ret)
+	return ret
+}
+
+// DefaultRegistry is the registry used by the --pipeline flag of the glazed
+// processing section. Applications register their own stages in it with
+// RegisterObjectMiddleware, RegisterRowMiddleware and RegisterTableMiddleware.
+var DefaultRegistry = NewDefaultRegistry()
+
+func RegisterObjectMiddleware(name string, factory ObjectMiddlewareFactory) error {
+	return DefaultRegistry.RegisterObjectMiddleware(name, factory)
+}
+
+func RegisterRowMiddleware(name string, factory RowMiddlewareFactory) error {
+	return DefaultRegistry.RegisterRowMiddleware(name, factory)
+}
+
+func RegisterTableMiddleware(name string, factory TableMiddlewareFactory) error {
+	return DefaultRegistry.RegisterTableMiddleware(name, factory)
+}
+
+func (r *Registry) RegisterObjectMiddleware(name string, factory ObjectMiddlewareFactory) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := checkRegistration(ObjectStage, name, factory == nil, r.objects[name] != nil); err != nil {
+		return err
+	}
+	r.objects[name] = factory
+	return nil
+}
+
+func (r *Registry) RegisterRowMiddleware(name string, factory RowMiddlewareFactory) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := checkRegistration(RowStage, name, factory == nil, r.rows[name] != nil); err != nil {
+		return err
+	}
+	r.rows[name] = factory
+	return nil
+}
+
+func (r *Registry) RegisterTableMiddleware(name string, factory TableMiddlewareFactory) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := checkRegistration(TableStage, name, factory == nil, r.tables[name] != nil); err != nil {
+		return err
+	}
+	r.tables[name] = factory
+	return nil
+}
+
+func checkRegistration(kind StageKind, name string, nilFactory bool, exists bool) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.Errorf("empty %s stage name", kind)
+	}
+	if nilFactory {
+		return errors.Errorf("%s stage %s has no factory", kind, name)
+	}
+	if exists {
+		return errors.Errorf("%s stage %s is already registered", kind, name)
+	}
+	return nil
+}
+
+// Names returns the sorted names of the registered stages of the given kind.
+func (r *Registry) Names(kind StageKind) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.names(kind)
+}
+
+func (r *Registry) names(kind StageKind) []string {
+	var ret []string
+	switch kind {
+	case ObjectStage:
+		for name := range r.objects {
+			ret = append(ret, name)
+		}
+	case RowStage:
+		for name := range r.rows {
+			ret = append(ret, name)
+		}
+	case TableStage:
+		for name := range r.tables {
+			ret = append(ret, name)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// ObjectMiddlewares creates the middlewares of the object stages of p.
+func (r *Registry) ObjectMiddlewares(p *Pipeline) ([]middlewares.ObjectMiddleware, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ret := make([]middlewares.ObjectMiddleware, 0, len(p.Object))
+	for i, stage := range p.Object {
+		factory, ok := r.objects[stage.Name]
+		if !ok {
+			return nil, r.unknownStageError(ObjectStage, i, stage)
+		}
+		mw, err := factory(stage.Options)
+		if err != nil {
+			return nil, stageError(ObjectStage, i, stage, err)
+		}
+		ret = append(ret, mw)
+	}
+	return ret, nil
+}
+
+// RowMiddlewares creates the middlewares of the row stages of p.
+func (r *Registry) RowMiddlewares(p *Pipeline) ([]middlewares.RowMiddleware, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ret := make([]middlewares.RowMiddleware, 0, len(p.Row))
+	for i, stage := range p.Row {
+		factory, ok := r.rows[stage.Name]
+		if !ok {
+			return nil, r.unknownStageError(RowStage, i, stage)
+		}
+		mw, err := factory(stage.Options)
+		if err != nil {
+			return nil, stageError(RowStage, i, stage, err)
+		}
+		ret = append(ret, mw)
+	}
+	return ret, nil
+}
+
+// TableMiddlewares creates the middlewares of the table stages of p.
+func (r *Registry) TableMiddlewares(p *Pipeline) ([]middlewares.TableMiddleware, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ret := make([]middlewares.TableMiddleware, 0, len(p.Table))
+	for i, stage := range p.Table {
+		factory, ok := r.tables[stage.Name]
+		if !ok {
+			return nil, r.unknownStageError(TableStage, i, stage)
+		}
+		mw, err := factory(stage.Options)
+		if err != nil {
+			return nil, stageError(TableStage, i, stage, err)
+		}
+		ret = append(ret, mw)
+	}
+	return ret, nil
+}
+
+// Validate checks that every stage of p is registered and that its options
+// are valid, by creating its middlewares. The middlewares are closed again, so
+// that stages holding resources, such as the state of lua stages, release them.
+func (r *Registry) Validate(p *Pipeline) error {
+	ctx := context.Background()
+	objects, err := r.ObjectMiddlewares(p)
+	if err != nil {
+		return err
+	}
+	for _, mw := range objects {
+		_ = mw.Close(ctx)
+	}
+	rows, err := r.RowMiddlewares(p)
+	if err != nil {
+		return err
+	}
+	for _, mw := range rows {
+		_ = mw.Close(ctx)
+	}
+	tables, err := r.TableMiddlewares(p)
+	if err != nil {
+		return err
+	}
+	for _, mw := range tables {
+		_ = mw.Close(ctx)
+	}
+	return nil
+}
+
+// AddMiddlewares appends the middlewares of every stage of p to processor.
+// Nothing is added if a stage is invalid.
+func (r *Registry) AddMiddlewares(processor *middlewares.TableProcessor, p *Pipeline) error {
+	objects, err := r.ObjectMiddlewares(p)
+	if err != nil {
+		return err
+	}
+	rows, err := r.RowMiddlewares(p)
+	if err != nil {
+		return err
+	}
+	tables, err := r.TableMiddlewares(p)
+	if err != nil {
+		return err
+	}
+	processor.AddObjectMiddleware(objects...)
+	processor.AddRowMiddleware(rows...)
+	processor.AddTableMiddleware(tables...)
+	return nil
+}
+
+// NewTableProcessor creates a TableProcessor running the stages of p after the
+// middlewares passed as options.
+func (r *Registry) NewTableProcessor(p *Pipeline, options ...middlewares.TableProcessorOption) (*middlewares.TableProcessor, error) {
+	processor := middlewares.NewTableProcessor(options...)
+	if err := r.AddMiddlewares(processor, p); err != nil {
+		return nil, err
+	}
+	return processor, nil
+}
+
+func (r *Registry) unknownStageError(kind StageKind, i int, stage Stage) error {
+	return errors.Errorf("%s stage %d: unknown stage %q, expected one of %s",
+		kind, i+1, stage.Name, strings.Join(r.names(kind), ", "))
+}
+
+func stageError(kind StageKind, i int, stage Stage, err error) error {
+	return errors.Wrapf(err, "%s stage %d (%s)", kind, i+1, stage.Name)
+}
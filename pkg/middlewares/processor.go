@@ -18,6 +18,9 @@ type TableProcessor struct {
 	Table *types.Table
 
 	preferredColumnOrder []types.FieldName
+
+	workers  int
+	pipeline *parallelPipeline
 }
 
 var _ Processor = (*TableProcessor)(nil)
@@ -112,6 +115,35 @@ func (p *TableProcessor) GetTable() *types.Table {
 }
 
 func (p *TableProcessor) Close(ctx context.Context) error {
+	if p.pipeline != nil {
+		err := p.pipeline.wait()
+		p.pipeline = nil
+		if err != nil {
+			return err
+		}
+	}
+
+	// flush held back rows in order, so that rows flushed by one middleware
+	// reach the downstream flushing middlewares before they are flushed.
+	for i, rm := range p.RowMiddlewares {
+		fm, ok := rm.(FlushingRowMiddleware)
+		if !ok {
+			continue
+		}
+		downstream := p.RowMiddlewares[i+1:]
+		err := fm.Flush(ctx, func(row types.Row) error {
+			rows, err := processRows(ctx, downstream, []types.Row{row})
+			if err != nil {
+				return err
+			}
+			p.collectRows(rows)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
 	for _, tm := range p.TableMiddlewares {
 		table, err := tm.Process(ctx, p.Table)
 		if err != nil {
@@ -147,43 +179,70 @@ func (p *TableProcessor) Close(ctx context.Context) error {
 
 // AddRow runs row through the chain of ObjectMiddlewares, then RowMiddlewares and
 // adds the resulting rows to the table.
+//
+// AddRow must not be called concurrently, see SynchronizedProcessor.
 func (p *TableProcessor) AddRow(ctx context.Context, row types.Row) error {
-	rows := []types.Row{row}
+	if p.workers > 1 {
+		// the middlewares are split up once the first row arrives, as formatters
+		// add their middlewares after the processor is created.
+		if p.pipeline == nil {
+			p.pipeline = p.startParallelPipeline()
+		}
+		return p.pipeline.addRow(ctx, row)
+	}
+
+	rows, err := processObjects(ctx, p.ObjectMiddlewares, []types.Row{row})
+	if err != nil {
+		return err
+	}
+	rows, err = processRows(ctx, p.RowMiddlewares, rows)
+	if err != nil {
+		return err
+	}
+	p.collectRows(rows)
+
+	return nil
+}
 
-	for _, ow := range p.ObjectMiddlewares {
+func processObjects(ctx context.Context, mws []ObjectMiddleware, rows []types.Row) ([]types.Row, error) {
+	for _, ow := range mws {
 		newRows := []types.Row{}
 		for _, row_ := range rows {
 			rows_, err := ow.Process(ctx, row_)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			newRows = append(newRows, rows_...)
 		}
 
 		rows = newRows
 	}
+	return rows, nil
+}
 
-	for _, mw := range p.RowMiddlewares {
+func processRows(ctx context.Context, mws []RowMiddleware, rows []types.Row) ([]types.Row, error) {
+	for _, mw := range mws {
 		newRows := []types.Row{}
 		for _, row_ := range rows {
 			rows_, err := mw.Process(ctx, row_)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			newRows = append(newRows, rows_...)
 		}
 
 		rows = newRows
 	}
+	return rows, nil
+}
 
+func (p *TableProcessor) collectRows(rows []types.Row) {
 	// Only collect table rows if we have table middlewares to actually process them,
 	// otherwise discard the row so that we don't waste memory.
 	if len(p.TableMiddlewares) > 0 {
 		p.Table.AddRows(rows...)
 		p.applyPreferredColumnOrder()
 	}
-
-	return nil
 }
 
 func (p *TableProcessor) AddObjectMiddleware(mw ...ObjectMiddleware) {
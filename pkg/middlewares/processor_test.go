@@ -26,3 +26,50 @@ func TestTableProcessorPreservesPreferredOrderAcrossSparseRows(t *testing.T) {
 
 	require.Equal(t, []types.FieldName{"a", "b"}, processor.Table.Columns)
 }
+
+type processorTestFlushingMiddleware struct {
+	held []types.Row
+}
+
+func (m *processorTestFlushingMiddleware) Process(_ context.Context, row types.Row) ([]types.Row, error) {
+	m.held = append([]types.Row{row}, m.held...)
+	return []types.Row{}, nil
+}
+
+func (m *processorTestFlushingMiddleware) Flush(_ context.Context, emit func(row types.Row) error) error {
+	for _, row := range m.held {
+		if err := emit(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (*processorTestFlushingMiddleware) Close(context.Context) error { return nil }
+
+type processorTestRenameMiddleware struct{}
+
+func (*processorTestRenameMiddleware) Process(_ context.Context, row types.Row) ([]types.Row, error) {
+	v, _ := row.Get("a")
+	return []types.Row{types.NewRow(types.MRP("b", v))}, nil
+}
+
+func (*processorTestRenameMiddleware) Close(context.Context) error { return nil }
+
+func TestTableProcessorFlushesThroughDownstreamRowMiddlewares(t *testing.T) {
+	processor := NewTableProcessor(
+		WithRowMiddleware(&processorTestFlushingMiddleware{}, &processorTestRenameMiddleware{}),
+		WithTableMiddleware(&processorTestTableMiddleware{}),
+	)
+
+	ctx := context.Background()
+	require.NoError(t, processor.AddRow(ctx, types.NewRow(types.MRP("a", 1))))
+	require.NoError(t, processor.AddRow(ctx, types.NewRow(types.MRP("a", 2))))
+	require.Empty(t, processor.Table.Rows)
+
+	require.NoError(t, processor.Close(ctx))
+	require.Len(t, processor.Table.Rows, 2)
+	v, _ := processor.Table.Rows[0].Get("b")
+	require.Equal(t, 2, v)
+	require.Equal(t, []types.FieldName{"b"}, processor.Table.Columns)
+}
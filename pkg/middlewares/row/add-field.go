@@ -31,3 +31,7 @@ func (a *AddFieldMiddleware) Process(ctx context.Context, row types.Row) ([]type
 	}
 	return []types.Row{newValues}, nil
 }
+
+func (a *AddFieldMiddleware) ConcurrencySafe() bool {
+	return true
+}
@@ -0,0 +1,325 @@
+package row
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/helpers/cast"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+)
+
+type CoerceType string
+
+const (
+	CoerceInt      CoerceType = "int"
+	CoerceFloat    CoerceType = "float"
+	CoerceBool     CoerceType = "bool"
+	CoerceTime     CoerceType = "time"
+	CoerceDuration CoerceType = "duration"
+	CoerceJSON     CoerceType = "json"
+	CoerceString   CoerceType = "string"
+)
+
+// CoerceErrorPolicy decides what happens to a value that can't be coerced.
+type CoerceErrorPolicy string
+
+const (
+	// CoerceFail stops processing with an error.
+	CoerceFail CoerceErrorPolicy = "error"
+	// CoerceNull replaces the value with null.
+	CoerceNull CoerceErrorPolicy = "null"
+	// CoerceKeep keeps the original value.
+	CoerceKeep CoerceErrorPolicy = "keep"
+	// CoerceDrop drops the row.
+	CoerceDrop CoerceErrorPolicy = "drop"
+)
+
+// ParseCoerceErrorPolicy validates a policy name.
+func ParseCoerceErrorPolicy(s string) (CoerceErrorPolicy, error) {
+	policy := CoerceErrorPolicy(strings.ToLower(strings.TrimSpace(s)))
+	switch policy {
+	case CoerceFail, CoerceNull, CoerceKeep, CoerceDrop:
+		return policy, nil
+	default:
+		return "", errors.Errorf("unknown coercion error policy %q, expected error, null, keep or drop", s)
+	}
+}
+
+// Coercion describes the type a column is cast to.
+type Coercion struct {
+	Column types.FieldName
+	Type   CoerceType
+	// Layout is the time.Parse layout of CoerceTime. Without a layout, times
+	// are parsed with fields.ParseDate, which accepts most date formats as
+	// well as natural dates such as "yesterday".
+	Layout string
+	// OnError is the policy for values that can't be coerced. It defaults to
+	// CoerceFail.
+	OnError CoerceErrorPolicy
+}
+
+// ParseCoercion parses a coercion spec of the form
+//
+//	column:type[:layout]
+//
+// where type is one of int, float, bool, time, duration, json or string. The
+// layout, which may itself contain colons, is only accepted for time.
+//
+// Examples:
+//
+//	cost:float
+//	created_at:time
+//	day:time:2006-01-02
+func ParseCoercion(spec string) (Coercion, error) {
+	parts := strings.SplitN(strings.TrimSpace(spec), ":", 3)
+	if len(parts) < 2 {
+		return Coercion{}, errors.Errorf("invalid coercion %q, expected column:type[:layout]", spec)
+	}
+	ret := Coercion{
+		Column:  strings.TrimSpace(parts[0]),
+		Type:    CoerceType(strings.ToLower(strings.TrimSpace(parts[1]))),
+		OnError: CoerceFail,
+	}
+	if ret.Column == "" {
+		return Coercion{}, errors.Errorf("empty column in coercion %q", spec)
+	}
+	switch ret.Type {
+	case CoerceInt, CoerceFloat, CoerceBool, CoerceTime, CoerceDuration, CoerceJSON, CoerceString:
+	default:
+		return Coercion{}, errors.Errorf("unknown type %q in coercion %q", parts[1], spec)
+	}
+	if len(parts) == 3 {
+		if ret.Type != CoerceTime {
+			return Coercion{}, errors.Errorf("type %s doesn't take a layout in coercion %q", ret.Type, spec)
+		}
+		ret.Layout = parts[2]
+	}
+	return ret, nil
+}
+
+// ParseCoercions parses a list of coercion specs, see ParseCoercion.
+func ParseCoercions(specs ...string) ([]Coercion, error) {
+	ret := make([]Coercion, 0, len(specs))
+	for _, spec := range specs {
+		c, err := ParseCoercion(spec)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, c)
+	}
+	return ret, nil
+}
+
+// CoerceMiddleware casts the values of columns to a given type, such as the
+// strings read from CSV files to numbers or times.
+//
+// Null and missing values are left alone, and empty strings become null for
+// every type but string. Values that can't be coerced are handled according to
+// the OnError policy of their column. The number of such values per column is
+// available from Failures once the rows have been processed, and is logged as
+// a warning when the middleware is closed.
+type CoerceMiddleware struct {
+	coercions []Coercion
+
+	mu       sync.Mutex
+	failures map[types.FieldName]int
+}
+
+var _ middlewares.RowMiddleware = (*CoerceMiddleware)(nil)
+
+func NewCoerceMiddleware(coercions ...Coercion) *CoerceMiddleware {
+	for i := range coercions {
+		if coercions[i].OnError == "" {
+			coercions[i].OnError = CoerceFail
+		}
+	}
+	return &CoerceMiddleware{
+		coercions: coercions,
+		failures:  map[types.FieldName]int{},
+	}
+}
+
+func (c *CoerceMiddleware) Process(ctx context.Context, row types.Row) ([]types.Row, error) {
+	for _, coercion := range c.coercions {
+		value, ok := row.Get(coercion.Column)
+		if !ok || value == nil {
+			continue
+		}
+
+		coerced, err := coerceValue(value, coercion)
+		if err == nil {
+			row.Set(coercion.Column, coerced)
+			continue
+		}
+
+		c.mu.Lock()
+		c.failures[coercion.Column]++
+		c.mu.Unlock()
+
+		switch coercion.OnError {
+		case CoerceNull:
+			row.Set(coercion.Column, nil)
+		case CoerceKeep:
+		case CoerceDrop:
+			return []types.Row{}, nil
+		default:
+			return nil, errors.Wrapf(err, "could not coerce column %s", coercion.Column)
+		}
+	}
+	return []types.Row{row}, nil
+}
+
+// Failures returns the number of values that couldn't be coerced, per column.
+func (c *CoerceMiddleware) Failures() map[types.FieldName]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ret := make(map[types.FieldName]int, len(c.failures))
+	for column, n := range c.failures {
+		ret[column] = n
+	}
+	return ret
+}
+
+func (c *CoerceMiddleware) ConcurrencySafe() bool {
+	return true
+}
+
+func (c *CoerceMiddleware) Close(ctx context.Context) error {
+	failures := c.Failures()
+	columns := make([]string, 0, len(failures))
+	for column := range failures {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	for _, column := range columns {
+		log.Warn().Str("column", column).Int("failures", failures[column]).Msg("values could not be coerced")
+	}
+	return nil
+}
+
+func coerceValue(value interface{}, coercion Coercion) (interface{}, error) {
+	s, isString := value.(string)
+	if isString {
+		s = strings.TrimSpace(s)
+		if s == "" && coercion.Type != CoerceString {
+			return nil, nil
+		}
+	}
+
+	switch coercion.Type {
+	case CoerceInt:
+		if isString {
+			if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return i, nil
+			}
+			// accept integral floats such as 3.0 or 1e3
+			if f, err := strconv.ParseFloat(s, 64); err == nil && f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+				return int64(f), nil
+			}
+		} else if f, ok := value.(float64); ok {
+			if f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+				return int64(f), nil
+			}
+		} else if f, ok := value.(float32); ok {
+			if float64(f) == math.Trunc(float64(f)) {
+				return int64(f), nil
+			}
+		} else if i, ok := cast.CastNumberInterfaceToInt[int64](value); ok {
+			return i, nil
+		}
+
+	case CoerceFloat:
+		if isString {
+			if f, err := strconv.ParseFloat(s, 64); err == nil {
+				return f, nil
+			}
+		} else if f, ok := cast.CastNumberInterfaceToFloat[float64](value); ok {
+			return f, nil
+		}
+
+	case CoerceBool:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+		if isString {
+			switch strings.ToLower(s) {
+			case "true", "t", "yes", "y", "1", "on":
+				return true, nil
+			case "false", "f", "no", "n", "0", "off":
+				return false, nil
+			}
+		} else if i, ok := cast.CastNumberInterfaceToInt[int64](value); ok && (i == 0 || i == 1) {
+			return i == 1, nil
+		}
+
+	case CoerceTime:
+		switch v := value.(type) {
+		case time.Time:
+			return v, nil
+		case *time.Time:
+			return *v, nil
+		}
+		if isString {
+			if coercion.Layout != "" {
+				t, err := time.Parse(coercion.Layout, s)
+				if err == nil {
+					return t, nil
+				}
+				return nil, errors.Wrapf(err, "could not parse %q as time with layout %q", s, coercion.Layout)
+			}
+			if t, err := fields.ParseDate(s); err == nil {
+				return t, nil
+			}
+		}
+
+	case CoerceDuration:
+		if d, ok := value.(time.Duration); ok {
+			return d, nil
+		}
+		if isString {
+			if d, err := time.ParseDuration(s); err == nil {
+				return d, nil
+			}
+		}
+
+	case CoerceJSON:
+		if !isString {
+			return value, nil
+		}
+		var v interface{}
+		if err := json.Unmarshal([]byte(s), &v); err == nil {
+			return v, nil
+		}
+
+	case CoerceString:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case time.Time:
+			return v.Format(time.RFC3339), nil
+		case []byte:
+			return string(v), nil
+		}
+		switch value.(type) {
+		case map[string]interface{}, []interface{}, types.Row:
+			b, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			return string(b), nil
+		}
+		return fmt.Sprintf("%v", value), nil
+	}
+
+	return nil, errors.Errorf("could not coerce %v (%T) to %s", value, value, coercion.Type)
+}
@@ -0,0 +1,91 @@
+package row
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	assert2 "github.com/go-go-golems/glazed/pkg/helpers/assert"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCoercion(t *testing.T) {
+	c, err := ParseCoercion("day:time:2006-01-02 15:04")
+	require.NoError(t, err)
+	assert.Equal(t, Coercion{Column: "day", Type: CoerceTime, Layout: "2006-01-02 15:04", OnError: CoerceFail}, c)
+
+	for _, spec := range []string{"cost", ":int", "cost:decimal", "cost:int:2006"} {
+		_, err := ParseCoercion(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestCoerceMiddlewareCastsValues(t *testing.T) {
+	coercions, err := ParseCoercions("n:int", "f:float", "b:bool", "d:time:2006-01-02", "dur:duration", "j:json", "s:string", "empty:int")
+	require.NoError(t, err)
+	mw := NewCoerceMiddleware(coercions...)
+
+	newRows, err := processRows(mw, []types.Row{
+		types.NewRow(
+			types.MRP("n", " 42 "),
+			types.MRP("f", "1.5"),
+			types.MRP("b", "yes"),
+			types.MRP("d", "2024-03-01"),
+			types.MRP("dur", "1m30s"),
+			types.MRP("j", `{"a":[1,2]}`),
+			types.MRP("s", 7),
+			types.MRP("empty", ""),
+			types.MRP("other", "x"),
+		),
+	})
+	require.NoError(t, err)
+	require.Len(t, newRows, 1)
+	row := newRows[0]
+	assert2.EqualRowValue(t, int64(42), row, "n")
+	assert2.EqualRowValue(t, 1.5, row, "f")
+	assert2.EqualRowValue(t, true, row, "b")
+	assert2.EqualRowValue(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), row, "d")
+	assert2.EqualRowValue(t, 90*time.Second, row, "dur")
+	assert2.EqualRowValue(t, map[string]interface{}{"a": []interface{}{1.0, 2.0}}, row, "j")
+	assert2.EqualRowValue(t, "7", row, "s")
+	assert2.EqualRowValue(t, nil, row, "empty")
+	assert2.EqualRowValue(t, "x", row, "other")
+	assert.Empty(t, mw.Failures())
+}
+
+func TestCoerceMiddlewareErrorPolicies(t *testing.T) {
+	rows := func() []types.Row {
+		return []types.Row{
+			types.NewRow(types.MRP("id", 1), types.MRP("n", "1")),
+			types.NewRow(types.MRP("id", 2), types.MRP("n", "oops")),
+			types.NewRow(types.MRP("id", 3), types.MRP("n", nil)),
+		}
+	}
+
+	mw := NewCoerceMiddleware(Coercion{Column: "n", Type: CoerceInt})
+	_, err := processRows(mw, rows())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "could not coerce column n")
+
+	mw = NewCoerceMiddleware(Coercion{Column: "n", Type: CoerceInt, OnError: CoerceNull})
+	newRows, err := processRows(mw, rows())
+	require.NoError(t, err)
+	require.Len(t, newRows, 3)
+	assert2.EqualRowValue(t, nil, newRows[1], "n")
+	assert.Equal(t, map[types.FieldName]int{"n": 1}, mw.Failures())
+
+	mw = NewCoerceMiddleware(Coercion{Column: "n", Type: CoerceInt, OnError: CoerceKeep})
+	newRows, err = processRows(mw, rows())
+	require.NoError(t, err)
+	assert2.EqualRowValue(t, "oops", newRows[1], "n")
+
+	mw = NewCoerceMiddleware(Coercion{Column: "n", Type: CoerceInt, OnError: CoerceDrop})
+	newRows, err = processRows(mw, rows())
+	require.NoError(t, err)
+	require.Len(t, newRows, 2)
+	assert2.EqualRowValue(t, 3, newRows[1], "id")
+	assert.Equal(t, map[types.FieldName]int{"n": 1}, mw.Failures())
+	require.NoError(t, mw.Close(context.Background()))
+}
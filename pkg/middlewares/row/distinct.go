@@ -0,0 +1,244 @@
+package row
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"sort"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+)
+
+// distinctKeyBytes is an estimate of the memory used by a key of the exact
+// set, including the overhead of the map.
+const distinctKeyBytes = 48
+
+// bloomFilterHashes is the number of hash functions of the Bloom filter,
+// which is optimal for about 10 bits per key, at a 1% false positive rate.
+const bloomFilterHashes = 7
+
+// DistinctMiddleware drops every row whose key was already seen, anywhere in
+// the input, unlike RemoveDuplicatesMiddleware which only compares a row to
+// the previous one. The key is made of the values of the given columns, or of
+// all columns and their values, in any order, if no column is given.
+//
+// Keys are remembered as 128-bit hashes. Without a memory budget, all of them
+// are kept in a set. With a budget, the set is replaced by a Bloom filter of
+// that size once it grows larger, which bounds the memory but drops distinct
+// rows whose key is a false positive of the filter, about 1% of them when the
+// filter holds one key per 10 bits. The filter keeps the size of the budget,
+// so its false positive rate grows with the number of keys: the rate
+// estimated from the number of keys it holds is available from
+// FalsePositiveRate and is logged, along with the number of dropped rows, when
+// the middleware is closed.
+//
+// Values are compared as strings, as by JoinMiddleware, so that the number 1
+// and the string "1" are the same value, while missing and null values are
+// different from every other value.
+type DistinctMiddleware struct {
+	columns      []types.FieldName
+	memoryBudget int
+
+	seen    map[[16]byte]struct{}
+	bloom   *bloomFilter
+	dropped int
+}
+
+var _ middlewares.RowMiddleware = (*DistinctMiddleware)(nil)
+
+type DistinctOption func(*DistinctMiddleware)
+
+// WithDistinctMemoryBudget bounds the memory used to remember keys to about
+// the given number of bytes, falling back to a Bloom filter. 0 means no bound.
+func WithDistinctMemoryBudget(bytes int) DistinctOption {
+	return func(d *DistinctMiddleware) {
+		d.memoryBudget = bytes
+	}
+}
+
+func NewDistinctMiddleware(columns []types.FieldName, options ...DistinctOption) *DistinctMiddleware {
+	ret := &DistinctMiddleware{
+		columns: columns,
+		seen:    map[[16]byte]struct{}{},
+	}
+	for _, option := range options {
+		option(ret)
+	}
+	return ret
+}
+
+func (d *DistinctMiddleware) Process(ctx context.Context, row types.Row) ([]types.Row, error) {
+	key := d.key(row)
+
+	if d.bloom != nil {
+		if !d.bloom.add(key) {
+			d.dropped++
+			return []types.Row{}, nil
+		}
+		return []types.Row{row}, nil
+	}
+
+	if _, ok := d.seen[key]; ok {
+		d.dropped++
+		return []types.Row{}, nil
+	}
+	d.seen[key] = struct{}{}
+	if d.memoryBudget > 0 && len(d.seen)*distinctKeyBytes > d.memoryBudget {
+		d.switchToBloomFilter()
+	}
+	return []types.Row{row}, nil
+}
+
+// Dropped returns the number of rows dropped so far.
+func (d *DistinctMiddleware) Dropped() int {
+	return d.dropped
+}
+
+// IsApproximate returns true if the keys are remembered in a Bloom filter,
+// in which case some distinct rows may have been dropped.
+func (d *DistinctMiddleware) IsApproximate() bool {
+	return d.bloom != nil
+}
+
+// FalsePositiveRate returns the estimated probability that a distinct row is
+// dropped at this point, which is 0 unless the keys are remembered in a Bloom
+// filter.
+func (d *DistinctMiddleware) FalsePositiveRate() float64 {
+	if d.bloom == nil {
+		return 0
+	}
+	return d.bloom.falsePositiveRate()
+}
+
+func (d *DistinctMiddleware) Close(ctx context.Context) error {
+	switch {
+	case d.bloom != nil:
+		log.Warn().
+			Int("dropped", d.dropped).
+			Float64("false-positive-rate", d.FalsePositiveRate()).
+			Msg("dropped duplicate rows, and possibly distinct rows, using a Bloom filter")
+	case d.dropped > 0:
+		log.Warn().
+			Int("dropped", d.dropped).
+			Msg("dropped duplicate rows")
+	}
+	d.seen = nil
+	d.bloom = nil
+	return nil
+}
+
+func (d *DistinctMiddleware) switchToBloomFilter() {
+	log.Warn().
+		Int("keys", len(d.seen)).
+		Int("memory-budget", d.memoryBudget).
+		Msg("distinct keys exceed the memory budget, falling back to a Bloom filter")
+	d.bloom = newBloomFilter(d.memoryBudget * 8)
+	for key := range d.seen {
+		d.bloom.add(key)
+	}
+	d.seen = nil
+}
+
+// key hashes the values of the key columns, or the columns and values of the
+// whole row. Strings are prefixed with their length so that values can't run
+// into each other.
+func (d *DistinctMiddleware) key(row types.Row) [16]byte {
+	hash := fnv.New128a()
+	var length [8]byte
+	writeString := func(s string) {
+		binary.LittleEndian.PutUint64(length[:], uint64(len(s)))
+		_, _ = hash.Write(length[:])
+		_, _ = hash.Write([]byte(s))
+	}
+	writeValue := func(v interface{}, ok bool) {
+		switch {
+		case !ok:
+			_, _ = hash.Write([]byte{0})
+		case v == nil:
+			_, _ = hash.Write([]byte{1})
+		default:
+			_, _ = hash.Write([]byte{2})
+			writeString(distinctKeyValue(v))
+		}
+	}
+
+	if len(d.columns) == 0 {
+		// rows with the same values in a different column order are the same
+		columns := types.GetFields(row)
+		sort.Strings(columns)
+		for _, column := range columns {
+			v, _ := row.Get(column)
+			writeString(column)
+			writeValue(v, true)
+		}
+	} else {
+		for _, column := range d.columns {
+			v, ok := row.Get(column)
+			writeValue(v, ok)
+		}
+	}
+
+	var ret [16]byte
+	hash.Sum(ret[:0])
+	return ret
+}
+
+func distinctKeyValue(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}, types.Row:
+		b, err := json.Marshal(v)
+		if err == nil {
+			return string(b)
+		}
+	}
+	return joinKeyValue(v)
+}
+
+// bloomFilter is a Bloom filter over 128-bit hashes, using the two halves of
+// the hash for double hashing.
+type bloomFilter struct {
+	bits []uint64
+	m    uint64
+	// n is the number of keys added to the filter.
+	n int
+}
+
+func newBloomFilter(m int) *bloomFilter {
+	if m < 64 {
+		m = 64
+	}
+	return &bloomFilter{
+		bits: make([]uint64, (m+63)/64),
+		m:    uint64(m),
+	}
+}
+
+// add adds the key to the filter and returns false if it was possibly already
+// present.
+func (b *bloomFilter) add(key [16]byte) bool {
+	h1 := binary.LittleEndian.Uint64(key[:8])
+	h2 := binary.LittleEndian.Uint64(key[8:]) | 1
+	added := false
+	for i := uint64(0); i < bloomFilterHashes; i++ {
+		bit, _ := bits.Mul64(h1+i*h2, b.m)
+		word, mask := bit/64, uint64(1)<<(bit%64)
+		if b.bits[word]&mask == 0 {
+			b.bits[word] |= mask
+			added = true
+		}
+	}
+	if added {
+		b.n++
+	}
+	return added
+}
+
+// falsePositiveRate estimates the probability that a new key is reported as
+// present, (1 - e^(-kn/m))^k for k hashes, n keys and m bits.
+func (b *bloomFilter) falsePositiveRate() float64 {
+	return math.Pow(1-math.Exp(-bloomFilterHashes*float64(b.n)/float64(b.m)), bloomFilterHashes)
+}
@@ -0,0 +1,88 @@
+package row
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDistinctMiddlewareDropsNonAdjacentDuplicates(t *testing.T) {
+	mw := NewDistinctMiddleware(nil)
+	newRows, err := processRows(mw, []types.Row{
+		types.NewRow(types.MRP("a", 1), types.MRP("b", "x")),
+		types.NewRow(types.MRP("a", 2), types.MRP("b", "x")),
+		types.NewRow(types.MRP("b", "x"), types.MRP("a", 1)),
+		types.NewRow(types.MRP("a", "1"), types.MRP("b", "x")),
+		types.NewRow(types.MRP("a", nil), types.MRP("b", "x")),
+		types.NewRow(types.MRP("b", "x")),
+		types.NewRow(types.MRP("a", nil), types.MRP("b", "x")),
+		types.NewRow(types.MRP("a", []interface{}{1, 2}), types.MRP("b", "x")),
+		types.NewRow(types.MRP("a", []interface{}{1, 2}), types.MRP("b", "x")),
+	})
+	require.NoError(t, err)
+	assert.Len(t, newRows, 5)
+	assert.Equal(t, 4, mw.Dropped())
+	assert.False(t, mw.IsApproximate())
+	require.NoError(t, mw.Close(context.Background()))
+}
+
+func TestDistinctMiddlewareComparesKeyColumns(t *testing.T) {
+	mw := NewDistinctMiddleware([]types.FieldName{"user", "day"})
+	newRows, err := processRows(mw, []types.Row{
+		types.NewRow(types.MRP("user", "ada"), types.MRP("day", 1), types.MRP("n", 1)),
+		types.NewRow(types.MRP("user", "bob"), types.MRP("day", 1), types.MRP("n", 2)),
+		types.NewRow(types.MRP("user", "ada"), types.MRP("day", 1), types.MRP("n", 3)),
+		types.NewRow(types.MRP("user", "ada"), types.MRP("n", 4)),
+		types.NewRow(types.MRP("user", "ada"), types.MRP("day", nil), types.MRP("n", 5)),
+		// values can't run into each other
+		types.NewRow(types.MRP("user", "ad"), types.MRP("day", "a1"), types.MRP("n", 6)),
+	})
+	require.NoError(t, err)
+	ns := []interface{}{}
+	for _, row := range newRows {
+		n, _ := row.Get("n")
+		ns = append(ns, n)
+	}
+	assert.Equal(t, []interface{}{1, 2, 4, 5, 6}, ns)
+}
+
+func TestDistinctMiddlewareFallsBackToBloomFilter(t *testing.T) {
+	mw := NewDistinctMiddleware([]types.FieldName{"id"}, WithDistinctMemoryBudget(64*1024))
+	rows := []types.Row{}
+	for i := 0; i < 20000; i++ {
+		rows = append(rows, types.NewRow(types.MRP("id", i%10000)))
+	}
+	newRows, err := processRows(mw, rows)
+	require.NoError(t, err)
+	assert.True(t, mw.IsApproximate())
+	// 64KB hold about 52k keys at 1% false positives: every duplicate is
+	// dropped, and only a few distinct rows are
+	assert.InDelta(t, 10000, len(newRows), 100)
+	assert.LessOrEqual(t, len(newRows), 10000)
+	assert.Equal(t, 20000-len(newRows), mw.Dropped())
+	assert.Greater(t, mw.FalsePositiveRate(), 0.0)
+	assert.Less(t, mw.FalsePositiveRate(), 0.001)
+}
+
+func TestDistinctMiddlewareEstimatesFalsePositiveRate(t *testing.T) {
+	mw := NewDistinctMiddleware([]types.FieldName{"id"})
+	_, err := processRows(mw, []types.Row{types.NewRow(types.MRP("id", 1))})
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, mw.FalsePositiveRate())
+
+	// the filter keeps its size: once it holds more keys than it was sized for,
+	// the rate grows well beyond 1%
+	mw = NewDistinctMiddleware([]types.FieldName{"id"}, WithDistinctMemoryBudget(1024))
+	rows := []types.Row{}
+	for i := 0; i < 5000; i++ {
+		rows = append(rows, types.NewRow(types.MRP("id", i)))
+	}
+	newRows, err := processRows(mw, rows)
+	require.NoError(t, err)
+	require.True(t, mw.IsApproximate())
+	assert.Greater(t, mw.FalsePositiveRate(), 0.1)
+	assert.Equal(t, len(rows)-len(newRows), mw.Dropped())
+}
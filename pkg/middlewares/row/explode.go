@@ -0,0 +1,178 @@
+package row
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	orderedmap "github.com/wk8/go-ordered-map/v2"
+)
+
+// ExplodeMiddleware expands a list-valued field into one row per element.
+//
+// Scalar elements replace the list in the field. Object elements (maps and
+// rows) are flattened with FlattenRow and merged into the row instead, their
+// keys prefixed with "field." by default, the way FlattenObjectMiddleware names
+// nested fields. This way the output formats that flatten rows before any
+// other middleware runs, such as CSV, still get flat rows. The other
+// fields of the row are copied into every output row, in their original order.
+//
+// Rows where the field is missing, null or an empty list are kept with a null
+// field, unless WithDropEmpty is used. Rows where the field isn't a list are
+// passed through unchanged.
+type ExplodeMiddleware struct {
+	field       types.FieldName
+	indexColumn types.FieldName
+	prefix      string
+	dropEmpty   bool
+}
+
+var _ middlewares.RowMiddleware = (*ExplodeMiddleware)(nil)
+
+type ExplodeOption func(*ExplodeMiddleware)
+
+// WithIndexColumn adds a column holding the position of the element in the
+// list, starting at 0.
+func WithIndexColumn(column types.FieldName) ExplodeOption {
+	return func(e *ExplodeMiddleware) {
+		e.indexColumn = column
+	}
+}
+
+// WithObjectPrefix sets the prefix of the keys of object elements. An empty
+// prefix merges the keys as they are, overwriting fields of the same name.
+func WithObjectPrefix(prefix string) ExplodeOption {
+	return func(e *ExplodeMiddleware) {
+		e.prefix = prefix
+	}
+}
+
+// WithDropEmpty drops rows where the field is missing, null or an empty list.
+func WithDropEmpty() ExplodeOption {
+	return func(e *ExplodeMiddleware) {
+		e.dropEmpty = true
+	}
+}
+
+func NewExplodeMiddleware(field types.FieldName, options ...ExplodeOption) *ExplodeMiddleware {
+	ret := &ExplodeMiddleware{
+		field:  field,
+		prefix: field + ".",
+	}
+	for _, option := range options {
+		option(ret)
+	}
+	return ret
+}
+
+func (e *ExplodeMiddleware) Process(ctx context.Context, row types.Row) ([]types.Row, error) {
+	value, ok := row.Get(e.field)
+	var elements []interface{}
+	if ok && value != nil {
+		var isList bool
+		elements, isList = listElements(value)
+		if !isList {
+			return []types.Row{row}, nil
+		}
+	}
+
+	if len(elements) == 0 {
+		if e.dropEmpty {
+			return []types.Row{}, nil
+		}
+		return []types.Row{e.explodedRow(row, -1, nil)}, nil
+	}
+
+	ret := make([]types.Row, 0, len(elements))
+	for i, element := range elements {
+		ret = append(ret, e.explodedRow(row, i, element))
+	}
+	return ret, nil
+}
+
+// explodedRow copies row, replacing the field with the element. An index of -1
+// marks the null row of an empty list.
+func (e *ExplodeMiddleware) explodedRow(row types.Row, index int, element interface{}) types.Row {
+	ret := types.NewRow()
+	for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+		if pair.Key != e.field {
+			// keys merged from objects with an empty prefix win over the row
+			if _, ok := ret.Get(pair.Key); !ok {
+				ret.Set(pair.Key, pair.Value)
+			}
+			continue
+		}
+
+		if e.indexColumn != "" {
+			if index < 0 {
+				ret.Set(e.indexColumn, nil)
+			} else {
+				ret.Set(e.indexColumn, index)
+			}
+		}
+
+		object, isObject := objectElement(element)
+		if !isObject {
+			ret.Set(e.field, element)
+			continue
+		}
+		for pair_ := FlattenRow(object).Oldest(); pair_ != nil; pair_ = pair_.Next() {
+			ret.Set(e.prefix+pair_.Key, pair_.Value)
+		}
+	}
+
+	if _, ok := row.Get(e.field); !ok {
+		if e.indexColumn != "" {
+			ret.Set(e.indexColumn, nil)
+		}
+		ret.Set(e.field, nil)
+	}
+
+	return ret
+}
+
+func (e *ExplodeMiddleware) ConcurrencySafe() bool {
+	return true
+}
+
+func (e *ExplodeMiddleware) Close(ctx context.Context) error {
+	return nil
+}
+
+// listElements returns the elements of a slice or array of any type.
+func listElements(value interface{}) ([]interface{}, bool) {
+	if l, ok := value.([]interface{}); ok {
+		return l, true
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, false
+	}
+	// byte slices are values, not lists
+	if v.Type().Elem().Kind() == reflect.Uint8 {
+		return nil, false
+	}
+	ret := make([]interface{}, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		ret[i] = v.Index(i).Interface()
+	}
+	return ret, true
+}
+
+func objectElement(element interface{}) (types.Row, bool) {
+	switch v := element.(type) {
+	case types.Row:
+		return v, true
+	case map[string]interface{}:
+		return types.NewRowFromMap(v), true
+	case *orderedmap.OrderedMap[string, string]:
+		ret := types.NewRow()
+		for pair := v.Oldest(); pair != nil; pair = pair.Next() {
+			ret.Set(pair.Key, pair.Value)
+		}
+		return ret, true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,95 @@
+package row
+
+import (
+	"testing"
+
+	assert2 "github.com/go-go-golems/glazed/pkg/helpers/assert"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplodeMiddlewareScalars(t *testing.T) {
+	mw := NewExplodeMiddleware("tags", WithIndexColumn("tags_index"))
+
+	newRows, err := processRows(mw, []types.Row{
+		types.NewRow(types.MRP("id", 1), types.MRP("tags", []string{"a", "b"}), types.MRP("owner", "ada")),
+	})
+	require.NoError(t, err)
+	require.Len(t, newRows, 2)
+
+	assert.Equal(t, []types.FieldName{"id", "tags_index", "tags", "owner"}, types.GetFields(newRows[0]))
+	assert2.EqualRowValue(t, 0, newRows[0], "tags_index")
+	assert2.EqualRowValue(t, "a", newRows[0], "tags")
+	assert2.EqualRowValue(t, 1, newRows[1], "tags_index")
+	assert2.EqualRowValue(t, "b", newRows[1], "tags")
+	assert2.EqualRowValue(t, "ada", newRows[1], "owner")
+}
+
+func TestExplodeMiddlewareObjects(t *testing.T) {
+	mw := NewExplodeMiddleware("items")
+
+	newRows, err := processRows(mw, []types.Row{
+		types.NewRow(types.MRP("order", 7), types.MRP("items", []interface{}{
+			map[string]interface{}{"sku": "x", "qty": 2},
+			map[string]interface{}{"sku": "y", "qty": 1},
+		})),
+	})
+	require.NoError(t, err)
+	require.Len(t, newRows, 2)
+	assert.Equal(t, []types.FieldName{"order", "items.qty", "items.sku"}, types.GetFields(newRows[0]))
+	assert2.EqualRowValue(t, "y", newRows[1], "items.sku")
+	assert2.EqualRowValue(t, 7, newRows[1], "order")
+}
+
+func TestExplodeMiddlewareFlattensNestedObjects(t *testing.T) {
+	mw := NewExplodeMiddleware("items")
+
+	newRows, err := processRows(mw, []types.Row{
+		types.NewRow(types.MRP("order", 7), types.MRP("items", []interface{}{
+			types.NewRow(types.MRP("sku", "x"), types.MRP("dim", map[string]interface{}{"w": 1})),
+		})),
+	})
+	require.NoError(t, err)
+	require.Len(t, newRows, 1)
+	assert.Equal(t, []types.FieldName{"order", "items.sku", "items.dim.w"}, types.GetFields(newRows[0]))
+	assert2.EqualRowValue(t, 1, newRows[0], "items.dim.w")
+}
+
+func TestExplodeMiddlewareObjectsWithoutPrefix(t *testing.T) {
+	mw := NewExplodeMiddleware("items", WithObjectPrefix(""))
+
+	newRows, err := processRows(mw, []types.Row{
+		types.NewRow(
+			types.MRP("sku", "parent"),
+			types.MRP("items", []interface{}{types.NewRow(types.MRP("sku", "x"))}),
+			types.MRP("note", "n"),
+		),
+	})
+	require.NoError(t, err)
+	require.Len(t, newRows, 1)
+	assert.Equal(t, []types.FieldName{"sku", "note"}, types.GetFields(newRows[0]))
+	assert2.EqualRowValue(t, "x", newRows[0], "sku")
+}
+
+func TestExplodeMiddlewareEmptyValues(t *testing.T) {
+	rows := []types.Row{
+		types.NewRow(types.MRP("id", 1), types.MRP("tags", []interface{}{})),
+		types.NewRow(types.MRP("id", 2), types.MRP("tags", nil)),
+		types.NewRow(types.MRP("id", 3)),
+		types.NewRow(types.MRP("id", 4), types.MRP("tags", "scalar")),
+	}
+
+	newRows, err := processRows(NewExplodeMiddleware("tags"), rows)
+	require.NoError(t, err)
+	require.Len(t, newRows, 4)
+	for _, row := range newRows[:3] {
+		assert2.EqualRowValue(t, nil, row, "tags")
+	}
+	assert2.EqualRowValue(t, "scalar", newRows[3], "tags")
+
+	newRows, err = processRows(NewExplodeMiddleware("tags", WithDropEmpty()), rows)
+	require.NoError(t, err)
+	require.Len(t, newRows, 1)
+	assert2.EqualRowValue(t, 4, newRows[0], "id")
+}
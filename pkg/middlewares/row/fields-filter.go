@@ -4,6 +4,7 @@ import (
 	"context"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/go-go-golems/glazed/pkg/middlewares"
 	"github.com/go-go-golems/glazed/pkg/types"
@@ -25,6 +26,8 @@ type FieldsFilterMiddleware struct {
 	regexFilters  []*regexp.Regexp
 
 	newColumns map[types.FieldName]interface{}
+	// mu guards newColumns, as Process can be called concurrently.
+	mu sync.Mutex
 }
 
 type FieldsFilterOption func(*FieldsFilterMiddleware)
@@ -111,7 +114,10 @@ func (ffm *FieldsFilterMiddleware) Process(ctx context.Context, row types.Row) (
 		rowField, value := pair.Key, pair.Value
 
 		// skip if we already filtered that field
-		if _, ok := ffm.newColumns[rowField]; !ok {
+		ffm.mu.Lock()
+		_, ok := ffm.newColumns[rowField]
+		ffm.mu.Unlock()
+		if !ok {
 			exactMatchFound := false
 			prefixMatchFound := false
 			regexMatchFound := false
@@ -203,7 +209,9 @@ func (ffm *FieldsFilterMiddleware) Process(ctx context.Context, row types.Row) (
 			}
 
 			if shouldInclude {
+				ffm.mu.Lock()
 				ffm.newColumns[rowField] = nil
+				ffm.mu.Unlock()
 				newRow.Set(rowField, value)
 			}
 		} else {
@@ -213,3 +221,7 @@ func (ffm *FieldsFilterMiddleware) Process(ctx context.Context, row types.Row) (
 
 	return []types.Row{newRow}, nil
 }
+
+func (ffm *FieldsFilterMiddleware) ConcurrencySafe() bool {
+	return true
+}
@@ -26,6 +26,10 @@ func (fom *FlattenObjectMiddleware) Process(ctx context.Context, row types.Row)
 	return []types.Row{newRow}, nil
 }
 
+func (fom *FlattenObjectMiddleware) ConcurrencySafe() bool {
+	return true
+}
+
 func FlattenRow(row types.Row) types.Row {
 	ret := types.NewRow()
 
@@ -0,0 +1,367 @@
+package row
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-go-golems/glazed/pkg/helpers/csv"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+type JoinType string
+
+const (
+	// JoinInner drops rows without a match in the lookup dataset.
+	JoinInner JoinType = "inner"
+	// JoinLeft keeps rows without a match, with null lookup columns.
+	JoinLeft JoinType = "left"
+)
+
+// JoinKey pairs a column of the input rows with a column of the lookup dataset.
+type JoinKey struct {
+	Left  types.FieldName
+	Right types.FieldName
+}
+
+// ParseJoinKeys parses key specs of the form column or left=right, where left
+// is a column of the input rows and right a column of the lookup dataset.
+func ParseJoinKeys(specs ...string) ([]JoinKey, error) {
+	ret := make([]JoinKey, 0, len(specs))
+	for _, spec := range specs {
+		left, right, found := strings.Cut(spec, "=")
+		left, right = strings.TrimSpace(left), strings.TrimSpace(right)
+		if !found {
+			right = left
+		}
+		if left == "" || right == "" {
+			return nil, errors.Errorf("invalid join key %q, expected column or left=right", spec)
+		}
+		ret = append(ret, JoinKey{Left: left, Right: right})
+	}
+	return ret, nil
+}
+
+// JoinMiddleware enriches rows with the columns of the matching rows of a
+// lookup dataset, using a hash join: the lookup dataset is indexed once, and
+// the input rows are streamed through and probe the index.
+//
+// A row matching several lookup rows is output once per match. Key values are
+// compared by their string representation, so that the number 1 read from JSON
+// matches the string "1" read from CSV. Rows with a null or missing key never
+// match.
+//
+// Lookup columns that are not keys and that conflict with a column of the
+// input row are prefixed with the conflict prefix, as many times as needed for
+// the name not to be used by the input row or another lookup column, so that
+// no value is overwritten.
+type JoinMiddleware struct {
+	joinType       JoinType
+	keys           []JoinKey
+	conflictPrefix string
+
+	index map[string][]types.Row
+	// columns are the non-key columns of the lookup dataset, in order of
+	// appearance. They are set to null in unmatched rows of a left join.
+	columns []types.FieldName
+}
+
+var _ middlewares.RowMiddleware = (*JoinMiddleware)(nil)
+
+type JoinOption func(*JoinMiddleware)
+
+// WithJoinType sets the join type, which defaults to JoinInner.
+func WithJoinType(joinType JoinType) JoinOption {
+	return func(j *JoinMiddleware) {
+		j.joinType = joinType
+	}
+}
+
+// WithConflictPrefix sets the prefix of lookup columns that conflict with
+// columns of the input rows. It defaults to "join_".
+func WithConflictPrefix(prefix string) JoinOption {
+	return func(j *JoinMiddleware) {
+		j.conflictPrefix = prefix
+	}
+}
+
+// NewJoinMiddleware indexes the lookup dataset on the right-hand side of keys.
+func NewJoinMiddleware(lookup []types.Row, keys []JoinKey, options ...JoinOption) (*JoinMiddleware, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("join requires at least one key column")
+	}
+
+	ret := &JoinMiddleware{
+		joinType:       JoinInner,
+		keys:           keys,
+		conflictPrefix: "join_",
+		index:          map[string][]types.Row{},
+	}
+	for _, option := range options {
+		option(ret)
+	}
+
+	switch ret.joinType {
+	case JoinInner, JoinLeft:
+	default:
+		return nil, errors.Errorf("unknown join type %q", ret.joinType)
+	}
+	if ret.conflictPrefix == "" {
+		return nil, errors.New("join conflict prefix must not be empty")
+	}
+
+	rightKeys := map[types.FieldName]struct{}{}
+	for _, key := range keys {
+		rightKeys[key.Right] = struct{}{}
+	}
+	seenColumns := map[types.FieldName]struct{}{}
+
+	for _, row := range lookup {
+		for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+			if _, ok := rightKeys[pair.Key]; ok {
+				continue
+			}
+			if _, ok := seenColumns[pair.Key]; !ok {
+				seenColumns[pair.Key] = struct{}{}
+				ret.columns = append(ret.columns, pair.Key)
+			}
+		}
+
+		key, ok := joinKey(row, keys, func(k JoinKey) types.FieldName { return k.Right })
+		if !ok {
+			continue
+		}
+		ret.index[key] = append(ret.index[key], row)
+	}
+
+	return ret, nil
+}
+
+func (j *JoinMiddleware) Process(ctx context.Context, row types.Row) ([]types.Row, error) {
+	key, ok := joinKey(row, j.keys, func(k JoinKey) types.FieldName { return k.Left })
+	var matches []types.Row
+	if ok {
+		matches = j.index[key]
+	}
+
+	if len(matches) == 0 {
+		if j.joinType == JoinInner {
+			return []types.Row{}, nil
+		}
+		newRow := types.NewRow()
+		for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+			newRow.Set(pair.Key, pair.Value)
+		}
+		for _, column := range j.outputColumns(row) {
+			newRow.Set(column, nil)
+		}
+		return []types.Row{newRow}, nil
+	}
+
+	columns := j.outputColumns(row)
+	ret := make([]types.Row, 0, len(matches))
+	for _, match := range matches {
+		newRow := types.NewRow()
+		for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+			newRow.Set(pair.Key, pair.Value)
+		}
+		for i, column := range j.columns {
+			value, _ := match.Get(column)
+			newRow.Set(columns[i], value)
+		}
+		ret = append(ret, newRow)
+	}
+	return ret, nil
+}
+
+// outputColumns returns the names of the lookup columns in the output row.
+// Columns that don't conflict with the input row keep their name, and only
+// then are the conflicting ones prefixed until their name is unused.
+func (j *JoinMiddleware) outputColumns(row types.Row) []types.FieldName {
+	used := map[types.FieldName]bool{}
+	for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+		used[pair.Key] = true
+	}
+
+	ret := make([]types.FieldName, len(j.columns))
+	conflicts := make([]bool, len(j.columns))
+	for i, column := range j.columns {
+		if used[column] {
+			conflicts[i] = true
+			continue
+		}
+		ret[i] = column
+		used[column] = true
+	}
+	for i, column := range j.columns {
+		if !conflicts[i] {
+			continue
+		}
+		name := j.conflictPrefix + column
+		for used[name] {
+			name = j.conflictPrefix + name
+		}
+		used[name] = true
+		ret[i] = name
+	}
+	return ret
+}
+
+func (j *JoinMiddleware) ConcurrencySafe() bool {
+	return true
+}
+
+func (j *JoinMiddleware) Close(ctx context.Context) error {
+	return nil
+}
+
+// joinKey computes the hash key of a row. It returns false if one of the key
+// columns is null or missing.
+func joinKey(row types.Row, keys []JoinKey, column func(JoinKey) types.FieldName) (string, bool) {
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value, ok := row.Get(column(key))
+		if !ok || value == nil {
+			return "", false
+		}
+		parts = append(parts, joinKeyValue(value))
+	}
+	return strings.Join(parts, "\x00"), true
+}
+
+// joinKeyValue formats a key value so that numbers of different types, such as
+// the float64 values decoded from JSON and the ints of YAML, compare equal.
+// Integers are formatted exactly, so that large IDs don't collide.
+func joinKeyValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.FormatInt(int64(v), 10)
+	case int8:
+		return strconv.FormatInt(int64(v), 10)
+	case int16:
+		return strconv.FormatInt(int64(v), 10)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// LoadDataset reads a lookup dataset from a CSV, TSV, JSON or YAML file, picked
+// by extension. JSON and YAML files hold either a single object or a list of
+// objects, and CSV files have a header row.
+func LoadDataset(path string) (*types.Table, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not open %s", path)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var rows []types.Row
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		rows, err = readCSVDataset(f)
+	case ".tsv":
+		rows, err = readCSVDataset(f, csv.WithComma('\t'))
+	case ".json":
+		reader := bufio.NewReader(f)
+		if isJSONArray(reader) {
+			err = json.NewDecoder(reader).Decode(&rows)
+		} else {
+			row := types.NewRow()
+			err = json.NewDecoder(reader).Decode(&row)
+			rows = []types.Row{row}
+		}
+	case ".yaml", ".yml":
+		reader := bufio.NewReader(f)
+		if isYAMLSequence(reader) {
+			err = yaml.NewDecoder(reader).Decode(&rows)
+		} else {
+			row := types.NewRow()
+			err = yaml.NewDecoder(reader).Decode(&row)
+			rows = []types.Row{row}
+		}
+		if err == io.EOF {
+			rows, err = nil, nil
+		}
+	default:
+		return nil, errors.Errorf("unsupported file %s, expected .csv, .tsv, .json or .yaml", path)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read %s", path)
+	}
+
+	ret := types.NewTable()
+	ret.AddRows(rows...)
+	return ret, nil
+}
+
+func readCSVDataset(r io.Reader, options ...csv.ParseCSVOption) ([]types.Row, error) {
+	header, records, err := csv.ParseCSV(r, options...)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]types.Row, 0, len(records))
+	for _, record := range records {
+		ret = append(ret, types.NewRowFromMapWithColumns(record, header))
+	}
+	return ret, nil
+}
+
+// isJSONArray peeks at the first non-whitespace character of r.
+func isJSONArray(r *bufio.Reader) bool {
+	for i := 1; ; i++ {
+		b, err := r.Peek(i)
+		if err != nil || len(b) < i {
+			return false
+		}
+		switch b[i-1] {
+		case ' ', '\t', '\r', '\n':
+			continue
+		default:
+			return b[i-1] == '['
+		}
+	}
+}
+
+// isYAMLSequence returns true if the first line that isn't blank, a comment or
+// a document separator starts a block or flow sequence.
+func isYAMLSequence(r *bufio.Reader) bool {
+	b, _ := r.Peek(64 * 1024)
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line == "---" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		return line == "-" || strings.HasPrefix(line, "- ") || strings.HasPrefix(line, "[")
+	}
+	return false
+}
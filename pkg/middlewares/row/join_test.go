@@ -0,0 +1,136 @@
+package row
+
+import (
+	"testing"
+
+	assert2 "github.com/go-go-golems/glazed/pkg/helpers/assert"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createJoinLookup() []types.Row {
+	return []types.Row{
+		types.NewRow(types.MRP("id", "1"), types.MRP("name", "Infrastructure"), types.MRP("cost_center", "CC-1")),
+		types.NewRow(types.MRP("id", "2"), types.MRP("name", "Web"), types.MRP("cost_center", "CC-2")),
+		types.NewRow(types.MRP("id", "2"), types.MRP("name", "Web (legacy)"), types.MRP("cost_center", "CC-9")),
+	}
+}
+
+func createJoinRows() []types.Row {
+	return []types.Row{
+		types.NewRow(types.MRP("name", "build"), types.MRP("team_id", 1.0)),
+		types.NewRow(types.MRP("name", "deploy"), types.MRP("team_id", 2)),
+		types.NewRow(types.MRP("name", "lint"), types.MRP("team_id", 3)),
+		types.NewRow(types.MRP("name", "test")),
+	}
+}
+
+func TestJoinMiddlewareInnerJoin(t *testing.T) {
+	keys, err := ParseJoinKeys("team_id=id")
+	require.NoError(t, err)
+	mw, err := NewJoinMiddleware(createJoinLookup(), keys)
+	require.NoError(t, err)
+
+	newRows, err := processRows(mw, createJoinRows())
+	require.NoError(t, err)
+	require.Len(t, newRows, 3)
+
+	assert.Equal(t, []types.FieldName{"name", "team_id", "join_name", "cost_center"}, types.GetFields(newRows[0]))
+	assert2.EqualRowValue(t, "build", newRows[0], "name")
+	assert2.EqualRowValue(t, "Infrastructure", newRows[0], "join_name")
+	assert2.EqualRowValue(t, "CC-1", newRows[0], "cost_center")
+	assert2.EqualRowValue(t, "Web", newRows[1], "join_name")
+	assert2.EqualRowValue(t, "Web (legacy)", newRows[2], "join_name")
+}
+
+func TestJoinMiddlewareLeftJoin(t *testing.T) {
+	keys, err := ParseJoinKeys("team_id=id")
+	require.NoError(t, err)
+	mw, err := NewJoinMiddleware(createJoinLookup(), keys, WithJoinType(JoinLeft), WithConflictPrefix("team_"))
+	require.NoError(t, err)
+
+	newRows, err := processRows(mw, createJoinRows())
+	require.NoError(t, err)
+	require.Len(t, newRows, 5)
+
+	assert2.EqualRowValue(t, "lint", newRows[3], "name")
+	assert2.EqualRowValue(t, nil, newRows[3], "team_name")
+	assert2.EqualRowValue(t, nil, newRows[3], "cost_center")
+	assert2.EqualRowValue(t, "test", newRows[4], "name")
+	assert2.EqualRowValue(t, nil, newRows[4], "team_name")
+}
+
+func TestJoinMiddlewareMultipleKeys(t *testing.T) {
+	lookup := []types.Row{
+		types.NewRow(types.MRP("region", "eu"), types.MRP("env", "prod"), types.MRP("owner", "ada")),
+		types.NewRow(types.MRP("region", "eu"), types.MRP("env", "dev"), types.MRP("owner", "bob")),
+	}
+	keys, err := ParseJoinKeys("region", "env")
+	require.NoError(t, err)
+	mw, err := NewJoinMiddleware(lookup, keys)
+	require.NoError(t, err)
+
+	newRows, err := processRows(mw, []types.Row{
+		types.NewRow(types.MRP("host", "a"), types.MRP("region", "eu"), types.MRP("env", "dev")),
+	})
+	require.NoError(t, err)
+	require.Len(t, newRows, 1)
+	assert2.EqualRowValue(t, "bob", newRows[0], "owner")
+	assert.Equal(t, []types.FieldName{"host", "region", "env", "owner"}, types.GetFields(newRows[0]))
+}
+
+func TestJoinMiddlewareLargeIntegerKeys(t *testing.T) {
+	keys, err := ParseJoinKeys("id")
+	require.NoError(t, err)
+	lookup := []types.Row{
+		types.NewRow(types.MRP("id", int64(9007199254740992)), types.MRP("name", "even")),
+		types.NewRow(types.MRP("id", uint64(9007199254740993)), types.MRP("name", "odd")),
+	}
+	mw, err := NewJoinMiddleware(lookup, keys)
+	require.NoError(t, err)
+
+	newRows, err := processRows(mw, []types.Row{
+		types.NewRow(types.MRP("id", int64(9007199254740993))),
+		types.NewRow(types.MRP("id", 9007199254740992.0)),
+	})
+	require.NoError(t, err)
+	require.Len(t, newRows, 2)
+	assert2.EqualRowValue(t, "odd", newRows[0], "name")
+	assert2.EqualRowValue(t, "even", newRows[1], "name")
+}
+
+func TestJoinMiddlewareKeepsPrefixingConflictingColumns(t *testing.T) {
+	keys, err := ParseJoinKeys("id")
+	require.NoError(t, err)
+	lookup := []types.Row{
+		types.NewRow(types.MRP("id", "1"), types.MRP("team", "infra")),
+	}
+	mw, err := NewJoinMiddleware(lookup, keys)
+	require.NoError(t, err)
+
+	newRows, err := processRows(mw, []types.Row{
+		types.NewRow(types.MRP("id", "1"), types.MRP("team", "web"), types.MRP("join_team", "ops")),
+	})
+	require.NoError(t, err)
+	require.Len(t, newRows, 1)
+
+	assert.Equal(t, []types.FieldName{"id", "team", "join_team", "join_join_team"}, types.GetFields(newRows[0]))
+	assert2.EqualRowValue(t, "web", newRows[0], "team")
+	assert2.EqualRowValue(t, "ops", newRows[0], "join_team")
+	assert2.EqualRowValue(t, "infra", newRows[0], "join_join_team")
+}
+
+func TestJoinMiddlewareInvalidConfiguration(t *testing.T) {
+	_, err := ParseJoinKeys("a=")
+	assert.Error(t, err)
+
+	_, err = NewJoinMiddleware(nil, nil)
+	assert.Error(t, err)
+
+	_, err = NewJoinMiddleware(nil, []JoinKey{{Left: "a", Right: "a"}}, WithJoinType("outer"))
+	assert.Error(t, err)
+
+	_, err = NewJoinMiddleware(nil, []JoinKey{{Left: "a", Right: "a"}}, WithConflictPrefix(""))
+	assert.Error(t, err)
+}
@@ -39,6 +39,10 @@ func (m *OutputFieldsMiddleware) Process(_ context.Context, input types.Row) ([]
 	return []types.Row{output}, nil
 }
 
+func (m *OutputFieldsMiddleware) ConcurrencySafe() bool {
+	return true
+}
+
 func (m *OutputFieldsMiddleware) Close(context.Context) error {
 	return nil
 }
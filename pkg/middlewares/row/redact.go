@@ -0,0 +1,326 @@
+package row
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+)
+
+type RedactAction string
+
+const (
+	// RedactMask replaces values with fields.RedactedPlaceholder.
+	RedactMask RedactAction = "mask"
+	// RedactHash replaces values with the first 16 hex characters of their
+	// HMAC-SHA256, so that equal values can still be joined and grouped.
+	RedactHash RedactAction = "hash"
+	// RedactTruncate keeps the first characters of values.
+	RedactTruncate RedactAction = "truncate"
+	// RedactDrop removes the column.
+	RedactDrop RedactAction = "drop"
+)
+
+// defaultRedactTruncateLength is the number of characters kept by truncate
+// without a length.
+const defaultRedactTruncateLength = 4
+
+type Redaction struct {
+	Action RedactAction
+	// Length is the number of characters kept by RedactTruncate.
+	Length int
+}
+
+// ParseRedaction parses mask, hash, drop, or truncate[:length].
+func ParseRedaction(spec string) (Redaction, error) {
+	action, length, hasLength := strings.Cut(strings.TrimSpace(spec), ":")
+	ret := Redaction{Action: RedactAction(strings.ToLower(strings.TrimSpace(action)))}
+	switch ret.Action {
+	case RedactMask, RedactHash, RedactDrop:
+		if hasLength {
+			return Redaction{}, errors.Errorf("invalid redaction %q, only truncate takes a length", spec)
+		}
+	case RedactTruncate:
+		ret.Length = defaultRedactTruncateLength
+		if hasLength {
+			n, err := strconv.Atoi(strings.TrimSpace(length))
+			if err != nil || n < 0 {
+				return Redaction{}, errors.Errorf("invalid redaction %q, expected truncate:length", spec)
+			}
+			ret.Length = n
+		}
+	default:
+		return Redaction{}, errors.Errorf("invalid redaction %q, expected mask, hash, truncate[:length] or drop", spec)
+	}
+	return ret, nil
+}
+
+type regexpRedaction struct {
+	regexp    *regexp.Regexp
+	redaction Redaction
+}
+
+// RedactMiddleware masks, hashes, truncates or drops sensitive columns,
+// selected by name or by regular expression. A column named explicitly uses
+// its own redaction, other columns use the redaction of the first regular
+// expression they match. Null values stay null.
+//
+// With format preservation, masked and hashed values that look like email
+// addresses keep their domain (a***@example.com), and values that look like
+// card numbers keep their separators and last 4 digits. Hashed card numbers
+// get digits derived from the hash and remain valid for the Luhn check.
+type RedactMiddleware struct {
+	columns          map[types.FieldName]Redaction
+	regexps          []regexpRedaction
+	key              []byte
+	formatPreserving bool
+}
+
+var _ middlewares.RowMiddleware = (*RedactMiddleware)(nil)
+
+type RedactOption func(*RedactMiddleware)
+
+func WithRedactColumn(column types.FieldName, redaction Redaction) RedactOption {
+	return func(r *RedactMiddleware) {
+		r.columns[column] = redaction
+	}
+}
+
+// WithRedactRegexp redacts the columns matching re. Regular expressions are
+// tried in the order in which they are added.
+func WithRedactRegexp(re *regexp.Regexp, redaction Redaction) RedactOption {
+	return func(r *RedactMiddleware) {
+		r.regexps = append(r.regexps, regexpRedaction{regexp: re, redaction: redaction})
+	}
+}
+
+// WithRedactKey sets the key of the HMAC used by RedactHash.
+func WithRedactKey(key []byte) RedactOption {
+	return func(r *RedactMiddleware) {
+		r.key = key
+	}
+}
+
+func WithFormatPreserving(formatPreserving bool) RedactOption {
+	return func(r *RedactMiddleware) {
+		r.formatPreserving = formatPreserving
+	}
+}
+
+// NewRedactMiddleware creates a RedactMiddleware. It returns an error if a
+// column is hashed without a key, as unkeyed hashes of low-entropy values
+// such as emails are easily reversed.
+func NewRedactMiddleware(options ...RedactOption) (*RedactMiddleware, error) {
+	ret := &RedactMiddleware{
+		columns: map[types.FieldName]Redaction{},
+	}
+	for _, option := range options {
+		option(ret)
+	}
+
+	if len(ret.key) == 0 {
+		for column, redaction := range ret.columns {
+			if redaction.Action == RedactHash {
+				return nil, errors.Errorf("column %s is hashed, which requires a key", column)
+			}
+		}
+		for _, r := range ret.regexps {
+			if r.redaction.Action == RedactHash {
+				return nil, errors.Errorf("columns matching %s are hashed, which requires a key", r.regexp)
+			}
+		}
+	}
+	return ret, nil
+}
+
+func (r *RedactMiddleware) Process(ctx context.Context, row types.Row) ([]types.Row, error) {
+	var dropped []types.FieldName
+	for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+		redaction, ok := r.redaction(pair.Key)
+		if !ok {
+			continue
+		}
+		if redaction.Action == RedactDrop {
+			dropped = append(dropped, pair.Key)
+			continue
+		}
+		pair.Value = r.redact(pair.Value, redaction)
+	}
+	for _, column := range dropped {
+		row.Delete(column)
+	}
+	return []types.Row{row}, nil
+}
+
+func (r *RedactMiddleware) ConcurrencySafe() bool {
+	return true
+}
+
+func (r *RedactMiddleware) Close(ctx context.Context) error {
+	return nil
+}
+
+func (r *RedactMiddleware) redaction(column types.FieldName) (Redaction, bool) {
+	if redaction, ok := r.columns[column]; ok {
+		return redaction, true
+	}
+	for _, re := range r.regexps {
+		if re.regexp.MatchString(column) {
+			return re.redaction, true
+		}
+	}
+	return Redaction{}, false
+}
+
+var emailRegexp = regexp.MustCompile(`^([^@\s]+)@([^@\s]+\.[^@\s]+)$`)
+
+func (r *RedactMiddleware) redact(value interface{}, redaction Redaction) interface{} {
+	if value == nil {
+		return nil
+	}
+	s := redactStringValue(value)
+
+	switch redaction.Action {
+	case RedactMask:
+		if r.formatPreserving {
+			if m := emailRegexp.FindStringSubmatch(s); m != nil {
+				return firstRunes(m[1], 1) + fields.RedactedPlaceholder + "@" + m[2]
+			}
+			if isCardNumber(s) {
+				return replaceCardDigits(s, func(i int) byte { return '*' })
+			}
+		}
+		return fields.RedactedPlaceholder
+
+	case RedactHash:
+		mac := hmac.New(sha256.New, r.key)
+		_, _ = mac.Write([]byte(s))
+		sum := mac.Sum(nil)
+		if r.formatPreserving {
+			if m := emailRegexp.FindStringSubmatch(s); m != nil {
+				return hex.EncodeToString(sum[:8]) + "@" + m[2]
+			}
+			if isCardNumber(s) {
+				ret := replaceCardDigits(s, func(i int) byte { return '0' + sum[i]%10 })
+				return fixLuhnCheck(ret)
+			}
+		}
+		return hex.EncodeToString(sum[:8])
+
+	case RedactTruncate:
+		return firstRunes(s, redaction.Length)
+
+	case RedactDrop:
+	}
+	return value
+}
+
+// redactStringValue returns the string that is redacted for value, encoding
+// nested objects and lists as JSON.
+func redactStringValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case map[string]interface{}, []interface{}, types.Row:
+		b, err := json.Marshal(v)
+		if err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprint(value)
+}
+
+func firstRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
+
+// isCardNumber returns true if s is made of 13 to 19 digits, optionally
+// separated by spaces or dashes, that pass the Luhn check.
+func isCardNumber(s string) bool {
+	digits := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c >= '0' && c <= '9':
+			digits = append(digits, c)
+		case c == ' ' || c == '-':
+		default:
+			return false
+		}
+	}
+	return len(digits) >= 13 && len(digits) <= 19 && luhnSum(digits)%10 == 0
+}
+
+// replaceCardDigits replaces all the digits of a card number except the last
+// 4 with digit(i), where i is the position of the digit.
+func replaceCardDigits(s string, digit func(i int) byte) string {
+	total := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] >= '0' && s[i] <= '9' {
+			total++
+		}
+	}
+	ret := []byte(s)
+	n := 0
+	for i := range ret {
+		if ret[i] < '0' || ret[i] > '9' {
+			continue
+		}
+		if n < total-4 {
+			ret[i] = digit(n)
+		}
+		n++
+	}
+	return string(ret)
+}
+
+// fixLuhnCheck changes the digit in front of the last 4 digits of a card
+// number so that it passes the Luhn check.
+func fixLuhnCheck(s string) string {
+	ret := []byte(s)
+	positions := []int{}
+	digits := []byte{}
+	for i, c := range ret {
+		if c >= '0' && c <= '9' {
+			positions = append(positions, i)
+			digits = append(digits, c)
+		}
+	}
+	idx := len(digits) - 5
+	for d := byte('0'); d <= '9'; d++ {
+		digits[idx] = d
+		if luhnSum(digits)%10 == 0 {
+			ret[positions[idx]] = d
+			break
+		}
+	}
+	return string(ret)
+}
+
+func luhnSum(digits []byte) int {
+	sum := 0
+	for i := range digits {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum
+}
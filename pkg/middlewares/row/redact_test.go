@@ -0,0 +1,101 @@
+package row
+
+import (
+	"regexp"
+	"testing"
+
+	assert2 "github.com/go-go-golems/glazed/pkg/helpers/assert"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseRedaction(t *testing.T, spec string) Redaction {
+	t.Helper()
+	ret, err := ParseRedaction(spec)
+	require.NoError(t, err)
+	return ret
+}
+
+func TestRedactMiddleware(t *testing.T) {
+	mw, err := NewRedactMiddleware(
+		WithRedactColumn("email", parseRedaction(t, "hash")),
+		WithRedactColumn("name", parseRedaction(t, "truncate:2")),
+		WithRedactColumn("secret_note", parseRedaction(t, "mask")),
+		WithRedactRegexp(regexp.MustCompile(`^secret_`), parseRedaction(t, "drop")),
+		WithRedactKey([]byte("key")),
+	)
+	require.NoError(t, err)
+
+	newRows, err := processRows(mw, []types.Row{
+		types.NewRow(
+			types.MRP("name", "ada"),
+			types.MRP("email", "ada@example.com"),
+			types.MRP("secret_token", "abc"),
+			types.MRP("secret_note", 42),
+		),
+		types.NewRow(types.MRP("name", "bob"), types.MRP("email", "ada@example.com")),
+		types.NewRow(types.MRP("email", nil)),
+	})
+	require.NoError(t, err)
+	require.Len(t, newRows, 3)
+
+	assert.Equal(t, []types.FieldName{"name", "email", "secret_note"}, types.GetFields(newRows[0]))
+	assert2.EqualRowValue(t, "ad", newRows[0], "name")
+	assert2.EqualRowValue(t, "***", newRows[0], "secret_note")
+	email, _ := newRows[0].Get("email")
+	assert.Len(t, email, 16)
+	assert.NotContains(t, email, "ada")
+	// equal values have equal hashes
+	assert2.EqualRowValue(t, email, newRows[1], "email")
+	assert2.EqualRowValue(t, nil, newRows[2], "email")
+}
+
+func TestRedactMiddlewarePreservesFormats(t *testing.T) {
+	for _, action := range []string{"mask", "hash"} {
+		mw, err := NewRedactMiddleware(
+			WithRedactColumn("email", parseRedaction(t, action)),
+			WithRedactColumn("card", parseRedaction(t, action)),
+			WithRedactColumn("note", parseRedaction(t, action)),
+			WithRedactKey([]byte("key")),
+			WithFormatPreserving(true),
+		)
+		require.NoError(t, err)
+
+		newRows, err := processRows(mw, []types.Row{
+			types.NewRow(
+				types.MRP("email", "ada@example.com"),
+				types.MRP("card", "4242 4242 4242 4242"),
+				types.MRP("note", "4242 4242 4242 4241"),
+			),
+		})
+		require.NoError(t, err)
+		email, _ := newRows[0].Get("email")
+		card, _ := newRows[0].Get("card")
+		note, _ := newRows[0].Get("note")
+
+		assert.Regexp(t, `^[^@]+@example\.com$`, email, action)
+		assert.NotContains(t, email, "ada", action)
+		assert.Regexp(t, `^.... .... .... 4242$`, card, action)
+		assert.NotEqual(t, "4242 4242 4242 4242", card, action)
+		// not a valid card number
+		assert.NotContains(t, note, "4241", action)
+
+		if action == "mask" {
+			assert.Equal(t, "a***@example.com", email)
+			assert.Equal(t, "**** **** **** 4242", card)
+		} else {
+			assert.True(t, isCardNumber(card.(string)), card)
+		}
+	}
+}
+
+func TestRedactMiddlewareRequiresKeyToHash(t *testing.T) {
+	_, err := NewRedactMiddleware(WithRedactRegexp(regexp.MustCompile("mail"), parseRedaction(t, "hash")))
+	assert.Error(t, err)
+
+	for _, spec := range []string{"blur", "truncate:x", "mask:3"} {
+		_, err := ParseRedaction(spec)
+		assert.Error(t, err, spec)
+	}
+}
@@ -31,3 +31,7 @@ func (rnm *RemoveNullsMiddleware) Process(ctx context.Context, row types.Row) ([
 
 	return []types.Row{newRow}, nil
 }
+
+func (rnm *RemoveNullsMiddleware) ConcurrencySafe() bool {
+	return true
+}
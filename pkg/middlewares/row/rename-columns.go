@@ -7,6 +7,7 @@ import (
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
 	"regexp"
+	"sync"
 )
 
 type RenameColumnMiddleware struct {
@@ -18,6 +19,8 @@ type RenameColumnMiddleware struct {
 	// going through all the Renames and RegexpRenames on every row,
 	// we cache affected columns in renamedColumns.
 	renamedColumns map[types.FieldName]types.FieldName
+	// mu guards renamedColumns, as Process can be called concurrently.
+	mu sync.Mutex
 }
 
 var _ middlewares.RowMiddleware = (*RenameColumnMiddleware)(nil)
@@ -109,6 +112,9 @@ func NewRenameColumnMiddlewareFromYAML(decoder *yaml.Decoder) (*RenameColumnMidd
 func (r *RenameColumnMiddleware) renameColumn(
 	column types.FieldName,
 ) types.FieldName {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	if rename, ok := r.renamedColumns[column]; ok {
 		return rename
 	}
@@ -142,3 +148,7 @@ func (r *RenameColumnMiddleware) Process(ctx context.Context, row types.Row) ([]
 	ret := []types.Row{newRow}
 	return ret, nil
 }
+
+func (r *RenameColumnMiddleware) ConcurrencySafe() bool {
+	return true
+}
@@ -60,3 +60,7 @@ func (scm *ReorderColumnOrderMiddleware) Process(ctx context.Context, row types.
 
 	return []types.Row{newRow}, nil
 }
+
+func (scm *ReorderColumnOrderMiddleware) ConcurrencySafe() bool {
+	return true
+}
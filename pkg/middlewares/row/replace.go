@@ -236,3 +236,7 @@ func (r *ReplaceMiddleware) Process(ctx context.Context, row types.Row) ([]types
 
 	return []types.Row{newRow}, nil
 }
+
+func (r *ReplaceMiddleware) ConcurrencySafe() bool {
+	return true
+}
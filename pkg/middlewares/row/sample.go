@@ -0,0 +1,169 @@
+package row
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+)
+
+// ReservoirSampleMiddleware keeps a uniform random sample of n rows, holding at
+// most n rows in memory. The sample is passed on to the downstream row
+// middlewares in input order when the processor is closed.
+//
+// The sample only depends on the seed and the input, so that a run can be
+// reproduced.
+type ReservoirSampleMiddleware struct {
+	n    int
+	rand *rand.Rand
+
+	seen   int
+	sample []sampledRow
+}
+
+type sampledRow struct {
+	row types.Row
+	seq int
+}
+
+var _ middlewares.FlushingRowMiddleware = (*ReservoirSampleMiddleware)(nil)
+
+func NewReservoirSampleMiddleware(n int, seed int64) *ReservoirSampleMiddleware {
+	return &ReservoirSampleMiddleware{
+		n:    n,
+		rand: rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (r *ReservoirSampleMiddleware) Process(ctx context.Context, row types.Row) ([]types.Row, error) {
+	seq := r.seen
+	r.seen++
+	if r.n <= 0 {
+		return []types.Row{}, nil
+	}
+
+	if len(r.sample) < r.n {
+		r.sample = append(r.sample, sampledRow{row: row, seq: seq})
+		return []types.Row{}, nil
+	}
+	// the i-th row replaces a kept row with probability n/i
+	if j := r.rand.Intn(r.seen); j < r.n {
+		r.sample[j] = sampledRow{row: row, seq: seq}
+	}
+	return []types.Row{}, nil
+}
+
+func (r *ReservoirSampleMiddleware) Flush(ctx context.Context, emit func(row types.Row) error) error {
+	sample := r.sample
+	r.sample = nil
+	sort.Slice(sample, func(i, j int) bool {
+		return sample[i].seq < sample[j].seq
+	})
+	for _, s := range sample {
+		if err := emit(s.row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ReservoirSampleMiddleware) Close(ctx context.Context) error {
+	r.sample = nil
+	return nil
+}
+
+// BernoulliSampleMiddleware keeps each row with the given probability, between
+// 0 and 1, independently of the other rows. Rows are streamed, so the number
+// of kept rows is only approximately the fraction of the input.
+//
+// The sample only depends on the seed and the input order.
+type BernoulliSampleMiddleware struct {
+	fraction float64
+	rand     *rand.Rand
+}
+
+var _ middlewares.RowMiddleware = (*BernoulliSampleMiddleware)(nil)
+
+func NewBernoulliSampleMiddleware(fraction float64, seed int64) *BernoulliSampleMiddleware {
+	return &BernoulliSampleMiddleware{
+		fraction: fraction,
+		rand:     rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (b *BernoulliSampleMiddleware) Process(ctx context.Context, row types.Row) ([]types.Row, error) {
+	if b.rand.Float64() < b.fraction {
+		return []types.Row{row}, nil
+	}
+	return []types.Row{}, nil
+}
+
+func (b *BernoulliSampleMiddleware) Close(ctx context.Context) error {
+	return nil
+}
+
+// HashSampleMiddleware keeps the rows whose key columns hash below the given
+// fraction, between 0 and 1. Since the decision only depends on the key and
+// the seed, the same entities are sampled across runs and across datasets, and
+// all rows of a sampled entity are kept.
+//
+// Key values are compared as strings, so the number 1 and the string "1" are
+// the same key. Rows missing a key column are sampled with a null key.
+type HashSampleMiddleware struct {
+	columns  []types.FieldName
+	fraction float64
+	seed     int64
+}
+
+var _ middlewares.RowMiddleware = (*HashSampleMiddleware)(nil)
+
+func NewHashSampleMiddleware(columns []types.FieldName, fraction float64, seed int64) *HashSampleMiddleware {
+	return &HashSampleMiddleware{
+		columns:  columns,
+		fraction: fraction,
+		seed:     seed,
+	}
+}
+
+func (h *HashSampleMiddleware) Process(ctx context.Context, row types.Row) ([]types.Row, error) {
+	hash := fnv.New64a()
+	var seed [8]byte
+	binary.LittleEndian.PutUint64(seed[:], uint64(h.seed))
+	_, _ = hash.Write(seed[:])
+	for _, column := range h.columns {
+		v, ok := row.Get(column)
+		if ok && v != nil {
+			_, _ = hash.Write([]byte(joinKeyValue(v)))
+		}
+		_, _ = hash.Write([]byte{0})
+	}
+
+	if float64(mixHash(hash.Sum64()))/math.MaxUint64 < h.fraction {
+		return []types.Row{row}, nil
+	}
+	return []types.Row{}, nil
+}
+
+func (h *HashSampleMiddleware) ConcurrencySafe() bool {
+	return true
+}
+
+func (h *HashSampleMiddleware) Close(ctx context.Context) error {
+	return nil
+}
+
+// mixHash spreads the bits of an FNV hash over the whole word, using the
+// finalizer of MurmurHash3.
+func mixHash(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,110 @@
+package row
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createSampleRows(n int) []types.Row {
+	ret := make([]types.Row, 0, n)
+	for i := 0; i < n; i++ {
+		ret = append(ret, types.NewRow(types.MRP("id", i), types.MRP("user", i%100)))
+	}
+	return ret
+}
+
+func sampledIDs(rows []types.Row) []int {
+	ret := make([]int, 0, len(rows))
+	for _, row := range rows {
+		id, _ := row.Get("id")
+		ret = append(ret, id.(int))
+	}
+	return ret
+}
+
+func runReservoirSample(t *testing.T, mw *ReservoirSampleMiddleware, rows []types.Row) []types.Row {
+	t.Helper()
+	kept, err := processRows(mw, rows)
+	require.NoError(t, err)
+	require.Empty(t, kept)
+
+	ret := []types.Row{}
+	require.NoError(t, mw.Flush(context.Background(), func(row types.Row) error {
+		ret = append(ret, row)
+		return nil
+	}))
+	return ret
+}
+
+func TestReservoirSampleMiddleware(t *testing.T) {
+	sample := runReservoirSample(t, NewReservoirSampleMiddleware(10, 1), createSampleRows(1000))
+	require.Len(t, sample, 10)
+	ids := sampledIDs(sample)
+	assert.IsIncreasing(t, ids)
+
+	again := runReservoirSample(t, NewReservoirSampleMiddleware(10, 1), createSampleRows(1000))
+	assert.Equal(t, ids, sampledIDs(again))
+
+	other := runReservoirSample(t, NewReservoirSampleMiddleware(10, 2), createSampleRows(1000))
+	assert.NotEqual(t, ids, sampledIDs(other))
+
+	small := runReservoirSample(t, NewReservoirSampleMiddleware(10, 1), createSampleRows(3))
+	assert.Equal(t, []int{0, 1, 2}, sampledIDs(small))
+}
+
+func TestReservoirSampleMiddlewareIsUniform(t *testing.T) {
+	// every row should be kept about 1000 * 10 / 100 times
+	counts := make([]int, 100)
+	for seed := int64(0); seed < 1000; seed++ {
+		sample := runReservoirSample(t, NewReservoirSampleMiddleware(10, seed), createSampleRows(100))
+		for _, id := range sampledIDs(sample) {
+			counts[id]++
+		}
+	}
+	for id, count := range counts {
+		assert.InDelta(t, 100, count, 40, "row %d", id)
+	}
+}
+
+func TestBernoulliSampleMiddleware(t *testing.T) {
+	kept, err := processRows(NewBernoulliSampleMiddleware(0.1, 1), createSampleRows(10000))
+	require.NoError(t, err)
+	assert.InDelta(t, 1000, len(kept), 100)
+
+	again, err := processRows(NewBernoulliSampleMiddleware(0.1, 1), createSampleRows(10000))
+	require.NoError(t, err)
+	assert.Equal(t, sampledIDs(kept), sampledIDs(again))
+}
+
+func TestHashSampleMiddleware(t *testing.T) {
+	mw := NewHashSampleMiddleware([]types.FieldName{"user"}, 0.2, 1)
+	kept, err := processRows(mw, createSampleRows(10000))
+	require.NoError(t, err)
+
+	// all rows of a sampled user are kept
+	users := map[int]int{}
+	for _, row := range kept {
+		user, _ := row.Get("user")
+		users[user.(int)]++
+	}
+	assert.InDelta(t, 20, len(users), 10)
+	for user, count := range users {
+		assert.Equal(t, 100, count, "user %d", user)
+	}
+
+	// keys are compared as strings, so the decision doesn't depend on the type
+	for user := range users {
+		rows, err := processRows(mw, []types.Row{types.NewRow(types.MRP("user", strconv.Itoa(user)), types.MRP("id", 0))})
+		require.NoError(t, err)
+		assert.Len(t, rows, 1)
+	}
+
+	other, err := processRows(NewHashSampleMiddleware([]types.FieldName{"user"}, 0.2, 2), createSampleRows(10000))
+	require.NoError(t, err)
+	assert.NotEqual(t, sampledIDs(kept), sampledIDs(other))
+}
@@ -31,3 +31,7 @@ func (scm *SortColumnsMiddleware) Process(ctx context.Context, row types.Row) ([
 	}
 	return []types.Row{newRow}, nil
 }
+
+func (scm *SortColumnsMiddleware) ConcurrencySafe() bool {
+	return true
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/go-go-golems/glazed/pkg/middlewares"
 	"github.com/go-go-golems/glazed/pkg/types"
 	"strings"
+	"sync"
 	"text/template"
 )
 
@@ -20,6 +21,8 @@ type TemplateMiddleware struct {
 	funcMaps        []template.FuncMap
 
 	renamedColumns map[types.FieldName]types.FieldName
+	// mu guards renamedColumns, as Process can be called concurrently.
+	mu sync.Mutex
 }
 
 var _ middlewares.RowMiddleware = (*TemplateMiddleware)(nil)
@@ -77,6 +80,7 @@ func NewTemplateMiddleware(
 func (rgtm *TemplateMiddleware) Process(ctx context.Context, row types.Row) ([]types.Row, error) {
 	templateValues := map[string]interface{}{}
 
+	rgtm.mu.Lock()
 	for pair := row.Oldest(); pair != nil; pair = pair.Next() {
 		key, value := pair.Key, pair.Value
 
@@ -89,6 +93,7 @@ func (rgtm *TemplateMiddleware) Process(ctx context.Context, row types.Row) ([]t
 		}
 		templateValues[key] = value
 	}
+	rgtm.mu.Unlock()
 	templateValues["_row"] = templateValues
 
 	for columnName, tmpl := range rgtm.templates {
@@ -105,6 +110,10 @@ func (rgtm *TemplateMiddleware) Process(ctx context.Context, row types.Row) ([]t
 	return []types.Row{row}, nil
 }
 
+func (rgtm *TemplateMiddleware) ConcurrencySafe() bool {
+	return true
+}
+
 func (rgtm *TemplateMiddleware) Close(ctx context.Context) error {
 	return nil
 }
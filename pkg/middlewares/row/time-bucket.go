@@ -0,0 +1,263 @@
+package row
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+)
+
+type TimeUnit string
+
+const (
+	TimeUnitMinute TimeUnit = "minute"
+	TimeUnitHour   TimeUnit = "hour"
+	TimeUnitDay    TimeUnit = "day"
+	TimeUnitWeek   TimeUnit = "week"
+	TimeUnitMonth  TimeUnit = "month"
+)
+
+// TimeBucket is the width of a time bucket: either a calendar unit or a fixed
+// duration.
+type TimeBucket struct {
+	// Unit is empty for a fixed duration.
+	Unit     TimeUnit
+	Duration time.Duration
+}
+
+// ParseTimeBucket parses minute, hour, day, week, month or a duration such as
+// 15m or 6h.
+func ParseTimeBucket(s string) (TimeBucket, error) {
+	s = strings.TrimSpace(s)
+	switch TimeUnit(strings.ToLower(s)) {
+	case TimeUnitMinute:
+		return TimeBucket{Unit: TimeUnitMinute, Duration: time.Minute}, nil
+	case TimeUnitHour:
+		return TimeBucket{Unit: TimeUnitHour, Duration: time.Hour}, nil
+	case TimeUnitDay, TimeUnitWeek, TimeUnitMonth:
+		return TimeBucket{Unit: TimeUnit(strings.ToLower(s))}, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return TimeBucket{}, errors.Errorf("invalid time bucket %q, expected minute, hour, day, week, month or a duration such as 15m", s)
+	}
+	if d <= 0 {
+		return TimeBucket{}, errors.Errorf("invalid time bucket %q, must be positive", s)
+	}
+	if d > 24*time.Hour && d%(24*time.Hour) != 0 {
+		return TimeBucket{}, errors.Errorf("invalid time bucket %q, durations longer than a day must be whole days", s)
+	}
+	return TimeBucket{Duration: d}, nil
+}
+
+func (b TimeBucket) String() string {
+	if b.Unit != "" {
+		return string(b.Unit)
+	}
+	return b.Duration.String()
+}
+
+// Truncate returns the start of the bucket holding t, in loc. Days start at
+// midnight and weeks on Monday. Durations are aligned on the wall clock of
+// loc, from the local midnight of the day of t, so that 6h buckets start at
+// midnight, 6am, noon and 6pm local time, even on the 23 and 25 hour days of
+// daylight saving time changes. A duration that doesn't divide a day leaves a
+// shorter last bucket before midnight. Durations of whole days are counted in
+// local days since the Unix epoch.
+func (b TimeBucket) Truncate(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	switch b.Unit {
+	case TimeUnitDay:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	case TimeUnitWeek:
+		daysSinceMonday := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, loc)
+	case TimeUnitMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+	}
+
+	year, month, day := t.Date()
+	if b.Duration%(24*time.Hour) == 0 {
+		days := int64(b.Duration / (24 * time.Hour))
+		n := time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Unix() / (24 * 60 * 60)
+		n -= ((n % days) + days) % days
+		return time.Date(1970, 1, 1+int(n), 0, 0, 0, 0, loc)
+	}
+
+	elapsed := sinceMidnight(t)
+	start := elapsed - elapsed%b.Duration
+	// Going back in time keeps the offset of t, which tells apart the two
+	// occurrences of the hour repeated when clocks are set back. A change of
+	// offset since the start of the bucket moves the wall clock though, in
+	// which case the start is looked up by its wall clock.
+	ret := t.Add(start - elapsed)
+	if y, m, d := ret.Date(); y == year && m == month && d == day && sinceMidnight(ret) == start {
+		return ret
+	}
+	if byWallClock := time.Date(year, month, day, 0, 0, 0, int(start), loc); !byWallClock.After(t) {
+		return byWallClock
+	}
+	// the start of the bucket was skipped when clocks were set forward
+	return ret
+}
+
+// sinceMidnight returns the time shown by the wall clock of t.
+func sinceMidnight(t time.Time) time.Duration {
+	hour, minute, second := t.Clock()
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute +
+		time.Duration(second)*time.Second + time.Duration(t.Nanosecond())
+}
+
+// Next returns the start of the bucket following the bucket starting at t.
+func (b TimeBucket) Next(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	switch b.Unit {
+	case TimeUnitDay:
+		return b.Truncate(t.AddDate(0, 0, 1), loc)
+	case TimeUnitWeek:
+		return b.Truncate(t.AddDate(0, 0, 7), loc)
+	case TimeUnitMonth:
+		return b.Truncate(t.AddDate(0, 1, 0), loc)
+	}
+
+	start := b.Truncate(t, loc)
+	if next := b.Truncate(start.Add(b.Duration), loc); next.After(start) {
+		return next
+	}
+	// the bucket is longer than its duration, because clocks were set back
+	year, month, day := start.Date()
+	return b.Truncate(time.Date(year, month, day, 0, 0, 0, int(sinceMidnight(start)+b.Duration), loc), loc)
+}
+
+// ParseTimeValue returns value as a time. Strings are parsed with
+// fields.ParseDate.
+func ParseTimeValue(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case *time.Time:
+		if v != nil {
+			return *v, nil
+		}
+	case string:
+		t, err := fields.ParseDate(strings.TrimSpace(v))
+		if err != nil {
+			return time.Time{}, errors.Wrapf(err, "could not parse %q as time", v)
+		}
+		return t, nil
+	}
+	return time.Time{}, errors.Errorf("could not use %v (%T) as time", value, value)
+}
+
+// TimeBucketColumn truncates the times of a column to a bucket.
+type TimeBucketColumn struct {
+	Column types.FieldName
+	Bucket TimeBucket
+	// As is the output column. It is the input column if empty.
+	As types.FieldName
+}
+
+// ParseTimeBucketColumn parses a spec of the form column:bucket[=name].
+//
+// Examples:
+//
+//	created_at:hour
+//	ts:15m=ts_bucket
+func ParseTimeBucketColumn(spec string) (TimeBucketColumn, error) {
+	ret := TimeBucketColumn{}
+	spec = strings.TrimSpace(spec)
+	if idx := strings.Index(spec, "="); idx >= 0 {
+		ret.As = strings.TrimSpace(spec[idx+1:])
+		spec = strings.TrimSpace(spec[:idx])
+		if ret.As == "" {
+			return TimeBucketColumn{}, errors.Errorf("empty output column name in time bucket %q", spec)
+		}
+	}
+	column, bucket, ok := strings.Cut(spec, ":")
+	ret.Column = strings.TrimSpace(column)
+	if !ok || ret.Column == "" {
+		return TimeBucketColumn{}, errors.Errorf("invalid time bucket %q, expected column:bucket", spec)
+	}
+	var err error
+	ret.Bucket, err = ParseTimeBucket(bucket)
+	if err != nil {
+		return TimeBucketColumn{}, err
+	}
+	return ret, nil
+}
+
+func ParseTimeBucketColumns(specs ...string) ([]TimeBucketColumn, error) {
+	ret := make([]TimeBucketColumn, 0, len(specs))
+	for _, spec := range specs {
+		c, err := ParseTimeBucketColumn(spec)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, c)
+	}
+	return ret, nil
+}
+
+// TimeBucketMiddleware truncates the times of one or more columns to the start
+// of their bucket, in a given location (UTC by default). String values are
+// parsed as times and null values are left alone. Values that aren't times
+// are an error.
+type TimeBucketMiddleware struct {
+	columns  []TimeBucketColumn
+	location *time.Location
+}
+
+var _ middlewares.RowMiddleware = (*TimeBucketMiddleware)(nil)
+
+type TimeBucketOption func(*TimeBucketMiddleware)
+
+func WithTimeBucketLocation(location *time.Location) TimeBucketOption {
+	return func(t *TimeBucketMiddleware) {
+		t.location = location
+	}
+}
+
+func NewTimeBucketMiddleware(columns []TimeBucketColumn, options ...TimeBucketOption) *TimeBucketMiddleware {
+	ret := &TimeBucketMiddleware{
+		columns:  columns,
+		location: time.UTC,
+	}
+	for _, option := range options {
+		option(ret)
+	}
+	return ret
+}
+
+func (t *TimeBucketMiddleware) Process(ctx context.Context, row types.Row) ([]types.Row, error) {
+	for _, c := range t.columns {
+		as := c.As
+		if as == "" {
+			as = c.Column
+		}
+		value, ok := row.Get(c.Column)
+		if !ok || value == nil {
+			if as != c.Column {
+				row.Set(as, nil)
+			}
+			continue
+		}
+		v, err := ParseTimeValue(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not bucket column %s", c.Column)
+		}
+		row.Set(as, c.Bucket.Truncate(v, t.location))
+	}
+	return []types.Row{row}, nil
+}
+
+func (t *TimeBucketMiddleware) ConcurrencySafe() bool {
+	return true
+}
+
+func (t *TimeBucketMiddleware) Close(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,145 @@
+package row
+
+import (
+	"testing"
+	"time"
+
+	assert2 "github.com/go-go-golems/glazed/pkg/helpers/assert"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeBucketTruncate(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	// a Wednesday, 01:40 in Paris
+	ts := time.Date(2024, 3, 13, 0, 40, 12, 0, time.UTC)
+
+	tests := []struct {
+		bucket   string
+		location *time.Location
+		expected time.Time
+	}{
+		{"minute", time.UTC, time.Date(2024, 3, 13, 0, 40, 0, 0, time.UTC)},
+		{"15m", time.UTC, time.Date(2024, 3, 13, 0, 30, 0, 0, time.UTC)},
+		{"hour", time.UTC, time.Date(2024, 3, 13, 0, 0, 0, 0, time.UTC)},
+		{"day", time.UTC, time.Date(2024, 3, 13, 0, 0, 0, 0, time.UTC)},
+		{"day", paris, time.Date(2024, 3, 13, 0, 0, 0, 0, paris)},
+		{"3h", paris, time.Date(2024, 3, 13, 0, 0, 0, 0, paris)},
+		{"week", time.UTC, time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)},
+		{"month", time.UTC, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		bucket, err := ParseTimeBucket(tt.bucket)
+		require.NoError(t, err)
+		assert.True(t, tt.expected.Equal(bucket.Truncate(ts, tt.location)), "%s in %s", tt.bucket, tt.location)
+	}
+
+	// the day of the switch to summer time only has 23 hours
+	day, err := ParseTimeBucket("day")
+	require.NoError(t, err)
+	start := time.Date(2024, 3, 31, 0, 0, 0, 0, paris)
+	assert.Equal(t, 23*time.Hour, day.Next(start, paris).Sub(start))
+
+	_, err = ParseTimeBucket("fortnight")
+	assert.Error(t, err)
+	_, err = ParseTimeBucket("-1h")
+	assert.Error(t, err)
+}
+
+func TestTimeBucketAcrossDaylightSavingTime(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	bucket := func(s string) TimeBucket {
+		ret, err := ParseTimeBucket(s)
+		require.NoError(t, err)
+		return ret
+	}
+	utc := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, time.UTC)
+	}
+	// clocks are set back from 03:00 CEST to 02:00 CET on 2026-10-25, which
+	// has 25 hours
+	midnight := time.Date(2026, 10, 25, 0, 0, 0, 0, paris)
+
+	h24 := bucket("24h")
+	for _, ts := range []time.Time{utc(24, 22, 0), utc(25, 0, 30), utc(25, 11, 0), utc(25, 22, 59)} {
+		assert.True(t, midnight.Equal(h24.Truncate(ts, paris)), "24h bucket of %s", ts)
+	}
+	assert.True(t, time.Date(2026, 10, 26, 0, 0, 0, 0, paris).Equal(h24.Truncate(utc(25, 23, 0), paris)))
+	assert.Equal(t, 25*time.Hour, h24.Next(midnight, paris).Sub(midnight))
+
+	h6 := bucket("6h")
+	tests := []struct {
+		ts       time.Time
+		expected time.Time
+	}{
+		{utc(25, 0, 30), midnight},                                  // 02:30 CEST
+		{utc(25, 1, 30), midnight},                                  // 02:30 CET
+		{utc(25, 4, 59), midnight},                                  // 05:59 CET
+		{utc(25, 5, 0), time.Date(2026, 10, 25, 6, 0, 0, 0, paris)}, // 06:00 CET
+		{utc(25, 22, 0), time.Date(2026, 10, 25, 18, 0, 0, 0, paris)},
+	}
+	for _, tt := range tests {
+		assert.True(t, tt.expected.Equal(h6.Truncate(tt.ts, paris)), "6h bucket of %s", tt.ts)
+	}
+	starts := []time.Time{midnight}
+	for len(starts) < 5 {
+		starts = append(starts, h6.Next(starts[len(starts)-1], paris))
+	}
+	for i, hour := range []int{0, 6, 12, 18} {
+		assert.Equal(t, hour, starts[i].Hour())
+	}
+	assert.Equal(t, 7*time.Hour, starts[1].Sub(starts[0]))
+	assert.True(t, time.Date(2026, 10, 26, 0, 0, 0, 0, paris).Equal(starts[4]))
+
+	// the repeated hour is two buckets
+	hour := bucket("hour")
+	first, second := hour.Truncate(utc(25, 0, 30), paris), hour.Truncate(utc(25, 1, 30), paris)
+	assert.True(t, utc(25, 0, 0).Equal(first))
+	assert.True(t, utc(25, 1, 0).Equal(second))
+	assert.True(t, second.Equal(hour.Next(first, paris)))
+	assert.True(t, utc(25, 2, 0).Equal(hour.Next(second, paris)))
+
+	// the day clocks are set forward has 23 hours
+	spring := time.Date(2026, 3, 29, 0, 0, 0, 0, paris)
+	assert.True(t, spring.Equal(h24.Truncate(time.Date(2026, 3, 29, 21, 0, 0, 0, time.UTC), paris)))
+	assert.Equal(t, 23*time.Hour, h24.Next(spring, paris).Sub(spring))
+	assert.Equal(t, 5*time.Hour, h6.Next(spring, paris).Sub(spring))
+	assert.True(t, time.Date(2026, 3, 29, 6, 0, 0, 0, paris).Equal(h6.Truncate(time.Date(2026, 3, 29, 5, 0, 0, 0, time.UTC), paris)))
+
+	// whole days are counted from the epoch, so that 48h buckets don't start
+	// every day
+	h48 := bucket("48h")
+	start := h48.Truncate(utc(25, 11, 0), paris)
+	assert.Equal(t, 0, start.Hour())
+	assert.False(t, start.After(midnight))
+	assert.True(t, start.Equal(h48.Truncate(start.AddDate(0, 0, 1).Add(12*time.Hour), paris)))
+	assert.True(t, start.AddDate(0, 0, 2).Equal(h48.Next(start, paris)))
+
+	_, err = ParseTimeBucket("36h")
+	assert.Error(t, err)
+}
+
+func TestTimeBucketMiddleware(t *testing.T) {
+	columns, err := ParseTimeBucketColumns("ts:hour=hour", "day:day")
+	require.NoError(t, err)
+	mw := NewTimeBucketMiddleware(columns)
+
+	newRows, err := processRows(mw, []types.Row{
+		types.NewRow(types.MRP("ts", "2024-03-13T10:42:00Z"), types.MRP("day", nil)),
+	})
+	require.NoError(t, err)
+	require.Len(t, newRows, 1)
+	assert2.EqualRowValue(t, "2024-03-13T10:42:00Z", newRows[0], "ts")
+	hour, _ := newRows[0].Get("hour")
+	assert.True(t, time.Date(2024, 3, 13, 10, 0, 0, 0, time.UTC).Equal(hour.(time.Time)))
+	assert2.EqualRowValue(t, nil, newRows[0], "day")
+
+	_, err = processRows(mw, []types.Row{types.NewRow(types.MRP("ts", 12))})
+	assert.Error(t, err)
+
+	_, err = ParseTimeBucketColumn("ts")
+	assert.Error(t, err)
+}
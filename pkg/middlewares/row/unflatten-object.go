@@ -0,0 +1,133 @@
+package row
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+)
+
+// UnflattenObjectMiddleware is the inverse of FlattenObjectMiddleware: it
+// rebuilds nested objects from the columns whose names contain the separator,
+// so that a.b.c becomes {"a": {"b": {"c": ...}}}. See UnflattenRow.
+type UnflattenObjectMiddleware struct {
+	separator string
+}
+
+var _ middlewares.RowMiddleware = (*UnflattenObjectMiddleware)(nil)
+
+func NewUnflattenObjectMiddleware(separator string) *UnflattenObjectMiddleware {
+	return &UnflattenObjectMiddleware{
+		separator: separator,
+	}
+}
+
+func (uom *UnflattenObjectMiddleware) Process(ctx context.Context, row types.Row) ([]types.Row, error) {
+	newRow := UnflattenRow(row, uom.separator)
+	return []types.Row{newRow}, nil
+}
+
+func (uom *UnflattenObjectMiddleware) ConcurrencySafe() bool {
+	return true
+}
+
+func (uom *UnflattenObjectMiddleware) Close(ctx context.Context) error {
+	return nil
+}
+
+// UnflattenRow splits the column names of row on separator and nests their
+// values into objects, in the order in which the columns appear. Objects whose
+// keys are exactly the indexes 0 to n-1 become lists, so that tags.0 and tags.1
+// turn back into a tags list.
+//
+// Columns are kept as they are when one of their segments is empty, or when a
+// prefix of their name is itself a column, as with a and a.b, since a can't be
+// both a value and an object.
+func UnflattenRow(row types.Row, separator string) types.Row {
+	ret := types.NewRow()
+	if separator == "" {
+		for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+			ret.Set(pair.Key, pair.Value)
+		}
+		return ret
+	}
+
+	// objects created while unflattening, as opposed to objects found in values
+	created := map[types.Row]struct{}{}
+
+	for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+		segments, ok := unflattenSegments(row, pair.Key, separator)
+		if !ok {
+			ret.Set(pair.Key, pair.Value)
+			continue
+		}
+
+		node := ret
+		for _, segment := range segments[:len(segments)-1] {
+			child, ok := node.Get(segment)
+			if !ok {
+				child = types.NewRow()
+				created[child.(types.Row)] = struct{}{}
+				node.Set(segment, child)
+			}
+			node = child.(types.Row)
+		}
+		node.Set(segments[len(segments)-1], pair.Value)
+	}
+
+	for pair := ret.Oldest(); pair != nil; pair = pair.Next() {
+		pair.Value = listsFromIndexes(pair.Value, created)
+	}
+
+	return ret
+}
+
+// unflattenSegments returns the segments of key, or false if the column has to
+// be kept as it is.
+func unflattenSegments(row types.Row, key types.FieldName, separator string) ([]string, bool) {
+	segments := strings.Split(key, separator)
+	if len(segments) < 2 {
+		return nil, false
+	}
+	for i, segment := range segments {
+		if segment == "" {
+			return nil, false
+		}
+		if i > 0 {
+			if _, ok := row.Get(strings.Join(segments[:i], separator)); ok {
+				return nil, false
+			}
+		}
+	}
+	return segments, true
+}
+
+// listsFromIndexes converts the created objects whose keys are 0 to n-1 into
+// lists, depth first.
+func listsFromIndexes(value interface{}, created map[types.Row]struct{}) interface{} {
+	object, ok := value.(types.Row)
+	if !ok {
+		return value
+	}
+	if _, ok := created[object]; !ok {
+		return value
+	}
+
+	for pair := object.Oldest(); pair != nil; pair = pair.Next() {
+		pair.Value = listsFromIndexes(pair.Value, created)
+	}
+
+	// keys are unique, so n keys in [0, n) cover every index
+	list := make([]interface{}, object.Len())
+	for pair := object.Oldest(); pair != nil; pair = pair.Next() {
+		i, err := strconv.Atoi(pair.Key)
+		// reject 01 or +1, which wouldn't round-trip
+		if err != nil || i < 0 || i >= len(list) || strconv.Itoa(i) != pair.Key {
+			return object
+		}
+		list[i] = pair.Value
+	}
+	return list
+}
@@ -0,0 +1,96 @@
+package row
+
+import (
+	"context"
+	"testing"
+
+	assert2 "github.com/go-go-golems/glazed/pkg/helpers/assert"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnflattenNestedObjects(t *testing.T) {
+	row := types.NewRow(
+		types.MRP("id", 1),
+		types.MRP("user.name", "ada"),
+		types.MRP("user.address.city", "london"),
+		types.MRP("status", "ok"),
+		types.MRP("user.address.zip", "n1"),
+	)
+
+	mw := NewUnflattenObjectMiddleware(".")
+	newRows, err := mw.Process(context.Background(), row)
+	require.NoError(t, err)
+	require.Len(t, newRows, 1)
+
+	assert2.EqualRow(t, types.NewRow(
+		types.MRP("id", 1),
+		types.MRP("user", types.NewRow(
+			types.MRP("name", "ada"),
+			types.MRP("address", types.NewRow(
+				types.MRP("city", "london"),
+				types.MRP("zip", "n1"),
+			)),
+		)),
+		types.MRP("status", "ok"),
+	), newRows[0])
+}
+
+func TestUnflattenNumericSegmentsToLists(t *testing.T) {
+	row := types.NewRow(
+		types.MRP("tags.1", "b"),
+		types.MRP("tags.0", "a"),
+		types.MRP("items.0.sku", "x"),
+		types.MRP("items.1.sku", "y"),
+		types.MRP("sparse.0", "a"),
+		types.MRP("sparse.2", "c"),
+		types.MRP("padded.00", "a"),
+	)
+
+	newRow := UnflattenRow(row, ".")
+
+	assert2.EqualRowValue(t, []interface{}{"a", "b"}, newRow, "tags")
+	assert2.EqualRowValue(t, []interface{}{
+		types.NewRow(types.MRP("sku", "x")),
+		types.NewRow(types.MRP("sku", "y")),
+	}, newRow, "items")
+	assert2.EqualRowValue(t, types.NewRow(types.MRP("0", "a"), types.MRP("2", "c")), newRow, "sparse")
+	assert2.EqualRowValue(t, types.NewRow(types.MRP("00", "a")), newRow, "padded")
+}
+
+func TestUnflattenKeepsConflictingColumns(t *testing.T) {
+	row := types.NewRow(
+		types.MRP("a", 1),
+		types.MRP("a.b", 2),
+		types.MRP(".c", 3),
+		types.MRP("d..e", 4),
+		types.MRP("f", types.NewRow(types.MRP("0", "kept"))),
+	)
+
+	newRow := UnflattenRow(row, ".")
+	assert2.EqualRow(t, row, newRow)
+}
+
+func TestUnflattenRoundTripsFlatten(t *testing.T) {
+	row := types.NewRow(
+		types.MRP("a", "value1"),
+		types.MRP("c", types.NewRow(
+			types.MRP("d", "value3"),
+			types.MRP("e", types.NewRow(types.MRP("f", "value4"))),
+		)),
+	)
+
+	assert2.EqualRow(t, row, UnflattenRow(FlattenRow(row), "."))
+}
+
+func TestUnflattenCustomSeparator(t *testing.T) {
+	row := types.NewRow(
+		types.MRP("user__name", "ada"),
+		types.MRP("user.id", 1),
+	)
+
+	newRow := UnflattenRow(row, "__")
+	assert.Equal(t, []types.FieldName{"user", "user.id"}, types.GetFields(newRow))
+	assert2.EqualRowValue(t, types.NewRow(types.MRP("name", "ada")), newRow, "user")
+}
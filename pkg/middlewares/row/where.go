@@ -0,0 +1,56 @@
+package row
+
+import (
+	"context"
+
+	"github.com/go-go-golems/glazed/pkg/expr"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// WhereMiddleware keeps the rows for which all its expressions are truthy.
+//
+// See the expr package for the expression syntax.
+type WhereMiddleware struct {
+	expressions []*expr.Expression
+}
+
+var _ middlewares.RowMiddleware = (*WhereMiddleware)(nil)
+
+func (w *WhereMiddleware) Close(ctx context.Context) error {
+	return nil
+}
+
+// NewWhereMiddleware compiles the given expressions. A row is kept only if
+// every expression matches it.
+func NewWhereMiddleware(expressions ...string) (*WhereMiddleware, error) {
+	ret := &WhereMiddleware{
+		expressions: make([]*expr.Expression, 0, len(expressions)),
+	}
+	for _, source := range expressions {
+		e, err := expr.Compile(source)
+		if err != nil {
+			return nil, err
+		}
+		ret.expressions = append(ret.expressions, e)
+	}
+	return ret, nil
+}
+
+func (w *WhereMiddleware) Process(ctx context.Context, row types.Row) ([]types.Row, error) {
+	for _, e := range w.expressions {
+		ok, err := e.Match(row)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not evaluate where expression %q", e.Source())
+		}
+		if !ok {
+			return []types.Row{}, nil
+		}
+	}
+	return []types.Row{row}, nil
+}
+
+func (w *WhereMiddleware) ConcurrencySafe() bool {
+	return true
+}
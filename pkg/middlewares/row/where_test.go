@@ -0,0 +1,56 @@
+package row
+
+import (
+	"testing"
+
+	"github.com/go-go-golems/glazed/pkg/expr"
+	assert2 "github.com/go-go-golems/glazed/pkg/helpers/assert"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createWhereRows() []types.Row {
+	return []types.Row{
+		types.NewRow(types.MRP("name", "build"), types.MRP("status", "failed"), types.MRP("duration", 45)),
+		types.NewRow(types.MRP("name", "lint"), types.MRP("status", "failed"), types.MRP("duration", 3)),
+		types.NewRow(types.MRP("name", "test"), types.MRP("status", "ok"), types.MRP("duration", 120)),
+	}
+}
+
+func TestWhereMiddlewareFiltersRows(t *testing.T) {
+	mw, err := NewWhereMiddleware(`status == "failed" && duration > 30`)
+	require.NoError(t, err)
+
+	newRows, err := processRows(mw, createWhereRows())
+	require.NoError(t, err)
+	require.Len(t, newRows, 1)
+	assert2.EqualRowValue(t, "build", newRows[0], "name")
+}
+
+func TestWhereMiddlewareRequiresAllExpressions(t *testing.T) {
+	mw, err := NewWhereMiddleware(`duration > 1`, `name in ["lint", "test"]`)
+	require.NoError(t, err)
+
+	newRows, err := processRows(mw, createWhereRows())
+	require.NoError(t, err)
+	require.Len(t, newRows, 2)
+	assert2.EqualRowValue(t, "lint", newRows[0], "name")
+	assert2.EqualRowValue(t, "test", newRows[1], "name")
+}
+
+func TestWhereMiddlewareReturnsParseErrors(t *testing.T) {
+	_, err := NewWhereMiddleware(`status ==`)
+	require.Error(t, err)
+	var parseError *expr.ParseError
+	assert.ErrorAs(t, err, &parseError)
+}
+
+func TestWhereMiddlewareReturnsEvaluationErrors(t *testing.T) {
+	mw, err := NewWhereMiddleware(`duration > "long"`)
+	require.NoError(t, err)
+
+	_, err = processRows(mw, createWhereRows())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `could not evaluate where expression "duration > \"long\""`)
+}
@@ -0,0 +1,392 @@
+package table
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-go-golems/glazed/pkg/helpers/cast"
+	"github.com/go-go-golems/glazed/pkg/helpers/compare"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+)
+
+type AggregateFunction string
+
+const (
+	AggregateCount         AggregateFunction = "count"
+	AggregateSum           AggregateFunction = "sum"
+	AggregateAvg           AggregateFunction = "avg"
+	AggregateMin           AggregateFunction = "min"
+	AggregateMax           AggregateFunction = "max"
+	AggregateCountDistinct AggregateFunction = "count-distinct"
+	AggregateFirst         AggregateFunction = "first"
+	AggregateLast          AggregateFunction = "last"
+	AggregatePercentile    AggregateFunction = "percentile"
+)
+
+// Aggregation describes a single aggregate column computed over each group.
+type Aggregation struct {
+	Function AggregateFunction
+	// Column is the input column. It is empty for a plain row count.
+	Column types.FieldName
+	// Percentile is the requested percentile (0-100) for AggregatePercentile.
+	Percentile float64
+	// As is the name of the output column.
+	As types.FieldName
+}
+
+// ParseAggregation parses an aggregation spec of the form
+//
+//	function[:column][=name]
+//
+// Supported functions are count, sum, avg, min, max, count-distinct (or
+// distinct), first, last, median and pNN percentiles such as p90 or p99.9.
+// Every function except count requires a column. The output column defaults
+// to function_column, or count for a plain count.
+//
+// Examples:
+//
+//	count
+//	sum:cost
+//	p95:latency=latency_p95
+func ParseAggregation(spec string) (Aggregation, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return Aggregation{}, errors.New("empty aggregation")
+	}
+
+	ret := Aggregation{}
+	if idx := strings.Index(spec, "="); idx >= 0 {
+		ret.As = strings.TrimSpace(spec[idx+1:])
+		spec = strings.TrimSpace(spec[:idx])
+		if ret.As == "" {
+			return Aggregation{}, errors.Errorf("empty output column name in aggregation %q", spec)
+		}
+	}
+
+	name := spec
+	if idx := strings.Index(spec, ":"); idx >= 0 {
+		name = strings.TrimSpace(spec[:idx])
+		ret.Column = strings.TrimSpace(spec[idx+1:])
+		if ret.Column == "" {
+			return Aggregation{}, errors.Errorf("empty column in aggregation %q", spec)
+		}
+	}
+	name = strings.ToLower(name)
+
+	switch {
+	case name == "count":
+		ret.Function = AggregateCount
+	case name == "sum":
+		ret.Function = AggregateSum
+	case name == "avg" || name == "mean":
+		ret.Function = AggregateAvg
+	case name == "min":
+		ret.Function = AggregateMin
+	case name == "max":
+		ret.Function = AggregateMax
+	case name == "count-distinct" || name == "distinct":
+		ret.Function = AggregateCountDistinct
+	case name == "first":
+		ret.Function = AggregateFirst
+	case name == "last":
+		ret.Function = AggregateLast
+	case name == "median":
+		ret.Function = AggregatePercentile
+		ret.Percentile = 50
+	case len(name) > 1 && name[0] == 'p':
+		p, err := strconv.ParseFloat(name[1:], 64)
+		if err != nil || p < 0 || p > 100 {
+			return Aggregation{}, errors.Errorf("invalid percentile %q in aggregation %q", name, spec)
+		}
+		ret.Function = AggregatePercentile
+		ret.Percentile = p
+	default:
+		return Aggregation{}, errors.Errorf("unknown aggregate function %q in aggregation %q", name, spec)
+	}
+
+	if ret.Function != AggregateCount && ret.Column == "" {
+		return Aggregation{}, errors.Errorf("aggregate function %s requires a column, e.g. %s:cost", name, name)
+	}
+
+	if ret.As == "" {
+		ret.As = name
+		if ret.Column != "" {
+			ret.As = name + "_" + ret.Column
+		}
+	}
+
+	return ret, nil
+}
+
+// ParseAggregations parses a list of aggregation specs, see ParseAggregation.
+func ParseAggregations(specs ...string) ([]Aggregation, error) {
+	ret := make([]Aggregation, 0, len(specs))
+	for _, spec := range specs {
+		agg, err := ParseAggregation(spec)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, agg)
+	}
+	return ret, nil
+}
+
+// aggregator accumulates the values of a single aggregation for a single group.
+type aggregator interface {
+	add(value interface{}, present bool) error
+	result() interface{}
+}
+
+func newAggregator(agg Aggregation) aggregator {
+	switch agg.Function {
+	case AggregateCount:
+		return &countAggregator{countAll: agg.Column == ""}
+	case AggregateSum:
+		return &sumAggregator{column: agg.Column, allInts: true}
+	case AggregateAvg:
+		return &avgAggregator{column: agg.Column}
+	case AggregateMin:
+		return &extremumAggregator{column: agg.Column, lower: true}
+	case AggregateMax:
+		return &extremumAggregator{column: agg.Column}
+	case AggregateCountDistinct:
+		return &countDistinctAggregator{seen: map[string]struct{}{}}
+	case AggregateFirst:
+		return &firstLastAggregator{}
+	case AggregateLast:
+		return &firstLastAggregator{last: true}
+	case AggregatePercentile:
+		return &percentileAggregator{column: agg.Column, percentile: agg.Percentile}
+	default:
+		panic(fmt.Sprintf("unknown aggregate function %s", agg.Function))
+	}
+}
+
+type countAggregator struct {
+	countAll bool
+	count    int
+}
+
+func (a *countAggregator) add(value interface{}, present bool) error {
+	if a.countAll || (present && value != nil) {
+		a.count++
+	}
+	return nil
+}
+
+func (a *countAggregator) result() interface{} {
+	return a.count
+}
+
+// sumAggregator keeps integer sums as int64 as long as it only sees integers.
+type sumAggregator struct {
+	column  types.FieldName
+	allInts bool
+	intSum  int64
+	sum     float64
+}
+
+func (a *sumAggregator) add(value interface{}, present bool) error {
+	if !present || value == nil {
+		return nil
+	}
+	if i, ok := toInt64(value); ok && a.allInts {
+		a.intSum += i
+		a.sum += float64(i)
+		return nil
+	}
+	f, ok := toFloat64(value)
+	if !ok {
+		return errors.Errorf("cannot sum non-numeric value %v in column %s", value, a.column)
+	}
+	a.allInts = false
+	a.sum += f
+	return nil
+}
+
+func (a *sumAggregator) result() interface{} {
+	if a.allInts {
+		return a.intSum
+	}
+	return a.sum
+}
+
+type avgAggregator struct {
+	column types.FieldName
+	sum    float64
+	count  int
+}
+
+func (a *avgAggregator) add(value interface{}, present bool) error {
+	if !present || value == nil {
+		return nil
+	}
+	f, ok := toFloat64(value)
+	if !ok {
+		return errors.Errorf("cannot average non-numeric value %v in column %s", value, a.column)
+	}
+	a.sum += f
+	a.count++
+	return nil
+}
+
+func (a *avgAggregator) result() interface{} {
+	if a.count == 0 {
+		return nil
+	}
+	return a.sum / float64(a.count)
+}
+
+type extremumAggregator struct {
+	column types.FieldName
+	lower  bool
+	value  interface{}
+	set    bool
+}
+
+func (a *extremumAggregator) add(value interface{}, present bool) error {
+	if !present || value == nil {
+		return nil
+	}
+	if !a.set {
+		a.value = value
+		a.set = true
+		return nil
+	}
+	if a.lower && isLowerThan(value, a.value) || !a.lower && isLowerThan(a.value, value) {
+		a.value = value
+	}
+	return nil
+}
+
+func (a *extremumAggregator) result() interface{} {
+	return a.value
+}
+
+type countDistinctAggregator struct {
+	seen map[string]struct{}
+}
+
+func (a *countDistinctAggregator) add(value interface{}, present bool) error {
+	if !present || value == nil {
+		return nil
+	}
+	a.seen[valueKey(value)] = struct{}{}
+	return nil
+}
+
+func (a *countDistinctAggregator) result() interface{} {
+	return len(a.seen)
+}
+
+// firstLastAggregator returns the value of the first or last row of the group,
+// which may be null.
+type firstLastAggregator struct {
+	last  bool
+	value interface{}
+	set   bool
+}
+
+func (a *firstLastAggregator) add(value interface{}, present bool) error {
+	if !a.set || a.last {
+		a.value = value
+		a.set = true
+	}
+	return nil
+}
+
+func (a *firstLastAggregator) result() interface{} {
+	return a.value
+}
+
+type percentileAggregator struct {
+	column     types.FieldName
+	percentile float64
+	values     []float64
+}
+
+func (a *percentileAggregator) add(value interface{}, present bool) error {
+	if !present || value == nil {
+		return nil
+	}
+	f, ok := toFloat64(value)
+	if !ok {
+		return errors.Errorf("cannot compute percentile of non-numeric value %v in column %s", value, a.column)
+	}
+	a.values = append(a.values, f)
+	return nil
+}
+
+func (a *percentileAggregator) result() interface{} {
+	if len(a.values) == 0 {
+		return nil
+	}
+	return percentile(a.values, a.percentile)
+}
+
+// percentile computes the p-th percentile (0-100) of values using linear
+// interpolation between the closest ranks. values is sorted in place.
+func percentile(values []float64, p float64) float64 {
+	sort.Float64s(values)
+	if len(values) == 1 {
+		return values[0]
+	}
+	rank := p / 100 * float64(len(values)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower == upper {
+		return values[lower]
+	}
+	return values[lower] + (values[upper]-values[lower])*(rank-float64(lower))
+}
+
+// toFloat64 converts numbers and numeric strings (as produced by CSV input) to
+// a float64.
+func toFloat64(value interface{}) (float64, bool) {
+	if f, ok := cast.CastNumberInterfaceToFloat[float64](value); ok {
+		return f, true
+	}
+	if s, ok := value.(string); ok {
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err == nil {
+			return f, true
+		}
+	}
+	return 0, false
+}
+
+// toInt64 converts integer types and integer strings to an int64. Floats are
+// not considered integers, even if they have no fractional part.
+func toInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case float32, float64:
+		return 0, false
+	case string:
+		i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		return i, err == nil
+	default:
+		return cast.CastNumberInterfaceToInt[int64](value)
+	}
+}
+
+// isLowerThan orders numbers and numeric strings numerically and falls back to
+// compare.IsLowerThan otherwise.
+func isLowerThan(a, b interface{}) bool {
+	af, ok := toFloat64(a)
+	if ok {
+		if bf, ok := toFloat64(b); ok {
+			return af < bf
+		}
+	}
+	return compare.IsLowerThan(a, b)
+}
+
+// valueKey returns a string identifying value, so that values of different
+// types that print the same (1 and "1") are kept apart.
+func valueKey(value interface{}) string {
+	return fmt.Sprintf("%T:%v", value, value)
+}
@@ -0,0 +1,429 @@
+package table
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+)
+
+// DescribeColumns are the columns of the profile output by DescribeMiddleware.
+var DescribeColumns = []types.FieldName{
+	"column", "type", "count", "nulls", "distinct", "min", "max", "mean", "top", "samples",
+}
+
+// DescribeMiddleware replaces the table with a profile of its columns, with
+// one row per input column holding:
+//
+//   - type: the inferred type of the values (int, float, bool, time, string,
+//     list, object), mixed if the values have different types, or null if all
+//     values are null
+//   - count and nulls: the number of non-null and of null, missing or empty
+//     string values
+//   - distinct: the number of distinct non-null values
+//   - min and max: the smallest and largest value of int, float, time and
+//     string columns
+//   - mean: the mean of int and float columns
+//   - top: the most frequent values with their count, such as "a (3), b (2)"
+//   - samples: the first distinct values
+//
+// Numeric, boolean, RFC 3339 and YYYY-MM-DD strings, as produced by CSV input, are
+// profiled as the type they hold.
+//
+// Distinct values are counted exactly by default. WithApproximateDistinct
+// estimates them with a HyperLogLog sketch and tracks the top values with a
+// bounded number of counters instead, so that the profile of a column doesn't
+// grow with the number of distinct values. The input table itself is still held
+// in memory, as for every table middleware.
+type DescribeMiddleware struct {
+	topValues   int
+	samples     int
+	approximate bool
+}
+
+var _ middlewares.TableMiddleware = (*DescribeMiddleware)(nil)
+
+type DescribeOption func(*DescribeMiddleware)
+
+// WithDescribeTopValues sets the number of most frequent values listed per
+// column. It defaults to 5.
+func WithDescribeTopValues(n int) DescribeOption {
+	return func(d *DescribeMiddleware) {
+		d.topValues = n
+	}
+}
+
+// WithDescribeSamples sets the number of sample values listed per column. It
+// defaults to 3.
+func WithDescribeSamples(n int) DescribeOption {
+	return func(d *DescribeMiddleware) {
+		d.samples = n
+	}
+}
+
+// WithApproximateDistinct estimates the distinct counts and top values with a
+// fixed number of counters per column.
+func WithApproximateDistinct() DescribeOption {
+	return func(d *DescribeMiddleware) {
+		d.approximate = true
+	}
+}
+
+func NewDescribeMiddleware(options ...DescribeOption) *DescribeMiddleware {
+	ret := &DescribeMiddleware{
+		topValues: 5,
+		samples:   3,
+	}
+	for _, option := range options {
+		option(ret)
+	}
+	return ret
+}
+
+func (d *DescribeMiddleware) Process(ctx context.Context, table *types.Table) (*types.Table, error) {
+	columns := tableColumns(table)
+	profiles := make([]*columnProfile, len(columns))
+	for i := range columns {
+		profiles[i] = d.newColumnProfile()
+	}
+
+	for _, row := range table.Rows {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for i, column := range columns {
+			v, _ := row.Get(column)
+			profiles[i].add(v)
+		}
+	}
+
+	ret := &types.Table{
+		Columns: append([]types.FieldName{}, DescribeColumns...),
+		Rows:    make([]types.Row, 0, len(columns)),
+	}
+	for i, column := range columns {
+		ret.Rows = append(ret.Rows, profiles[i].row(column, d.topValues))
+	}
+	return ret, nil
+}
+
+func (d *DescribeMiddleware) Close(ctx context.Context) error {
+	return nil
+}
+
+func (d *DescribeMiddleware) newColumnProfile() *columnProfile {
+	ret := &columnProfile{
+		types:      map[string]int{},
+		counts:     newValueCounts(0),
+		samples:    d.samples,
+		sampleKeys: map[string]struct{}{},
+	}
+	if d.approximate {
+		ret.distinct = newHyperLogLog()
+		// a capacity of 0 would count every value, and no counts are needed
+		// without top values
+		ret.counts = nil
+		if d.topValues > 0 {
+			ret.counts = newValueCounts(10 * d.topValues)
+		}
+	}
+	return ret
+}
+
+// columnProfile accumulates the statistics of a single column.
+type columnProfile struct {
+	count int
+	nulls int
+	types map[string]int
+
+	min, max       interface{}
+	minKey, maxKey interface{}
+	sum            float64
+	numbers        int
+
+	distinct *hyperLogLog
+	counts   *valueCounts
+
+	samples      int
+	sampleValues []interface{}
+	sampleKeys   map[string]struct{}
+}
+
+func (p *columnProfile) add(value interface{}) {
+	if value == nil {
+		p.nulls++
+		return
+	}
+	type_, sortKey := profileValueType(value)
+	if type_ == "null" {
+		p.nulls++
+		return
+	}
+	p.count++
+	p.types[type_]++
+
+	if sortKey != nil {
+		if p.minKey == nil || sortKeyLess(sortKey, p.minKey) {
+			p.min, p.minKey = value, sortKey
+		}
+		if p.maxKey == nil || sortKeyLess(p.maxKey, sortKey) {
+			p.max, p.maxKey = value, sortKey
+		}
+	}
+	if f, ok := sortKey.(float64); ok {
+		p.sum += f
+		p.numbers++
+	}
+
+	key := valueKey(value)
+	if type_ == "list" || type_ == "object" {
+		key = fmt.Sprintf("%T:%s", value, profileValueString(value))
+	}
+	if p.distinct != nil {
+		p.distinct.add(key)
+	}
+	if p.counts != nil {
+		p.counts.add(key, value)
+	}
+
+	if len(p.sampleValues) < p.samples {
+		if _, ok := p.sampleKeys[key]; !ok {
+			p.sampleKeys[key] = struct{}{}
+			p.sampleValues = append(p.sampleValues, value)
+		}
+	}
+}
+
+// columnType merges the types of the values: a column of ints and floats is a
+// float column.
+func (p *columnProfile) columnType() string {
+	switch {
+	case len(p.types) == 0:
+		return "null"
+	case len(p.types) == 1:
+		for type_ := range p.types {
+			return type_
+		}
+	case len(p.types) == 2 && p.types["int"] > 0 && p.types["float"] > 0:
+		return "float"
+	}
+	return "mixed"
+}
+
+func (p *columnProfile) row(column types.FieldName, topValues int) types.Row {
+	type_ := p.columnType()
+
+	var distinct interface{}
+	if p.distinct != nil {
+		distinct = int(p.distinct.count())
+	} else {
+		distinct = p.counts.len()
+	}
+
+	var min, max, mean interface{}
+	switch type_ {
+	case "int", "float", "time", "string":
+		min, max = p.min, p.max
+	}
+	if (type_ == "int" || type_ == "float") && p.numbers > 0 {
+		mean = p.sum / float64(p.numbers)
+	}
+
+	top := []string{}
+	if p.counts != nil {
+		for _, c := range p.counts.top(topValues) {
+			top = append(top, fmt.Sprintf("%s (%d)", profileValueString(c.value), c.count))
+		}
+	}
+	samples := []string{}
+	for _, v := range p.sampleValues {
+		samples = append(samples, profileValueString(v))
+	}
+
+	return types.NewRow(
+		types.MRP("column", column),
+		types.MRP("type", type_),
+		types.MRP("count", p.count),
+		types.MRP("nulls", p.nulls),
+		types.MRP("distinct", distinct),
+		types.MRP("min", min),
+		types.MRP("max", max),
+		types.MRP("mean", mean),
+		types.MRP("top", strings.Join(top, ", ")),
+		types.MRP("samples", strings.Join(samples, ", ")),
+	)
+}
+
+// profileValueType returns the type of a non-null value, null for empty
+// strings such as empty CSV cells, and the key it is
+// ordered by for min and max: a float64 for numbers, a time.Time for times, a
+// string for strings, or nil if the value isn't ordered.
+func profileValueType(value interface{}) (string, interface{}) {
+	switch v := value.(type) {
+	case bool:
+		return "bool", nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		f, _ := toFloat64(v)
+		return "int", f
+	case float32, float64:
+		f, _ := toFloat64(v)
+		return "float", f
+	case time.Time:
+		return "time", v
+	case *time.Time:
+		if v == nil {
+			return "null", nil
+		}
+		return "time", *v
+	case string:
+		s := strings.TrimSpace(v)
+		if s == "" {
+			return "null", nil
+		}
+		if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+			f, _ := strconv.ParseFloat(s, 64)
+			return "int", f
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return "float", f
+		}
+		if _, err := strconv.ParseBool(s); err == nil && len(s) > 1 {
+			return "bool", nil
+		}
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			return "time", t
+		}
+		if t, err := time.Parse("2006-01-02", s); err == nil {
+			return "time", t
+		}
+		return "string", v
+	case types.Row, map[string]interface{}, map[string]string:
+		return "object", nil
+	}
+
+	kind := reflect.ValueOf(value).Kind()
+	switch kind {
+	case reflect.Slice, reflect.Array:
+		return "list", nil
+	case reflect.Map, reflect.Struct:
+		return "object", nil
+	default:
+		return "string", nil
+	}
+}
+
+// profileValueString formats a value for the top and samples columns, lists and
+// objects as JSON.
+func profileValueString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case *time.Time:
+		return v.Format(time.RFC3339)
+	}
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Ptr, reflect.Struct:
+		if b, err := json.Marshal(value); err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+func sortKeyLess(a, b interface{}) bool {
+	switch a := a.(type) {
+	case float64:
+		if b, ok := b.(float64); ok {
+			return a < b
+		}
+	case time.Time:
+		if b, ok := b.(time.Time); ok {
+			return a.Before(b)
+		}
+	case string:
+		if b, ok := b.(string); ok {
+			return a < b
+		}
+	}
+	// keys of different types are ordered by type name, so that the order is
+	// stable for mixed columns
+	return fmt.Sprintf("%T", a) < fmt.Sprintf("%T", b)
+}
+
+type valueCount struct {
+	value interface{}
+	count int
+	// seq is the order in which the value was first counted, used to break
+	// ties between values of the same count.
+	seq int
+}
+
+// valueCounts counts the occurrences of values. With a capacity, it uses the
+// space-saving algorithm: when all counters are taken, the least frequent
+// value is replaced by the new one, which inherits its count. The most
+// frequent values are then kept with an overestimated count.
+type valueCounts struct {
+	capacity int
+	counts   map[string]*valueCount
+	seq      int
+}
+
+func newValueCounts(capacity int) *valueCounts {
+	return &valueCounts{
+		capacity: capacity,
+		counts:   map[string]*valueCount{},
+	}
+}
+
+func (c *valueCounts) add(key string, value interface{}) {
+	if vc, ok := c.counts[key]; ok {
+		vc.count++
+		return
+	}
+	c.seq++
+	if c.capacity <= 0 || len(c.counts) < c.capacity {
+		c.counts[key] = &valueCount{value: value, count: 1, seq: c.seq}
+		return
+	}
+
+	var minKey string
+	var minCount *valueCount
+	for k, vc := range c.counts {
+		if minCount == nil || vc.count < minCount.count || vc.count == minCount.count && vc.seq > minCount.seq {
+			minKey, minCount = k, vc
+		}
+	}
+	delete(c.counts, minKey)
+	c.counts[key] = &valueCount{value: value, count: minCount.count + 1, seq: c.seq}
+}
+
+func (c *valueCounts) len() int {
+	return len(c.counts)
+}
+
+// top returns the n most frequent values, most frequent first.
+func (c *valueCounts) top(n int) []*valueCount {
+	ret := make([]*valueCount, 0, len(c.counts))
+	for _, vc := range c.counts {
+		ret = append(ret, vc)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].count != ret[j].count {
+			return ret[i].count > ret[j].count
+		}
+		return ret[i].seq < ret[j].seq
+	})
+	if n >= 0 && len(ret) > n {
+		ret = ret[:n]
+	}
+	return ret
+}
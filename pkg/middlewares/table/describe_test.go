@@ -0,0 +1,123 @@
+package table
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	assert2 "github.com/go-go-golems/glazed/pkg/helpers/assert"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createDescribeTable() *types.Table {
+	ret := types.NewTable()
+	ret.Columns = []types.FieldName{"name", "cost", "created", "tags"}
+	ret.AddRows(
+		types.NewRow(types.MRP("name", "ada"), types.MRP("cost", "10"), types.MRP("created", "2024-01-02"), types.MRP("tags", []interface{}{"a"})),
+		types.NewRow(types.MRP("name", "bob"), types.MRP("cost", 2.5), types.MRP("created", "2024-03-01"), types.MRP("tags", nil)),
+		types.NewRow(types.MRP("name", "ada"), types.MRP("cost", nil), types.MRP("created", "2023-12-31")),
+		types.NewRow(types.MRP("name", "cy"), types.MRP("cost", 4), types.MRP("created", "2024-01-02"), types.MRP("active", true)),
+	)
+	return ret
+}
+
+func describeRow(t *testing.T, table *types.Table, column string) types.Row {
+	t.Helper()
+	for _, row := range table.Rows {
+		if v, _ := row.Get("column"); v == column {
+			return row
+		}
+	}
+	require.Failf(t, "missing profile row", "column %s", column)
+	return nil
+}
+
+func TestDescribeMiddleware(t *testing.T) {
+	mw := NewDescribeMiddleware(WithDescribeTopValues(2), WithDescribeSamples(2))
+	newTable, err := mw.Process(context.Background(), createDescribeTable())
+	require.NoError(t, err)
+
+	assert.Equal(t, DescribeColumns, newTable.Columns)
+	require.Len(t, newTable.Rows, 5)
+
+	name := describeRow(t, newTable, "name")
+	assert2.EqualRowValue(t, "string", name, "type")
+	assert2.EqualRowValue(t, 4, name, "count")
+	assert2.EqualRowValue(t, 0, name, "nulls")
+	assert2.EqualRowValue(t, 3, name, "distinct")
+	assert2.EqualRowValue(t, "ada", name, "min")
+	assert2.EqualRowValue(t, "cy", name, "max")
+	assert2.EqualRowValue(t, nil, name, "mean")
+	assert2.EqualRowValue(t, "ada (2), bob (1)", name, "top")
+	assert2.EqualRowValue(t, "ada, bob", name, "samples")
+
+	cost := describeRow(t, newTable, "cost")
+	assert2.EqualRowValue(t, "float", cost, "type")
+	assert2.EqualRowValue(t, 3, cost, "count")
+	assert2.EqualRowValue(t, 1, cost, "nulls")
+	assert2.EqualRowValue(t, 2.5, cost, "min")
+	assert2.EqualRowValue(t, "10", cost, "max")
+	assert2.EqualRowValue(t, 16.5/3, cost, "mean")
+
+	created := describeRow(t, newTable, "created")
+	assert2.EqualRowValue(t, "time", created, "type")
+	assert2.EqualRowValue(t, "2023-12-31", created, "min")
+	assert2.EqualRowValue(t, "2024-03-01", created, "max")
+	assert2.EqualRowValue(t, "2024-01-02 (2), 2024-03-01 (1)", created, "top")
+
+	tags := describeRow(t, newTable, "tags")
+	assert2.EqualRowValue(t, "list", tags, "type")
+	assert2.EqualRowValue(t, 3, tags, "nulls")
+	assert2.EqualRowValue(t, `["a"]`, tags, "samples")
+
+	active := describeRow(t, newTable, "active")
+	assert2.EqualRowValue(t, "bool", active, "type")
+	assert2.EqualRowValue(t, 3, active, "nulls")
+	assert2.EqualRowValue(t, nil, active, "min")
+}
+
+func TestDescribeMiddlewareMixedTypes(t *testing.T) {
+	table := types.NewTable()
+	table.AddRows(
+		types.NewRow(types.MRP("v", 1)),
+		types.NewRow(types.MRP("v", "x")),
+	)
+	newTable, err := NewDescribeMiddleware().Process(context.Background(), table)
+	require.NoError(t, err)
+	v := describeRow(t, newTable, "v")
+	assert2.EqualRowValue(t, "mixed", v, "type")
+	assert2.EqualRowValue(t, nil, v, "min")
+}
+
+func TestDescribeMiddlewareApproximateDistinct(t *testing.T) {
+	table := types.NewTable()
+	for i := 0; i < 20000; i++ {
+		table.AddRows(types.NewRow(types.MRP("id", i), types.MRP("mod", fmt.Sprintf("m%d", i%3))))
+	}
+
+	newTable, err := NewDescribeMiddleware(WithApproximateDistinct()).Process(context.Background(), table)
+	require.NoError(t, err)
+
+	id := describeRow(t, newTable, "id")
+	distinct, _ := id.Get("distinct")
+	assert.InDelta(t, 20000, distinct, 20000*0.03)
+
+	mod := describeRow(t, newTable, "mod")
+	assert2.EqualRowValue(t, 3, mod, "distinct")
+	assert2.EqualRowValue(t, "m0 (6667), m1 (6667), m2 (6666)", mod, "top")
+}
+
+func TestDescribeMiddlewareApproximateBoundsTopValueCounters(t *testing.T) {
+	profile := NewDescribeMiddleware(WithApproximateDistinct(), WithDescribeTopValues(0)).newColumnProfile()
+	profile.add("a")
+	assert.Nil(t, profile.counts)
+	assert2.EqualRowValue(t, "", profile.row("c", 0), "top")
+
+	profile = NewDescribeMiddleware(WithApproximateDistinct(), WithDescribeTopValues(1)).newColumnProfile()
+	for i := 0; i < 1000; i++ {
+		profile.add(i)
+	}
+	assert.LessOrEqual(t, profile.counts.len(), 10)
+}
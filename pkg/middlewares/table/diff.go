@@ -0,0 +1,256 @@
+package table
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+)
+
+type DiffType string
+
+const (
+	DiffAdded   DiffType = "added"
+	DiffRemoved DiffType = "removed"
+	DiffChanged DiffType = "changed"
+)
+
+// DiffMiddleware compares the table it processes with a base table, matching
+// rows by their key columns, and replaces it with one row per difference:
+//
+//	id | diff    | name_old | name_new | cost_old | cost_new
+//	2  | changed | bob      | rob      | <nil>    | <nil>
+//	3  | removed | cy       | <nil>    | 5        | <nil>
+//	4  | added   | <nil>    | dee      | <nil>    | 7
+//
+// Changed rows only hold the old and new values of the columns that differ.
+// Removed and changed rows come first, in the order of the base table,
+// followed by the added rows in the order of the processed table.
+// Columns that never differ are left out.
+//
+// Values are compared as strings, so that the number 1 read from a JSON file
+// is the same as the string "1" read from a CSV file. Missing and null values
+// are the same, and different from every other value. Keys have to be unique
+// in both tables.
+type DiffMiddleware struct {
+	keys       []types.FieldName
+	diffColumn types.FieldName
+	oldSuffix  string
+	newSuffix  string
+
+	base      *types.Table
+	baseIndex map[string]int
+}
+
+var _ middlewares.TableMiddleware = (*DiffMiddleware)(nil)
+
+type DiffOption func(*DiffMiddleware)
+
+// WithDiffColumn sets the column holding the type of the difference, diff by
+// default.
+func WithDiffColumn(column types.FieldName) DiffOption {
+	return func(d *DiffMiddleware) {
+		d.diffColumn = column
+	}
+}
+
+// WithDiffSuffixes sets the suffixes of the columns holding the old and new
+// values, _old and _new by default.
+func WithDiffSuffixes(oldSuffix string, newSuffix string) DiffOption {
+	return func(d *DiffMiddleware) {
+		d.oldSuffix = oldSuffix
+		d.newSuffix = newSuffix
+	}
+}
+
+// NewDiffMiddleware creates a DiffMiddleware comparing tables against base.
+// It returns an error if no key is given or if base has duplicate keys.
+func NewDiffMiddleware(base *types.Table, keys []types.FieldName, options ...DiffOption) (*DiffMiddleware, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("diff requires at least one key column")
+	}
+	ret := &DiffMiddleware{
+		keys:       keys,
+		diffColumn: "diff",
+		oldSuffix:  "_old",
+		newSuffix:  "_new",
+		base:       base,
+	}
+	for _, option := range options {
+		option(ret)
+	}
+	if ret.oldSuffix == ret.newSuffix {
+		return nil, errors.Errorf("old and new suffixes are both %q", ret.oldSuffix)
+	}
+
+	var err error
+	ret.baseIndex, err = ret.index(base, "base")
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (d *DiffMiddleware) Process(ctx context.Context, table *types.Table) (*types.Table, error) {
+	index, err := d.index(table, "new")
+	if err != nil {
+		return nil, err
+	}
+
+	// columns are listed in the order of the base table, followed by the
+	// columns only found in the new table
+	columns := []types.FieldName{}
+	for _, column := range tableColumns(d.base) {
+		if !containsField(d.keys, column) {
+			columns = append(columns, column)
+		}
+	}
+	for _, column := range tableColumns(table) {
+		if !containsField(d.keys, column) && !containsField(columns, column) {
+			columns = append(columns, column)
+		}
+	}
+	used := map[types.FieldName]bool{}
+
+	rows := []types.Row{}
+	counts := map[DiffType]int{}
+	addDiff := func(diffType DiffType, key types.Row, oldRow types.Row, newRow types.Row) {
+		row := types.NewRow()
+		for _, k := range d.keys {
+			v, _ := key.Get(k)
+			row.Set(k, v)
+		}
+		row.Set(d.diffColumn, string(diffType))
+		for _, column := range columns {
+			var oldValue, newValue interface{}
+			if oldRow != nil {
+				oldValue, _ = oldRow.Get(column)
+			}
+			if newRow != nil {
+				newValue, _ = newRow.Get(column)
+			}
+			if diffType == DiffChanged && diffValuesEqual(oldValue, newValue) {
+				continue
+			}
+			if oldValue == nil && newValue == nil {
+				continue
+			}
+			used[column] = true
+			row.Set(column+d.oldSuffix, oldValue)
+			row.Set(column+d.newSuffix, newValue)
+		}
+		rows = append(rows, row)
+		counts[diffType]++
+	}
+
+	for _, oldRow := range d.base.Rows {
+		i, ok := index[d.key(oldRow)]
+		if !ok {
+			addDiff(DiffRemoved, oldRow, oldRow, nil)
+			continue
+		}
+		newRow := table.Rows[i]
+		for _, column := range columns {
+			oldValue, _ := oldRow.Get(column)
+			newValue, _ := newRow.Get(column)
+			if !diffValuesEqual(oldValue, newValue) {
+				addDiff(DiffChanged, oldRow, oldRow, newRow)
+				break
+			}
+		}
+	}
+	for _, newRow := range table.Rows {
+		if _, ok := d.baseIndex[d.key(newRow)]; !ok {
+			addDiff(DiffAdded, newRow, nil, newRow)
+		}
+	}
+
+	log.Debug().
+		Int("added", counts[DiffAdded]).
+		Int("removed", counts[DiffRemoved]).
+		Int("changed", counts[DiffChanged]).
+		Msg("compared tables")
+
+	ret := &types.Table{
+		Columns: append(append([]types.FieldName{}, d.keys...), d.diffColumn),
+		Rows:    rows,
+	}
+	for _, column := range columns {
+		if used[column] {
+			ret.Columns = append(ret.Columns, column+d.oldSuffix, column+d.newSuffix)
+		}
+	}
+	// cells that don't differ in a row are null
+	for _, row := range ret.Rows {
+		for _, column := range ret.Columns {
+			if _, ok := row.Get(column); !ok {
+				row.Set(column, nil)
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+func (d *DiffMiddleware) Close(ctx context.Context) error {
+	return nil
+}
+
+// index maps the keys of the rows of table to their position.
+func (d *DiffMiddleware) index(table *types.Table, name string) (map[string]int, error) {
+	ret := make(map[string]int, len(table.Rows))
+	for i, row := range table.Rows {
+		key := d.key(row)
+		if j, ok := ret[key]; ok {
+			return nil, errors.Errorf("rows %d and %d of the %s table have the same key %s", j+1, i+1, name, d.describeKey(row))
+		}
+		ret[key] = i
+	}
+	return ret, nil
+}
+
+func (d *DiffMiddleware) key(row types.Row) string {
+	keys := make([]string, len(d.keys))
+	for i, column := range d.keys {
+		v, _ := row.Get(column)
+		if v == nil {
+			keys[i] = "\x01"
+		} else {
+			keys[i] = diffValue(v)
+		}
+	}
+	return strings.Join(keys, "\x00")
+}
+
+func (d *DiffMiddleware) describeKey(row types.Row) string {
+	parts := make([]string, len(d.keys))
+	for i, column := range d.keys {
+		v, _ := row.Get(column)
+		parts[i] = fmt.Sprintf("%s=%v", column, v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func diffValuesEqual(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return diffValue(a) == diffValue(b)
+}
+
+// diffValue formats a value for comparison, encoding nested objects and
+// lists as JSON.
+func diffValue(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}, types.Row:
+		b, err := json.Marshal(v)
+		if err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,86 @@
+package table
+
+import (
+	"context"
+	"testing"
+
+	assert2 "github.com/go-go-golems/glazed/pkg/helpers/assert"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffMiddleware(t *testing.T) {
+	base := types.NewTable()
+	base.AddRows(
+		types.NewRow(types.MRP("id", 1.0), types.MRP("name", "ada"), types.MRP("cost", 1.0)),
+		types.NewRow(types.MRP("id", 2.0), types.MRP("name", "bob"), types.MRP("cost", 2.0)),
+		types.NewRow(types.MRP("id", 3.0), types.MRP("name", "cy"), types.MRP("cost", 5.0)),
+	)
+	// the new table was read from a CSV file
+	table := types.NewTable()
+	table.AddRows(
+		types.NewRow(types.MRP("id", "4"), types.MRP("name", "dee"), types.MRP("cost", "7")),
+		types.NewRow(types.MRP("id", "2"), types.MRP("name", "rob"), types.MRP("cost", "2")),
+		types.NewRow(types.MRP("id", "1"), types.MRP("name", "ada"), types.MRP("cost", "1")),
+	)
+
+	mw, err := NewDiffMiddleware(base, []types.FieldName{"id"})
+	require.NoError(t, err)
+	newTable, err := mw.Process(context.Background(), table)
+	require.NoError(t, err)
+
+	assert.Equal(t, []types.FieldName{"id", "diff", "name_old", "name_new", "cost_old", "cost_new"}, newTable.Columns)
+	require.Len(t, newTable.Rows, 3)
+
+	assert2.EqualRowValue(t, 2.0, newTable.Rows[0], "id")
+	assert2.EqualRowValue(t, "changed", newTable.Rows[0], "diff")
+	assert2.EqualRowValue(t, "bob", newTable.Rows[0], "name_old")
+	assert2.EqualRowValue(t, "rob", newTable.Rows[0], "name_new")
+	assert2.EqualRowValue(t, nil, newTable.Rows[0], "cost_old")
+
+	assert2.EqualRowValue(t, "removed", newTable.Rows[1], "diff")
+	assert2.EqualRowValue(t, 5.0, newTable.Rows[1], "cost_old")
+	assert2.EqualRowValue(t, nil, newTable.Rows[1], "cost_new")
+
+	assert2.EqualRowValue(t, "4", newTable.Rows[2], "id")
+	assert2.EqualRowValue(t, "added", newTable.Rows[2], "diff")
+	assert2.EqualRowValue(t, nil, newTable.Rows[2], "name_old")
+	assert2.EqualRowValue(t, "dee", newTable.Rows[2], "name_new")
+}
+
+func TestDiffMiddlewareCompositeKeys(t *testing.T) {
+	base := types.NewTable()
+	base.AddRows(
+		types.NewRow(types.MRP("user", "ada"), types.MRP("day", 1), types.MRP("tags", []interface{}{"a"})),
+		types.NewRow(types.MRP("user", "ada"), types.MRP("day", 2), types.MRP("tags", nil)),
+	)
+	table := types.NewTable()
+	table.AddRows(
+		types.NewRow(types.MRP("user", "ada"), types.MRP("day", 1), types.MRP("tags", []interface{}{"a", "b"})),
+		types.NewRow(types.MRP("user", "ada"), types.MRP("day", 2)),
+	)
+
+	mw, err := NewDiffMiddleware(base, []types.FieldName{"user", "day"}, WithDiffColumn("change"), WithDiffSuffixes(".a", ".b"))
+	require.NoError(t, err)
+	newTable, err := mw.Process(context.Background(), table)
+	require.NoError(t, err)
+
+	assert.Equal(t, []types.FieldName{"user", "day", "change", "tags.a", "tags.b"}, newTable.Columns)
+	require.Len(t, newTable.Rows, 1)
+	assert2.EqualRowValue(t, []interface{}{"a", "b"}, newTable.Rows[0], "tags.b")
+}
+
+func TestDiffMiddlewareRejectsDuplicateKeys(t *testing.T) {
+	base := types.NewTable()
+	base.AddRows(
+		types.NewRow(types.MRP("id", 1)),
+		types.NewRow(types.MRP("id", "1")),
+	)
+	_, err := NewDiffMiddleware(base, []types.FieldName{"id"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "id=1")
+
+	_, err = NewDiffMiddleware(types.NewTable(), nil)
+	assert.Error(t, err)
+}
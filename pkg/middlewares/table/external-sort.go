@@ -0,0 +1,546 @@
+package table
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"encoding/gob"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+)
+
+const DefaultExternalSortMemoryBudget = 64 * 1024 * 1024
+
+// DefaultExternalSortMergeFanIn is the maximum number of run files opened at
+// once while merging.
+const DefaultExternalSortMergeFanIn = 64
+
+func init() {
+	// the types produced by the glazed input readers, beyond the basic types
+	// gob already knows about.
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+	gob.Register([]string{})
+	gob.Register(map[string]string{})
+	gob.Register(time.Time{})
+	// nested rows and time pointers are converted by spillValue
+	gob.Register(&spilledRow{})
+	gob.Register([]*spilledRow{})
+	gob.Register(&spilledTime{})
+}
+
+// ExternalSortByMiddleware sorts rows like SortByMiddleware, but without holding
+// the whole table in memory. It is a row middleware: rows are buffered until
+// their estimated size exceeds the memory budget, at which point the buffer is
+// sorted and spilled to a temporary file. When the processor is closed, the
+// sorted runs are merged and the rows are passed on to the downstream row
+// middlewares in order. At most mergeFanIn runs are merged at once: when more
+// runs were spilled, they are first merged in several passes into longer
+// intermediate runs, so that the number of open files stays bounded.
+//
+// Rows are encoded with encoding/gob when spilled. Values of types other than
+// the basic types, []interface{}, map[string]interface{}, []string,
+// map[string]string, time.Time, *time.Time and nested types.Row values have to
+// be registered with gob.Register.
+//
+// Rows that compare equal keep their input order.
+type ExternalSortByMiddleware struct {
+	columns      []columnOrder
+	memoryBudget int
+	mergeFanIn   int
+	tempDir      string
+
+	buffer     []types.Row
+	bufferSize int
+	runs       []string
+}
+
+var _ middlewares.FlushingRowMiddleware = (*ExternalSortByMiddleware)(nil)
+
+type ExternalSortOption func(*ExternalSortByMiddleware)
+
+// WithMemoryBudget sets the estimated number of bytes of rows that are held in
+// memory before a sorted run is spilled to disk.
+func WithMemoryBudget(bytes int) ExternalSortOption {
+	return func(m *ExternalSortByMiddleware) {
+		m.memoryBudget = bytes
+	}
+}
+
+// WithMergeFanIn sets the maximum number of runs merged at once,
+// DefaultExternalSortMergeFanIn by default. It is at least 2.
+func WithMergeFanIn(runs int) ExternalSortOption {
+	return func(m *ExternalSortByMiddleware) {
+		m.mergeFanIn = runs
+	}
+}
+
+// WithTempDir sets the directory the sorted runs are written to. It defaults
+// to os.TempDir().
+func WithTempDir(dir string) ExternalSortOption {
+	return func(m *ExternalSortByMiddleware) {
+		m.tempDir = dir
+	}
+}
+
+// NewExternalSortByMiddlewareFromColumns creates an ExternalSortByMiddleware.
+// The columns use the same syntax as NewSortByMiddlewareFromColumns.
+func NewExternalSortByMiddlewareFromColumns(columns []string, options ...ExternalSortOption) *ExternalSortByMiddleware {
+	ret := &ExternalSortByMiddleware{
+		columns:      parseColumnOrders(columns),
+		memoryBudget: DefaultExternalSortMemoryBudget,
+		mergeFanIn:   DefaultExternalSortMergeFanIn,
+	}
+	for _, option := range options {
+		option(ret)
+	}
+	if ret.mergeFanIn < 2 {
+		ret.mergeFanIn = 2
+	}
+	return ret
+}
+
+func (m *ExternalSortByMiddleware) Process(ctx context.Context, row types.Row) ([]types.Row, error) {
+	m.buffer = append(m.buffer, row)
+	m.bufferSize += estimateRowSize(row)
+	if m.bufferSize >= m.memoryBudget {
+		if err := m.spill(); err != nil {
+			return nil, err
+		}
+	}
+	return []types.Row{}, nil
+}
+
+func (m *ExternalSortByMiddleware) sortBuffer() {
+	sort.SliceStable(m.buffer, func(i, j int) bool {
+		return lessRows(m.columns, m.buffer[i], m.buffer[j])
+	})
+}
+
+// spill sorts the buffered rows and writes them to a new run file.
+func (m *ExternalSortByMiddleware) spill() error {
+	if len(m.buffer) == 0 {
+		return nil
+	}
+	m.sortBuffer()
+
+	w, err := m.createRun()
+	if err != nil {
+		return err
+	}
+	for _, row := range m.buffer {
+		if err := w.write(row); err != nil {
+			_ = w.close()
+			return err
+		}
+	}
+	if err := w.close(); err != nil {
+		return err
+	}
+
+	m.buffer = nil
+	m.bufferSize = 0
+	return nil
+}
+
+// createRun creates a new run file, registered in m.runs so that it gets
+// removed even if writing it fails.
+func (m *ExternalSortByMiddleware) createRun() (*runWriter, error) {
+	f, err := os.CreateTemp(m.tempDir, "glazed-sort-*.run")
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create sort run file")
+	}
+	m.runs = append(m.runs, f.Name())
+
+	w := bufio.NewWriter(f)
+	return &runWriter{f: f, w: w, encoder: gob.NewEncoder(w)}, nil
+}
+
+// Flush merges the spilled runs and the rows still held in memory.
+func (m *ExternalSortByMiddleware) Flush(ctx context.Context, emit func(row types.Row) error) error {
+	defer m.removeRuns()
+
+	m.sortBuffer()
+	if len(m.runs) == 0 {
+		for _, row := range m.buffer {
+			if err := emit(row); err != nil {
+				return err
+			}
+		}
+		m.buffer = nil
+		return nil
+	}
+
+	for len(m.runs) > m.mergeFanIn {
+		if err := m.mergePass(ctx); err != nil {
+			return err
+		}
+	}
+
+	memory := &memoryCursor{rows: m.buffer}
+	m.buffer = nil
+	return m.mergeRuns(ctx, m.runs, memory, emit)
+}
+
+// mergePass merges each group of mergeFanIn consecutive runs into a single
+// run. Runs stay in input order, which keeps the merge stable.
+func (m *ExternalSortByMiddleware) mergePass(ctx context.Context) error {
+	runs := m.runs
+	m.runs = nil
+	defer func() {
+		// the runs that were not merged yet are removed along with the others
+		m.runs = append(m.runs, runs...)
+	}()
+
+	for len(runs) > 0 {
+		n := m.mergeFanIn
+		if n > len(runs) {
+			n = len(runs)
+		}
+		group := runs[:n]
+
+		w, err := m.createRun()
+		if err != nil {
+			return err
+		}
+		err = m.mergeRuns(ctx, group, nil, w.write)
+		if closeErr := w.close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, run := range group {
+			_ = os.Remove(run)
+		}
+		runs = runs[n:]
+	}
+
+	return nil
+}
+
+// mergeRuns merges the given run files, followed by the optional in-memory
+// run, and emits the rows in order.
+func (m *ExternalSortByMiddleware) mergeRuns(
+	ctx context.Context,
+	runs []string,
+	memory *memoryCursor,
+	emit func(row types.Row) error,
+) error {
+	cursors := make([]runCursor, 0, len(runs)+1)
+	defer func() {
+		for _, c := range cursors {
+			_ = c.close()
+		}
+	}()
+	for _, run := range runs {
+		c, err := openFileCursor(run)
+		if err != nil {
+			return err
+		}
+		cursors = append(cursors, c)
+	}
+	if memory != nil {
+		cursors = append(cursors, memory)
+	}
+
+	h := &mergeHeap{columns: m.columns}
+	for i, c := range cursors {
+		row, err := c.next()
+		if err != nil {
+			return err
+		}
+		if row != nil {
+			h.items = append(h.items, mergeItem{row: row, run: i})
+		}
+	}
+	heap.Init(h)
+
+	for h.Len() > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		item := h.items[0]
+		if err := emit(item.row); err != nil {
+			return err
+		}
+		row, err := cursors[item.run].next()
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			heap.Pop(h)
+		} else {
+			h.items[0].row = row
+			heap.Fix(h, 0)
+		}
+	}
+
+	return nil
+}
+
+func (m *ExternalSortByMiddleware) removeRuns() {
+	for _, run := range m.runs {
+		_ = os.Remove(run)
+	}
+	m.runs = nil
+}
+
+func (m *ExternalSortByMiddleware) Close(ctx context.Context) error {
+	m.removeRuns()
+	m.buffer = nil
+	return nil
+}
+
+// spilledRow is the on-disk representation of a row.
+type spilledRow struct {
+	Keys   []string
+	Values []interface{}
+}
+
+// spilledTime keeps *time.Time values apart from time.Time values, which gob
+// would otherwise decode as time.Time.
+type spilledTime struct {
+	Time time.Time
+}
+
+func newSpilledRow(row types.Row) *spilledRow {
+	ret := &spilledRow{
+		Keys:   make([]string, 0, row.Len()),
+		Values: make([]interface{}, 0, row.Len()),
+	}
+	for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+		ret.Keys = append(ret.Keys, pair.Key)
+		ret.Values = append(ret.Values, spillValue(pair.Value))
+	}
+	return ret
+}
+
+func (s *spilledRow) toRow() types.Row {
+	row := types.NewRow()
+	for i, key := range s.Keys {
+		row.Set(key, unspillValue(s.Values[i]))
+	}
+	return row
+}
+
+// spillValue converts the values gob can't encode as is, nested rows and
+// *time.Time, including those inside lists and maps.
+func spillValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case types.Row:
+		if v == nil {
+			return nil
+		}
+		return newSpilledRow(v)
+	case []types.Row:
+		ret := make([]*spilledRow, len(v))
+		for i, row := range v {
+			ret[i] = newSpilledRow(row)
+		}
+		return ret
+	case *time.Time:
+		if v == nil {
+			return nil
+		}
+		return &spilledTime{Time: *v}
+	case []interface{}:
+		ret := make([]interface{}, len(v))
+		for i, e := range v {
+			ret[i] = spillValue(e)
+		}
+		return ret
+	case map[string]interface{}:
+		ret := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			ret[k] = spillValue(e)
+		}
+		return ret
+	default:
+		return value
+	}
+}
+
+// unspillValue reverses spillValue.
+func unspillValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *spilledRow:
+		return v.toRow()
+	case []*spilledRow:
+		ret := make([]types.Row, len(v))
+		for i, row := range v {
+			ret[i] = row.toRow()
+		}
+		return ret
+	case *spilledTime:
+		t := v.Time
+		return &t
+	case []interface{}:
+		for i, e := range v {
+			v[i] = unspillValue(e)
+		}
+		return v
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = unspillValue(e)
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+type runCursor interface {
+	// next returns nil once the run is exhausted.
+	next() (types.Row, error)
+	close() error
+}
+
+type runWriter struct {
+	f       *os.File
+	w       *bufio.Writer
+	encoder *gob.Encoder
+}
+
+func (w *runWriter) write(row types.Row) error {
+	if err := w.encoder.Encode(newSpilledRow(row)); err != nil {
+		return errors.Wrapf(err, "could not write row to sort run %s", w.f.Name())
+	}
+	return nil
+}
+
+func (w *runWriter) close() error {
+	if err := w.w.Flush(); err != nil {
+		_ = w.f.Close()
+		return errors.Wrapf(err, "could not write sort run %s", w.f.Name())
+	}
+	if err := w.f.Close(); err != nil {
+		return errors.Wrapf(err, "could not close sort run %s", w.f.Name())
+	}
+	return nil
+}
+
+type fileCursor struct {
+	name    string
+	f       *os.File
+	decoder *gob.Decoder
+}
+
+func openFileCursor(name string) (*fileCursor, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not open sort run %s", name)
+	}
+	return &fileCursor{
+		name:    name,
+		f:       f,
+		decoder: gob.NewDecoder(bufio.NewReader(f)),
+	}, nil
+}
+
+func (c *fileCursor) next() (types.Row, error) {
+	row := &spilledRow{}
+	if err := c.decoder.Decode(row); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "could not read sort run %s", c.name)
+	}
+	return row.toRow(), nil
+}
+
+func (c *fileCursor) close() error {
+	return c.f.Close()
+}
+
+type memoryCursor struct {
+	rows []types.Row
+}
+
+func (c *memoryCursor) next() (types.Row, error) {
+	if len(c.rows) == 0 {
+		return nil, nil
+	}
+	row := c.rows[0]
+	c.rows = c.rows[1:]
+	return row, nil
+}
+
+func (c *memoryCursor) close() error {
+	return nil
+}
+
+type mergeItem struct {
+	row types.Row
+	run int
+}
+
+// mergeHeap orders the current rows of each run. Ties are broken by run index,
+// runs being created in input order, which keeps the merge stable.
+type mergeHeap struct {
+	columns []columnOrder
+	items   []mergeItem
+}
+
+func (h *mergeHeap) Len() int { return len(h.items) }
+
+func (h *mergeHeap) Less(i, j int) bool {
+	a, b := h.items[i], h.items[j]
+	if lessRows(h.columns, a.row, b.row) {
+		return true
+	}
+	if lessRows(h.columns, b.row, a.row) {
+		return false
+	}
+	return a.run < b.run
+}
+
+func (h *mergeHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *mergeHeap) Push(x interface{}) { h.items = append(h.items, x.(mergeItem)) }
+
+func (h *mergeHeap) Pop() interface{} {
+	n := len(h.items)
+	item := h.items[n-1]
+	h.items = h.items[:n-1]
+	return item
+}
+
+// estimateRowSize roughly estimates the memory used by a row, in bytes.
+func estimateRowSize(row types.Row) int {
+	size := 64
+	for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+		size += 48 + len(pair.Key) + estimateValueSize(pair.Value)
+	}
+	return size
+}
+
+func estimateValueSize(value interface{}) int {
+	switch v := value.(type) {
+	case string:
+		return 16 + len(v)
+	case []interface{}:
+		size := 24
+		for _, e := range v {
+			size += estimateValueSize(e)
+		}
+		return size
+	case map[string]interface{}:
+		size := 48
+		for k, e := range v {
+			size += 16 + len(k) + estimateValueSize(e)
+		}
+		return size
+	case types.Row:
+		return estimateRowSize(v)
+	default:
+		return 16
+	}
+}
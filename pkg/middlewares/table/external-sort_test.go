@@ -0,0 +1,182 @@
+package table
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runExternalSort(t *testing.T, mw *ExternalSortByMiddleware, rows ...types.Row) []types.Row {
+	t.Helper()
+	processor := middlewares.NewTableProcessor(
+		middlewares.WithRowMiddleware(mw),
+		middlewares.WithTableMiddleware(&NullTableMiddleware{}),
+	)
+	ctx := context.Background()
+	for _, row := range rows {
+		require.NoError(t, processor.AddRow(ctx, row))
+	}
+	require.NoError(t, processor.Close(ctx))
+	return processor.GetTable().Rows
+}
+
+func TestExternalSortSpillsAndMerges(t *testing.T) {
+	dir := t.TempDir()
+	// a budget this small spills every couple of rows
+	mw := NewExternalSortByMiddlewareFromColumns([]string{"group", "-n"}, WithMemoryBudget(300), WithTempDir(dir))
+
+	rows := []types.Row{}
+	for i := 0; i < 50; i++ {
+		rows = append(rows, types.NewRow(
+			types.MRP("group", fmt.Sprintf("g%d", i%3)),
+			types.MRP("n", (i*7)%50),
+			types.MRP("tags", []interface{}{"a", i}),
+		))
+	}
+
+	sorted := runExternalSort(t, mw, rows...)
+	require.Len(t, sorted, 50)
+	for i := 1; i < len(sorted); i++ {
+		prev, cur := sorted[i-1], sorted[i]
+		prevGroup, _ := prev.Get("group")
+		curGroup, _ := cur.Get("group")
+		require.LessOrEqual(t, prevGroup.(string), curGroup.(string))
+		if prevGroup == curGroup {
+			prevN, _ := prev.Get("n")
+			curN, _ := cur.Get("n")
+			require.Greater(t, prevN.(int), curN.(int))
+		}
+	}
+
+	// values keep their types through the spill
+	tags, ok := sorted[0].Get("tags")
+	require.True(t, ok)
+	assert.IsType(t, []interface{}{}, tags)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestExternalSortIsStable(t *testing.T) {
+	mw := NewExternalSortByMiddlewareFromColumns([]string{"k"}, WithMemoryBudget(200), WithTempDir(t.TempDir()))
+
+	rows := []types.Row{}
+	for i := 0; i < 20; i++ {
+		rows = append(rows, types.NewRow(types.MRP("k", i%2), types.MRP("i", i)))
+	}
+
+	sorted := runExternalSort(t, mw, rows...)
+	require.Len(t, sorted, 20)
+	previous := map[int]int{0: -1, 1: -1}
+	for _, row := range sorted {
+		k, _ := row.Get("k")
+		i, _ := row.Get("i")
+		require.Greater(t, i.(int), previous[k.(int)])
+		previous[k.(int)] = i.(int)
+	}
+}
+
+func TestExternalSortMergesInPassesBeyondFanIn(t *testing.T) {
+	dir := t.TempDir()
+	// every row is spilled to its own run
+	mw := NewExternalSortByMiddlewareFromColumns([]string{"k"},
+		WithMemoryBudget(1), WithMergeFanIn(3), WithTempDir(dir))
+
+	ctx := context.Background()
+	for i := 0; i < 40; i++ {
+		_, err := mw.Process(ctx, types.NewRow(types.MRP("k", (i*7)%5), types.MRP("i", i)))
+		require.NoError(t, err)
+	}
+	require.Len(t, mw.runs, 40)
+
+	sorted := []types.Row{}
+	err := mw.Flush(ctx, func(row types.Row) error {
+		// the final merge only opens mergeFanIn runs
+		require.LessOrEqual(t, len(mw.runs), 3)
+		sorted = append(sorted, row)
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, mw.Close(ctx))
+
+	require.Len(t, sorted, 40)
+	previousK, previousI := -1, -1
+	for _, row := range sorted {
+		k, _ := row.Get("k")
+		i, _ := row.Get("i")
+		require.GreaterOrEqual(t, k.(int), previousK)
+		if k.(int) == previousK {
+			require.Greater(t, i.(int), previousI)
+		}
+		previousK, previousI = k.(int), i.(int)
+	}
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestExternalSortInMemory(t *testing.T) {
+	dir := t.TempDir()
+	mw := NewExternalSortByMiddlewareFromColumns([]string{"-a"}, WithTempDir(dir))
+
+	sorted := runExternalSort(t, mw,
+		types.NewRow(types.MRP("a", 1)),
+		types.NewRow(types.MRP("a", 3)),
+		types.NewRow(types.MRP("a", 2)),
+	)
+	require.Len(t, sorted, 3)
+	for i, expected := range []int{3, 2, 1} {
+		v, _ := sorted[i].Get("a")
+		assert.Equal(t, expected, v)
+	}
+	assert.Empty(t, mw.runs)
+}
+
+func TestExternalSortSpillsNestedValues(t *testing.T) {
+	mw := NewExternalSortByMiddlewareFromColumns([]string{"a"}, WithMemoryBudget(1), WithTempDir(t.TempDir()))
+
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	sorted := runExternalSort(t, mw,
+		types.NewRow(
+			types.MRP("a", 2),
+			types.MRP("user", types.NewRow(types.MRP("name", "ada"), types.MRP("langs", []interface{}{"go"}))),
+			types.MRP("seen", &ts),
+		),
+		types.NewRow(
+			types.MRP("a", 1),
+			types.MRP("items", []interface{}{types.NewRow(types.MRP("id", 1))}),
+			types.MRP("meta", map[string]interface{}{"owner": types.NewRow(types.MRP("id", 2))}),
+		),
+	)
+	require.Len(t, sorted, 2)
+	assert.Empty(t, mw.runs)
+
+	items, _ := sorted[0].Get("items")
+	require.IsType(t, []interface{}{}, items)
+	item := items.([]interface{})[0]
+	require.IsType(t, types.NewRow(), item)
+	id, _ := item.(types.Row).Get("id")
+	assert.Equal(t, 1, id)
+
+	meta, _ := sorted[0].Get("meta")
+	require.IsType(t, map[string]interface{}{}, meta)
+	require.IsType(t, types.NewRow(), meta.(map[string]interface{})["owner"])
+
+	user, _ := sorted[1].Get("user")
+	require.IsType(t, types.NewRow(), user)
+	name, _ := user.(types.Row).Get("name")
+	assert.Equal(t, "ada", name)
+
+	seen, _ := sorted[1].Get("seen")
+	require.IsType(t, &ts, seen)
+	assert.True(t, ts.Equal(*seen.(*time.Time)))
+}
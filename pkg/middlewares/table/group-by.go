@@ -0,0 +1,146 @@
+package table
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// GroupByMiddleware groups the rows of a table by the values of one or more
+// columns and replaces them with one row per group, holding the group columns
+// followed by one column per aggregation.
+//
+// Groups are output in the order in which they are first seen. Rows missing a
+// group column are grouped under a null value. Without group columns, the whole
+// table is aggregated into a single row.
+type GroupByMiddleware struct {
+	groupBy      []types.FieldName
+	aggregations []Aggregation
+}
+
+var _ middlewares.TableMiddleware = (*GroupByMiddleware)(nil)
+
+// NewGroupByMiddleware creates a GroupByMiddleware. If no aggregations are
+// given, the rows of each group are counted.
+func NewGroupByMiddleware(groupBy []types.FieldName, aggregations ...Aggregation) *GroupByMiddleware {
+	if len(aggregations) == 0 {
+		aggregations = []Aggregation{{Function: AggregateCount, As: "count"}}
+	}
+	return &GroupByMiddleware{
+		groupBy:      groupBy,
+		aggregations: aggregations,
+	}
+}
+
+// NewGroupByMiddlewareFromSpecs creates a GroupByMiddleware from aggregation
+// specs such as "count" or "sum:cost", see ParseAggregation.
+//
+// Example:
+//
+//	NewGroupByMiddlewareFromSpecs([]string{"team"}, "count", "sum:cost")
+func NewGroupByMiddlewareFromSpecs(groupBy []string, specs ...string) (*GroupByMiddleware, error) {
+	aggregations, err := ParseAggregations(specs...)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[types.FieldName]struct{}{}
+	for _, column := range groupBy {
+		seen[column] = struct{}{}
+	}
+	for _, agg := range aggregations {
+		if _, ok := seen[agg.As]; ok {
+			return nil, errors.Errorf("duplicate output column %s, use function:column=name to rename it", agg.As)
+		}
+		seen[agg.As] = struct{}{}
+	}
+
+	return NewGroupByMiddleware(groupBy, aggregations...), nil
+}
+
+type group struct {
+	values      []interface{}
+	aggregators []aggregator
+}
+
+func (g *GroupByMiddleware) Process(ctx context.Context, table *types.Table) (*types.Table, error) {
+	groups := map[string]*group{}
+	order := []*group{}
+
+	for _, row := range table.Rows {
+		values := make([]interface{}, len(g.groupBy))
+		keys := make([]string, len(g.groupBy))
+		for i, column := range g.groupBy {
+			v, ok := row.Get(column)
+			if !ok {
+				v = nil
+			}
+			values[i] = v
+			keys[i] = valueKey(v)
+		}
+		key := strings.Join(keys, "\x00")
+
+		grp, ok := groups[key]
+		if !ok {
+			grp = &group{
+				values:      values,
+				aggregators: make([]aggregator, len(g.aggregations)),
+			}
+			for i, agg := range g.aggregations {
+				grp.aggregators[i] = newAggregator(agg)
+			}
+			groups[key] = grp
+			order = append(order, grp)
+		}
+
+		for i, agg := range g.aggregations {
+			var v interface{}
+			present := false
+			if agg.Column != "" {
+				v, present = row.Get(agg.Column)
+			}
+			if err := grp.aggregators[i].add(v, present); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// aggregating an empty table without group columns still yields a row,
+	// like SELECT count(*) would.
+	if len(g.groupBy) == 0 && len(order) == 0 {
+		grp := &group{aggregators: make([]aggregator, len(g.aggregations))}
+		for i, agg := range g.aggregations {
+			grp.aggregators[i] = newAggregator(agg)
+		}
+		order = append(order, grp)
+	}
+
+	ret := &types.Table{
+		Columns: make([]types.FieldName, 0, len(g.groupBy)+len(g.aggregations)),
+		Rows:    make([]types.Row, 0, len(order)),
+	}
+	ret.Columns = append(ret.Columns, g.groupBy...)
+	for _, agg := range g.aggregations {
+		ret.Columns = append(ret.Columns, agg.As)
+	}
+
+	for _, grp := range order {
+		row := types.NewRow()
+		for i, column := range g.groupBy {
+			row.Set(column, grp.values[i])
+		}
+		for i, agg := range g.aggregations {
+			row.Set(agg.As, grp.aggregators[i].result())
+		}
+		ret.Rows = append(ret.Rows, row)
+	}
+
+	return ret, nil
+}
+
+func (g *GroupByMiddleware) Close(ctx context.Context) error {
+	return nil
+}
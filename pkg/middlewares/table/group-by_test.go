@@ -0,0 +1,133 @@
+package table
+
+import (
+	"context"
+	"testing"
+
+	assert2 "github.com/go-go-golems/glazed/pkg/helpers/assert"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createGroupByTable() *types.Table {
+	ret := types.NewTable()
+	ret.AddRows(
+		types.NewRow(types.MRP("team", "infra"), types.MRP("cost", 10), types.MRP("owner", "ada")),
+		types.NewRow(types.MRP("team", "web"), types.MRP("cost", 5), types.MRP("owner", "bob")),
+		types.NewRow(types.MRP("team", "infra"), types.MRP("cost", 30), types.MRP("owner", "ada")),
+		types.NewRow(types.MRP("team", "infra"), types.MRP("cost", nil), types.MRP("owner", "cy")),
+		types.NewRow(types.MRP("team", "web"), types.MRP("cost", 7), types.MRP("owner", "bob")),
+	)
+	return ret
+}
+
+func TestGroupByCountAndSum(t *testing.T) {
+	mw, err := NewGroupByMiddlewareFromSpecs([]string{"team"}, "count", "sum:cost")
+	require.NoError(t, err)
+
+	newTable, err := mw.Process(context.Background(), createGroupByTable())
+	require.NoError(t, err)
+
+	assert.Equal(t, []types.FieldName{"team", "count", "sum_cost"}, newTable.Columns)
+	require.Len(t, newTable.Rows, 2)
+	assert2.EqualRowValue(t, "infra", newTable.Rows[0], "team")
+	assert2.EqualRowValue(t, 3, newTable.Rows[0], "count")
+	assert2.EqualRowValue(t, int64(40), newTable.Rows[0], "sum_cost")
+	assert2.EqualRowValue(t, "web", newTable.Rows[1], "team")
+	assert2.EqualRowValue(t, 2, newTable.Rows[1], "count")
+	assert2.EqualRowValue(t, int64(12), newTable.Rows[1], "sum_cost")
+}
+
+func TestGroupByAggregates(t *testing.T) {
+	mw, err := NewGroupByMiddlewareFromSpecs(
+		[]string{"team"},
+		"count:cost", "avg:cost", "min:cost", "max:cost",
+		"distinct:owner", "first:owner", "last:owner", "median:cost=median",
+	)
+	require.NoError(t, err)
+
+	newTable, err := mw.Process(context.Background(), createGroupByTable())
+	require.NoError(t, err)
+	require.Len(t, newTable.Rows, 2)
+
+	infra := newTable.Rows[0]
+	assert2.EqualRowValue(t, 2, infra, "count_cost")
+	assert2.EqualRowValue(t, 20.0, infra, "avg_cost")
+	assert2.EqualRowValue(t, 10, infra, "min_cost")
+	assert2.EqualRowValue(t, 30, infra, "max_cost")
+	assert2.EqualRowValue(t, 2, infra, "distinct_owner")
+	assert2.EqualRowValue(t, "ada", infra, "first_owner")
+	assert2.EqualRowValue(t, "cy", infra, "last_owner")
+	assert2.EqualRowValue(t, 20.0, infra, "median")
+}
+
+func TestGroupByNumericStrings(t *testing.T) {
+	table := types.NewTable()
+	table.AddRows(
+		types.NewRow(types.MRP("cost", "9")),
+		types.NewRow(types.MRP("cost", "10")),
+		types.NewRow(types.MRP("cost", "2.5")),
+	)
+
+	mw, err := NewGroupByMiddlewareFromSpecs(nil, "sum:cost", "max:cost")
+	require.NoError(t, err)
+
+	newTable, err := mw.Process(context.Background(), table)
+	require.NoError(t, err)
+	require.Len(t, newTable.Rows, 1)
+	assert2.EqualRowValue(t, 21.5, newTable.Rows[0], "sum_cost")
+	assert2.EqualRowValue(t, "10", newTable.Rows[0], "max_cost")
+}
+
+func TestGroupByEmptyTableWithoutGroups(t *testing.T) {
+	mw := NewGroupByMiddleware(nil)
+
+	newTable, err := mw.Process(context.Background(), types.NewTable())
+	require.NoError(t, err)
+	require.Len(t, newTable.Rows, 1)
+	assert2.EqualRowValue(t, 0, newTable.Rows[0], "count")
+}
+
+func TestGroupByNonNumericSum(t *testing.T) {
+	mw, err := NewGroupByMiddlewareFromSpecs([]string{"team"}, "sum:owner")
+	require.NoError(t, err)
+
+	_, err = mw.Process(context.Background(), createGroupByTable())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot sum non-numeric value ada in column owner")
+}
+
+func TestPercentile(t *testing.T) {
+	values := []float64{4, 1, 3, 2}
+	assert.Equal(t, 1.0, percentile(values, 0))
+	assert.Equal(t, 2.5, percentile(values, 50))
+	assert.InDelta(t, 3.7, percentile(values, 90), 1e-9)
+	assert.Equal(t, 4.0, percentile(values, 100))
+}
+
+func TestParseAggregation(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected Aggregation
+	}{
+		{"count", Aggregation{Function: AggregateCount, As: "count"}},
+		{"sum:cost", Aggregation{Function: AggregateSum, Column: "cost", As: "sum_cost"}},
+		{"AVG:cost=mean_cost", Aggregation{Function: AggregateAvg, Column: "cost", As: "mean_cost"}},
+		{"count-distinct:user", Aggregation{Function: AggregateCountDistinct, Column: "user", As: "count-distinct_user"}},
+		{"p99.9:latency", Aggregation{Function: AggregatePercentile, Column: "latency", Percentile: 99.9, As: "p99.9_latency"}},
+	}
+	for _, tt := range tests {
+		agg, err := ParseAggregation(tt.spec)
+		require.NoError(t, err, tt.spec)
+		assert.Equal(t, tt.expected, agg, tt.spec)
+	}
+
+	for _, spec := range []string{"", "sum", "foo:bar", "p101:x", "sum:", "sum:x="} {
+		_, err := ParseAggregation(spec)
+		assert.Error(t, err, spec)
+	}
+
+	_, err := NewGroupByMiddlewareFromSpecs([]string{"team"}, "count", "count")
+	assert.Error(t, err)
+}
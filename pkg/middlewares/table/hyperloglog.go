@@ -0,0 +1,68 @@
+package table
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// hyperLogLogPrecision is the number of bits of the hash used to pick a
+// register. 2^14 registers give a standard error of about 0.8%.
+const hyperLogLogPrecision = 14
+
+// hyperLogLog estimates the number of distinct strings added to it, in a fixed
+// amount of memory.
+type hyperLogLog struct {
+	registers []uint8
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{
+		registers: make([]uint8, 1<<hyperLogLogPrecision),
+	}
+}
+
+func (h *hyperLogLog) add(s string) {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(s))
+	x := mix64(hash.Sum64())
+
+	index := x >> (64 - hyperLogLogPrecision)
+	// the remaining bits, with a sentinel bit so that the rank is bounded
+	rest := x<<hyperLogLogPrecision | 1<<(hyperLogLogPrecision-1)
+	rank := uint8(bits.LeadingZeros64(rest)) + 1
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+func (h *hyperLogLog) count() uint64 {
+	m := float64(len(h.registers))
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+	// small cardinalities are estimated more precisely by linear counting
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// mix64 is the finalizer of MurmurHash3, spreading the bits of the FNV hash
+// over the whole word.
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,67 @@
+package table
+
+import (
+	"context"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+)
+
+// OutputFieldsMiddleware is the table-level counterpart of
+// row.OutputFieldsMiddleware. It is used when the projected fields only exist
+// after a table middleware (such as GroupByMiddleware) has reshaped the rows.
+type OutputFieldsMiddleware struct {
+	fields []types.FieldName
+}
+
+var _ middlewares.TableMiddleware = (*OutputFieldsMiddleware)(nil)
+
+func NewOutputFieldsMiddleware(fields ...string) *OutputFieldsMiddleware {
+	ret := &OutputFieldsMiddleware{
+		fields: make([]types.FieldName, 0, len(fields)),
+	}
+	ret.fields = append(ret.fields, fields...)
+	return ret
+}
+
+func (m *OutputFieldsMiddleware) Process(_ context.Context, table *types.Table) (*types.Table, error) {
+	if len(m.fields) == 0 {
+		return table, nil
+	}
+
+	existing := map[types.FieldName]struct{}{}
+	for _, column := range table.Columns {
+		existing[column] = struct{}{}
+	}
+	for _, row := range table.Rows {
+		for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+			existing[pair.Key] = struct{}{}
+		}
+	}
+
+	ret := &types.Table{
+		Columns: make([]types.FieldName, 0, len(m.fields)),
+		Rows:    make([]types.Row, 0, len(table.Rows)),
+	}
+	for _, field := range m.fields {
+		if _, ok := existing[field]; ok {
+			ret.Columns = append(ret.Columns, field)
+		}
+	}
+
+	for _, input := range table.Rows {
+		output := types.NewRow()
+		for _, field := range m.fields {
+			if value, ok := input.Get(field); ok {
+				output.Set(field, value)
+			}
+		}
+		ret.Rows = append(ret.Rows, output)
+	}
+
+	return ret, nil
+}
+
+func (m *OutputFieldsMiddleware) Close(context.Context) error {
+	return nil
+}
@@ -0,0 +1,283 @@
+package table
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// PivotMiddleware reshapes a table from long to wide: every distinct value of
+// the key column becomes a column, holding the aggregated values of the value
+// column for the rows sharing the same index columns.
+//
+// For example, pivoting
+//
+//	team  | month | cost
+//	infra | jan   | 10
+//	infra | feb   | 20
+//	web   | jan   | 5
+//
+// on month with value cost yields
+//
+//	team  | jan | feb
+//	infra | 10  | 20
+//	web   | 5   | <nil>
+//
+// Index rows and pivoted columns are output in the order in which they are
+// first seen. Cells without a value are set to the fill value (nil by default).
+// A key value naming one of the index columns is an error, as its column would
+// overwrite the index column.
+type PivotMiddleware struct {
+	keyColumn   types.FieldName
+	valueColumn types.FieldName
+	index       []types.FieldName
+	aggregation Aggregation
+	fillValue   interface{}
+}
+
+var _ middlewares.TableMiddleware = (*PivotMiddleware)(nil)
+
+type PivotOption func(*PivotMiddleware)
+
+// WithPivotIndex sets the columns identifying an output row. By default, all
+// columns except the key and value columns are used.
+func WithPivotIndex(columns ...types.FieldName) PivotOption {
+	return func(p *PivotMiddleware) {
+		p.index = columns
+	}
+}
+
+// WithPivotAggregation sets the aggregate function used to combine the values
+// of rows with the same index and key, such as "sum" or "p90" (see
+// ParseAggregation). It defaults to "first".
+func WithPivotAggregation(aggregation Aggregation) PivotOption {
+	return func(p *PivotMiddleware) {
+		p.aggregation = aggregation
+	}
+}
+
+// WithPivotFillValue sets the value of cells without any value.
+func WithPivotFillValue(value interface{}) PivotOption {
+	return func(p *PivotMiddleware) {
+		p.fillValue = value
+	}
+}
+
+func NewPivotMiddleware(keyColumn types.FieldName, valueColumn types.FieldName, options ...PivotOption) *PivotMiddleware {
+	ret := &PivotMiddleware{
+		keyColumn:   keyColumn,
+		valueColumn: valueColumn,
+		aggregation: Aggregation{Function: AggregateFirst, Column: valueColumn},
+	}
+	for _, option := range options {
+		option(ret)
+	}
+	ret.aggregation.Column = valueColumn
+	return ret
+}
+
+// ParsePivotAggregation parses the name of an aggregate function for
+// WithPivotAggregation, such as "sum" or "p90".
+func ParsePivotAggregation(function string, valueColumn types.FieldName) (Aggregation, error) {
+	return ParseAggregation(function + ":" + valueColumn)
+}
+
+type pivotRow struct {
+	values []interface{}
+	cells  map[string]aggregator
+}
+
+func (p *PivotMiddleware) Process(ctx context.Context, table *types.Table) (*types.Table, error) {
+	index := p.index
+	if len(index) == 0 {
+		index = p.defaultIndex(table)
+	}
+
+	rows := map[string]*pivotRow{}
+	rowOrder := []*pivotRow{}
+	pivotColumns := []types.FieldName{}
+	seenColumns := map[types.FieldName]struct{}{}
+
+	for _, row := range table.Rows {
+		key, ok := row.Get(p.keyColumn)
+		if !ok || key == nil {
+			continue
+		}
+		column := fmt.Sprintf("%v", key)
+		if _, ok := seenColumns[column]; !ok {
+			if containsField(index, column) {
+				return nil, errors.Errorf("pivot key %q of column %s conflicts with an index column", column, p.keyColumn)
+			}
+			seenColumns[column] = struct{}{}
+			pivotColumns = append(pivotColumns, column)
+		}
+
+		values := make([]interface{}, len(index))
+		keys := make([]string, len(index))
+		for i, c := range index {
+			v, _ := row.Get(c)
+			values[i] = v
+			keys[i] = valueKey(v)
+		}
+		rowKey := strings.Join(keys, "\x00")
+
+		pr, ok := rows[rowKey]
+		if !ok {
+			pr = &pivotRow{values: values, cells: map[string]aggregator{}}
+			rows[rowKey] = pr
+			rowOrder = append(rowOrder, pr)
+		}
+
+		cell, ok := pr.cells[column]
+		if !ok {
+			cell = newAggregator(p.aggregation)
+			pr.cells[column] = cell
+		}
+		v, present := row.Get(p.valueColumn)
+		if err := cell.add(v, present); err != nil {
+			return nil, err
+		}
+	}
+
+	ret := &types.Table{
+		Columns: make([]types.FieldName, 0, len(index)+len(pivotColumns)),
+		Rows:    make([]types.Row, 0, len(rowOrder)),
+	}
+	ret.Columns = append(ret.Columns, index...)
+	ret.Columns = append(ret.Columns, pivotColumns...)
+
+	for _, pr := range rowOrder {
+		row := types.NewRow()
+		for i, c := range index {
+			row.Set(c, pr.values[i])
+		}
+		for _, column := range pivotColumns {
+			if cell, ok := pr.cells[column]; ok {
+				row.Set(column, cell.result())
+			} else {
+				row.Set(column, p.fillValue)
+			}
+		}
+		ret.Rows = append(ret.Rows, row)
+	}
+
+	return ret, nil
+}
+
+func (p *PivotMiddleware) defaultIndex(table *types.Table) []types.FieldName {
+	ret := []types.FieldName{}
+	for _, column := range tableColumns(table) {
+		if column != p.keyColumn && column != p.valueColumn {
+			ret = append(ret, column)
+		}
+	}
+	return ret
+}
+
+func (p *PivotMiddleware) Close(ctx context.Context) error {
+	return nil
+}
+
+// UnpivotMiddleware reshapes a table from wide to long, the inverse of
+// PivotMiddleware: every row is replaced by one row per melted column, holding
+// the other columns, the name of the melted column in the key column and its
+// value in the value column. Melted columns missing from a row are skipped.
+type UnpivotMiddleware struct {
+	columns     []types.FieldName
+	keyColumn   types.FieldName
+	valueColumn types.FieldName
+}
+
+var _ middlewares.TableMiddleware = (*UnpivotMiddleware)(nil)
+
+type UnpivotOption func(*UnpivotMiddleware)
+
+// WithUnpivotColumnNames sets the names of the key and value columns, which
+// default to "key" and "value".
+func WithUnpivotColumnNames(keyColumn types.FieldName, valueColumn types.FieldName) UnpivotOption {
+	return func(u *UnpivotMiddleware) {
+		u.keyColumn = keyColumn
+		u.valueColumn = valueColumn
+	}
+}
+
+func NewUnpivotMiddleware(columns []types.FieldName, options ...UnpivotOption) *UnpivotMiddleware {
+	ret := &UnpivotMiddleware{
+		columns:     columns,
+		keyColumn:   "key",
+		valueColumn: "value",
+	}
+	for _, option := range options {
+		option(ret)
+	}
+	return ret
+}
+
+func (u *UnpivotMiddleware) Process(ctx context.Context, table *types.Table) (*types.Table, error) {
+	ret := &types.Table{
+		Columns: []types.FieldName{},
+		Rows:    make([]types.Row, 0, len(table.Rows)*len(u.columns)),
+	}
+	for _, column := range tableColumns(table) {
+		if !containsField(u.columns, column) {
+			ret.Columns = append(ret.Columns, column)
+		}
+	}
+	ret.Columns = append(ret.Columns, u.keyColumn, u.valueColumn)
+
+	for _, row := range table.Rows {
+		for _, column := range u.columns {
+			value, ok := row.Get(column)
+			if !ok {
+				continue
+			}
+			newRow := types.NewRow()
+			for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+				if !containsField(u.columns, pair.Key) {
+					newRow.Set(pair.Key, pair.Value)
+				}
+			}
+			newRow.Set(u.keyColumn, column)
+			newRow.Set(u.valueColumn, value)
+			ret.Rows = append(ret.Rows, newRow)
+		}
+	}
+
+	return ret, nil
+}
+
+func (u *UnpivotMiddleware) Close(ctx context.Context) error {
+	return nil
+}
+
+// tableColumns returns the columns of the table, followed by the columns only
+// found in its rows.
+func tableColumns(table *types.Table) []types.FieldName {
+	ret := append([]types.FieldName{}, table.Columns...)
+	seen := map[types.FieldName]struct{}{}
+	for _, column := range ret {
+		seen[column] = struct{}{}
+	}
+	for _, row := range table.Rows {
+		for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+			if _, ok := seen[pair.Key]; !ok {
+				seen[pair.Key] = struct{}{}
+				ret = append(ret, pair.Key)
+			}
+		}
+	}
+	return ret
+}
+
+func containsField(fields []types.FieldName, field types.FieldName) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
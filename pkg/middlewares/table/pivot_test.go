@@ -0,0 +1,97 @@
+package table
+
+import (
+	"context"
+	"testing"
+
+	assert2 "github.com/go-go-golems/glazed/pkg/helpers/assert"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createPivotTable() *types.Table {
+	ret := types.NewTable()
+	ret.AddRows(
+		types.NewRow(types.MRP("team", "infra"), types.MRP("month", "jan"), types.MRP("cost", 10)),
+		types.NewRow(types.MRP("team", "infra"), types.MRP("month", "feb"), types.MRP("cost", 20)),
+		types.NewRow(types.MRP("team", "web"), types.MRP("month", "jan"), types.MRP("cost", 5)),
+		types.NewRow(types.MRP("team", "infra"), types.MRP("month", "jan"), types.MRP("cost", 1)),
+	)
+	return ret
+}
+
+func TestPivotMiddleware(t *testing.T) {
+	agg, err := ParsePivotAggregation("sum", "cost")
+	require.NoError(t, err)
+	mw := NewPivotMiddleware("month", "cost", WithPivotAggregation(agg), WithPivotFillValue(0))
+
+	newTable, err := mw.Process(context.Background(), createPivotTable())
+	require.NoError(t, err)
+
+	assert.Equal(t, []types.FieldName{"team", "jan", "feb"}, newTable.Columns)
+	require.Len(t, newTable.Rows, 2)
+	assert2.EqualRowValue(t, "infra", newTable.Rows[0], "team")
+	assert2.EqualRowValue(t, int64(11), newTable.Rows[0], "jan")
+	assert2.EqualRowValue(t, int64(20), newTable.Rows[0], "feb")
+	assert2.EqualRowValue(t, "web", newTable.Rows[1], "team")
+	assert2.EqualRowValue(t, int64(5), newTable.Rows[1], "jan")
+	assert2.EqualRowValue(t, 0, newTable.Rows[1], "feb")
+}
+
+func TestPivotMiddlewareDefaultsToFirstValue(t *testing.T) {
+	mw := NewPivotMiddleware("month", "cost", WithPivotIndex("team"))
+
+	newTable, err := mw.Process(context.Background(), createPivotTable())
+	require.NoError(t, err)
+	require.Len(t, newTable.Rows, 2)
+	assert2.EqualRowValue(t, 10, newTable.Rows[0], "jan")
+	assert2.EqualRowValue(t, nil, newTable.Rows[1], "feb")
+}
+
+func TestPivotMiddlewareRejectsKeyNamingAnIndexColumn(t *testing.T) {
+	table := createPivotTable()
+	table.AddRows(types.NewRow(types.MRP("team", "web"), types.MRP("month", "team"), types.MRP("cost", 3)))
+	mw := NewPivotMiddleware("month", "cost")
+
+	_, err := mw.Process(context.Background(), table)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"team"`)
+}
+
+func TestUnpivotMiddleware(t *testing.T) {
+	table := types.NewTable()
+	table.AddRows(
+		types.NewRow(types.MRP("team", "infra"), types.MRP("jan", 10), types.MRP("feb", 20)),
+		types.NewRow(types.MRP("team", "web"), types.MRP("jan", 5)),
+	)
+
+	mw := NewUnpivotMiddleware([]types.FieldName{"jan", "feb"}, WithUnpivotColumnNames("month", "cost"))
+	newTable, err := mw.Process(context.Background(), table)
+	require.NoError(t, err)
+
+	assert.Equal(t, []types.FieldName{"team", "month", "cost"}, newTable.Columns)
+	require.Len(t, newTable.Rows, 3)
+	expected := [][]interface{}{{"infra", "jan", 10}, {"infra", "feb", 20}, {"web", "jan", 5}}
+	for i, e := range expected {
+		assert2.EqualRowValue(t, e[0], newTable.Rows[i], "team")
+		assert2.EqualRowValue(t, e[1], newTable.Rows[i], "month")
+		assert2.EqualRowValue(t, e[2], newTable.Rows[i], "cost")
+	}
+}
+
+func TestUnpivotThenPivotRoundTrips(t *testing.T) {
+	table := types.NewTable()
+	table.AddRows(
+		types.NewRow(types.MRP("team", "infra"), types.MRP("jan", 10), types.MRP("feb", 20)),
+		types.NewRow(types.MRP("team", "web"), types.MRP("jan", 5), types.MRP("feb", 7)),
+	)
+
+	long, err := NewUnpivotMiddleware([]types.FieldName{"jan", "feb"}).Process(context.Background(), table)
+	require.NoError(t, err)
+	wide, err := NewPivotMiddleware("key", "value").Process(context.Background(), long)
+	require.NoError(t, err)
+
+	assert.Equal(t, table.Columns, wide.Columns)
+	assert.Equal(t, table.Rows, wide.Rows)
+}
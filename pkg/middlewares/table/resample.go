@@ -0,0 +1,243 @@
+package table
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/middlewares/row"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+)
+
+type ResampleFill string
+
+const (
+	// ResampleFillNull sets the aggregates of missing buckets to null.
+	ResampleFillNull ResampleFill = "null"
+	// ResampleFillZero sets the aggregates of missing buckets to 0.
+	ResampleFillZero ResampleFill = "zero"
+	// ResampleFillPrevious repeats the aggregates of the previous bucket of
+	// the same series, or null if there is none.
+	ResampleFillPrevious ResampleFill = "previous"
+)
+
+func ParseResampleFill(s string) (ResampleFill, error) {
+	switch f := ResampleFill(strings.ToLower(strings.TrimSpace(s))); f {
+	case ResampleFillNull, ResampleFillZero, ResampleFillPrevious:
+		return f, nil
+	}
+	return "", errors.Errorf("invalid resample fill %q, expected null, zero or previous", s)
+}
+
+// maxResampleRows bounds the number of rows a ResampleMiddleware outputs, so
+// that a bucket much smaller than the time range of the input fails instead of
+// exhausting memory.
+const maxResampleRows = 10_000_000
+
+// ResampleMiddleware turns the rows of a table into regular time series: rows
+// are grouped by series columns and by the bucket of their time column, and
+// every bucket between the first and the last time of the table is output
+// for every series, holding the aggregations of its rows.
+//
+// For example, resampling
+//
+//	host | ts    | cpu
+//	a    | 10:05 | 10
+//	a    | 10:40 | 20
+//	b    | 12:10 | 5
+//
+// by hour, with host as series and avg:cpu as aggregation, yields
+//
+//	ts    | host | avg_cpu
+//	10:00 | a    | 15
+//	10:00 | b    | <nil>
+//	11:00 | a    | <nil>
+//	11:00 | b    | <nil>
+//	12:00 | a    | <nil>
+//	12:00 | b    | 5
+//
+// Buckets without rows are filled according to the fill policy. Rows are
+// output in time order, and series in the order in which they are first seen.
+// Rows without a time are dropped.
+type ResampleMiddleware struct {
+	timeColumn   types.FieldName
+	bucket       row.TimeBucket
+	location     *time.Location
+	series       []types.FieldName
+	aggregations []Aggregation
+	fill         ResampleFill
+}
+
+var _ middlewares.TableMiddleware = (*ResampleMiddleware)(nil)
+
+type ResampleOption func(*ResampleMiddleware)
+
+// WithResampleLocation sets the location in which buckets are computed, UTC by
+// default.
+func WithResampleLocation(location *time.Location) ResampleOption {
+	return func(r *ResampleMiddleware) {
+		r.location = location
+	}
+}
+
+// WithResampleSeries sets the columns identifying a series. By default, the
+// whole table is a single series.
+func WithResampleSeries(columns ...types.FieldName) ResampleOption {
+	return func(r *ResampleMiddleware) {
+		r.series = columns
+	}
+}
+
+// WithResampleAggregations sets the aggregations computed for each bucket. By
+// default, the rows of each bucket are counted.
+func WithResampleAggregations(aggregations ...Aggregation) ResampleOption {
+	return func(r *ResampleMiddleware) {
+		r.aggregations = aggregations
+	}
+}
+
+func WithResampleFill(fill ResampleFill) ResampleOption {
+	return func(r *ResampleMiddleware) {
+		r.fill = fill
+	}
+}
+
+func NewResampleMiddleware(timeColumn types.FieldName, bucket row.TimeBucket, options ...ResampleOption) *ResampleMiddleware {
+	ret := &ResampleMiddleware{
+		timeColumn: timeColumn,
+		bucket:     bucket,
+		location:   time.UTC,
+		fill:       ResampleFillNull,
+	}
+	for _, option := range options {
+		option(ret)
+	}
+	if len(ret.aggregations) == 0 {
+		ret.aggregations = []Aggregation{{Function: AggregateCount, As: "count"}}
+	}
+	return ret
+}
+
+type resampleSeries struct {
+	values  []interface{}
+	buckets map[int64]*group
+}
+
+func (r *ResampleMiddleware) Process(ctx context.Context, table *types.Table) (*types.Table, error) {
+	series := map[string]*resampleSeries{}
+	order := []*resampleSeries{}
+	var first, last time.Time
+	dropped := 0
+
+	for _, input := range table.Rows {
+		value, ok := input.Get(r.timeColumn)
+		if !ok || value == nil {
+			dropped++
+			continue
+		}
+		t, err := row.ParseTimeValue(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not resample column %s", r.timeColumn)
+		}
+		bucket := r.bucket.Truncate(t, r.location)
+		if first.IsZero() || bucket.Before(first) {
+			first = bucket
+		}
+		if last.IsZero() || bucket.After(last) {
+			last = bucket
+		}
+
+		values := make([]interface{}, len(r.series))
+		keys := make([]string, len(r.series))
+		for i, column := range r.series {
+			v, _ := input.Get(column)
+			values[i] = v
+			keys[i] = valueKey(v)
+		}
+		key := strings.Join(keys, "\x00")
+		s, ok := series[key]
+		if !ok {
+			s = &resampleSeries{values: values, buckets: map[int64]*group{}}
+			series[key] = s
+			order = append(order, s)
+		}
+
+		grp, ok := s.buckets[bucket.UnixNano()]
+		if !ok {
+			grp = &group{aggregators: make([]aggregator, len(r.aggregations))}
+			for i, agg := range r.aggregations {
+				grp.aggregators[i] = newAggregator(agg)
+			}
+			s.buckets[bucket.UnixNano()] = grp
+		}
+		for i, agg := range r.aggregations {
+			var v interface{}
+			present := false
+			if agg.Column != "" {
+				v, present = input.Get(agg.Column)
+			}
+			if err := grp.aggregators[i].add(v, present); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if dropped > 0 {
+		log.Warn().Str("column", r.timeColumn).Int("rows", dropped).Msg("dropped rows without a time")
+	}
+
+	ret := &types.Table{
+		Columns: append([]types.FieldName{r.timeColumn}, r.series...),
+		Rows:    []types.Row{},
+	}
+	for _, agg := range r.aggregations {
+		ret.Columns = append(ret.Columns, agg.As)
+	}
+	if len(order) == 0 {
+		return ret, nil
+	}
+
+	previous := make([][]interface{}, len(order))
+	for bucket := first; !bucket.After(last); bucket = r.bucket.Next(bucket, r.location) {
+		if len(ret.Rows)+len(order) > maxResampleRows {
+			return nil, errors.Errorf("resampling by %s from %s to %s yields more than %d rows", r.bucket, first, last, maxResampleRows)
+		}
+		for i, s := range order {
+			results := make([]interface{}, len(r.aggregations))
+			if grp, ok := s.buckets[bucket.UnixNano()]; ok {
+				for j, aggregator := range grp.aggregators {
+					results[j] = aggregator.result()
+				}
+				previous[i] = results
+			} else {
+				switch r.fill {
+				case ResampleFillZero:
+					for j := range results {
+						results[j] = 0
+					}
+				case ResampleFillPrevious:
+					if previous[i] != nil {
+						copy(results, previous[i])
+					}
+				case ResampleFillNull:
+				}
+			}
+
+			output := types.NewRow(types.MRP(r.timeColumn, bucket))
+			for j, column := range r.series {
+				output.Set(column, s.values[j])
+			}
+			for j, agg := range r.aggregations {
+				output.Set(agg.As, results[j])
+			}
+			ret.Rows = append(ret.Rows, output)
+		}
+	}
+
+	return ret, nil
+}
+
+func (r *ResampleMiddleware) Close(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,98 @@
+package table
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	assert2 "github.com/go-go-golems/glazed/pkg/helpers/assert"
+	"github.com/go-go-golems/glazed/pkg/middlewares/row"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createResampleTable() *types.Table {
+	ret := types.NewTable()
+	ret.AddRows(
+		types.NewRow(types.MRP("host", "a"), types.MRP("ts", "2024-03-13T10:05:00Z"), types.MRP("cpu", 10)),
+		types.NewRow(types.MRP("host", "a"), types.MRP("ts", "2024-03-13T10:40:00Z"), types.MRP("cpu", 20)),
+		types.NewRow(types.MRP("host", "b"), types.MRP("ts", "2024-03-13T12:10:00Z"), types.MRP("cpu", 5)),
+		types.NewRow(types.MRP("host", "b"), types.MRP("ts", nil), types.MRP("cpu", 1)),
+	)
+	return ret
+}
+
+func TestResampleMiddleware(t *testing.T) {
+	hour, err := row.ParseTimeBucket("hour")
+	require.NoError(t, err)
+	aggregations, err := ParseAggregations("sum:cpu")
+	require.NoError(t, err)
+
+	tests := []struct {
+		fill     ResampleFill
+		expected []interface{}
+	}{
+		{ResampleFillNull, []interface{}{int64(30), nil, nil, nil, nil, int64(5)}},
+		{ResampleFillZero, []interface{}{int64(30), 0, 0, 0, 0, int64(5)}},
+		{ResampleFillPrevious, []interface{}{int64(30), nil, int64(30), nil, int64(30), int64(5)}},
+	}
+	for _, tt := range tests {
+		mw := NewResampleMiddleware("ts", hour,
+			WithResampleSeries("host"),
+			WithResampleAggregations(aggregations...),
+			WithResampleFill(tt.fill),
+		)
+		newTable, err := mw.Process(context.Background(), createResampleTable())
+		require.NoError(t, err)
+
+		assert.Equal(t, []types.FieldName{"ts", "host", "sum_cpu"}, newTable.Columns)
+		require.Len(t, newTable.Rows, 6)
+		sums := []interface{}{}
+		for _, r := range newTable.Rows {
+			v, _ := r.Get("sum_cpu")
+			sums = append(sums, v)
+		}
+		assert.Equal(t, tt.expected, sums, "fill %s", tt.fill)
+	}
+}
+
+func TestResampleMiddlewareCountsByDefault(t *testing.T) {
+	hour, err := row.ParseTimeBucket("hour")
+	require.NoError(t, err)
+	newTable, err := NewResampleMiddleware("ts", hour).Process(context.Background(), createResampleTable())
+	require.NoError(t, err)
+
+	require.Len(t, newTable.Rows, 3)
+	ts, _ := newTable.Rows[1].Get("ts")
+	assert.True(t, time.Date(2024, 3, 13, 11, 0, 0, 0, time.UTC).Equal(ts.(time.Time)))
+	assert2.EqualRowValue(t, nil, newTable.Rows[1], "count")
+
+	_, err = ParseResampleFill("linear")
+	assert.Error(t, err)
+}
+
+func TestResampleMiddlewareAcrossDaylightSavingTime(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	h6, err := row.ParseTimeBucket("6h")
+	require.NoError(t, err)
+
+	// clocks are set back from 03:00 CEST to 02:00 CET on 2026-10-25
+	table := types.NewTable()
+	table.AddRows(
+		types.NewRow(types.MRP("ts", "2026-10-24T22:30:00Z")),
+		types.NewRow(types.MRP("ts", "2026-10-25T01:30:00Z")),
+		types.NewRow(types.MRP("ts", "2026-10-25T17:30:00Z")),
+	)
+	newTable, err := NewResampleMiddleware("ts", h6, WithResampleLocation(paris)).Process(context.Background(), table)
+	require.NoError(t, err)
+
+	require.Len(t, newTable.Rows, 4)
+	for i, hour := range []int{0, 6, 12, 18} {
+		ts, _ := newTable.Rows[i].Get("ts")
+		assert.True(t, time.Date(2026, 10, 25, hour, 0, 0, 0, paris).Equal(ts.(time.Time)), "bucket %d", i)
+	}
+	assert2.EqualRowValue(t, 2, newTable.Rows[0], "count")
+	assert2.EqualRowValue(t, 1, newTable.Rows[3], "count")
+}
@@ -0,0 +1,48 @@
+package table
+
+import (
+	"context"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+)
+
+// SkipLimitMiddleware is the table-level counterpart of row.SkipLimitMiddleware.
+// It is used when the rows have to be capped after a table middleware (such as
+// SortByMiddleware) has reordered them.
+type SkipLimitMiddleware struct {
+	Skip  int
+	Limit int
+}
+
+var _ middlewares.TableMiddleware = (*SkipLimitMiddleware)(nil)
+
+func NewSkipLimitMiddleware(skip int, limit int) *SkipLimitMiddleware {
+	return &SkipLimitMiddleware{
+		Skip:  skip,
+		Limit: limit,
+	}
+}
+
+func (s *SkipLimitMiddleware) Process(ctx context.Context, table *types.Table) (*types.Table, error) {
+	ret := &types.Table{
+		Columns: table.Columns,
+		Rows:    make([]types.Row, 0),
+	}
+
+	start := s.Skip
+	if start > len(table.Rows) {
+		start = len(table.Rows)
+	}
+	end := len(table.Rows)
+	if s.Limit > 0 && start+s.Limit < end {
+		end = start + s.Limit
+	}
+	ret.Rows = append(ret.Rows, table.Rows[start:end]...)
+
+	return ret, nil
+}
+
+func (s *SkipLimitMiddleware) Close(ctx context.Context) error {
+	return nil
+}
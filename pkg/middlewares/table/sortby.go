@@ -31,9 +31,13 @@ func (s *SortByMiddleware) Close(ctx context.Context) error {
 //
 // This will sort by name in ascending order and by age in descending order.
 func NewSortByMiddlewareFromColumns(columns ...string) *SortByMiddleware {
-	ret := &SortByMiddleware{
-		columns: make([]columnOrder, 0),
+	return &SortByMiddleware{
+		columns: parseColumnOrders(columns),
 	}
+}
+
+func parseColumnOrders(columns []string) []columnOrder {
+	ret := make([]columnOrder, 0)
 
 	for _, column := range columns {
 		if len(column) == 0 {
@@ -47,7 +51,7 @@ func NewSortByMiddlewareFromColumns(columns ...string) *SortByMiddleware {
 			isAsc = false
 		}
 
-		ret.columns = append(ret.columns, columnOrder{
+		ret = append(ret, columnOrder{
 			name: column,
 			asc:  isAsc,
 		})
@@ -56,6 +60,25 @@ func NewSortByMiddlewareFromColumns(columns ...string) *SortByMiddleware {
 	return ret
 }
 
+// lessRows compares two rows column by column, using compare.IsLowerThan.
+func lessRows(columns []columnOrder, rowA, rowB types.Row) bool {
+	for _, column := range columns {
+		v, ok := rowA.Get(column.name)
+		v2, ok2 := rowB.Get(column.name)
+		if ok == ok2 && v == v2 {
+			continue
+		}
+
+		if compare.IsLowerThan(v, v2) {
+			return column.asc
+		} else {
+			return !column.asc
+		}
+	}
+
+	return false
+}
+
 func (s *SortByMiddleware) Process(ctx context.Context, table *types.Table) (*types.Table, error) {
 	ret := &types.Table{
 		Columns: table.Columns,
@@ -69,24 +92,7 @@ func (s *SortByMiddleware) Process(ctx context.Context, table *types.Table) (*ty
 	}
 
 	sort.Slice(ret.Rows, func(i, j int) bool {
-		rowA := ret.Rows[i]
-		rowB := ret.Rows[j]
-
-		for _, column := range s.columns {
-			v, ok := rowA.Get(column.name)
-			v2, ok2 := rowB.Get(column.name)
-			if ok == ok2 && v == v2 {
-				continue
-			}
-
-			if compare.IsLowerThan(v, v2) {
-				return column.asc
-			} else {
-				return !column.asc
-			}
-		}
-
-		return false
+		return lessRows(s.columns, ret.Rows[i], ret.Rows[j])
 	})
 
 	return ret, nil
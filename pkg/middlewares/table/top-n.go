@@ -0,0 +1,124 @@
+package table
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+)
+
+// TopNMiddleware keeps the first N rows in the order of the given columns. It
+// produces the same rows as a SortByMiddleware followed by a
+// SkipLimitMiddleware, but only ever holds N rows in memory.
+//
+// It is a row middleware: rows are streamed into a bounded heap and the kept
+// rows are passed on to the downstream row middlewares, in order, when the
+// processor is closed. Rows that compare equal keep their input order.
+type TopNMiddleware struct {
+	columns []columnOrder
+	n       int
+
+	heap *topNHeap
+	seq  int
+}
+
+var _ middlewares.FlushingRowMiddleware = (*TopNMiddleware)(nil)
+
+// NewTopNMiddlewareFromColumns creates a TopNMiddleware keeping n rows. The
+// columns use the same syntax as NewSortByMiddlewareFromColumns.
+//
+// Example:
+//
+//	NewTopNMiddlewareFromColumns(20, "-cost")
+//
+// This keeps the 20 rows with the highest cost.
+func NewTopNMiddlewareFromColumns(n int, columns ...string) *TopNMiddleware {
+	ret := &TopNMiddleware{
+		columns: parseColumnOrders(columns),
+		n:       n,
+	}
+	ret.heap = &topNHeap{columns: ret.columns}
+	return ret
+}
+
+func (t *TopNMiddleware) Process(ctx context.Context, row types.Row) ([]types.Row, error) {
+	if t.n <= 0 {
+		return []types.Row{}, nil
+	}
+
+	item := topNItem{row: row, seq: t.seq}
+	t.seq++
+
+	if t.heap.Len() < t.n {
+		heap.Push(t.heap, item)
+		return []types.Row{}, nil
+	}
+
+	// the root of the heap is the worst row kept so far. Later rows never
+	// win ties against it.
+	if lessRows(t.columns, row, t.heap.items[0].row) {
+		t.heap.items[0] = item
+		heap.Fix(t.heap, 0)
+	}
+
+	return []types.Row{}, nil
+}
+
+func (t *TopNMiddleware) Flush(ctx context.Context, emit func(row types.Row) error) error {
+	items := t.heap.items
+	t.heap.items = nil
+
+	sort.Slice(items, func(i, j int) bool {
+		return t.heap.better(items[i], items[j])
+	})
+	for _, item := range items {
+		if err := emit(item.row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *TopNMiddleware) Close(ctx context.Context) error {
+	t.heap.items = nil
+	return nil
+}
+
+type topNItem struct {
+	row types.Row
+	seq int
+}
+
+// topNHeap is a max-heap: its root is the row that would be dropped first.
+type topNHeap struct {
+	columns []columnOrder
+	items   []topNItem
+}
+
+// better returns true if a comes before b in the sorted output.
+func (h *topNHeap) better(a, b topNItem) bool {
+	if lessRows(h.columns, a.row, b.row) {
+		return true
+	}
+	if lessRows(h.columns, b.row, a.row) {
+		return false
+	}
+	return a.seq < b.seq
+}
+
+func (h *topNHeap) Len() int { return len(h.items) }
+
+func (h *topNHeap) Less(i, j int) bool { return h.better(h.items[j], h.items[i]) }
+
+func (h *topNHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *topNHeap) Push(x interface{}) { h.items = append(h.items, x.(topNItem)) }
+
+func (h *topNHeap) Pop() interface{} {
+	n := len(h.items)
+	item := h.items[n-1]
+	h.items = h.items[:n-1]
+	return item
+}
@@ -0,0 +1,70 @@
+package table
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runTopN(t *testing.T, mw *TopNMiddleware, rows ...types.Row) []types.Row {
+	t.Helper()
+	processor := middlewares.NewTableProcessor(
+		middlewares.WithRowMiddleware(mw),
+		middlewares.WithTableMiddleware(&NullTableMiddleware{}),
+	)
+	ctx := context.Background()
+	for _, row := range rows {
+		require.NoError(t, processor.AddRow(ctx, row))
+	}
+	require.NoError(t, processor.Close(ctx))
+	return processor.GetTable().Rows
+}
+
+func TestTopNMatchesSortAndLimit(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+	table := types.NewTable()
+	for _, i := range r.Perm(200) {
+		table.AddRows(types.NewRow(types.MRP("a", i%10), types.MRP("b", i)))
+	}
+
+	sorted, err := NewSortByMiddlewareFromColumns("a", "-b").Process(context.Background(), table)
+	require.NoError(t, err)
+	expected, err := NewSkipLimitMiddleware(0, 15).Process(context.Background(), sorted)
+	require.NoError(t, err)
+
+	top := runTopN(t, NewTopNMiddlewareFromColumns(15, "a", "-b"), table.Rows...)
+	require.Len(t, top, 15)
+	for i := range top {
+		assert.Equal(t, expected.Rows[i], top[i])
+	}
+}
+
+func TestTopNKeepsInputOrderOnTies(t *testing.T) {
+	top := runTopN(t, NewTopNMiddlewareFromColumns(3, "k"),
+		types.NewRow(types.MRP("k", 1), types.MRP("i", 0)),
+		types.NewRow(types.MRP("k", 0), types.MRP("i", 1)),
+		types.NewRow(types.MRP("k", 1), types.MRP("i", 2)),
+		types.NewRow(types.MRP("k", 1), types.MRP("i", 3)),
+		types.NewRow(types.MRP("k", 0), types.MRP("i", 4)),
+	)
+	require.Len(t, top, 3)
+	for idx, expected := range []int{1, 4, 0} {
+		v, _ := top[idx].Get("i")
+		assert.Equal(t, expected, v)
+	}
+}
+
+func TestTopNWithFewerRowsThanN(t *testing.T) {
+	top := runTopN(t, NewTopNMiddlewareFromColumns(10, "-a"),
+		types.NewRow(types.MRP("a", 1)),
+		types.NewRow(types.MRP("a", 2)),
+	)
+	require.Len(t, top, 2)
+	v, _ := top[0].Get("a")
+	assert.Equal(t, 2, v)
+}
@@ -0,0 +1,46 @@
+package table
+
+import (
+	"context"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/middlewares/row"
+	"github.com/go-go-golems/glazed/pkg/types"
+)
+
+// UnflattenObjectMiddleware is the table-level counterpart of
+// row.UnflattenObjectMiddleware. It is used when the dotted columns only have
+// to be nested after the table middlewares, for example once the table has
+// been sorted by one of them.
+type UnflattenObjectMiddleware struct {
+	separator string
+}
+
+var _ middlewares.TableMiddleware = (*UnflattenObjectMiddleware)(nil)
+
+func NewUnflattenObjectMiddleware(separator string) *UnflattenObjectMiddleware {
+	return &UnflattenObjectMiddleware{
+		separator: separator,
+	}
+}
+
+func (m *UnflattenObjectMiddleware) Process(_ context.Context, table *types.Table) (*types.Table, error) {
+	ret := &types.Table{
+		Columns: []types.FieldName{},
+		Rows:    make([]types.Row, 0, len(table.Rows)),
+	}
+	for _, input := range table.Rows {
+		ret.Rows = append(ret.Rows, row.UnflattenRow(input, m.separator))
+	}
+	if len(ret.Rows) == 0 {
+		ret.Columns = append(ret.Columns, table.Columns...)
+		return ret, nil
+	}
+	ret.Columns = tableColumns(ret)
+
+	return ret, nil
+}
+
+func (m *UnflattenObjectMiddleware) Close(context.Context) error {
+	return nil
+}
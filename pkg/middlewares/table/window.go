@@ -0,0 +1,316 @@
+package table
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+)
+
+type WindowFunction string
+
+const (
+	WindowRowNumber      WindowFunction = "row_number"
+	WindowRank           WindowFunction = "rank"
+	WindowDenseRank      WindowFunction = "dense_rank"
+	WindowRunningSum     WindowFunction = "running_sum"
+	WindowRunningAvg     WindowFunction = "running_avg"
+	WindowLag            WindowFunction = "lag"
+	WindowLead           WindowFunction = "lead"
+	WindowPercentOfTotal WindowFunction = "percent_of_total"
+)
+
+// WindowColumn describes a column computed by a window function over the rows
+// of each partition.
+type WindowColumn struct {
+	Function WindowFunction
+	// Column is the input column. It is empty for row_number, rank and
+	// dense_rank, which only depend on the order of the rows.
+	Column types.FieldName
+	// Offset is the number of rows to look back or ahead for lag and lead.
+	Offset int
+	// As is the name of the output column.
+	As types.FieldName
+}
+
+// ParseWindowColumn parses a window column spec of the form
+//
+//	function[:column[:offset]][=name]
+//
+// Supported functions are row_number, rank, dense_rank, running_sum,
+// running_avg, lag, lead and percent_of_total (dashes can be used instead of
+// underscores). All functions except row_number, rank and dense_rank require a
+// column, and only lag and lead accept an offset, which defaults to 1. The
+// output column defaults to function_column, or function without a column.
+//
+// Examples:
+//
+//	row_number
+//	running_sum:cost
+//	lag:latency:7=latency_last_week
+func ParseWindowColumn(spec string) (WindowColumn, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return WindowColumn{}, errors.New("empty window column")
+	}
+
+	ret := WindowColumn{}
+	if idx := strings.Index(spec, "="); idx >= 0 {
+		ret.As = strings.TrimSpace(spec[idx+1:])
+		spec = strings.TrimSpace(spec[:idx])
+		if ret.As == "" {
+			return WindowColumn{}, errors.Errorf("empty output column name in window column %q", spec)
+		}
+	}
+
+	parts := strings.Split(spec, ":")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	name := strings.ReplaceAll(strings.ToLower(parts[0]), "-", "_")
+	if len(parts) > 1 {
+		ret.Column = parts[1]
+		if ret.Column == "" {
+			return WindowColumn{}, errors.Errorf("empty column in window column %q", spec)
+		}
+	}
+
+	ret.Function = WindowFunction(name)
+	switch ret.Function {
+	case WindowRowNumber, WindowRank, WindowDenseRank:
+		if ret.Column != "" {
+			return WindowColumn{}, errors.Errorf("window function %s doesn't take a column, it uses the window order", name)
+		}
+	case WindowRunningSum, WindowRunningAvg, WindowPercentOfTotal, WindowLag, WindowLead:
+		if ret.Column == "" {
+			return WindowColumn{}, errors.Errorf("window function %s requires a column, e.g. %s:cost", name, name)
+		}
+	default:
+		return WindowColumn{}, errors.Errorf("unknown window function %q in window column %q", parts[0], spec)
+	}
+
+	switch {
+	case len(parts) > 3:
+		return WindowColumn{}, errors.Errorf("invalid window column %q, expected function[:column[:offset]][=name]", spec)
+	case len(parts) == 3:
+		if ret.Function != WindowLag && ret.Function != WindowLead {
+			return WindowColumn{}, errors.Errorf("window function %s doesn't take an offset", name)
+		}
+		offset, err := strconv.Atoi(parts[2])
+		if err != nil || offset < 1 {
+			return WindowColumn{}, errors.Errorf("invalid offset %q in window column %q, expected a positive integer", parts[2], spec)
+		}
+		ret.Offset = offset
+	case ret.Function == WindowLag || ret.Function == WindowLead:
+		ret.Offset = 1
+	}
+
+	if ret.As == "" {
+		ret.As = name
+		if ret.Column != "" {
+			ret.As = name + "_" + ret.Column
+		}
+	}
+
+	return ret, nil
+}
+
+// ParseWindowColumns parses a list of window column specs, see ParseWindowColumn.
+func ParseWindowColumns(specs ...string) ([]WindowColumn, error) {
+	ret := make([]WindowColumn, 0, len(specs))
+	for _, spec := range specs {
+		column, err := ParseWindowColumn(spec)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, column)
+	}
+	return ret, nil
+}
+
+// WindowMiddleware adds columns computed by window functions, such as running
+// totals or ranks, to every row of the table.
+//
+// Rows are split into partitions by the values of the partition columns (a
+// single partition by default), and each partition is ordered by the order
+// columns (the table order by default, ties keep the table order). Unlike
+// GroupByMiddleware, rows are not merged: the table keeps its rows in their
+// original order, so SortByMiddleware can be used to order the result.
+//
+// Null and missing values are skipped by running_sum and running_avg, which
+// carry their previous value, and yield a null percent_of_total.
+type WindowMiddleware struct {
+	columns     []WindowColumn
+	partitionBy []types.FieldName
+	orderBy     []columnOrder
+}
+
+var _ middlewares.TableMiddleware = (*WindowMiddleware)(nil)
+
+type WindowOption func(*WindowMiddleware)
+
+// WithWindowPartitionBy sets the columns splitting the rows into partitions.
+func WithWindowPartitionBy(columns ...types.FieldName) WindowOption {
+	return func(w *WindowMiddleware) {
+		w.partitionBy = columns
+	}
+}
+
+// WithWindowOrderBy sets the columns ordering the rows of each partition,
+// prefixed with a minus sign for descending order as for
+// NewSortByMiddlewareFromColumns.
+func WithWindowOrderBy(columns ...string) WindowOption {
+	return func(w *WindowMiddleware) {
+		w.orderBy = parseColumnOrders(columns)
+	}
+}
+
+func NewWindowMiddleware(columns []WindowColumn, options ...WindowOption) *WindowMiddleware {
+	ret := &WindowMiddleware{
+		columns: columns,
+	}
+	for _, option := range options {
+		option(ret)
+	}
+	return ret
+}
+
+func (w *WindowMiddleware) Process(ctx context.Context, table *types.Table) (*types.Table, error) {
+	ret := &types.Table{
+		Columns: append([]types.FieldName{}, table.Columns...),
+		Rows:    make([]types.Row, 0, len(table.Rows)),
+	}
+	for _, column := range w.columns {
+		if !containsField(ret.Columns, column.As) {
+			ret.Columns = append(ret.Columns, column.As)
+		}
+	}
+
+	partitions := map[string][]int{}
+	partitionOrder := []string{}
+	for i, row := range table.Rows {
+		newRow := types.NewRow()
+		for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+			newRow.Set(pair.Key, pair.Value)
+		}
+		ret.Rows = append(ret.Rows, newRow)
+
+		keys := make([]string, len(w.partitionBy))
+		for j, column := range w.partitionBy {
+			v, _ := row.Get(column)
+			keys[j] = valueKey(v)
+		}
+		key := strings.Join(keys, "\x00")
+		if _, ok := partitions[key]; !ok {
+			partitionOrder = append(partitionOrder, key)
+		}
+		partitions[key] = append(partitions[key], i)
+	}
+
+	for _, key := range partitionOrder {
+		rows := make([]types.Row, 0, len(partitions[key]))
+		for _, i := range partitions[key] {
+			rows = append(rows, ret.Rows[i])
+		}
+		sort.SliceStable(rows, func(i, j int) bool {
+			return lessRows(w.orderBy, rows[i], rows[j])
+		})
+		for _, column := range w.columns {
+			if err := w.computeColumn(column, rows); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+// computeColumn sets the column on the ordered rows of a partition. The values
+// are computed before being set, so that lag and lead read the input values
+// even when the output column replaces the input column.
+func (w *WindowMiddleware) computeColumn(column WindowColumn, rows []types.Row) error {
+	values := make([]interface{}, len(rows))
+
+	switch column.Function {
+	case WindowRowNumber:
+		for i := range rows {
+			values[i] = i + 1
+		}
+
+	case WindowRank, WindowDenseRank:
+		rank, denseRank := 0, 0
+		for i, row := range rows {
+			if i == 0 || lessRows(w.orderBy, rows[i-1], row) || lessRows(w.orderBy, row, rows[i-1]) {
+				rank = i + 1
+				denseRank++
+			}
+			if column.Function == WindowRank {
+				values[i] = rank
+			} else {
+				values[i] = denseRank
+			}
+		}
+
+	case WindowRunningSum, WindowRunningAvg:
+		function := AggregateSum
+		if column.Function == WindowRunningAvg {
+			function = AggregateAvg
+		}
+		agg := newAggregator(Aggregation{Function: function, Column: column.Column})
+		for i, row := range rows {
+			v, present := row.Get(column.Column)
+			if err := agg.add(v, present); err != nil {
+				return err
+			}
+			values[i] = agg.result()
+		}
+
+	case WindowLag, WindowLead:
+		offset := column.Offset
+		if column.Function == WindowLag {
+			offset = -offset
+		}
+		for i := range rows {
+			if j := i + offset; j >= 0 && j < len(rows) {
+				values[i], _ = rows[j].Get(column.Column)
+			}
+		}
+
+	case WindowPercentOfTotal:
+		total := 0.0
+		numbers := make([]*float64, len(rows))
+		for i, row := range rows {
+			v, ok := row.Get(column.Column)
+			if !ok || v == nil {
+				continue
+			}
+			f, ok := toFloat64(v)
+			if !ok {
+				return errors.Errorf("cannot compute percent of total of non-numeric value %v in column %s", v, column.Column)
+			}
+			numbers[i] = &f
+			total += f
+		}
+		for i, f := range numbers {
+			if f != nil && total != 0 {
+				values[i] = *f / total * 100
+			}
+		}
+
+	default:
+		return errors.Errorf("unknown window function %s", column.Function)
+	}
+
+	for i, row := range rows {
+		row.Set(column.As, values[i])
+	}
+	return nil
+}
+
+func (w *WindowMiddleware) Close(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,103 @@
+package table
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createWindowTable() *types.Table {
+	ret := types.NewTable()
+	ret.Columns = []types.FieldName{"team", "day", "cost"}
+	ret.AddRows(
+		types.NewRow(types.MRP("team", "infra"), types.MRP("day", 2), types.MRP("cost", 20)),
+		types.NewRow(types.MRP("team", "web"), types.MRP("day", 1), types.MRP("cost", 5)),
+		types.NewRow(types.MRP("team", "infra"), types.MRP("day", 1), types.MRP("cost", 10)),
+		types.NewRow(types.MRP("team", "infra"), types.MRP("day", 3), types.MRP("cost", 10)),
+		types.NewRow(types.MRP("team", "web"), types.MRP("day", 2), types.MRP("cost", nil)),
+	)
+	return ret
+}
+
+func columnValues(table *types.Table, column types.FieldName) []interface{} {
+	ret := make([]interface{}, 0, len(table.Rows))
+	for _, row := range table.Rows {
+		v, _ := row.Get(column)
+		ret = append(ret, v)
+	}
+	return ret
+}
+
+func TestParseWindowColumn(t *testing.T) {
+	column, err := ParseWindowColumn("running-sum:cost")
+	require.NoError(t, err)
+	assert.Equal(t, WindowColumn{Function: WindowRunningSum, Column: "cost", As: "running_sum_cost"}, column)
+
+	column, err = ParseWindowColumn("lag:cost:7=last_week")
+	require.NoError(t, err)
+	assert.Equal(t, WindowColumn{Function: WindowLag, Column: "cost", Offset: 7, As: "last_week"}, column)
+
+	column, err = ParseWindowColumn("lead:cost")
+	require.NoError(t, err)
+	assert.Equal(t, 1, column.Offset)
+
+	for _, spec := range []string{"", "rank:cost", "running_sum", "sum:cost", "lag:cost:0", "running_avg:cost:2", "lag:cost:1:2"} {
+		_, err := ParseWindowColumn(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestWindowMiddlewareRunningValues(t *testing.T) {
+	columns, err := ParseWindowColumns("row_number", "running_sum:cost", "running_avg:cost", "percent_of_total:cost=pct")
+	require.NoError(t, err)
+	mw := NewWindowMiddleware(columns, WithWindowPartitionBy("team"), WithWindowOrderBy("day"))
+
+	newTable, err := mw.Process(context.Background(), createWindowTable())
+	require.NoError(t, err)
+
+	assert.Equal(t, []types.FieldName{"team", "day", "cost", "row_number", "running_sum_cost", "running_avg_cost", "pct"}, newTable.Columns)
+	// rows keep the table order
+	assert.Equal(t, []interface{}{2, 1, 1, 3, 2}, columnValues(newTable, "day"))
+	assert.Equal(t, []interface{}{2, 1, 1, 3, 2}, columnValues(newTable, "row_number"))
+	assert.Equal(t, []interface{}{int64(30), int64(5), int64(10), int64(40), int64(5)}, columnValues(newTable, "running_sum_cost"))
+	assert.Equal(t, []interface{}{15.0, 5.0, 10.0, 40.0 / 3, 5.0}, columnValues(newTable, "running_avg_cost"))
+	assert.Equal(t, []interface{}{50.0, 100.0, 25.0, 25.0, nil}, columnValues(newTable, "pct"))
+}
+
+func TestWindowMiddlewareRanks(t *testing.T) {
+	columns, err := ParseWindowColumns("rank", "dense_rank", "row_number")
+	require.NoError(t, err)
+	mw := NewWindowMiddleware(columns, WithWindowOrderBy("-cost"))
+
+	table := createWindowTable()
+	table.Rows = table.Rows[:4]
+	newTable, err := mw.Process(context.Background(), table)
+	require.NoError(t, err)
+
+	// costs are 20, 5, 10, 10
+	assert.Equal(t, []interface{}{1, 4, 2, 2}, columnValues(newTable, "rank"))
+	assert.Equal(t, []interface{}{1, 3, 2, 2}, columnValues(newTable, "dense_rank"))
+	assert.Equal(t, []interface{}{1, 4, 2, 3}, columnValues(newTable, "row_number"))
+}
+
+func TestWindowMiddlewareLagLead(t *testing.T) {
+	columns, err := ParseWindowColumns("lag:cost", "lead:cost:2", "lag:day=day")
+	require.NoError(t, err)
+	mw := NewWindowMiddleware(columns, WithWindowPartitionBy("team"), WithWindowOrderBy("day"))
+
+	newTable, err := mw.Process(context.Background(), createWindowTable())
+	require.NoError(t, err)
+
+	assert.Equal(t, []interface{}{10, nil, nil, 20, 5}, columnValues(newTable, "lag_cost"))
+	assert.Equal(t, []interface{}{nil, nil, 10, nil, nil}, columnValues(newTable, "lead_cost"))
+	assert.Equal(t, []interface{}{1, nil, nil, 2, 1}, columnValues(newTable, "day"))
+}
+
+func TestWindowMiddlewareRejectsNonNumericValues(t *testing.T) {
+	mw := NewWindowMiddleware([]WindowColumn{{Function: WindowRunningSum, Column: "team", As: "total"}})
+	_, err := mw.Process(context.Background(), createWindowTable())
+	assert.Error(t, err)
+}
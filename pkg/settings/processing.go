@@ -0,0 +1,1215 @@
+package settings
+
+import (
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/expr"
+	parquetformatter "github.com/go-go-golems/glazed/pkg/formatters/parquet"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/middlewares/lua"
+	"github.com/go-go-golems/glazed/pkg/middlewares/pipeline"
+	"github.com/go-go-golems/glazed/pkg/middlewares/row"
+	"github.com/go-go-golems/glazed/pkg/middlewares/table"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	GlazedProcessingSlug = "glazed-processing"
+)
+
+// GlazedProcessingSettings configures the optional row and table post-processing
+// that SetupStructuredProcessor applies before projection and serialization.
+//
+// The zero value performs no processing.
+type GlazedProcessingSettings struct {
+	Explode          []string          `glazed:"explode"`
+	ExplodeIndex     bool              `glazed:"explode-index"`
+	Flatten          bool              `glazed:"flatten"`
+	Rename           map[string]string `glazed:"rename"`
+	RenameRegexp     map[string]string `glazed:"rename-regexp"`
+	RenameYAML       string            `glazed:"rename-yaml"`
+	ReplaceFile      string            `glazed:"replace-file"`
+	Coerce           []string          `glazed:"coerce"`
+	CoerceErrors     string            `glazed:"coerce-errors"`
+	CoerceColErrors  map[string]string `glazed:"coerce-column-errors"`
+	TimeBucket       []string          `glazed:"time-bucket"`
+	TimeZone         string            `glazed:"time-zone"`
+	AddFields        map[string]string `glazed:"add-fields"`
+	TemplateFields   map[string]string `glazed:"template-field"`
+	Where            string            `glazed:"where"`
+	Filter           []string          `glazed:"filter"`
+	RegexFilter      []string          `glazed:"regex-filter"`
+	RemoveDuplicates []string          `glazed:"remove-duplicates"`
+	Distinct         bool              `glazed:"distinct"`
+	DistinctOn       []string          `glazed:"distinct-on"`
+	DistinctMemoryMB int               `glazed:"distinct-memory-mb"`
+	Sample           int               `glazed:"sample"`
+	SamplePercent    float64           `glazed:"sample-percent"`
+	SampleKey        []string          `glazed:"sample-key"`
+	SampleSeed       int               `glazed:"sample-seed"`
+	Redact           map[string]string `glazed:"redact"`
+	RedactRegexp     map[string]string `glazed:"redact-regexp"`
+	RedactKey        string            `glazed:"redact-key"`
+	RedactFormats    bool              `glazed:"redact-format-preserving"`
+	Unpivot          []string          `glazed:"unpivot"`
+	GroupBy          []string          `glazed:"group-by"`
+	Aggregations     []string          `glazed:"agg"`
+	Resample         string            `glazed:"resample"`
+	ResampleFill     string            `glazed:"resample-fill"`
+	Pivot            string            `glazed:"pivot"`
+	PivotAgg         string            `glazed:"pivot-agg"`
+	Window           []string          `glazed:"window"`
+	PartitionBy      []string          `glazed:"partition-by"`
+	WindowOrderBy    []string          `glazed:"window-order-by"`
+	Describe         bool              `glazed:"describe"`
+	DescribeTop      int               `glazed:"describe-top"`
+	DescribeApprox   bool              `glazed:"describe-approx"`
+	Pipeline         string            `glazed:"pipeline"`
+	SortBy           []string          `glazed:"sort-by"`
+	SortMemoryMB     int               `glazed:"sort-memory-mb"`
+	Unflatten        bool              `glazed:"unflatten"`
+	UnflattenSep     string            `glazed:"unflatten-separator"`
+	OutputFile       string            `glazed:"output-file"`
+	XLSXSheetColumn  string            `glazed:"xlsx-sheet-column"`
+	SQLiteTable      string            `glazed:"sqlite-table"`
+	SQLiteIndex      []string          `glazed:"sqlite-index"`
+	SQLiteBatchSize  int               `glazed:"sqlite-batch-size"`
+	ParquetGroupSize int               `glazed:"parquet-row-group-size"`
+	ParquetCompress  string            `glazed:"parquet-compression"`
+	JoinFile         string            `glazed:"join-file"`
+	JoinOn           []string          `glazed:"join-on"`
+	JoinType         string            `glazed:"join-type"`
+	JoinPrefix       string            `glazed:"join-prefix"`
+	LuaScript        string            `glazed:"lua-script"`
+	LuaRowFunction   string            `glazed:"lua-row-function"`
+	LuaTableFunction string            `glazed:"lua-table-function"`
+
+	// loadedPipeline is the parsed --pipeline file.
+	loadedPipeline *pipeline.Pipeline
+	// loadedLua is the last loaded --lua-script, and luaInUse is true once
+	// middlewares were created from it.
+	loadedLua *lua.Script
+	luaInUse  bool
+}
+
+// NewGlazedProcessingSection creates the companion section of the structured
+// output section. It is not mounted automatically: applications that want the
+// generic post-processing flags on their GlazeCommands add it to their schema,
+// optionally with schema.WithPrefix to keep the flag names out of the way of
+// their own flags.
+func NewGlazedProcessingSection(options ...schema.SectionOption) (*schema.SectionImpl, error) {
+	sectionOptions := []schema.SectionOption{
+		schema.WithDescription("Generic row and table post-processing applied before structured output"),
+		schema.WithFields(
+			fields.New(
+				"explode",
+				fields.TypeStringList,
+				fields.WithHelp("Output one row per element of these list columns (object elements become field.key columns)"),
+				fields.WithDefault([]string{}),
+			),
+			fields.New(
+				"explode-index",
+				fields.TypeBool,
+				fields.WithHelp("Add a field_index column with the position of each exploded element"),
+				fields.WithDefault(false),
+			),
+			fields.New(
+				"flatten",
+				fields.TypeBool,
+				fields.WithHelp("Flatten nested objects into dotted columns"),
+				fields.WithDefault(false),
+			),
+			fields.New(
+				"rename",
+				fields.TypeKeyValue,
+				fields.WithHelp("Rename columns (old:new)"),
+				fields.WithDefault(map[string]string{}),
+			),
+			fields.New(
+				"rename-regexp",
+				fields.TypeKeyValue,
+				fields.WithHelp("Rename columns matching a regular expression (regexp:replacement)"),
+				fields.WithDefault(map[string]string{}),
+			),
+			fields.New(
+				"rename-yaml",
+				fields.TypeString,
+				fields.WithHelp("YAML file with renames and regexp renames"),
+				fields.WithDefault(""),
+			),
+			fields.New(
+				"replace-file",
+				fields.TypeString,
+				fields.WithHelp("YAML file with per-column value replacements and skips"),
+				fields.WithDefault(""),
+			),
+			fields.New(
+				"coerce",
+				fields.TypeStringList,
+				fields.WithHelp("Cast columns to int, float, bool, time, duration, json or string (e.g. cost:float,day:time:2006-01-02)"),
+				fields.WithDefault([]string{}),
+			),
+			fields.New(
+				"coerce-errors",
+				fields.TypeChoice,
+				fields.WithHelp("What to do with values --coerce can't cast: fail, replace them with null, keep them, or drop the row"),
+				fields.WithChoices("error", "null", "keep", "drop"),
+				fields.WithDefault("error"),
+			),
+			fields.New(
+				"coerce-column-errors",
+				fields.TypeKeyValue,
+				fields.WithHelp("Per-column --coerce-errors policies (column:policy)"),
+				fields.WithDefault(map[string]string{}),
+			),
+			fields.New(
+				"time-bucket",
+				fields.TypeStringList,
+				fields.WithHelp("Truncate time columns to minute, hour, day, week, month or a duration (e.g. ts:hour,created_at:15m=slot)"),
+				fields.WithDefault([]string{}),
+			),
+			fields.New(
+				"time-zone",
+				fields.TypeString,
+				fields.WithHelp("Time zone in which --time-bucket and --resample compute days, weeks and months (e.g. Europe/Paris, Local)"),
+				fields.WithDefault("UTC"),
+			),
+			fields.New(
+				"add-fields",
+				fields.TypeKeyValue,
+				fields.WithHelp("Add constant columns (name:value)"),
+				fields.WithDefault(map[string]string{}),
+			),
+			fields.New(
+				"template-field",
+				fields.TypeKeyValue,
+				fields.WithHelp("Add columns computed from a go template (name={{ .field }}); dots in field names become _"),
+				fields.WithDefault(map[string]string{}),
+			),
+			fields.New(
+				"where",
+				fields.TypeString,
+				fields.WithHelp(`Only keep rows matching an expression, e.g. 'status == "failed" && duration > 30'`),
+				fields.WithDefault(""),
+			),
+			fields.New(
+				"filter",
+				fields.TypeStringList,
+				fields.WithHelp("Columns to remove (a trailing . removes a prefix)"),
+				fields.WithDefault([]string{}),
+			),
+			fields.New(
+				"regex-filter",
+				fields.TypeStringList,
+				fields.WithHelp("Regular expressions of columns to remove"),
+				fields.WithDefault([]string{}),
+			),
+			fields.New(
+				"remove-duplicates",
+				fields.TypeStringList,
+				fields.WithHelp("Drop consecutive rows with identical values in these columns"),
+				fields.WithDefault([]string{}),
+			),
+			fields.New(
+				"distinct",
+				fields.TypeBool,
+				fields.WithHelp("Drop rows that are identical to any previous row, not only to the previous one"),
+				fields.WithDefault(false),
+			),
+			fields.New(
+				"distinct-on",
+				fields.TypeStringList,
+				fields.WithHelp("Compare only these columns for --distinct"),
+				fields.WithDefault([]string{}),
+			),
+			fields.New(
+				"distinct-memory-mb",
+				fields.TypeInteger,
+				fields.WithHelp("Remember the keys of --distinct in at most this many megabytes, falling back to a Bloom filter that may drop some distinct rows (0 keeps all keys)"),
+				fields.WithDefault(0),
+			),
+			fields.New(
+				"sample",
+				fields.TypeInteger,
+				fields.WithHelp("Keep a uniform random sample of this many rows, in input order (0 keeps all rows)"),
+				fields.WithDefault(0),
+			),
+			fields.New(
+				"sample-percent",
+				fields.TypeFloat,
+				fields.WithHelp("Keep each row with this probability, in percent (0 keeps all rows)"),
+				fields.WithDefault(0.0),
+			),
+			fields.New(
+				"sample-key",
+				fields.TypeStringList,
+				fields.WithHelp("Make --sample-percent keep the rows whose key columns hash into the sample, so that the same entities are sampled across runs"),
+				fields.WithDefault([]string{}),
+			),
+			fields.New(
+				"sample-seed",
+				fields.TypeInteger,
+				fields.WithHelp("Seed of --sample and --sample-percent; the same seed and input yield the same sample"),
+				fields.WithDefault(0),
+			),
+			fields.New(
+				"redact",
+				fields.TypeKeyValue,
+				fields.WithHelp("Redact columns (column:action), where action is mask, hash, truncate[:length] or drop"),
+				fields.WithDefault(map[string]string{}),
+			),
+			fields.New(
+				"redact-regexp",
+				fields.TypeKeyValue,
+				fields.WithHelp("Redact the columns matching a regular expression (regexp:action)"),
+				fields.WithDefault(map[string]string{}),
+			),
+			fields.New(
+				"redact-key",
+				fields.TypeSecret,
+				fields.WithHelp("Key of the HMAC-SHA256 used to hash redacted columns"),
+				fields.WithDefault(""),
+			),
+			fields.New(
+				"redact-format-preserving",
+				fields.TypeBool,
+				fields.WithHelp("Keep the domain of masked or hashed emails and the separators and last 4 digits of card numbers"),
+				fields.WithDefault(false),
+			),
+			fields.New(
+				"unpivot",
+				fields.TypeStringList,
+				fields.WithHelp("Melt these columns into key/value rows"),
+				fields.WithDefault([]string{}),
+			),
+			fields.New(
+				"group-by",
+				fields.TypeStringList,
+				fields.WithHelp("Group rows by these columns and output one row per group with the --agg columns"),
+				fields.WithDefault([]string{}),
+			),
+			fields.New(
+				"agg",
+				fields.TypeStringList,
+				fields.WithHelp("Aggregations computed per group: count, sum, avg, min, max, distinct, first, last, median, pNN (e.g. count,sum:cost,p95:latency=p95)"),
+				fields.WithDefault([]string{}),
+			),
+			fields.New(
+				"resample",
+				fields.TypeString,
+				fields.WithHelp("Output one row per time bucket and --group-by series with the --agg columns, including empty buckets (column:bucket, e.g. ts:hour)"),
+				fields.WithDefault(""),
+			),
+			fields.New(
+				"resample-fill",
+				fields.TypeChoice,
+				fields.WithHelp("Value of the --agg columns in the empty buckets of --resample"),
+				fields.WithChoices(string(table.ResampleFillNull), string(table.ResampleFillZero), string(table.ResampleFillPrevious)),
+				fields.WithDefault(string(table.ResampleFillNull)),
+			),
+			fields.New(
+				"pivot",
+				fields.TypeString,
+				fields.WithHelp("Turn the values of a key column into columns holding a value column (key:value)"),
+				fields.WithDefault(""),
+			),
+			fields.New(
+				"pivot-agg",
+				fields.TypeString,
+				fields.WithHelp("Aggregation combining pivoted values that share a row and column (e.g. first, sum, avg)"),
+				fields.WithDefault("first"),
+			),
+			fields.New(
+				"window",
+				fields.TypeStringList,
+				fields.WithHelp("Window columns added to every row: row_number, rank, dense_rank, running_sum, running_avg, lag, lead, percent_of_total (e.g. running_sum:cost,lag:cost:7=last_week)"),
+				fields.WithDefault([]string{}),
+			),
+			fields.New(
+				"partition-by",
+				fields.TypeStringList,
+				fields.WithHelp("Compute --window columns separately for each distinct value of these columns"),
+				fields.WithDefault([]string{}),
+			),
+			fields.New(
+				"window-order-by",
+				fields.TypeStringList,
+				fields.WithHelp("Order the rows of each --window partition by these columns (prefix with - for descending order)"),
+				fields.WithDefault([]string{}),
+			),
+			fields.New(
+				"describe",
+				fields.TypeBool,
+				fields.WithHelp("Replace the rows with a profile of each column: type, null and distinct counts, min/max, mean, top and sample values"),
+				fields.WithDefault(false),
+			),
+			fields.New(
+				"describe-top",
+				fields.TypeInteger,
+				fields.WithHelp("Number of most frequent values listed per column by --describe"),
+				fields.WithDefault(5),
+			),
+			fields.New(
+				"describe-approx",
+				fields.TypeBool,
+				fields.WithHelp("Estimate distinct counts and top values of --describe with a fixed number of counters per column (HyperLogLog)"),
+				fields.WithDefault(false),
+			),
+			fields.New(
+				"pipeline",
+				fields.TypeString,
+				fields.WithHelp("YAML file listing additional object, row and table stages, run after the other row and table stages"),
+				fields.WithDefault(""),
+			),
+			fields.New(
+				"sort-by",
+				fields.TypeStringList,
+				fields.WithHelp("Sort rows by these columns (prefix with - for descending order)"),
+				fields.WithDefault([]string{}),
+			),
+			fields.New(
+				"sort-memory-mb",
+				fields.TypeInteger,
+				fields.WithHelp("Sort with at most this many megabytes of rows in memory, spilling sorted runs to temporary files (0 sorts in memory)"),
+				fields.WithDefault(0),
+			),
+			fields.New(
+				"unflatten",
+				fields.TypeBool,
+				fields.WithHelp("Nest dotted columns back into objects, and numeric segments into lists, before output"),
+				fields.WithDefault(false),
+			),
+			fields.New(
+				"unflatten-separator",
+				fields.TypeString,
+				fields.WithHelp("Separator of the nested column names for --unflatten"),
+				fields.WithDefault("."),
+			),
+			fields.New(
+				"output-file",
+				fields.TypeString,
+				fields.WithHelp("File written by the binary formats, such as xlsx, which can't be written to stdout"),
+				fields.WithDefault(""),
+			),
+			fields.New(
+				"xlsx-sheet-column",
+				fields.TypeString,
+				fields.WithHelp("Write one xlsx sheet per value of this column, named after the value"),
+				fields.WithDefault(""),
+			),
+			fields.New(
+				"sqlite-table",
+				fields.TypeString,
+				fields.WithHelp("Table of the sqlite database the rows are inserted into, created if it doesn't exist"),
+				fields.WithDefault("data"),
+			),
+			fields.New(
+				"sqlite-index",
+				fields.TypeStringList,
+				fields.WithHelp("Columns of the sqlite table to index"),
+				fields.WithDefault([]string{}),
+			),
+			fields.New(
+				"sqlite-batch-size",
+				fields.TypeInteger,
+				fields.WithHelp("Number of rows inserted per sqlite INSERT statement"),
+				fields.WithDefault(500),
+			),
+			fields.New(
+				"parquet-row-group-size",
+				fields.TypeInteger,
+				fields.WithHelp("Number of rows per parquet row group"),
+				fields.WithDefault(10000),
+			),
+			fields.New(
+				"parquet-compression",
+				fields.TypeChoice,
+				fields.WithHelp("Compression of the parquet pages"),
+				fields.WithChoices(
+					string(parquetformatter.CompressionNone),
+					string(parquetformatter.CompressionSnappy),
+					string(parquetformatter.CompressionGzip),
+					string(parquetformatter.CompressionZstd),
+				),
+				fields.WithDefault(string(parquetformatter.CompressionGzip)),
+			),
+			fields.New(
+				"join-file",
+				fields.TypeString,
+				fields.WithHelp("Lookup dataset (.csv, .tsv, .json or .yaml) to enrich the rows with"),
+				fields.WithDefault(""),
+			),
+			fields.New(
+				"join-on",
+				fields.TypeStringList,
+				fields.WithHelp("Key columns of --join-file, either column or input_column=lookup_column"),
+				fields.WithDefault([]string{}),
+			),
+			fields.New(
+				"join-type",
+				fields.TypeChoice,
+				fields.WithHelp("inner drops rows without a match in --join-file, left keeps them"),
+				fields.WithChoices(string(row.JoinInner), string(row.JoinLeft)),
+				fields.WithDefault(string(row.JoinInner)),
+			),
+			fields.New(
+				"join-prefix",
+				fields.TypeString,
+				fields.WithHelp("Prefix of lookup columns that conflict with input columns"),
+				fields.WithDefault("join_"),
+			),
+			fields.New(
+				"lua-script",
+				fields.TypeString,
+				fields.WithHelp("Lua script defining a row function, a table function, or both"),
+				fields.WithDefault(""),
+			),
+			fields.New(
+				"lua-row-function",
+				fields.TypeString,
+				fields.WithHelp("Function of --lua-script called with every row, returning false to drop it, true to keep it, or the output rows"),
+				fields.WithDefault("process_row"),
+			),
+			fields.New(
+				"lua-table-function",
+				fields.TypeString,
+				fields.WithHelp("Function of --lua-script called with the list of all rows, returning the output rows"),
+				fields.WithDefault("process_table"),
+			),
+		),
+	}
+	sectionOptions = append(sectionOptions, options...)
+	return schema.NewSection(GlazedProcessingSlug, "Glazed processing", sectionOptions...)
+}
+
+func DecodeGlazedProcessingSettings(sectionValues *values.SectionValues) (*GlazedProcessingSettings, error) {
+	settings := &GlazedProcessingSettings{}
+	if err := sectionValues.DecodeInto(settings); err != nil {
+		return nil, errors.Wrap(err, "failed to decode glazed processing settings")
+	}
+
+	for pattern := range settings.RenameRegexp {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, errors.Wrapf(err, "invalid rename-regexp pattern %q", pattern)
+		}
+	}
+	for _, pattern := range settings.RegexFilter {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, errors.Wrapf(err, "invalid regex-filter pattern %q", pattern)
+		}
+	}
+
+	settings.Where = strings.TrimSpace(settings.Where)
+	if settings.Where != "" {
+		if _, err := expr.Compile(settings.Where); err != nil {
+			return nil, errors.Wrap(err, "invalid where expression")
+		}
+	}
+
+	settings.Coerce = normalizeStringList(settings.Coerce)
+	if _, err := settings.coercions(); err != nil {
+		return nil, err
+	}
+	settings.TimeBucket = normalizeStringList(settings.TimeBucket)
+	if _, err := row.ParseTimeBucketColumns(settings.TimeBucket...); err != nil {
+		return nil, errors.Wrap(err, "invalid time-bucket")
+	}
+	settings.TimeZone = strings.TrimSpace(settings.TimeZone)
+	if _, err := settings.location(); err != nil {
+		return nil, err
+	}
+
+	settings.JoinFile = strings.TrimSpace(settings.JoinFile)
+	settings.JoinOn = normalizeStringList(settings.JoinOn)
+	switch {
+	case settings.JoinFile == "" && len(settings.JoinOn) > 0:
+		return nil, errors.New("--join-on requires --join-file")
+	case settings.JoinFile != "" && len(settings.JoinOn) == 0:
+		return nil, errors.New("--join-file requires --join-on")
+	case settings.JoinFile != "" && settings.JoinPrefix == "":
+		return nil, errors.New("invalid join-prefix, must not be empty")
+	}
+	if _, err := row.ParseJoinKeys(settings.JoinOn...); err != nil {
+		return nil, errors.Wrap(err, "invalid join-on")
+	}
+
+	settings.Explode = normalizeStringList(settings.Explode)
+	settings.Filter = normalizeStringList(settings.Filter)
+	settings.RegexFilter = normalizeStringList(settings.RegexFilter)
+	settings.RemoveDuplicates = normalizeStringList(settings.RemoveDuplicates)
+	settings.DistinctOn = normalizeStringList(settings.DistinctOn)
+	switch {
+	case settings.DistinctMemoryMB < 0:
+		return nil, errors.Errorf("invalid distinct-memory-mb %d, must not be negative", settings.DistinctMemoryMB)
+	case !settings.Distinct && (len(settings.DistinctOn) > 0 || settings.DistinctMemoryMB > 0):
+		return nil, errors.New("--distinct-on and --distinct-memory-mb require --distinct")
+	}
+	settings.SampleKey = normalizeStringList(settings.SampleKey)
+	switch {
+	case settings.Sample < 0:
+		return nil, errors.Errorf("invalid sample %d, must not be negative", settings.Sample)
+	case settings.SamplePercent < 0 || settings.SamplePercent > 100:
+		return nil, errors.Errorf("invalid sample-percent %g, must be between 0 and 100", settings.SamplePercent)
+	case settings.Sample > 0 && settings.SamplePercent > 0:
+		return nil, errors.New("--sample and --sample-percent can't be combined")
+	case len(settings.SampleKey) > 0 && settings.SamplePercent == 0:
+		return nil, errors.New("--sample-key requires --sample-percent")
+	}
+	if _, err := settings.redactMiddleware(); err != nil {
+		return nil, err
+	}
+	settings.GroupBy = normalizeStringList(settings.GroupBy)
+	settings.Aggregations = normalizeStringList(settings.Aggregations)
+	if _, err := table.ParseAggregations(settings.Aggregations...); err != nil {
+		return nil, errors.Wrap(err, "invalid agg")
+	}
+	settings.Resample = strings.TrimSpace(settings.Resample)
+	if settings.Resample != "" {
+		if _, err := settings.resampleMiddleware(); err != nil {
+			return nil, err
+		}
+	} else if settings.ResampleFill != "" && settings.ResampleFill != string(table.ResampleFillNull) {
+		return nil, errors.New("--resample-fill requires --resample")
+	}
+	settings.Unpivot = normalizeStringList(settings.Unpivot)
+	settings.Pivot = strings.TrimSpace(settings.Pivot)
+	if settings.Pivot != "" {
+		if _, err := settings.pivotMiddleware(); err != nil {
+			return nil, err
+		}
+	}
+	settings.Window = normalizeStringList(settings.Window)
+	if _, err := table.ParseWindowColumns(settings.Window...); err != nil {
+		return nil, errors.Wrap(err, "invalid window")
+	}
+	settings.PartitionBy = normalizeStringList(settings.PartitionBy)
+	settings.WindowOrderBy = normalizeStringList(settings.WindowOrderBy)
+	if len(settings.Window) == 0 && (len(settings.PartitionBy) > 0 || len(settings.WindowOrderBy) > 0) {
+		return nil, errors.New("--partition-by and --window-order-by require --window")
+	}
+	if settings.DescribeTop < 0 {
+		return nil, errors.Errorf("invalid describe-top %d, must not be negative", settings.DescribeTop)
+	}
+	settings.Pipeline = strings.TrimSpace(settings.Pipeline)
+	if settings.Pipeline != "" {
+		if _, err := settings.loadPipeline(); err != nil {
+			return nil, err
+		}
+	}
+	settings.SortBy = normalizeStringList(settings.SortBy)
+	if settings.SortMemoryMB < 0 {
+		return nil, errors.Errorf("invalid sort-memory-mb %d, must not be negative", settings.SortMemoryMB)
+	}
+	if settings.Unflatten && settings.UnflattenSep == "" {
+		return nil, errors.New("invalid unflatten-separator, must not be empty")
+	}
+	settings.OutputFile = strings.TrimSpace(settings.OutputFile)
+	settings.XLSXSheetColumn = strings.TrimSpace(settings.XLSXSheetColumn)
+	settings.SQLiteTable = strings.TrimSpace(settings.SQLiteTable)
+	settings.SQLiteIndex = normalizeStringList(settings.SQLiteIndex)
+	switch {
+	case settings.SQLiteTable == "":
+		return nil, errors.New("invalid sqlite-table, must not be empty")
+	case settings.SQLiteBatchSize <= 0:
+		return nil, errors.Errorf("invalid sqlite-batch-size %d, must be positive", settings.SQLiteBatchSize)
+	case settings.ParquetGroupSize <= 0:
+		return nil, errors.Errorf("invalid parquet-row-group-size %d, must be positive", settings.ParquetGroupSize)
+	}
+	if _, err := parquetformatter.ParseCompression(settings.ParquetCompress); err != nil {
+		return nil, err
+	}
+	// the script is run last, so that its state isn't left open when
+	// another setting is invalid
+	settings.LuaScript = strings.TrimSpace(settings.LuaScript)
+	if settings.LuaScript != "" {
+		if _, err := settings.loadLuaScript(); err != nil {
+			return nil, err
+		}
+		settings.luaInUse = false
+	}
+	return settings, nil
+}
+
+// outputFile returns the --output-file of the binary formats, or "" if s is
+// nil.
+func (s *GlazedProcessingSettings) outputFile() string {
+	if s == nil {
+		return ""
+	}
+	return s.OutputFile
+}
+
+// RequiresTable returns true if the configured processing has to see the full
+// table before rows can be serialized.
+func (s *GlazedProcessingSettings) RequiresTable() bool {
+	return s != nil && (s.ReshapesTable() || len(s.SortBy) > 0 && !s.sortsExternally())
+}
+
+// topN returns the number of rows a top-N middleware has to keep to implement
+// --sort-by followed by a cap of maxOutputRows, or 0 if the sort has to be done
+// in full. Reshaped tables are always sorted in full.
+func (s *GlazedProcessingSettings) topN(maxOutputRows int) int {
+	if s == nil || len(s.SortBy) == 0 || s.ReshapesTable() {
+		return 0
+	}
+	return maxOutputRows
+}
+
+// requiresTable is RequiresTable once --max-output-rows is known: sorting
+// with a cap doesn't need the full table.
+func (s *GlazedProcessingSettings) requiresTable(maxOutputRows int) bool {
+	return s.RequiresTable() && s.topN(maxOutputRows) == 0
+}
+
+// sortsExternally returns true if --sort-by is done by a row middleware that
+// spills to disk instead of a table middleware. Reshaped tables are always
+// sorted in memory.
+func (s *GlazedProcessingSettings) sortsExternally() bool {
+	return len(s.SortBy) > 0 && s.SortMemoryMB > 0 && !s.ReshapesTable()
+}
+
+// ReshapesTable returns true if the table stages replace the input rows with
+// rows that have different or additional columns, so that projections have to
+// run after them.
+func (s *GlazedProcessingSettings) ReshapesTable() bool {
+	return s != nil && (len(s.Unpivot) > 0 || s.groups() || s.Resample != "" || s.Pivot != "" || len(s.Window) > 0 || s.Describe ||
+		s.pipelineReshapesTable() || s.luaReshapesTable())
+}
+
+// pipelineReshapesTable returns true if the --pipeline file has table stages.
+// Settings that weren't decoded haven't loaded the file yet, in which case
+// its table stages are assumed to reshape the table.
+func (s *GlazedProcessingSettings) pipelineReshapesTable() bool {
+	if s.Pipeline == "" {
+		return false
+	}
+	return s.loadedPipeline == nil || len(s.loadedPipeline.Table) > 0
+}
+
+// luaReshapesTable returns true if --lua-script defines a table function. As
+// for --pipeline, a script that wasn't loaded yet is assumed to define one.
+func (s *GlazedProcessingSettings) luaReshapesTable() bool {
+	if s.LuaScript == "" {
+		return false
+	}
+	return s.loadedLua == nil || s.loadedLua.HasTableFunction()
+}
+
+// loadLuaScript returns the script loaded when decoding the settings, or runs
+// --lua-script again if middlewares were already created from it, so that
+// every processor has its own Lua state.
+func (s *GlazedProcessingSettings) loadLuaScript() (*lua.Script, error) {
+	if s.loadedLua == nil || s.luaInUse {
+		script, err := lua.LoadScript(s.LuaScript, s.LuaRowFunction, s.LuaTableFunction)
+		if err != nil {
+			return nil, err
+		}
+		s.loadedLua = script
+	}
+	s.luaInUse = true
+	return s.loadedLua, nil
+}
+
+// closeLuaScript closes the state of the last loaded script, whose
+// middlewares won't be closed if setting up the processor failed.
+func (s *GlazedProcessingSettings) closeLuaScript() {
+	if s != nil && s.loadedLua != nil {
+		s.loadedLua.Close()
+	}
+}
+
+// loadPipeline loads the --pipeline file and validates its stages against
+// pipeline.DefaultRegistry.
+func (s *GlazedProcessingSettings) loadPipeline() (*pipeline.Pipeline, error) {
+	if s.loadedPipeline != nil {
+		return s.loadedPipeline, nil
+	}
+	p, err := pipeline.LoadPipeline(s.Pipeline)
+	if err != nil {
+		return nil, err
+	}
+	if err := pipeline.DefaultRegistry.Validate(p); err != nil {
+		return nil, errors.Wrapf(err, "invalid pipeline file %s", s.Pipeline)
+	}
+	s.loadedPipeline = p
+	return p, nil
+}
+
+func (s *GlazedProcessingSettings) groups() bool {
+	return len(s.GroupBy) > 0 || len(s.Aggregations) > 0
+}
+
+// coercions parses --coerce and applies the --coerce-errors and
+// --coerce-column-errors policies.
+func (s *GlazedProcessingSettings) coercions() ([]row.Coercion, error) {
+	coercions, err := row.ParseCoercions(s.Coerce...)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid coerce")
+	}
+	policy := row.CoerceFail
+	if s.CoerceErrors != "" {
+		policy, err = row.ParseCoerceErrorPolicy(s.CoerceErrors)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid coerce-errors")
+		}
+	}
+
+	columnPolicies := map[string]row.CoerceErrorPolicy{}
+	for column, name := range s.CoerceColErrors {
+		p, err := row.ParseCoerceErrorPolicy(name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid coerce-column-errors for column %s", column)
+		}
+		columnPolicies[column] = p
+	}
+
+	for i := range coercions {
+		coercions[i].OnError = policy
+		if p, ok := columnPolicies[coercions[i].Column]; ok {
+			coercions[i].OnError = p
+			delete(columnPolicies, coercions[i].Column)
+		}
+	}
+	for _, column := range sortedKeys(s.CoerceColErrors) {
+		if _, ok := columnPolicies[column]; ok {
+			return nil, errors.Errorf("coerce-column-errors refers to column %s, which is not coerced", column)
+		}
+	}
+	return coercions, nil
+}
+
+// redactMiddleware returns the middleware implementing --redact and
+// --redact-regexp, or nil if no column is redacted.
+func (s *GlazedProcessingSettings) redactMiddleware() (*row.RedactMiddleware, error) {
+	if len(s.Redact) == 0 && len(s.RedactRegexp) == 0 {
+		if s.RedactKey != "" || s.RedactFormats {
+			return nil, errors.New("--redact-key and --redact-format-preserving require --redact or --redact-regexp")
+		}
+		return nil, nil
+	}
+
+	options := []row.RedactOption{
+		row.WithRedactKey([]byte(s.RedactKey)),
+		row.WithFormatPreserving(s.RedactFormats),
+	}
+	for _, column := range sortedKeys(s.Redact) {
+		redaction, err := row.ParseRedaction(s.Redact[column])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid redact for column %s", column)
+		}
+		options = append(options, row.WithRedactColumn(column, redaction))
+	}
+	for _, pattern := range sortedKeys(s.RedactRegexp) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid redact-regexp %s", pattern)
+		}
+		redaction, err := row.ParseRedaction(s.RedactRegexp[pattern])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid redact-regexp %s", pattern)
+		}
+		options = append(options, row.WithRedactRegexp(re, redaction))
+	}
+	return row.NewRedactMiddleware(options...)
+}
+
+// location returns the --time-zone location, UTC if it is empty.
+func (s *GlazedProcessingSettings) location() (*time.Location, error) {
+	location, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid time-zone")
+	}
+	return location, nil
+}
+
+// resampleMiddleware resamples --resample into the --group-by series, with the
+// --agg aggregations.
+func (s *GlazedProcessingSettings) resampleMiddleware() (*table.ResampleMiddleware, error) {
+	column, bucketSpec, ok := strings.Cut(s.Resample, ":")
+	column = strings.TrimSpace(column)
+	if !ok || column == "" {
+		return nil, errors.Errorf("invalid resample %q, expected column:bucket", s.Resample)
+	}
+	bucket, err := row.ParseTimeBucket(bucketSpec)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid resample")
+	}
+	aggregations, err := table.ParseAggregations(s.Aggregations...)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid agg")
+	}
+	fill := table.ResampleFillNull
+	if s.ResampleFill != "" {
+		fill, err = table.ParseResampleFill(s.ResampleFill)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid resample-fill")
+		}
+	}
+	location, err := s.location()
+	if err != nil {
+		return nil, err
+	}
+	return table.NewResampleMiddleware(
+		column,
+		bucket,
+		table.WithResampleSeries(s.GroupBy...),
+		table.WithResampleAggregations(aggregations...),
+		table.WithResampleFill(fill),
+		table.WithResampleLocation(location),
+	), nil
+}
+
+func (s *GlazedProcessingSettings) pivotMiddleware() (*table.PivotMiddleware, error) {
+	key, value, ok := strings.Cut(s.Pivot, ":")
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+	if !ok || key == "" || value == "" {
+		return nil, errors.Errorf("invalid pivot %q, expected key_column:value_column", s.Pivot)
+	}
+	agg, err := table.ParsePivotAggregation(strings.TrimSpace(s.PivotAgg), value)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid pivot-agg")
+	}
+	return table.NewPivotMiddleware(key, value, table.WithPivotAggregation(agg)), nil
+}
+
+// joinMiddleware loads --join-file and joins the rows with it on --join-on.
+func (s *GlazedProcessingSettings) joinMiddleware() (*row.JoinMiddleware, error) {
+	keys, err := row.ParseJoinKeys(s.JoinOn...)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid join-on")
+	}
+	lookup, err := row.LoadDataset(s.JoinFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not load join file")
+	}
+	options := []row.JoinOption{row.WithConflictPrefix(s.JoinPrefix)}
+	if s.JoinType != "" {
+		options = append(options, row.WithJoinType(row.JoinType(s.JoinType)))
+	}
+	return row.NewJoinMiddleware(lookup.Rows, keys, options...)
+}
+
+// addRowMiddlewares appends the row-level processing stages to the processor,
+// in the following order:
+//
+//	join, lua, explode, flatten, rename, replace, coerce, time-bucket, add-fields, template-field, where, filter/regex-filter, remove-duplicates, distinct, sample, pipeline, redact, sort-by
+//
+// Rows are joined first, on the input column names, so that every later stage
+// sees the lookup columns, and the row function of --lua-script sees the rows
+// as they were read. Its table function is added here as well, as the first
+// table stage, so that both functions share the state of the script. Lists are
+// exploded next so that flatten
+// sees the exploded elements. Renames
+// run early so that every later stage refers to the final column names,
+// coercions run before the stages comparing values, times are bucketed once
+// coerced, and where runs before filter so that expressions can use filtered
+// columns. Rows are sampled once they have been filtered and deduplicated.
+// Columns are redacted after every other row stage, so that no table stage
+// sees their original values.
+// The object stages of --pipeline are added in front of all row stages, as the
+// processor always runs object middlewares first.
+// sort-by is only a row stage when the output is capped to maxOutputRows,
+// which keeps the top rows in a bounded heap, or when --sort-memory-mb is set.
+func (s *GlazedProcessingSettings) addRowMiddlewares(processor *middlewares.TableProcessor, maxOutputRows int) error {
+	if s.JoinFile != "" {
+		mw, err := s.joinMiddleware()
+		if err != nil {
+			return err
+		}
+		processor.AddRowMiddleware(mw)
+	}
+
+	if s.LuaScript != "" {
+		script, err := s.loadLuaScript()
+		if err != nil {
+			return err
+		}
+		if mw := script.RowMiddleware(); mw != nil {
+			processor.AddRowMiddleware(mw)
+		}
+		if mw := script.TableMiddleware(); mw != nil {
+			processor.AddTableMiddleware(mw)
+		}
+	}
+
+	for _, field := range s.Explode {
+		options := []row.ExplodeOption{}
+		if s.ExplodeIndex {
+			options = append(options, row.WithIndexColumn(field+"_index"))
+		}
+		processor.AddRowMiddleware(row.NewExplodeMiddleware(field, options...))
+	}
+
+	if s.Flatten {
+		processor.AddRowMiddleware(row.NewFlattenObjectMiddleware())
+	}
+
+	if len(s.Rename) > 0 || len(s.RenameRegexp) > 0 {
+		renames := map[types.FieldName]types.FieldName{}
+		for from, to := range s.Rename {
+			renames[from] = to
+		}
+		regexpRenames := row.RegexpReplacements{}
+		for _, pattern := range sortedKeys(s.RenameRegexp) {
+			regexpRenames = append(regexpRenames, &row.RegexpReplacement{
+				Regexp:      regexp.MustCompile(pattern),
+				Replacement: s.RenameRegexp[pattern],
+			})
+		}
+		processor.AddRowMiddleware(row.NewRenameColumnMiddleware(renames, regexpRenames))
+	}
+
+	if s.RenameYAML != "" {
+		f, err := os.Open(s.RenameYAML)
+		if err != nil {
+			return errors.Wrapf(err, "could not open rename file %s", s.RenameYAML)
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		mw, err := row.NewRenameColumnMiddlewareFromYAML(yaml.NewDecoder(f))
+		if err != nil {
+			return errors.Wrapf(err, "could not parse rename file %s", s.RenameYAML)
+		}
+		processor.AddRowMiddleware(mw)
+	}
+
+	if s.ReplaceFile != "" {
+		b, err := os.ReadFile(s.ReplaceFile)
+		if err != nil {
+			return errors.Wrapf(err, "could not read replace file %s", s.ReplaceFile)
+		}
+		mw, err := row.NewReplaceMiddlewareFromYAML(b)
+		if err != nil {
+			return errors.Wrapf(err, "could not parse replace file %s", s.ReplaceFile)
+		}
+		processor.AddRowMiddleware(mw)
+	}
+
+	if len(s.Coerce) > 0 {
+		coercions, err := s.coercions()
+		if err != nil {
+			return err
+		}
+		processor.AddRowMiddleware(row.NewCoerceMiddleware(coercions...))
+	}
+
+	if len(s.TimeBucket) > 0 {
+		columns, err := row.ParseTimeBucketColumns(s.TimeBucket...)
+		if err != nil {
+			return errors.Wrap(err, "invalid time-bucket")
+		}
+		location, err := s.location()
+		if err != nil {
+			return err
+		}
+		processor.AddRowMiddleware(row.NewTimeBucketMiddleware(columns, row.WithTimeBucketLocation(location)))
+	}
+
+	if len(s.AddFields) > 0 {
+		processor.AddRowMiddleware(row.NewAddFieldMiddleware(s.AddFields))
+	}
+
+	if len(s.TemplateFields) > 0 {
+		templates := map[types.FieldName]string{}
+		for column, template := range s.TemplateFields {
+			templates[column] = template
+		}
+		mw, err := row.NewTemplateMiddleware(templates, "_")
+		if err != nil {
+			return errors.Wrap(err, "could not parse template-field")
+		}
+		processor.AddRowMiddleware(mw)
+	}
+
+	if s.Where != "" {
+		mw, err := row.NewWhereMiddleware(s.Where)
+		if err != nil {
+			return errors.Wrap(err, "invalid where expression")
+		}
+		processor.AddRowMiddleware(mw)
+	}
+
+	if len(s.Filter) > 0 || len(s.RegexFilter) > 0 {
+		processor.AddRowMiddleware(row.NewFieldsFilterMiddleware(
+			row.WithFilters(s.Filter),
+			row.WithRegexFilters(s.RegexFilter),
+		))
+	}
+
+	if len(s.RemoveDuplicates) > 0 {
+		processor.AddRowMiddleware(row.NewRemoveDuplicatesMiddleware(s.RemoveDuplicates...))
+	}
+
+	if s.Distinct {
+		processor.AddRowMiddleware(row.NewDistinctMiddleware(
+			s.DistinctOn,
+			row.WithDistinctMemoryBudget(s.DistinctMemoryMB*1024*1024),
+		))
+	}
+
+	seed := int64(s.SampleSeed)
+	switch {
+	case s.Sample > 0:
+		processor.AddRowMiddleware(row.NewReservoirSampleMiddleware(s.Sample, seed))
+	case s.SamplePercent > 0 && len(s.SampleKey) > 0:
+		processor.AddRowMiddleware(row.NewHashSampleMiddleware(s.SampleKey, s.SamplePercent/100, seed))
+	case s.SamplePercent > 0:
+		processor.AddRowMiddleware(row.NewBernoulliSampleMiddleware(s.SamplePercent/100, seed))
+	}
+
+	if s.Pipeline != "" {
+		p, err := s.loadPipeline()
+		if err != nil {
+			return err
+		}
+		objects, err := pipeline.DefaultRegistry.ObjectMiddlewares(p)
+		if err != nil {
+			return err
+		}
+		rows, err := pipeline.DefaultRegistry.RowMiddlewares(p)
+		if err != nil {
+			return err
+		}
+		processor.AddObjectMiddleware(objects...)
+		processor.AddRowMiddleware(rows...)
+	}
+
+	mw, err := s.redactMiddleware()
+	if err != nil {
+		return err
+	}
+	if mw != nil {
+		processor.AddRowMiddleware(mw)
+	}
+
+	if n := s.topN(maxOutputRows); n > 0 {
+		processor.AddRowMiddleware(table.NewTopNMiddlewareFromColumns(n, s.SortBy...))
+	} else if s.sortsExternally() {
+		processor.AddRowMiddleware(table.NewExternalSortByMiddlewareFromColumns(
+			s.SortBy,
+			table.WithMemoryBudget(s.SortMemoryMB*1024*1024),
+		))
+	}
+
+	return nil
+}
+
+// addTableMiddlewares appends the table-level processing stages to the processor,
+// in the following order:
+//
+//	lua, unpivot, group-by/agg or resample, pivot, window, describe, pipeline, sort-by
+//
+// where the table function of --lua-script is added by addRowMiddlewares, so that melted columns can be aggregated, or resampled, aggregates can be pivoted, window
+// columns can be computed over the aggregates, the result can be profiled or
+// processed further by the table stages of --pipeline, and the final rows can
+// be sorted by any of the resulting columns.
+func (s *GlazedProcessingSettings) addTableMiddlewares(processor *middlewares.TableProcessor, maxOutputRows int) error {
+	if len(s.Unpivot) > 0 {
+		processor.AddTableMiddleware(table.NewUnpivotMiddleware(s.Unpivot))
+	}
+
+	if s.Resample != "" {
+		mw, err := s.resampleMiddleware()
+		if err != nil {
+			return err
+		}
+		processor.AddTableMiddleware(mw)
+	} else if s.groups() {
+		mw, err := table.NewGroupByMiddlewareFromSpecs(s.GroupBy, s.Aggregations...)
+		if err != nil {
+			return errors.Wrap(err, "invalid agg")
+		}
+		processor.AddTableMiddleware(mw)
+	}
+
+	if s.Pivot != "" {
+		mw, err := s.pivotMiddleware()
+		if err != nil {
+			return err
+		}
+		processor.AddTableMiddleware(mw)
+	}
+
+	if len(s.Window) > 0 {
+		columns, err := table.ParseWindowColumns(s.Window...)
+		if err != nil {
+			return errors.Wrap(err, "invalid window")
+		}
+		processor.AddTableMiddleware(table.NewWindowMiddleware(
+			columns,
+			table.WithWindowPartitionBy(s.PartitionBy...),
+			table.WithWindowOrderBy(s.WindowOrderBy...),
+		))
+	}
+
+	if s.Describe {
+		options := []table.DescribeOption{table.WithDescribeTopValues(s.DescribeTop)}
+		if s.DescribeApprox {
+			options = append(options, table.WithApproximateDistinct())
+		}
+		processor.AddTableMiddleware(table.NewDescribeMiddleware(options...))
+	}
+
+	if s.Pipeline != "" {
+		p, err := s.loadPipeline()
+		if err != nil {
+			return err
+		}
+		tables, err := pipeline.DefaultRegistry.TableMiddlewares(p)
+		if err != nil {
+			return err
+		}
+		processor.AddTableMiddleware(tables...)
+	}
+
+	if len(s.SortBy) > 0 && !s.sortsExternally() && s.topN(maxOutputRows) == 0 {
+		processor.AddTableMiddleware(table.NewSortByMiddlewareFromColumns(s.SortBy...))
+	}
+
+	return nil
+}
+
+// addUnflattenMiddleware appends --unflatten after every other stage,
+// including the --output-fields projection and the --max-output-rows cap, so
+// that they can all refer to the dotted column names.
+func (s *GlazedProcessingSettings) addUnflattenMiddleware(processor *middlewares.TableProcessor, requiresTable bool) {
+	if s == nil || !s.Unflatten {
+		return
+	}
+	if requiresTable {
+		processor.AddTableMiddleware(table.NewUnflattenObjectMiddleware(s.UnflattenSep))
+	} else {
+		processor.AddRowMiddleware(row.NewUnflattenObjectMiddleware(s.UnflattenSep))
+	}
+}
+
+func normalizeStringList(list []string) []string {
+	ret := make([]string, 0, len(list))
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		ret = append(ret, s)
+	}
+	return ret
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,635 @@
+package settings
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/sources"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares/table"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseStructuredAndProcessingValues(
+	t *testing.T,
+	structuredArgs []string,
+	processingArgs ...string,
+) *values.Values {
+	t.Helper()
+	processingSection, err := NewGlazedProcessingSection()
+	require.NoError(t, err)
+
+	schema_ := schema.NewSchema(schema.WithSections(processingSection))
+	parsedValues := values.New()
+	err = sources.Execute(
+		schema_,
+		parsedValues,
+		sources.UpdateFromStringList("", processingArgs, fields.WithSource("test")),
+		sources.FromDefaults(fields.WithSource(fields.SourceDefaults)),
+	)
+	require.NoError(t, err)
+
+	parsedValues.Set(StructuredOutputSlug, parseStructuredOutputSection(t, []schema.SectionOption{WithFileOutputFormats()}, structuredArgs...))
+	return parsedValues
+}
+
+func runStructuredOutputFromValues(t *testing.T, parsedValues *values.Values, rows ...types.Row) string {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	processor, _, err := SetupStructuredOutputFromValues(parsedValues, buf)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	for _, row_ := range rows {
+		require.NoError(t, processor.AddRow(ctx, row_))
+	}
+	require.NoError(t, processor.Close(ctx))
+	return buf.String()
+}
+
+func TestGlazedProcessingSettingsDefaults(t *testing.T) {
+	parsedValues := parseStructuredAndProcessingValues(t, nil)
+	sectionValues, ok := parsedValues.Get(GlazedProcessingSlug)
+	require.True(t, ok)
+
+	settings, err := DecodeGlazedProcessingSettings(sectionValues)
+	require.NoError(t, err)
+	assert.False(t, settings.Flatten)
+	assert.Empty(t, settings.Filter)
+	assert.Empty(t, settings.SortBy)
+	assert.False(t, settings.RequiresTable())
+}
+
+func TestGlazedProcessingRejectsInvalidRegexFilter(t *testing.T) {
+	parsedValues := parseStructuredAndProcessingValues(t, nil, "--regex-filter", "a(")
+	_, _, err := SetupStructuredOutputFromValues(parsedValues, &bytes.Buffer{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid regex-filter pattern")
+}
+
+func TestGlazedProcessingRenamesFiltersAndAddsFields(t *testing.T) {
+	parsedValues := parseStructuredAndProcessingValues(
+		t,
+		[]string{"--format", "csv"},
+		"--rename", "name:person",
+		"--filter", "internal",
+		"--add-fields", "team:core",
+		"--template-field", "label={{ .person }}-{{ .id }}",
+	)
+	out := runStructuredOutputFromValues(t, parsedValues,
+		types.NewRow(types.MRP("id", 1), types.MRP("name", "Ada"), types.MRP("internal", true)),
+	)
+	assert.Equal(t, "id,person,team,label\n1,Ada,core,Ada-1\n", out)
+}
+
+func TestGlazedProcessingSortsBeforeCapping(t *testing.T) {
+	parsedValues := parseStructuredAndProcessingValues(
+		t,
+		[]string{"--format", "jsonl", "--max-output-rows", "2"},
+		"--sort-by", "-id",
+	)
+	out := runStructuredOutputFromValues(t, parsedValues,
+		types.NewRow(types.MRP("id", 1)),
+		types.NewRow(types.MRP("id", 3)),
+		types.NewRow(types.MRP("id", 2)),
+	)
+	assert.Equal(t, "{\"id\":3}\n{\"id\":2}\n", out)
+}
+
+func TestGlazedProcessingRemovesDuplicatesBeforeProjection(t *testing.T) {
+	parsedValues := parseStructuredAndProcessingValues(
+		t,
+		[]string{"--format", "csv", "--output-fields", "name"},
+		"--remove-duplicates", "team",
+	)
+	out := runStructuredOutputFromValues(t, parsedValues,
+		types.NewRow(types.MRP("name", "Ada"), types.MRP("team", "a")),
+		types.NewRow(types.MRP("name", "Grace"), types.MRP("team", "a")),
+		types.NewRow(types.MRP("name", "Katherine"), types.MRP("team", "b")),
+	)
+	assert.Equal(t, "name\nAda\nKatherine\n", out)
+}
+
+func TestStructuredOutputFromValuesWithoutProcessingSection(t *testing.T) {
+	sectionValues := parseStructuredOutputSettings(t, "--format", "jsonl")
+	parsedValues := values.New(values.WithSectionValues(StructuredOutputSlug, sectionValues))
+	out := runStructuredOutputFromValues(t, parsedValues, types.NewRow(types.MRP("id", 1)))
+	assert.Equal(t, "{\"id\":1}\n", out)
+}
+
+func TestGlazedProcessingWhereFiltersRows(t *testing.T) {
+	parsedValues := parseStructuredAndProcessingValues(
+		t,
+		[]string{"--format", "csv", "--output-fields", "name"},
+		"--where", `status == "failed" && duration > 30`,
+	)
+	out := runStructuredOutputFromValues(t, parsedValues,
+		types.NewRow(types.MRP("name", "build"), types.MRP("status", "failed"), types.MRP("duration", 45)),
+		types.NewRow(types.MRP("name", "lint"), types.MRP("status", "failed"), types.MRP("duration", 3)),
+		types.NewRow(types.MRP("name", "test"), types.MRP("status", "ok"), types.MRP("duration", 120)),
+	)
+	assert.Equal(t, "name\nbuild\n", out)
+}
+
+func TestGlazedProcessingRejectsInvalidWhere(t *testing.T) {
+	parsedValues := parseStructuredAndProcessingValues(t, nil, "--where", "status == ")
+	_, _, err := SetupStructuredOutputFromValues(parsedValues, &bytes.Buffer{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid where expression: parse error at column 10")
+}
+
+func TestGlazedProcessingGroupsAndSortsByAggregate(t *testing.T) {
+	parsedValues := parseStructuredAndProcessingValues(
+		t,
+		[]string{"--format", "csv", "--output-fields", "team,sum_cost"},
+		"--group-by", "team",
+		"--agg", "count,sum:cost",
+		"--sort-by", "-sum_cost",
+	)
+	out := runStructuredOutputFromValues(t, parsedValues,
+		types.NewRow(types.MRP("team", "web"), types.MRP("cost", 5)),
+		types.NewRow(types.MRP("team", "infra"), types.MRP("cost", 10)),
+		types.NewRow(types.MRP("team", "infra"), types.MRP("cost", 30)),
+	)
+	assert.Equal(t, "team,sum_cost\ninfra,40\nweb,5\n", out)
+}
+
+func TestGlazedProcessingRejectsInvalidAgg(t *testing.T) {
+	parsedValues := parseStructuredAndProcessingValues(t, nil, "--group-by", "team", "--agg", "total:cost")
+	_, _, err := SetupStructuredOutputFromValues(parsedValues, &bytes.Buffer{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid agg: unknown aggregate function "total"`)
+}
+
+func TestGlazedProcessingSortsByColumnsThatAreNotOutput(t *testing.T) {
+	parsedValues := parseStructuredAndProcessingValues(
+		t,
+		[]string{"--format", "csv", "--output-fields", "name"},
+		"--sort-by", "-id",
+	)
+	out := runStructuredOutputFromValues(t, parsedValues,
+		types.NewRow(types.MRP("id", 1), types.MRP("name", "Ada")),
+		types.NewRow(types.MRP("id", 2), types.MRP("name", "Grace")),
+	)
+	assert.Equal(t, "name\nGrace\nAda\n", out)
+}
+
+func TestGlazedProcessingSortsExternallyWithMemoryBudget(t *testing.T) {
+	parsedValues := parseStructuredAndProcessingValues(
+		t,
+		[]string{"--format", "jsonl", "--output-fields", "name"},
+		"--sort-by", "-id",
+		"--sort-memory-mb", "1",
+	)
+	sectionValues, ok := parsedValues.Get(GlazedProcessingSlug)
+	require.True(t, ok)
+	settings, err := DecodeGlazedProcessingSettings(sectionValues)
+	require.NoError(t, err)
+	assert.False(t, settings.RequiresTable())
+
+	out := runStructuredOutputFromValues(t, parsedValues,
+		types.NewRow(types.MRP("id", 1), types.MRP("name", "Ada")),
+		types.NewRow(types.MRP("id", 3), types.MRP("name", "Katherine")),
+		types.NewRow(types.MRP("id", 2), types.MRP("name", "Grace")),
+	)
+	assert.Equal(t, "{\"name\":\"Katherine\"}\n{\"name\":\"Grace\"}\n{\"name\":\"Ada\"}\n", out)
+}
+
+func TestGlazedProcessingUsesTopNForSortAndCap(t *testing.T) {
+	parsedValues := parseStructuredAndProcessingValues(
+		t,
+		[]string{"--format", "table", "--max-output-rows", "2"},
+		"--sort-by", "-id",
+	)
+	processor, _, err := SetupStructuredProcessorFromValues(parsedValues)
+	require.NoError(t, err)
+	require.Empty(t, processor.TableMiddlewares)
+	require.Len(t, processor.RowMiddlewares, 1)
+	assert.IsType(t, &table.TopNMiddleware{}, processor.RowMiddlewares[0])
+
+	parsedValues = parseStructuredAndProcessingValues(
+		t,
+		[]string{"--format", "csv", "--max-output-rows", "2", "--output-fields", "name"},
+		"--sort-by", "-id",
+	)
+	out := runStructuredOutputFromValues(t, parsedValues,
+		types.NewRow(types.MRP("id", 1), types.MRP("name", "Ada")),
+		types.NewRow(types.MRP("id", 3), types.MRP("name", "Katherine")),
+		types.NewRow(types.MRP("id", 2), types.MRP("name", "Grace")),
+	)
+	assert.Equal(t, "name\nKatherine\nGrace\n", out)
+}
+
+func TestGlazedProcessingUnpivotsAndPivots(t *testing.T) {
+	parsedValues := parseStructuredAndProcessingValues(
+		t,
+		[]string{"--format", "csv"},
+		"--unpivot", "jan,feb",
+		"--group-by", "key",
+		"--agg", "sum:value",
+		"--pivot", "key:sum_value",
+	)
+	out := runStructuredOutputFromValues(t, parsedValues,
+		types.NewRow(types.MRP("team", "infra"), types.MRP("jan", 10), types.MRP("feb", 20)),
+		types.NewRow(types.MRP("team", "web"), types.MRP("jan", 5), types.MRP("feb", 7)),
+	)
+	assert.Equal(t, "jan,feb\n15,27\n", out)
+}
+
+func TestGlazedProcessingRejectsInvalidPivot(t *testing.T) {
+	parsedValues := parseStructuredAndProcessingValues(t, nil, "--pivot", "month")
+	_, _, err := SetupStructuredOutputFromValues(parsedValues, &bytes.Buffer{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid pivot "month", expected key_column:value_column`)
+
+	parsedValues = parseStructuredAndProcessingValues(t, nil, "--pivot", "month:cost", "--pivot-agg", "total")
+	_, _, err = SetupStructuredOutputFromValues(parsedValues, &bytes.Buffer{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid pivot-agg")
+}
+
+func TestGlazedProcessingExplodesBeforeFlattening(t *testing.T) {
+	parsedValues := parseStructuredAndProcessingValues(
+		t,
+		[]string{"--format", "csv"},
+		"--explode", "items",
+		"--explode-index",
+		"--flatten",
+	)
+	out := runStructuredOutputFromValues(t, parsedValues,
+		types.NewRow(types.MRP("order", 1), types.MRP("items", []interface{}{
+			map[string]interface{}{"sku": "a", "price": map[string]interface{}{"amount": 3}},
+			map[string]interface{}{"sku": "b", "price": map[string]interface{}{"amount": 4}},
+		})),
+	)
+	assert.Equal(t, "order,items_index,items.price.amount,items.sku\n1,0,3,a\n1,1,4,b\n", out)
+}
+
+func TestGlazedProcessingExplodesObjectsForCSVWithoutFlatten(t *testing.T) {
+	parsedValues := parseStructuredAndProcessingValues(t, []string{"--format", "csv"}, "--explode", "items")
+	out := runStructuredOutputFromValues(t, parsedValues,
+		types.NewRow(types.MRP("order", 1), types.MRP("items", []interface{}{
+			map[string]interface{}{"sku": "a", "dim": map[string]interface{}{"w": 1}},
+		})),
+	)
+	assert.Equal(t, "order,items.dim.w,items.sku\n1,1,a\n", out)
+}
+
+func TestGlazedProcessingUnflattensAfterSortAndProjection(t *testing.T) {
+	parsedValues := parseStructuredAndProcessingValues(
+		t,
+		[]string{"--format", "json", "--output-fields", "id,user.name,tags.0,tags.1"},
+		"--unflatten",
+		"--sort-by", "-user.age",
+	)
+	out := runStructuredOutputFromValues(t, parsedValues,
+		types.NewRow(types.MRP("id", 1), types.MRP("user.name", "ada"), types.MRP("user.age", 36), types.MRP("tags.0", "a"), types.MRP("tags.1", "b")),
+		types.NewRow(types.MRP("id", 2), types.MRP("user.name", "grace"), types.MRP("user.age", 85), types.MRP("tags.0", "c"), types.MRP("tags.1", "d")),
+	)
+	assert.JSONEq(t, `[
+		{"id": 2, "user": {"name": "grace"}, "tags": ["c", "d"]},
+		{"id": 1, "user": {"name": "ada"}, "tags": ["a", "b"]}
+	]`, out)
+}
+
+func TestGlazedProcessingUnflattensRowsWithSeparator(t *testing.T) {
+	parsedValues := parseStructuredAndProcessingValues(
+		t,
+		[]string{"--format", "yaml"},
+		"--unflatten",
+		"--unflatten-separator", "/",
+	)
+	out := runStructuredOutputFromValues(t, parsedValues,
+		types.NewRow(types.MRP("id", 1), types.MRP("user/name", "ada"), types.MRP("user/langs/0", "go")),
+	)
+	assert.Equal(t, "- id: 1\n  user:\n    name: ada\n    langs:\n        - go\n", out)
+}
+
+func TestGlazedProcessingComputesWindowColumns(t *testing.T) {
+	parsedValues := parseStructuredAndProcessingValues(
+		t,
+		[]string{"--format", "csv", "--output-fields", "team,day,running_sum_cost,pct", "--max-output-rows", "3"},
+		"--window", "running_sum:cost,percent_of_total:cost=pct",
+		"--partition-by", "team",
+		"--window-order-by", "day",
+		"--sort-by", "team,day",
+	)
+	out := runStructuredOutputFromValues(t, parsedValues,
+		types.NewRow(types.MRP("team", "web"), types.MRP("day", 1), types.MRP("cost", 5)),
+		types.NewRow(types.MRP("team", "infra"), types.MRP("day", 2), types.MRP("cost", 30)),
+		types.NewRow(types.MRP("team", "infra"), types.MRP("day", 1), types.MRP("cost", 10)),
+	)
+	assert.Equal(t, "team,day,running_sum_cost,pct\ninfra,1,10,25\ninfra,2,40,75\nweb,1,5,100\n", out)
+}
+
+func TestGlazedProcessingRejectsInvalidWindow(t *testing.T) {
+	parsedValues := parseStructuredAndProcessingValues(t, nil, "--window", "rank:cost")
+	_, _, err := SetupStructuredOutputFromValues(parsedValues, &bytes.Buffer{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid window")
+
+	parsedValues = parseStructuredAndProcessingValues(t, nil, "--partition-by", "team")
+	_, _, err = SetupStructuredOutputFromValues(parsedValues, &bytes.Buffer{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "require --window")
+}
+
+func TestGlazedProcessingDescribesColumns(t *testing.T) {
+	parsedValues := parseStructuredAndProcessingValues(
+		t,
+		[]string{"--format", "csv", "--output-fields", "column,type,nulls,distinct,top"},
+		"--describe",
+		"--describe-top", "1",
+		"--sort-by", "column",
+	)
+	out := runStructuredOutputFromValues(t, parsedValues,
+		types.NewRow(types.MRP("team", "web"), types.MRP("cost", "5")),
+		types.NewRow(types.MRP("team", "infra"), types.MRP("cost", nil)),
+		types.NewRow(types.MRP("team", "web"), types.MRP("cost", "7")),
+	)
+	assert.Equal(t, "column,type,nulls,distinct,top\ncost,int,1,2,5 (1)\nteam,string,0,2,web (2)\n", out)
+}
+
+func TestGlazedProcessingCoercesBeforeSorting(t *testing.T) {
+	parsedValues := parseStructuredAndProcessingValues(
+		t,
+		[]string{"--format", "json"},
+		"--coerce", "n:int,day:time:2006-01-02",
+		"--coerce-errors", "null",
+		"--coerce-column-errors", "day:drop",
+		"--sort-by", "n",
+	)
+	out := runStructuredOutputFromValues(t, parsedValues,
+		types.NewRow(types.MRP("n", "10"), types.MRP("day", "2024-01-02")),
+		types.NewRow(types.MRP("n", "9"), types.MRP("day", "2024-01-01")),
+		types.NewRow(types.MRP("n", "x"), types.MRP("day", "2024-01-03")),
+		types.NewRow(types.MRP("n", "1"), types.MRP("day", "yesterday")),
+	)
+	assert.JSONEq(t, `[
+		{"n": 9, "day": "2024-01-01T00:00:00Z"},
+		{"n": 10, "day": "2024-01-02T00:00:00Z"},
+		{"n": null, "day": "2024-01-03T00:00:00Z"}
+	]`, out)
+}
+
+func TestGlazedProcessingRejectsInvalidCoercion(t *testing.T) {
+	parsedValues := parseStructuredAndProcessingValues(t, nil, "--coerce", "n:decimal")
+	_, _, err := SetupStructuredOutputFromValues(parsedValues, &bytes.Buffer{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid coerce")
+
+	parsedValues = parseStructuredAndProcessingValues(t, nil, "--coerce", "n:int", "--coerce-column-errors", "m:null")
+	_, _, err = SetupStructuredOutputFromValues(parsedValues, &bytes.Buffer{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "which is not coerced")
+}
+
+func TestGlazedProcessingSamplesRows(t *testing.T) {
+	rows := make([]types.Row, 0, 100)
+	for i := 0; i < 100; i++ {
+		rows = append(rows, types.NewRow(types.MRP("id", i), types.MRP("user", i%10)))
+	}
+
+	parsedValues := parseStructuredAndProcessingValues(t, []string{"--format", "csv"}, "--sample", "5", "--sample-seed", "3")
+	out := runStructuredOutputFromValues(t, parsedValues, rows...)
+	assert.Len(t, strings.Split(strings.TrimSpace(out), "\n"), 6)
+	assert.Equal(t, out, runStructuredOutputFromValues(t, parsedValues, rows...))
+
+	parsedValues = parseStructuredAndProcessingValues(t, []string{"--format", "csv", "--output-fields", "user"},
+		"--sample-percent", "30", "--sample-key", "user", "--group-by", "user")
+	out = runStructuredOutputFromValues(t, parsedValues, rows...)
+	users := strings.Split(strings.TrimSpace(out), "\n")[1:]
+	assert.NotEmpty(t, users)
+	assert.Less(t, len(users), 10)
+}
+
+func TestGlazedProcessingRejectsInvalidSample(t *testing.T) {
+	for _, args := range [][]string{
+		{"--sample", "-1"},
+		{"--sample-percent", "101"},
+		{"--sample", "1", "--sample-percent", "10"},
+		{"--sample-key", "user"},
+	} {
+		parsedValues := parseStructuredAndProcessingValues(t, nil, args...)
+		_, _, err := SetupStructuredOutputFromValues(parsedValues, &bytes.Buffer{})
+		assert.Error(t, err, args)
+	}
+}
+
+func TestGlazedProcessingRunsPipelineFile(t *testing.T) {
+	pipelineFile := filepath.Join(t.TempDir(), "pipeline.yaml")
+	require.NoError(t, os.WriteFile(pipelineFile, []byte(`
+row:
+  - name: rename
+    options:
+      renames:
+        amount: cost
+table:
+  - name: group-by
+    options:
+      columns: [team]
+      aggregations: [sum:cost]
+`), 0644))
+
+	parsedValues := parseStructuredAndProcessingValues(t, []string{"--format", "csv"},
+		"--pipeline", pipelineFile, "--where", "amount > 1", "--sort-by", "-sum_cost")
+	out := runStructuredOutputFromValues(t, parsedValues,
+		types.NewRow(types.MRP("team", "web"), types.MRP("amount", 1)),
+		types.NewRow(types.MRP("team", "web"), types.MRP("amount", 2)),
+		types.NewRow(types.MRP("team", "infra"), types.MRP("amount", 5)),
+	)
+	assert.Equal(t, "team,sum_cost\ninfra,5\nweb,2\n", out)
+}
+
+func TestGlazedProcessingRejectsInvalidPipeline(t *testing.T) {
+	pipelineFile := filepath.Join(t.TempDir(), "pipeline.yaml")
+	require.NoError(t, os.WriteFile(pipelineFile, []byte("table:\n  - name: where\n"), 0644))
+
+	parsedValues := parseStructuredAndProcessingValues(t, nil, "--pipeline", pipelineFile)
+	_, _, err := SetupStructuredOutputFromValues(parsedValues, &bytes.Buffer{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown stage "where"`)
+
+	parsedValues = parseStructuredAndProcessingValues(t, nil, "--pipeline", filepath.Join(t.TempDir(), "missing.yaml"))
+	_, _, err = SetupStructuredOutputFromValues(parsedValues, &bytes.Buffer{})
+	assert.Error(t, err)
+}
+
+func TestGlazedProcessingDropsNonAdjacentDuplicates(t *testing.T) {
+	rows := []types.Row{
+		types.NewRow(types.MRP("user", "ada"), types.MRP("day", 1)),
+		types.NewRow(types.MRP("user", "bob"), types.MRP("day", 1)),
+		types.NewRow(types.MRP("user", "ada"), types.MRP("day", 2)),
+		types.NewRow(types.MRP("user", "ada"), types.MRP("day", 1)),
+	}
+
+	parsedValues := parseStructuredAndProcessingValues(t, []string{"--format", "csv"}, "--distinct")
+	out := runStructuredOutputFromValues(t, parsedValues, rows...)
+	assert.Equal(t, "user,day\nada,1\nbob,1\nada,2\n", out)
+
+	parsedValues = parseStructuredAndProcessingValues(t, []string{"--format", "csv"}, "--distinct", "--distinct-on", "user")
+	out = runStructuredOutputFromValues(t, parsedValues, rows...)
+	assert.Equal(t, "user,day\nada,1\nbob,1\n", out)
+
+	parsedValues = parseStructuredAndProcessingValues(t, nil, "--distinct-on", "user")
+	_, _, err := SetupStructuredOutputFromValues(parsedValues, &bytes.Buffer{})
+	assert.Error(t, err)
+}
+
+func TestGlazedProcessingBucketsAndResamplesTimes(t *testing.T) {
+	rows := []types.Row{
+		types.NewRow(types.MRP("host", "a"), types.MRP("ts", "2024-03-13T10:05:00Z"), types.MRP("cpu", 10)),
+		types.NewRow(types.MRP("host", "a"), types.MRP("ts", "2024-03-13T10:40:00Z"), types.MRP("cpu", 20)),
+		types.NewRow(types.MRP("host", "a"), types.MRP("ts", "2024-03-13T12:10:00Z"), types.MRP("cpu", 5)),
+	}
+
+	parsedValues := parseStructuredAndProcessingValues(t, []string{"--format", "csv"},
+		"--time-bucket", "ts:day=day", "--time-zone", "America/New_York", "--group-by", "day")
+	out := runStructuredOutputFromValues(t, parsedValues, rows...)
+	assert.Equal(t, "day,count\n2024-03-13 00:00:00 -0400 EDT,3\n", out)
+
+	parsedValues = parseStructuredAndProcessingValues(t, []string{"--format", "csv"},
+		"--resample", "ts:hour", "--group-by", "host", "--agg", "sum:cpu", "--resample-fill", "zero")
+	out = runStructuredOutputFromValues(t, parsedValues, rows...)
+	assert.Equal(t, "ts,host,sum_cpu\n"+
+		"2024-03-13 10:00:00 +0000 UTC,a,30\n"+
+		"2024-03-13 11:00:00 +0000 UTC,a,0\n"+
+		"2024-03-13 12:00:00 +0000 UTC,a,5\n", out)
+}
+
+func TestGlazedProcessingRejectsInvalidTimeBuckets(t *testing.T) {
+	for _, args := range [][]string{
+		{"--time-bucket", "ts:fortnight"},
+		{"--time-zone", "Mars/Olympus_Mons"},
+		{"--resample", "ts"},
+		{"--resample-fill", "zero"},
+	} {
+		parsedValues := parseStructuredAndProcessingValues(t, nil, args...)
+		_, _, err := SetupStructuredOutputFromValues(parsedValues, &bytes.Buffer{})
+		assert.Error(t, err, args)
+	}
+}
+
+func TestGlazedProcessingRedactsColumns(t *testing.T) {
+	parsedValues := parseStructuredAndProcessingValues(t, []string{"--format", "csv"},
+		"--redact", "card:mask,name:truncate:1",
+		"--redact-regexp", "^secret_:drop",
+		"--redact-format-preserving",
+		"--group-by", "name,card",
+	)
+	out := runStructuredOutputFromValues(t, parsedValues,
+		types.NewRow(types.MRP("name", "ada"), types.MRP("card", "4242-4242-4242-4242"), types.MRP("secret_token", "x")),
+		types.NewRow(types.MRP("name", "alan"), types.MRP("card", "4242-4242-4242-4242"), types.MRP("secret_token", "y")),
+	)
+	assert.Equal(t, "name,card,count\na,****-****-****-4242,2\n", out)
+
+	for _, args := range [][]string{
+		{"--redact", "email:hash"},
+		{"--redact", "email:blur"},
+		{"--redact-regexp", "(:mask"},
+		{"--redact-key", "key"},
+	} {
+		parsedValues := parseStructuredAndProcessingValues(t, nil, args...)
+		_, _, err := SetupStructuredOutputFromValues(parsedValues, &bytes.Buffer{})
+		assert.Error(t, err, args)
+	}
+}
+
+func TestGlazedProcessingJoinsLookupFile(t *testing.T) {
+	lookupFile := filepath.Join(t.TempDir(), "teams.csv")
+	require.NoError(t, os.WriteFile(lookupFile, []byte("id,team\n1,infra\n2,web\n"), 0644))
+
+	parsedValues := parseStructuredAndProcessingValues(t, []string{"--format", "csv"},
+		"--join-file", lookupFile, "--join-on", "team_id=id", "--sort-by", "team")
+	out := runStructuredOutputFromValues(t, parsedValues,
+		types.NewRow(types.MRP("name", "deploy"), types.MRP("team_id", 2), types.MRP("team", "ops")),
+		types.NewRow(types.MRP("name", "build"), types.MRP("team_id", 1), types.MRP("team", "dev")),
+		types.NewRow(types.MRP("name", "lint"), types.MRP("team_id", 3), types.MRP("team", "qa")),
+	)
+	assert.Equal(t, "name,team_id,team,join_team\nbuild,1,dev,infra\ndeploy,2,ops,web\n", out)
+}
+
+func TestGlazedProcessingRejectsInvalidJoin(t *testing.T) {
+	for _, args := range [][]string{
+		{"--join-file", "teams.csv"},
+		{"--join-on", "id"},
+		{"--join-file", "teams.csv", "--join-on", "id="},
+		{"--join-file", "teams.csv", "--join-on", "id", "--join-prefix", ""},
+		{"--join-file", filepath.Join(t.TempDir(), "missing.csv"), "--join-on", "id"},
+	} {
+		parsedValues := parseStructuredAndProcessingValues(t, nil, args...)
+		_, _, err := SetupStructuredOutputFromValues(parsedValues, &bytes.Buffer{})
+		assert.Error(t, err, args)
+	}
+}
+
+func TestGlazedProcessingRunsLuaScript(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script.lua")
+	require.NoError(t, os.WriteFile(script, []byte(`
+function process_row(row)
+  row.cost = row.cost * 2
+  return true
+end
+
+function process_table(rows)
+  local ret = {}
+  for _, row in ipairs(rows) do
+    table.insert(ret, { team = row.team, total = row.cost + 1 })
+  end
+  return ret
+end
+`), 0644))
+
+	parsedValues := parseStructuredAndProcessingValues(t, []string{"--format", "csv"},
+		"--lua-script", script, "--sort-by", "-total")
+	rows := []types.Row{
+		types.NewRow(types.MRP("team", "web"), types.MRP("cost", 1)),
+		types.NewRow(types.MRP("team", "infra"), types.MRP("cost", 5)),
+	}
+	out := runStructuredOutputFromValues(t, parsedValues, rows...)
+	assert.Equal(t, "team,total\ninfra,11\nweb,3\n", out)
+	// every processor runs the script in a state of its own
+	assert.Equal(t, out, runStructuredOutputFromValues(t, parsedValues, rows...))
+
+	pipelineFile := filepath.Join(dir, "pipeline.yaml")
+	require.NoError(t, os.WriteFile(pipelineFile, []byte(`
+row:
+  - name: lua
+    options:
+      script: `+script+`
+table:
+  - name: lua
+    options:
+      script: `+script+`
+`), 0644))
+	parsedValues = parseStructuredAndProcessingValues(t, []string{"--format", "csv"}, "--pipeline", pipelineFile)
+	assert.Equal(t, "team,total\nweb,3\ninfra,11\n", runStructuredOutputFromValues(t, parsedValues, rows...))
+}
+
+func TestGlazedProcessingRejectsInvalidLuaScript(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "script.lua")
+	require.NoError(t, os.WriteFile(script, []byte("function other(row) return true end\n"), 0644))
+
+	for _, args := range [][]string{
+		{"--lua-script", script},
+		{"--lua-script", filepath.Join(t.TempDir(), "missing.lua")},
+	} {
+		parsedValues := parseStructuredAndProcessingValues(t, nil, args...)
+		_, _, err := SetupStructuredOutputFromValues(parsedValues, &bytes.Buffer{})
+		assert.Error(t, err, args)
+	}
+
+	parsedValues := parseStructuredAndProcessingValues(t, []string{"--format", "csv"},
+		"--lua-script", script, "--lua-row-function", "other")
+	out := runStructuredOutputFromValues(t, parsedValues, types.NewRow(types.MRP("a", 1)))
+	assert.Equal(t, "a\n1\n", out)
+}
@@ -2,15 +2,21 @@ package settings
 
 import (
 	"io"
+	"slices"
 	"strings"
 
+	"github.com/go-go-golems/glazed/pkg/cmds"
 	"github.com/go-go-golems/glazed/pkg/cmds/fields"
 	"github.com/go-go-golems/glazed/pkg/cmds/schema"
 	"github.com/go-go-golems/glazed/pkg/cmds/values"
 	"github.com/go-go-golems/glazed/pkg/formatters"
 	"github.com/go-go-golems/glazed/pkg/formatters/csv"
+	htmlformatter "github.com/go-go-golems/glazed/pkg/formatters/html"
 	jsonformatter "github.com/go-go-golems/glazed/pkg/formatters/json"
+	parquetformatter "github.com/go-go-golems/glazed/pkg/formatters/parquet"
+	sqliteformatter "github.com/go-go-golems/glazed/pkg/formatters/sqlite"
 	tableformatter "github.com/go-go-golems/glazed/pkg/formatters/table"
+	xlsxformatter "github.com/go-go-golems/glazed/pkg/formatters/xlsx"
 	yamlformatter "github.com/go-go-golems/glazed/pkg/formatters/yaml"
 	"github.com/go-go-golems/glazed/pkg/middlewares"
 	"github.com/go-go-golems/glazed/pkg/middlewares/row"
@@ -28,6 +34,16 @@ const (
 	OutputCSV   OutputFormat = "csv"
 	OutputTSV   OutputFormat = "tsv"
 	OutputYAML  OutputFormat = "yaml"
+	// OutputMarkdown is a GitHub-flavored markdown table.
+	OutputMarkdown OutputFormat = "markdown"
+	// OutputHTML is a standalone HTML page.
+	OutputHTML OutputFormat = "html"
+	// OutputXLSX is an Excel workbook, written to --output-file.
+	OutputXLSX OutputFormat = "xlsx"
+	// OutputSQLite is a table of a SQLite database, written to --output-file.
+	OutputSQLite OutputFormat = "sqlite"
+	// OutputParquet is a Parquet file, written to --output-file.
+	OutputParquet OutputFormat = "parquet"
 )
 
 const (
@@ -35,13 +51,34 @@ const (
 	StructuredOutputFlag = "format"
 )
 
-var structuredOutputFormats = []string{
+// streamOutputFormats are the formats written to the output stream, offered by
+// every structured output section.
+var streamOutputFormats = []string{
 	string(OutputTable),
 	string(OutputJSON),
 	string(OutputJSONL),
 	string(OutputCSV),
 	string(OutputTSV),
 	string(OutputYAML),
+	string(OutputMarkdown),
+	string(OutputHTML),
+}
+
+// fileOutputFormatList are the binary formats, written to the --output-file of
+// the glazed processing section rather than to the output stream. They are
+// only offered with WithFileOutputFormats.
+var fileOutputFormatList = []string{
+	string(OutputXLSX),
+	string(OutputSQLite),
+	string(OutputParquet),
+}
+
+var structuredOutputFormats = append(append([]string(nil), streamOutputFormats...), fileOutputFormatList...)
+
+var fileOutputFormats = map[OutputFormat]bool{
+	OutputXLSX:    true,
+	OutputSQLite:  true,
+	OutputParquet: true,
 }
 
 // StructuredOutputFormats returns the supported structured-output format
@@ -51,6 +88,24 @@ func StructuredOutputFormats() []string {
 	return append([]string(nil), structuredOutputFormats...)
 }
 
+// WithFileOutputFormats adds the xlsx, sqlite and parquet formats to the
+// --format choices. Pass it only when the glazed processing section, which
+// provides --output-file and the options of these formats, is mounted too.
+func WithFileOutputFormats() schema.SectionOption {
+	return func(p *schema.SectionImpl) error {
+		definition, ok := p.Definitions.Get(StructuredOutputFlag)
+		if !ok {
+			return errors.Errorf("structured output section has no %s field", StructuredOutputFlag)
+		}
+		for _, format := range fileOutputFormatList {
+			if !slices.Contains(definition.Choices, format) {
+				definition.Choices = append(definition.Choices, format)
+			}
+		}
+		return nil
+	}
+}
+
 type StructuredOutputSettings struct {
 	Format        OutputFormat `glazed:"format"`
 	OutputFields  []string     `glazed:"output-fields"`
@@ -65,7 +120,7 @@ func NewStructuredOutputSection(options ...schema.SectionOption) (*schema.Sectio
 				StructuredOutputFlag,
 				fields.TypeChoice,
 				fields.WithHelp("Structured output format"),
-				fields.WithChoices(structuredOutputFormats...),
+				fields.WithChoices(streamOutputFormats...),
 				fields.WithDefault(string(OutputTable)),
 			),
 			fields.New(
@@ -115,6 +170,10 @@ func DecodeStructuredOutputSettings(sectionValues *values.SectionValues) (*Struc
 // SetupStructuredProcessor creates the row-processing portion of structured
 // output without attaching a formatter. This is useful for programmatic callers
 // that want projected/capped rows as a Table instead of serialized bytes.
+//
+// Only the structured output section is decoded: the stages of the glazed
+// processing section are not wired in. Use SetupStructuredProcessorFromValues
+// for commands mounting that section.
 func SetupStructuredProcessor(
 	sectionValues *values.SectionValues,
 	options ...middlewares.TableProcessorOption,
@@ -124,8 +183,61 @@ func SetupStructuredProcessor(
 		return nil, nil, err
 	}
 
+	processor, err := setupStructuredProcessor(settings, nil, options...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return processor, settings, nil
+}
+
+// SetupStructuredProcessorFromValues is SetupStructuredProcessor for callers
+// holding all parsed values of a command. If the command mounted the glazed
+// processing section (see NewGlazedProcessingSection), its stages are wired in
+// front of the structured output projection and row cap.
+func SetupStructuredProcessorFromValues(
+	parsedValues *values.Values,
+	options ...middlewares.TableProcessorOption,
+) (*middlewares.TableProcessor, *StructuredOutputSettings, error) {
+	settings, processing, err := decodeStructuredValues(parsedValues)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	processor, err := setupStructuredProcessor(settings, processing, options...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return processor, settings, nil
+}
+
+// setupStructuredProcessor assembles the processor in a fixed order:
+//
+//  1. caller-provided middlewares (options)
+//  2. glazed processing row stages (see GlazedProcessingSettings.addRowMiddlewares)
+//  3. --output-fields projection
+//  4. glazed processing table stages (--group-by/--agg, --sort-by)
+//  5. --max-output-rows, applied to the table when a table stage reorders rows
+//
+// --sort-by combined with --max-output-rows is done by a row stage keeping only
+// the top rows, so that the full table never has to be materialized.
+//
+// When table stages are configured, the projection runs on the processed table
+// instead, so that sorting can use columns that are not output and
+// --output-fields can select aggregate columns.
+func setupStructuredProcessor(
+	settings *StructuredOutputSettings,
+	processing *GlazedProcessingSettings,
+	options ...middlewares.TableProcessorOption,
+) (*middlewares.TableProcessor, error) {
 	processor := middlewares.NewTableProcessor(options...)
-	if len(settings.OutputFields) > 0 {
+	if processing != nil {
+		if err := processing.addRowMiddlewares(processor, settings.MaxOutputRows); err != nil {
+			processing.closeLuaScript()
+			return nil, err
+		}
+	}
+	requiresTable := processing.requiresTable(settings.MaxOutputRows)
+	if len(settings.OutputFields) > 0 && !requiresTable {
 		preferredColumns := make([]types.FieldName, 0, len(settings.OutputFields))
 		for _, field := range settings.OutputFields {
 			preferredColumns = append(preferredColumns, types.FieldName(field))
@@ -133,12 +245,31 @@ func SetupStructuredProcessor(
 		processor.SetPreferredColumnOrder(preferredColumns...)
 		processor.AddRowMiddleware(row.NewOutputFieldsMiddleware(settings.OutputFields...))
 	}
-	if settings.MaxOutputRows > 0 {
-		processor.AddRowMiddleware(&row.SkipLimitMiddleware{Limit: settings.MaxOutputRows})
+	if processing != nil {
+		if err := processing.addTableMiddlewares(processor, settings.MaxOutputRows); err != nil {
+			processing.closeLuaScript()
+			return nil, err
+		}
 	}
-	return processor, settings, nil
+	if len(settings.OutputFields) > 0 && requiresTable {
+		processor.AddTableMiddleware(table.NewOutputFieldsMiddleware(settings.OutputFields...))
+	}
+	if settings.MaxOutputRows > 0 && processing.topN(settings.MaxOutputRows) == 0 {
+		if requiresTable {
+			processor.AddTableMiddleware(table.NewSkipLimitMiddleware(0, settings.MaxOutputRows))
+		} else {
+			processor.AddRowMiddleware(&row.SkipLimitMiddleware{Limit: settings.MaxOutputRows})
+		}
+	}
+	processing.addUnflattenMiddleware(processor, requiresTable)
+	return processor, nil
 }
 
+// SetupStructuredOutput creates the processor of SetupStructuredProcessor and
+// attaches the formatter selected by --format, writing to writer.
+//
+// Like SetupStructuredProcessor, it ignores the glazed processing section. Use
+// SetupStructuredOutputFromValues for commands mounting that section.
 func SetupStructuredOutput(
 	sectionValues *values.SectionValues,
 	writer io.Writer,
@@ -149,28 +280,121 @@ func SetupStructuredOutput(
 		return nil, nil, err
 	}
 
-	formatter, rowOutput, err := newStructuredOutputFormatter(settings.Format)
+	formatter, err := attachStructuredOutputFormatter(processor, settings, nil, nil, writer)
 	if err != nil {
 		return nil, nil, err
 	}
-	if rowOutput {
+	return processor, formatter, nil
+}
+
+// SetupStructuredOutputFromValues is SetupStructuredOutput for callers holding
+// all parsed values of a command, honoring the glazed processing section when
+// it is present.
+func SetupStructuredOutputFromValues(
+	parsedValues *values.Values,
+	writer io.Writer,
+	options ...middlewares.TableProcessorOption,
+) (*middlewares.TableProcessor, formatters.OutputFormatter, error) {
+	return SetupStructuredOutputForCommand(nil, parsedValues, writer, options...)
+}
+
+// SetupStructuredOutputForCommand is SetupStructuredOutputFromValues for the
+// command described by description, which titles the formats producing
+// documents, such as html. description may be nil.
+func SetupStructuredOutputForCommand(
+	description *cmds.CommandDescription,
+	parsedValues *values.Values,
+	writer io.Writer,
+	options ...middlewares.TableProcessorOption,
+) (*middlewares.TableProcessor, formatters.OutputFormatter, error) {
+	settings, processing, err := decodeStructuredValues(parsedValues)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	processor, err := setupStructuredProcessor(settings, processing, options...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	formatter, err := attachStructuredOutputFormatter(processor, settings, processing, description, writer)
+	if err != nil {
+		return nil, nil, err
+	}
+	return processor, formatter, nil
+}
+
+func decodeStructuredValues(parsedValues *values.Values) (*StructuredOutputSettings, *GlazedProcessingSettings, error) {
+	structuredOutputValues, ok := parsedValues.Get(StructuredOutputSlug)
+	if !ok {
+		return nil, nil, errors.Errorf("section %s not found", StructuredOutputSlug)
+	}
+	settings, err := DecodeStructuredOutputSettings(structuredOutputValues)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	processingValues, ok := parsedValues.Get(GlazedProcessingSlug)
+	if !ok {
+		return settings, nil, nil
+	}
+	processing, err := DecodeGlazedProcessingSettings(processingValues)
+	if err != nil {
+		return nil, nil, err
+	}
+	return settings, processing, nil
+}
+
+func attachStructuredOutputFormatter(
+	processor *middlewares.TableProcessor,
+	settings *StructuredOutputSettings,
+	processing *GlazedProcessingSettings,
+	description *cmds.CommandDescription,
+	writer io.Writer,
+) (formatters.OutputFormatter, error) {
+	formatter, rowOutput, err := newStructuredOutputFormatter(settings.Format, processing, description)
+	if err != nil {
+		return nil, err
+	}
+	// Streaming formats can only emit rows directly when no table stage has
+	// to see the full table first.
+	if rowOutput && !processing.requiresTable(settings.MaxOutputRows) {
 		rowFormatter := formatter.(formatters.RowOutputFormatter)
 		if err := rowFormatter.RegisterRowMiddlewares(processor); err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 		processor.AddRowMiddleware(row.NewOutputMiddleware(rowFormatter, writer))
 	} else {
-		tableFormatter := formatter.(formatters.TableOutputFormatter)
+		tableFormatter, ok := formatter.(formatters.TableOutputFormatter)
+		if !ok {
+			return nil, errors.Errorf("structured output format %q does not support table output", settings.Format)
+		}
 		if err := tableFormatter.RegisterTableMiddlewares(processor); err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 		processor.AddTableMiddleware(table.NewOutputMiddleware(tableFormatter, writer))
 	}
 
-	return processor, formatter, nil
+	return formatter, nil
 }
 
-func newStructuredOutputFormatter(format OutputFormat) (formatters.OutputFormatter, bool, error) {
+func newStructuredOutputFormatter(
+	format OutputFormat,
+	processing *GlazedProcessingSettings,
+	description *cmds.CommandDescription,
+) (formatters.OutputFormatter, bool, error) {
+	outputFile := processing.outputFile()
+	switch {
+	case fileOutputFormats[format] && outputFile == "":
+		return nil, false, errors.Errorf("structured output format %q requires --output-file", format)
+	case !fileOutputFormats[format] && outputFile != "":
+		return nil, false, errors.Errorf("structured output format %q is written to stdout and doesn't support --output-file", format)
+	case format != OutputXLSX && processing != nil && processing.XLSXSheetColumn != "":
+		return nil, false, errors.New("--xlsx-sheet-column requires the xlsx format")
+	case format != OutputSQLite && processing != nil && len(processing.SQLiteIndex) > 0:
+		return nil, false, errors.New("--sqlite-index requires the sqlite format")
+	}
+
 	switch format {
 	case OutputTable:
 		return tableformatter.NewOutputFormatter("ascii"), false, nil
@@ -184,6 +408,45 @@ func newStructuredOutputFormatter(format OutputFormat) (formatters.OutputFormatt
 		return csv.NewTSVOutputFormatter(), false, nil
 	case OutputYAML:
 		return yamlformatter.NewOutputFormatter(), false, nil
+	case OutputMarkdown:
+		return tableformatter.NewOutputFormatter("markdown"), false, nil
+	case OutputHTML:
+		options := []htmlformatter.OutputFormatterOption{}
+		if description != nil {
+			title := description.Short
+			if title == "" {
+				title = description.Name
+			}
+			options = append(options,
+				htmlformatter.WithTitle(title),
+				htmlformatter.WithDescription(description.Long),
+			)
+		}
+		return htmlformatter.NewOutputFormatter(options...), false, nil
+	case OutputXLSX:
+		return xlsxformatter.NewOutputFormatter(
+			xlsxformatter.WithOutputFile(outputFile),
+			xlsxformatter.WithSheetColumn(processing.XLSXSheetColumn),
+		), false, nil
+	case OutputSQLite:
+		indexes := make([]types.FieldName, len(processing.SQLiteIndex))
+		copy(indexes, processing.SQLiteIndex)
+		return sqliteformatter.NewOutputFormatter(
+			sqliteformatter.WithOutputFile(outputFile),
+			sqliteformatter.WithTableName(processing.SQLiteTable),
+			sqliteformatter.WithIndexes(indexes...),
+			sqliteformatter.WithBatchSize(processing.SQLiteBatchSize),
+		), false, nil
+	case OutputParquet:
+		compression, err := parquetformatter.ParseCompression(processing.ParquetCompress)
+		if err != nil {
+			return nil, false, err
+		}
+		return parquetformatter.NewOutputFormatter(
+			parquetformatter.WithOutputFile(outputFile),
+			parquetformatter.WithRowGroupSize(processing.ParquetGroupSize),
+			parquetformatter.WithCompression(compression),
+		), false, nil
 	default:
 		return nil, false, errors.Errorf("unsupported structured output format %q", format)
 	}
@@ -1,22 +1,32 @@
 package settings
 
 import (
+	"archive/zip"
 	"bytes"
 	"context"
+	"database/sql"
+	"path/filepath"
 	"testing"
 
+	"github.com/go-go-golems/glazed/pkg/cmds"
 	"github.com/go-go-golems/glazed/pkg/cmds/fields"
 	"github.com/go-go-golems/glazed/pkg/cmds/schema"
 	"github.com/go-go-golems/glazed/pkg/cmds/sources"
 	"github.com/go-go-golems/glazed/pkg/cmds/values"
 	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/parquet-go/parquet-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func parseStructuredOutputSettings(t *testing.T, args ...string) *values.SectionValues {
 	t.Helper()
-	section, err := NewStructuredOutputSection()
+	return parseStructuredOutputSection(t, nil, args...)
+}
+
+func parseStructuredOutputSection(t *testing.T, options []schema.SectionOption, args ...string) *values.SectionValues {
+	t.Helper()
+	section, err := NewStructuredOutputSection(options...)
 	require.NoError(t, err)
 
 	schema_ := schema.NewSchema(schema.WithSections(section))
@@ -127,8 +137,130 @@ func TestStructuredOutputCSVPreservesProjectionOrderAcrossSparseRows(t *testing.
 	assert.Equal(t, "a,b\n1,\n,2\n", buf.String())
 }
 
+func TestStructuredOutputMarkdownTable(t *testing.T) {
+	sectionValues := parseStructuredOutputSettings(t, "--format", "markdown")
+	buf := &bytes.Buffer{}
+	processor, outputFormatter, err := SetupStructuredOutput(sectionValues, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "text/markdown", outputFormatter.ContentType())
+
+	ctx := context.Background()
+	require.NoError(t, processor.AddRow(ctx, types.NewRow(
+		types.MRP("id", 1),
+		types.MRP("name", "Ada"),
+	)))
+	require.NoError(t, processor.Close(ctx))
+	assert.Equal(t, "| id | name |\n| ---:| --- |\n| 1 | Ada |\n", buf.String())
+}
+
+func TestStructuredOutputHTMLUsesCommandDescription(t *testing.T) {
+	parsedValues := values.New()
+	parsedValues.Set(StructuredOutputSlug, parseStructuredOutputSettings(t, "--format", "html"))
+	description := cmds.NewCommandDescription(
+		"jobs",
+		cmds.WithShort("List jobs"),
+		cmds.WithLong("Lists the jobs of the last day."),
+	)
+
+	buf := &bytes.Buffer{}
+	processor, outputFormatter, err := SetupStructuredOutputForCommand(description, parsedValues, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "text/html", outputFormatter.ContentType())
+
+	ctx := context.Background()
+	require.NoError(t, processor.AddRow(ctx, types.NewRow(types.MRP("id", 1))))
+	require.NoError(t, processor.Close(ctx))
+	assert.Contains(t, buf.String(), "<title>List jobs</title>")
+	assert.Contains(t, buf.String(), "Lists the jobs of the last day.")
+	assert.Contains(t, buf.String(), `<td class="num" data-sort="1">1</td>`)
+}
+
+func TestStructuredOutputXLSXWritesOutputFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.xlsx")
+	parsedValues := parseStructuredAndProcessingValues(
+		t,
+		[]string{"--format", "xlsx"},
+		"--output-file", path,
+	)
+	out := runStructuredOutputFromValues(t, parsedValues, types.NewRow(types.MRP("id", 1)))
+	assert.Equal(t, "Wrote output to "+path+"\n", out)
+
+	r, err := zip.OpenReader(path)
+	require.NoError(t, err)
+	defer func() {
+		_ = r.Close()
+	}()
+	assert.NotEmpty(t, r.File)
+}
+
+func TestStructuredOutputSQLiteWritesOutputFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.db")
+	parsedValues := parseStructuredAndProcessingValues(
+		t,
+		[]string{"--format", "sqlite"},
+		"--output-file", path,
+		"--sqlite-table", "people",
+		"--sqlite-index", "id",
+	)
+	out := runStructuredOutputFromValues(t, parsedValues,
+		types.NewRow(types.MRP("id", 1), types.MRP("name", "Ada")),
+		types.NewRow(types.MRP("id", 2), types.MRP("name", "Grace")),
+	)
+	assert.Equal(t, "Wrote 2 rows to table people of "+path+"\n", out)
+
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	defer func() {
+		_ = db.Close()
+	}()
+	var count int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM people").Scan(&count))
+	assert.Equal(t, 2, count)
+}
+
+func TestStructuredOutputParquetWritesOutputFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.parquet")
+	parsedValues := parseStructuredAndProcessingValues(
+		t,
+		[]string{"--format", "parquet"},
+		"--output-file", path,
+		"--parquet-compression", "zstd",
+	)
+	out := runStructuredOutputFromValues(t, parsedValues, types.NewRow(types.MRP("id", 1)))
+	assert.Equal(t, "Wrote output to "+path+"\n", out)
+
+	rows, err := parquet.ReadFile[struct {
+		ID int64 `parquet:"id"`
+	}](path)
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, int64(1), rows[0].ID)
+}
+
+func TestStructuredOutputFileFormatsValidateOutputFile(t *testing.T) {
+	for _, args := range [][][]string{
+		{{"--format", "xlsx"}, {}},
+		{{"--format", "csv"}, {"--output-file", "out.csv"}},
+		{{"--format", "csv"}, {"--xlsx-sheet-column", "region"}},
+		{{"--format", "sqlite"}, {}},
+		{{"--format", "xlsx"}, {"--output-file", "out.xlsx", "--sqlite-index", "id"}},
+		{{"--format", "sqlite"}, {"--output-file", "out.db", "--sqlite-batch-size", "0"}},
+		{{"--format", "parquet"}, {"--output-file", "out.parquet", "--parquet-row-group-size", "0"}},
+	} {
+		parsedValues := parseStructuredAndProcessingValues(t, args[0], args[1]...)
+		_, _, err := SetupStructuredOutputFromValues(parsedValues, &bytes.Buffer{})
+		assert.Error(t, err, "%v", args)
+	}
+}
+
 func TestEveryStructuredOutputFormatProducesOutput(t *testing.T) {
-	for _, format := range structuredOutputFormats {
+	section, err := NewStructuredOutputSection()
+	require.NoError(t, err)
+	definition, ok := section.GetDefinitions().Get(StructuredOutputFlag)
+	require.True(t, ok)
+	require.NotEmpty(t, definition.Choices)
+
+	for _, format := range definition.Choices {
 		t.Run(format, func(t *testing.T) {
 			sectionValues := parseStructuredOutputSettings(t, "--format", format)
 			buf := &bytes.Buffer{}
@@ -146,3 +278,26 @@ func TestEveryStructuredOutputFormatProducesOutput(t *testing.T) {
 		})
 	}
 }
+
+func TestStructuredOutputOffersFileFormatsOnlyWithOption(t *testing.T) {
+	section, err := NewStructuredOutputSection()
+	require.NoError(t, err)
+	definition, ok := section.GetDefinitions().Get(StructuredOutputFlag)
+	require.True(t, ok)
+	for _, format := range []string{"xlsx", "sqlite", "parquet"} {
+		assert.NotContains(t, definition.Choices, format)
+
+		err = sources.Execute(
+			schema.NewSchema(schema.WithSections(section)),
+			values.New(),
+			sources.UpdateFromStringList("", []string{"--format", format}, fields.WithSource("test")),
+		)
+		assert.Error(t, err, format)
+	}
+
+	section, err = NewStructuredOutputSection(WithFileOutputFormats())
+	require.NoError(t, err)
+	definition, ok = section.GetDefinitions().Get(StructuredOutputFlag)
+	require.True(t, ok)
+	assert.ElementsMatch(t, StructuredOutputFormats(), definition.Choices)
+}